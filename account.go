@@ -0,0 +1,231 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/rsksmart/liquidity-provider/providers"
+)
+
+type accountOutput struct {
+	Address  string          `json:"address"`
+	Path     string          `json:"path,omitempty"`
+	File     string          `json:"file,omitempty"`
+	Keystore json.RawMessage `json:"keystore,omitempty"`
+}
+
+type inspectOutput struct {
+	Address       string `json:"address"`
+	File          string `json:"file"`
+	Version       int    `json:"version"`
+	Cipher        string `json:"cipher"`
+	KDF           string `json:"kdf"`
+	PasswordValid *bool  `json:"passwordValid,omitempty"`
+}
+
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	return fs
+}
+
+func openKeystore(keydir string) *keystore.KeyStore {
+	return keystore.NewKeyStore(keydir, keystore.StandardScryptN, keystore.StandardScryptP)
+}
+
+// derivationPath resolves the rsk and ethereum aliases of the BIP-44 paths.
+func derivationPath(path string) string {
+	switch strings.ToLower(path) {
+	case "rsk":
+		return providers.RSKDerivationPath
+	case "eth", "ethereum":
+		return providers.EthereumDerivationPath
+	default:
+		return path
+	}
+}
+
+func accountNew(args []string, stdout io.Writer) error {
+	fs := newFlagSet("account new")
+	keydir := fs.String("keydir", "keystore", "keystore directory")
+	password := addSecretFlags(fs, "password", "password of the new account")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	passwd, err := password.read("password")
+	if err != nil {
+		return err
+	}
+	acc, err := providers.NewAccount(openKeystore(*keydir), passwd)
+	if err != nil {
+		return err
+	}
+	return writeJSON(stdout, accountOutput{Address: acc.Address.Hex(), File: acc.URL.Path})
+}
+
+func accountList(args []string, stdout io.Writer) error {
+	fs := newFlagSet("account list")
+	keydir := fs.String("keydir", "keystore", "keystore directory")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	res := []accountOutput{}
+	for _, acc := range openKeystore(*keydir).Accounts() {
+		res = append(res, accountOutput{Address: acc.Address.Hex(), File: acc.URL.Path})
+	}
+	return writeJSON(stdout, res)
+}
+
+func accountInspect(args []string, stdout io.Writer) error {
+	fs := newFlagSet("account inspect")
+	keydir := fs.String("keydir", "keystore", "keystore directory")
+	address := fs.String("address", "", "RSK address of the account to inspect")
+	password := addSecretFlags(fs, "password", "password to check against the account")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if !common.IsHexAddress(*address) {
+		return fmt.Errorf("%w: %v", providers.ErrInvalidProviderAddress, *address)
+	}
+	ks := openKeystore(*keydir)
+	acc, err := ks.Find(accounts.Account{Address: common.HexToAddress(*address)})
+	if err != nil {
+		return fmt.Errorf("%w: %v", providers.ErrAccountNotFound, *address)
+	}
+	keyJSON, err := ioutil.ReadFile(acc.URL.Path)
+	if err != nil {
+		return err
+	}
+	var key struct {
+		Version int `json:"version"`
+		Crypto  struct {
+			Cipher string `json:"cipher"`
+			KDF    string `json:"kdf"`
+		} `json:"crypto"`
+	}
+	if err = json.Unmarshal(keyJSON, &key); err != nil {
+		return fmt.Errorf("error decoding keystore file %v: %v", acc.URL.Path, err)
+	}
+	out := inspectOutput{
+		Address: acc.Address.Hex(),
+		File:    acc.URL.Path,
+		Version: key.Version,
+		Cipher:  key.Crypto.Cipher,
+		KDF:     key.Crypto.KDF,
+	}
+	if password.isSet() {
+		passwd, err := password.read("password")
+		if err != nil {
+			return err
+		}
+		_, err = keystore.DecryptKey(keyJSON, passwd)
+		if err != nil && err != keystore.ErrDecrypt {
+			return err
+		}
+		valid := err == nil
+		out.PasswordValid = &valid
+	}
+	return writeJSON(stdout, out)
+}
+
+func accountImport(args []string, stdout io.Writer) error {
+	fs := newFlagSet("account import")
+	keydir := fs.String("keydir", "keystore", "keystore directory")
+	path := fs.String("path", "rsk", "BIP-44 derivation path of mnemonic accounts, rsk and ethereum select the first account of each coin type")
+	key := addSecretFlags(fs, "key", "hex encoded private key")
+	mnemonic := addSecretFlags(fs, "mnemonic", "BIP-39 mnemonic")
+	passphrase := addSecretFlags(fs, "passphrase", "optional BIP-39 passphrase")
+	password := addSecretFlags(fs, "password", "password of the imported account")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if key.isSet() == mnemonic.isSet() {
+		return errors.New("exactly one of a private key or a mnemonic is required")
+	}
+
+	out := accountOutput{}
+	ks := openKeystore(*keydir)
+	if key.isSet() {
+		hexKey, err := key.source().Secret()
+		if err != nil {
+			return err
+		}
+		passwd, err := password.read("password")
+		if err != nil {
+			return err
+		}
+		acc, err := providers.ImportPrivateKey(ks, hexKey, passwd)
+		if err != nil {
+			return err
+		}
+		out.Address = acc.Address.Hex()
+	} else {
+		words, err := mnemonic.source().Secret()
+		if err != nil {
+			return err
+		}
+		var pass string
+		if passphrase.isSet() {
+			if pass, err = passphrase.source().Secret(); err != nil {
+				return err
+			}
+		}
+		passwd, err := password.read("password")
+		if err != nil {
+			return err
+		}
+		out.Path = derivationPath(*path)
+		acc, err := providers.ImportMnemonic(ks, words, pass, out.Path, passwd)
+		if err != nil {
+			return err
+		}
+		out.Address = acc.Address.Hex()
+	}
+	return writeJSON(stdout, out)
+}
+
+func accountExport(args []string, stdout io.Writer) error {
+	fs := newFlagSet("account export")
+	keydir := fs.String("keydir", "keystore", "keystore directory")
+	address := fs.String("address", "", "RSK address of the account to export")
+	file := fs.String("out", "", "file the keystore JSON is written to, it is included in the output when empty")
+	password := addSecretFlags(fs, "password", "password of the account")
+	newPassword := addSecretFlags(fs, "new-password", "password the exported key is encrypted with")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *address == "" {
+		return errors.New("-address is required")
+	}
+	passwd, err := password.read("password")
+	if err != nil {
+		return err
+	}
+	newPasswd, err := newPassword.read("new password")
+	if err != nil {
+		return err
+	}
+	keyJSON, err := providers.ExportAccount(openKeystore(*keydir), *address, passwd, newPasswd)
+	if err != nil {
+		return err
+	}
+
+	out := accountOutput{Address: *address}
+	if *file == "" {
+		out.Keystore = keyJSON
+	} else {
+		if err = ioutil.WriteFile(*file, keyJSON, 0600); err != nil {
+			return err
+		}
+		out.File = *file
+	}
+	return writeJSON(stdout, out)
+}
@@ -0,0 +1,36 @@
+// Command openapi writes the OpenAPI document of the liquidity provider HTTP API, which is generated from the Go
+// types exchanged by the API.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"os"
+
+	"github.com/rsksmart/liquidity-provider/server"
+	log "github.com/sirupsen/logrus"
+)
+
+func main() {
+	out := flag.String("out", "", "file the document is written to, stdout when empty")
+	flag.Parse()
+
+	doc, err := server.Spec()
+	if err != nil {
+		log.Fatal("error generating OpenAPI document: ", err)
+	}
+	b, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		log.Fatal(err)
+	}
+	b = append(b, '\n')
+	if *out == "" {
+		_, err = os.Stdout.Write(b)
+	} else {
+		err = ioutil.WriteFile(*out, b, 0644)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,84 @@
+// Command stubsigner serves the keys of a keystore through the Clef external API, signing every request without
+// approval. It lets the liquidity provider be run against an external signer in tests and local development.
+package main
+
+import (
+	"crypto/ecdsa"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/rsksmart/liquidity-provider/stubsigner"
+	log "github.com/sirupsen/logrus"
+)
+
+func main() {
+	keydir := flag.String("keydir", "keystore", "directory of the keystore files to serve")
+	pwdFile := flag.String("pwdfile", "", "file containing the password of the keystore files")
+	httpAddr := flag.String("http", "", "address to serve the signer API over HTTP, e.g. 127.0.0.1:8550")
+	ipcPath := flag.String("ipc", "", "path of the IPC socket to serve the signer API")
+	flag.Parse()
+
+	if (*httpAddr == "") == (*ipcPath == "") {
+		log.Fatal("exactly one of -http or -ipc is required")
+	}
+	if *pwdFile == "" {
+		log.Fatal("-pwdfile is required")
+	}
+	pwd, err := ioutil.ReadFile(*pwdFile)
+	if err != nil {
+		log.Fatal("error reading password file: ", err)
+	}
+	keys, err := loadKeys(*keydir, strings.TrimRight(string(pwd), "\r\n"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	server, err := stubsigner.NewServer(keys...)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *httpAddr != "" {
+		log.Info("serving signer API on http://", *httpAddr)
+		log.Fatal(http.ListenAndServe(*httpAddr, server))
+	}
+	l, err := net.Listen("unix", *ipcPath)
+	if err != nil {
+		log.Fatal("error listening on IPC socket: ", err)
+	}
+	log.Info("serving signer API on ", *ipcPath)
+	log.Fatal(server.ServeListener(l))
+}
+
+func loadKeys(keydir string, pwd string) ([]*ecdsa.PrivateKey, error) {
+	files, err := ioutil.ReadDir(keydir)
+	if err != nil {
+		return nil, err
+	}
+	var keys []*ecdsa.PrivateKey
+	for _, f := range files {
+		if f.IsDir() || strings.HasPrefix(f.Name(), ".") {
+			continue
+		}
+		keyJSON, err := ioutil.ReadFile(filepath.Join(keydir, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+		key, err := keystore.DecryptKey(keyJSON, pwd)
+		if err != nil {
+			log.Warn("skipping keystore file ", f.Name(), ": ", err)
+			continue
+		}
+		log.Info("serving account ", key.Address.Hex())
+		keys = append(keys, key.PrivateKey)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no keys could be decrypted in %v", keydir)
+	}
+	return keys, nil
+}
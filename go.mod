@@ -4,8 +4,10 @@ go 1.16
 
 require (
 	github.com/ethereum/go-ethereum v1.10.8
+	github.com/mattn/go-sqlite3 v1.14.16
 	github.com/sirupsen/logrus v1.8.1
 	github.com/stretchr/testify v1.7.0
+	github.com/tyler-smith/go-bip39 v1.0.1-0.20181017060643-dbb3b84ba2ef
 	github.com/wagslane/go-password-validator v0.3.0
 	golang.org/x/term v0.0.0-20210615171337-6886f2dfbf5b
 )
@@ -1,5 +1,79 @@
+// Command lp operates a liquidity provider from the command line. Every subcommand writes its result to stdout as
+// JSON, errors are written to stderr as a JSON object with an "error" field.
 package main
 
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+type subcommand func(args []string, stdout io.Writer) error
+
+var commands = map[string]map[string]subcommand{
+	"account": {
+		"new":     accountNew,
+		"list":    accountList,
+		"import":  accountImport,
+		"export":  accountExport,
+		"inspect": accountInspect,
+	},
+	"quote": {
+		"price":  quotePrice,
+		"sign":   quoteSign,
+		"verify": quoteVerify,
+	},
+	"retained": {
+		"list": retainedList,
+		"show": retainedShow,
+	},
+}
+
+var errUsage = errors.New("usage: lp <command> <subcommand> [flags]")
+
+type errorOutput struct {
+	Error string `json:"error"`
+}
+
 func main() {
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		_ = writeJSON(os.Stderr, errorOutput{Error: err.Error()})
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdout io.Writer) error {
+	if len(args) < 2 {
+		return fmt.Errorf("%w, commands: %v", errUsage, usage())
+	}
+	subcommands, ok := commands[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown command %v, commands: %v", args[0], usage())
+	}
+	cmd, ok := subcommands[args[1]]
+	if !ok {
+		return fmt.Errorf("unknown subcommand %v %v, commands: %v", args[0], args[1], usage())
+	}
+	return cmd(args[2:], stdout)
+}
+
+func usage() string {
+	var res []string
+	for name, subcommands := range commands {
+		for sub := range subcommands {
+			res = append(res, name+" "+sub)
+		}
+	}
+	sort.Strings(res)
+	return strings.Join(res, ", ")
+}
 
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
 }
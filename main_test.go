@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/rsksmart/liquidity-provider/providers"
+	"github.com/rsksmart/liquidity-provider/repository/inmem"
+	"github.com/rsksmart/liquidity-provider/types"
+	"github.com/stretchr/testify/assert"
+)
+
+const testPasswd = "correct horse battery staple"
+
+// setTestEnv sets the environment variable name until the test finishes, restoring its previous value afterwards.
+func setTestEnv(t *testing.T, name, value string) {
+	t.Helper()
+	prev, set := os.LookupEnv(name)
+	if err := os.Setenv(name, value); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if set {
+			_ = os.Setenv(name, prev)
+		} else {
+			_ = os.Unsetenv(name)
+		}
+	})
+}
+
+func TestAccountImportExport(t *testing.T) {
+	keydir := t.TempDir()
+	setTestEnv(t, "LP_TEST_KEY", "0x4c0883a69102937d6231471b5dbb6204fe5129617082792ae468d01a3f362318")
+	setTestEnv(t, "LP_TEST_PASSWD", testPasswd)
+
+	var out bytes.Buffer
+	err := run([]string{"account", "import", "-keydir", keydir, "-key-env", "LP_TEST_KEY", "-password-env", "LP_TEST_PASSWD"}, &out)
+	if !assert.NoError(t, err) {
+		return
+	}
+	var imported accountOutput
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &imported))
+	assert.Equal(t, "0x2c7536E3605D9C16a7a3D7b1898e529396a65c23", imported.Address)
+	_, set := os.LookupEnv("LP_TEST_KEY")
+	assert.False(t, set)
+
+	setTestEnv(t, "LP_TEST_PASSWD", testPasswd)
+	setTestEnv(t, "LP_TEST_NEW_PASSWD", testPasswd+" again")
+	out.Reset()
+	err = run([]string{"account", "export", "-keydir", keydir, "-address", imported.Address,
+		"-password-env", "LP_TEST_PASSWD", "-new-password-env", "LP_TEST_NEW_PASSWD"}, &out)
+	if !assert.NoError(t, err) {
+		return
+	}
+	var exported accountOutput
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &exported))
+	key, err := keystore.DecryptKey(exported.Keystore, testPasswd+" again")
+	if assert.NoError(t, err) {
+		assert.Equal(t, imported.Address, key.Address.Hex())
+	}
+}
+
+func TestAccountImportRequiresOneKey(t *testing.T) {
+	err := run([]string{"account", "import", "-keydir", t.TempDir()}, &bytes.Buffer{})
+	assert.Error(t, err)
+}
+
+func TestRunUnknownCommand(t *testing.T) {
+	assert.ErrorIs(t, run(nil, &bytes.Buffer{}), errUsage)
+	assert.Error(t, run([]string{"account", "nope"}, &bytes.Buffer{}))
+}
+
+const testLPAddr = "0xd562c283d2260c62110fa3da885842afbe16bda2"
+
+func writeTestFile(t *testing.T, name string, v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), name)
+	if err = ioutil.WriteFile(path, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestQuotePriceSignVerify(t *testing.T) {
+	config := writeTestFile(t, "config.json", map[string]interface{}{
+		"keydir":      "./providers/testdata/keystore/keystore",
+		"btcAddr":     "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2",
+		"maxConf":     60,
+		"callFee":     1000,
+		"penaltyFee":  1000000,
+		"callTime":    7200,
+		"chainId":     31,
+		"passwordEnv": "LP_TEST_PASSWD",
+	})
+	quote := writeTestFile(t, "quote.json", types.Quote{
+		FedBTCAddr:    "3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy",
+		LBCAddr:       "0x0000000000000000000000000000000000000001",
+		BTCRefundAddr: "mipcBbFg9gMiCh81Kj8tqqdgoZub1ZJRfn",
+		RSKRefundAddr: "0x0000000000000000000000000000000000000002",
+		ContractAddr:  "0x0000000000000000000000000000000000000003",
+		Value:         types.NewWei(3000000),
+	})
+
+	setTestEnv(t, "LP_TEST_PASSWD", testPasswd)
+	var out bytes.Buffer
+	err := run([]string{"quote", "price", "-config", config, "-quote", quote, "-gas", "100", "-gas-price", "2"}, &out)
+	if !assert.NoError(t, err) {
+		return
+	}
+	var priced quoteOutput
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &priced))
+	assert.Equal(t, types.NewWei(1200), priced.Quote.CallFee)
+	assert.Equal(t, common.HexToAddress(testLPAddr).Hex(), priced.Quote.LPRSKAddr)
+
+	// the gas is not priced at zero when neither a gas price nor an oracle is given
+	setTestEnv(t, "LP_TEST_PASSWD", testPasswd)
+	err = run([]string{"quote", "price", "-config", config, "-quote", quote, "-gas", "100"}, &bytes.Buffer{})
+	assert.ErrorIs(t, err, providers.ErrGasPriceRequired)
+	signed := writeTestFile(t, "signed.json", priced.Quote)
+
+	setTestEnv(t, "LP_TEST_PASSWD", testPasswd)
+	out.Reset()
+	if !assert.NoError(t, run([]string{"quote", "sign", "-config", config, "-quote", signed}, &out)) {
+		return
+	}
+	var sig signatureOutput
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &sig))
+	assert.Equal(t, priced.Hash, sig.Hash)
+	assert.Equal(t, providers.SignatureSchemePersonalSign, sig.Scheme)
+
+	out.Reset()
+	if !assert.NoError(t, run([]string{"quote", "verify", "-quote", signed, "-signature", sig.Signature, "-chain-id", "31"}, &out)) {
+		return
+	}
+	var verified signatureOutput
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &verified))
+	assert.Equal(t, sig, verified)
+
+	err = run([]string{"quote", "verify", "-quote", quote, "-signature", sig.Signature}, &bytes.Buffer{})
+	assert.Error(t, err)
+}
+
+// TestQuotePriceWithoutKeys checks that pricing a quote neither unlocks nor creates keys.
+func TestQuotePriceWithoutKeys(t *testing.T) {
+	keydir := t.TempDir()
+	cfg := map[string]interface{}{
+		"keydir":     keydir,
+		"btcAddr":    "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2",
+		"maxConf":    60,
+		"callFee":    1000,
+		"penaltyFee": 1000000,
+		"callTime":   7200,
+	}
+	quote := writeTestFile(t, "quote.json", types.Quote{
+		FedBTCAddr:    "3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy",
+		LBCAddr:       "0x0000000000000000000000000000000000000001",
+		BTCRefundAddr: "mipcBbFg9gMiCh81Kj8tqqdgoZub1ZJRfn",
+		RSKRefundAddr: "0x0000000000000000000000000000000000000002",
+		ContractAddr:  "0x0000000000000000000000000000000000000003",
+		Value:         types.NewWei(3000000),
+	})
+	args := []string{"quote", "price", "-config", writeTestFile(t, "config.json", cfg), "-quote", quote, "-gas-price", "2"}
+	var out bytes.Buffer
+	assert.ErrorIs(t, run(args, &out), providers.ErrAccountNotFound)
+	files, err := ioutil.ReadDir(keydir)
+	if assert.NoError(t, err) {
+		assert.Empty(t, files)
+	}
+
+	// the keystore is not read when the account address is configured
+	cfg["accountAddr"] = testLPAddr
+	args[3] = writeTestFile(t, "config.json", cfg)
+	if !assert.NoError(t, run(args, &out)) {
+		return
+	}
+	var priced quoteOutput
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &priced))
+	assert.Equal(t, common.HexToAddress(testLPAddr).Hex(), priced.Quote.LPRSKAddr)
+}
+
+func TestRetainedListShow(t *testing.T) {
+	r := inmem.NewRepository()
+	assert.NoError(t, r.SetLiquidity(types.NewWei(100)))
+	rq := &types.RetainedQuote{
+		QuoteHash:   "abcd",
+		DepositAddr: "2N3JQb9erL1SnAr3NTMrZiPQQ8dcjJp4idV",
+		Signature:   "1234",
+		ReqLiq:      types.NewWei(10),
+		State:       types.RQStateWaitingForDeposit,
+	}
+	assert.NoError(t, r.ReserveLiquidity(rq))
+	snapshot := filepath.Join(t.TempDir(), "lp.json")
+	assert.NoError(t, r.SaveFile(snapshot))
+
+	var out bytes.Buffer
+	if !assert.NoError(t, run([]string{"retained", "list", "-repo", "snapshot:" + snapshot}, &out)) {
+		return
+	}
+	var rqs []*types.RetainedQuote
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &rqs))
+	assert.Equal(t, []*types.RetainedQuote{rq}, rqs)
+
+	out.Reset()
+	assert.NoError(t, run([]string{"retained", "list", "-repo", "snapshot:" + snapshot, "-state", "CallForUserSucceeded"}, &out))
+	assert.JSONEq(t, "[]", out.String())
+
+	out.Reset()
+	if !assert.NoError(t, run([]string{"retained", "show", "-repo", "snapshot:" + snapshot, "-hash", "abcd"}, &out)) {
+		return
+	}
+	var shown types.RetainedQuote
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &shown))
+	assert.Equal(t, *rq, shown)
+
+	err := run([]string{"retained", "show", "-repo", "snapshot:" + snapshot, "-hash", "ef"}, &bytes.Buffer{})
+	assert.ErrorIs(t, err, providers.ErrRetainedQuoteNotFound)
+	err = run([]string{"retained", "list", "-repo", "mysql:lp"}, &bytes.Buffer{})
+	assert.Error(t, err)
+}
+
+func TestAccountNewListInspect(t *testing.T) {
+	keydir := t.TempDir()
+	setTestEnv(t, "LP_TEST_PASSWD", "weak")
+	err := run([]string{"account", "new", "-keydir", keydir, "-password-env", "LP_TEST_PASSWD"}, &bytes.Buffer{})
+	assert.Error(t, err)
+
+	setTestEnv(t, "LP_TEST_PASSWD", testPasswd)
+	var out bytes.Buffer
+	if !assert.NoError(t, run([]string{"account", "new", "-keydir", keydir, "-password-env", "LP_TEST_PASSWD"}, &out)) {
+		return
+	}
+	var created accountOutput
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &created))
+
+	out.Reset()
+	assert.NoError(t, run([]string{"account", "list", "-keydir", keydir}, &out))
+	var listed []accountOutput
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &listed))
+	assert.Equal(t, []accountOutput{created}, listed)
+
+	setTestEnv(t, "LP_TEST_PASSWD", "not the password")
+	out.Reset()
+	err = run([]string{"account", "inspect", "-keydir", keydir, "-address", created.Address, "-password-env", "LP_TEST_PASSWD"}, &out)
+	if !assert.NoError(t, err) {
+		return
+	}
+	var inspected inspectOutput
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &inspected))
+	assert.Equal(t, created.Address, inspected.Address)
+	assert.Equal(t, 3, inspected.Version)
+	assert.Equal(t, "scrypt", inspected.KDF)
+	if assert.NotNil(t, inspected.PasswordValid) {
+		assert.False(t, *inspected.PasswordValid)
+	}
+}
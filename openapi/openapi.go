@@ -0,0 +1,342 @@
+// Package openapi generates OpenAPI 3 documents from Go types, reading the json, example and description struct tags
+// of their fields.
+package openapi
+
+import (
+	"encoding"
+	"fmt"
+	"math/big"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/rsksmart/liquidity-provider/types"
+)
+
+// Version is the OpenAPI version of the generated documents.
+const Version = "3.0.3"
+
+type Document struct {
+	OpenAPI    string              `json:"openapi"`
+	Info       Info                `json:"info"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components Components          `json:"components"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+// PathItem maps the lower case HTTP methods of a path to their operations.
+type PathItem map[string]*Operation
+
+type Operation struct {
+	OperationId string               `json:"operationId"`
+	Summary     string               `json:"summary,omitempty"`
+	RequestBody *RequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*Response `json:"responses"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Components struct {
+	Schemas map[string]*Schema `json:"schemas"`
+}
+
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	AllOf                []*Schema          `json:"allOf,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Example              interface{}        `json:"example,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+// Endpoint describes an HTTP endpoint. Request and Response are values of the body types, Request is nil when the
+// endpoint takes no body. Errors lists the status codes of the error responses, whose body is ErrorResponse.
+type Endpoint struct {
+	Method        string
+	Path          string
+	Summary       string
+	Request       interface{}
+	Response      interface{}
+	Errors        []int
+	ErrorResponse interface{}
+}
+
+var (
+	weiType       = reflect.TypeOf(types.Wei{})
+	bigIntType    = reflect.TypeOf(big.Int{})
+	addressType   = reflect.TypeOf(common.Address{})
+	textMarshaler = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// Generator builds a Document, adding a component schema for every struct type it encounters.
+type Generator struct {
+	doc   Document
+	types map[string]reflect.Type
+}
+
+func NewGenerator(info Info) *Generator {
+	return &Generator{
+		doc: Document{
+			OpenAPI:    Version,
+			Info:       info,
+			Paths:      make(map[string]PathItem),
+			Components: Components{Schemas: make(map[string]*Schema)},
+		},
+		types: make(map[string]reflect.Type),
+	}
+}
+
+// AddEndpoint adds the operation of the endpoint to the document.
+func (g *Generator) AddEndpoint(e Endpoint) error {
+	method := strings.ToLower(e.Method)
+	if item, ok := g.doc.Paths[e.Path]; ok && item[method] != nil {
+		return fmt.Errorf("duplicate endpoint %v %v", e.Method, e.Path)
+	}
+	op := &Operation{
+		OperationId: operationId(e.Method, e.Path),
+		Summary:     e.Summary,
+		Responses:   make(map[string]*Response),
+	}
+	if e.Request != nil {
+		schema, err := g.schema(reflect.TypeOf(e.Request))
+		if err != nil {
+			return err
+		}
+		op.RequestBody = &RequestBody{Required: true, Content: jsonContent(schema)}
+	}
+	schema, err := g.schema(reflect.TypeOf(e.Response))
+	if err != nil {
+		return err
+	}
+	op.Responses[strconv.Itoa(http.StatusOK)] = &Response{Description: http.StatusText(http.StatusOK), Content: jsonContent(schema)}
+	if len(e.Errors) > 0 {
+		schema, err = g.schema(reflect.TypeOf(e.ErrorResponse))
+		if err != nil {
+			return err
+		}
+		for _, status := range e.Errors {
+			op.Responses[strconv.Itoa(status)] = &Response{Description: http.StatusText(status), Content: jsonContent(schema)}
+		}
+	}
+	if g.doc.Paths[e.Path] == nil {
+		g.doc.Paths[e.Path] = make(PathItem)
+	}
+	g.doc.Paths[e.Path][method] = op
+	return nil
+}
+
+// AddSchema adds the component schema of the struct type of v, so types that are not exchanged by any endpoint can
+// be published too.
+func (g *Generator) AddSchema(v interface{}) error {
+	_, err := g.schema(reflect.TypeOf(v))
+	return err
+}
+
+func (g *Generator) Document() *Document {
+	return &g.doc
+}
+
+func jsonContent(schema *Schema) map[string]MediaType {
+	return map[string]MediaType{"application/json": {Schema: schema}}
+}
+
+// operationId turns "POST /pegin/getQuote" into "postPeginGetQuote".
+func operationId(method string, path string) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(method))
+	for _, part := range strings.Split(path, "/") {
+		if part != "" {
+			b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+		}
+	}
+	return b.String()
+}
+
+// schema returns the schema of t, which is a reference for struct types.
+func (g *Generator) schema(t reflect.Type) (*Schema, error) {
+	if t == nil {
+		return nil, fmt.Errorf("type is required")
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch {
+	case t == weiType, t == bigIntType:
+		return &Schema{Type: "string", Pattern: "^[0-9]+$"}, nil
+	case t == addressType:
+		return &Schema{Type: "string", Pattern: "^0x[0-9a-fA-F]{40}$"}, nil
+	case reflect.PtrTo(t).Implements(textMarshaler):
+		return &Schema{Type: "string"}, nil
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return &Schema{Type: "string"}, nil
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}, nil
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16:
+		return &Schema{Type: "integer", Format: "int32"}, nil
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}, nil
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}, nil
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}, nil
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}, nil
+		}
+		items, err := g.schema(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return &Schema{Type: "array", Items: items}, nil
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("unsupported map key type %v", t.Key())
+		}
+		values, err := g.schema(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return &Schema{Type: "object", AdditionalProperties: values}, nil
+	case reflect.Struct:
+		return g.structRef(t)
+	default:
+		return nil, fmt.Errorf("unsupported type %v", t)
+	}
+}
+
+// structRef adds the component schema of the struct type t, returning a reference to it.
+func (g *Generator) structRef(t reflect.Type) (*Schema, error) {
+	ref := &Schema{Ref: "#/components/schemas/" + t.Name()}
+	if prev, ok := g.types[t.Name()]; ok {
+		if prev != t {
+			return nil, fmt.Errorf("schema name %v is used by both %v and %v", t.Name(), prev, t)
+		}
+		return ref, nil
+	}
+	if t.Name() == "" {
+		return nil, fmt.Errorf("anonymous struct types are not supported")
+	}
+	g.types[t.Name()] = t
+	schema := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	if err := g.addFields(schema, t); err != nil {
+		return nil, err
+	}
+	g.doc.Components.Schemas[t.Name()] = schema
+	return ref, nil
+}
+
+func (g *Generator) addFields(schema *Schema, t reflect.Type) error {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		// the fields of unexported embedded structs are still encoded
+		if f.PkgPath != "" && !f.Anonymous {
+			continue
+		}
+		name, omitempty := jsonName(f)
+		if name == "-" {
+			continue
+		}
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				if err := g.addFields(schema, ft); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fs, err := g.schema(f.Type)
+		if err != nil {
+			return fmt.Errorf("%v.%v: %w", t.Name(), f.Name, err)
+		}
+		if fs.Ref != "" {
+			// siblings of $ref are ignored, so the description is attached through allOf
+			fs = &Schema{AllOf: []*Schema{fs}}
+		}
+		fs.Description = f.Tag.Get("description")
+		if example, ok := f.Tag.Lookup("example"); ok {
+			fs.Example = parseExample(fs, example)
+		}
+		// nil pointers are encoded as null, fields are only missing when they are omitted
+		fs.Nullable = f.Type.Kind() == reflect.Ptr && !omitempty
+		if !omitempty {
+			schema.Required = append(schema.Required, name)
+		}
+		schema.Properties[name] = fs
+	}
+	return nil
+}
+
+func jsonName(f reflect.StructField) (string, bool) {
+	tag := f.Tag.Get("json")
+	parts := strings.Split(tag, ",")
+	omitempty := false
+	for _, opt := range parts[1:] {
+		if opt == "omitempty" {
+			omitempty = true
+		}
+	}
+	return parts[0], omitempty
+}
+
+// parseExample converts the example tag to the type of the schema, dropping examples that do not match it.
+func parseExample(schema *Schema, example string) interface{} {
+	switch schema.Type {
+	case "integer":
+		if v, err := strconv.ParseInt(example, 10, 64); err == nil {
+			return v
+		}
+	case "number":
+		if v, err := strconv.ParseFloat(example, 64); err == nil {
+			return v
+		}
+	case "boolean":
+		if v, err := strconv.ParseBool(example); err == nil {
+			return v
+		}
+	case "string":
+		if ok, _ := regexp.MatchString(schema.Pattern, example); ok {
+			return example
+		}
+	case "":
+		return example
+	}
+	return nil
+}
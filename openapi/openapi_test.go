@@ -0,0 +1,97 @@
+package openapi
+
+import (
+	"math/big"
+	"net/http"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/rsksmart/liquidity-provider/types"
+	"github.com/stretchr/testify/assert"
+)
+
+type testEmbedded struct {
+	Embedded string `json:"embedded"`
+}
+
+type testChild struct {
+	Name string `json:"name"`
+}
+
+type testStruct struct {
+	testEmbedded
+	Value    *types.Wei        `json:"value" example:"1000" description:"Value in wei"`
+	Amount   *big.Int          `json:"amount,omitempty" example:"-1"`
+	Address  common.Address    `json:"address"`
+	State    types.RQState     `json:"state"`
+	Count    uint16            `json:"count" example:"3"`
+	Nonce    int64             `json:"nonce" example:"not a number"`
+	Enabled  bool              `json:"enabled" example:"true"`
+	Data     []byte            `json:"data"`
+	Children []testChild       `json:"children"`
+	Child    *testChild        `json:"child" description:"Child"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	Ignored  string            `json:"-"`
+	private  string
+}
+
+func TestGeneratorSchemas(t *testing.T) {
+	g := NewGenerator(Info{Title: "test", Version: "1"})
+	if !assert.NoError(t, g.AddSchema(testStruct{})) {
+		return
+	}
+	schemas := g.Document().Components.Schemas
+	s := schemas["testStruct"]
+	if !assert.NotNil(t, s) {
+		return
+	}
+	assert.Equal(t, []string{"embedded", "value", "address", "state", "count", "nonce", "enabled", "data", "children", "child"}, s.Required)
+	assert.Equal(t, &Schema{Type: "string", Pattern: "^[0-9]+$", Description: "Value in wei", Example: "1000", Nullable: true}, s.Properties["value"])
+	assert.Equal(t, &Schema{Type: "string", Pattern: "^[0-9]+$"}, s.Properties["amount"])
+	assert.Equal(t, &Schema{Type: "string", Pattern: "^0x[0-9a-fA-F]{40}$"}, s.Properties["address"])
+	assert.Equal(t, &Schema{Type: "string"}, s.Properties["state"])
+	assert.Equal(t, &Schema{Type: "integer", Format: "int32", Example: int64(3)}, s.Properties["count"])
+	assert.Equal(t, &Schema{Type: "integer", Format: "int64"}, s.Properties["nonce"])
+	assert.Equal(t, &Schema{Type: "boolean", Example: true}, s.Properties["enabled"])
+	assert.Equal(t, &Schema{Type: "string", Format: "byte"}, s.Properties["data"])
+	assert.Equal(t, &Schema{Type: "array", Items: &Schema{Ref: "#/components/schemas/testChild"}}, s.Properties["children"])
+	assert.Equal(t, &Schema{AllOf: []*Schema{{Ref: "#/components/schemas/testChild"}}, Description: "Child", Nullable: true}, s.Properties["child"])
+	assert.Equal(t, &Schema{Type: "object", AdditionalProperties: &Schema{Type: "string"}}, s.Properties["labels"])
+	assert.Len(t, s.Properties, 12)
+	assert.Contains(t, schemas, "testChild")
+}
+
+func TestGeneratorEndpoint(t *testing.T) {
+	g := NewGenerator(Info{Title: "test", Version: "1"})
+	e := Endpoint{
+		Method:        http.MethodPost,
+		Path:          "/children/add",
+		Request:       testChild{},
+		Response:      []testChild{},
+		Errors:        []int{http.StatusBadRequest},
+		ErrorResponse: testEmbedded{},
+	}
+	if !assert.NoError(t, g.AddEndpoint(e)) {
+		return
+	}
+	op := g.Document().Paths["/children/add"]["post"]
+	if !assert.NotNil(t, op) {
+		return
+	}
+	assert.Equal(t, "postChildrenAdd", op.OperationId)
+	assert.Equal(t, &Schema{Ref: "#/components/schemas/testChild"}, op.RequestBody.Content["application/json"].Schema)
+	assert.Equal(t, "array", op.Responses["200"].Content["application/json"].Schema.Type)
+	assert.Equal(t, &Schema{Ref: "#/components/schemas/testEmbedded"}, op.Responses["400"].Content["application/json"].Schema)
+	assert.Error(t, g.AddEndpoint(e))
+}
+
+func TestGeneratorErrors(t *testing.T) {
+	type testChild struct {
+		Other int `json:"other"`
+	}
+	g := NewGenerator(Info{Title: "test", Version: "1"})
+	assert.NoError(t, g.AddSchema(struct{ Child testChild }{}.Child))
+	assert.Error(t, g.AddSchema(testStruct{}), "schema names must be unique")
+	assert.Error(t, g.AddSchema(struct{ C chan int }{}))
+	assert.Error(t, g.AddSchema(map[int]string{}))
+}
@@ -0,0 +1,204 @@
+package providers
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	gethTypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/rsksmart/liquidity-provider/types"
+	"github.com/stretchr/testify/assert"
+)
+
+const testPasswd = "correct horse battery staple"
+
+// newTestKeystore creates n accounts in a new keystore directory, using light scrypt parameters to keep tests fast.
+func newTestKeystore(t *testing.T, n int) (string, []common.Address) {
+	dir := t.TempDir()
+	ks := keystore.NewKeyStore(dir, keystore.LightScryptN, keystore.LightScryptP)
+	addrs := make([]common.Address, n)
+	for i := range addrs {
+		acc, err := ks.NewAccount(testPasswd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		addrs[i] = acc.Address
+	}
+	return dir, addrs
+}
+
+func TestNewLocalProviderAccountSelection(t *testing.T) {
+	keydir, addrs := newTestKeystore(t, 2)
+	tests := []struct {
+		name    string
+		cfg     ProviderConfig
+		passwd  string
+		want    common.Address
+		wantErr error
+	}{
+		{
+			name: "by address",
+			cfg:  ProviderConfig{AccountAddr: addrs[1].Hex()},
+			want: addrs[1],
+		},
+		{
+			name: "by lowercase address",
+			cfg:  ProviderConfig{AccountAddr: addrs[0].String()[2:]},
+			want: addrs[0],
+		},
+		{
+			name:    "missing address",
+			cfg:     ProviderConfig{AccountAddr: "0x0000000000000000000000000000000000000001"},
+			wantErr: ErrAccountNotFound,
+		},
+		{
+			name:    "invalid address",
+			cfg:     ProviderConfig{AccountAddr: "abc"},
+			wantErr: ErrInvalidProviderAddress,
+		},
+		{
+			name:    "missing pegout address",
+			cfg:     ProviderConfig{AccountAddr: addrs[0].Hex(), PegoutAccountAddr: "0x0000000000000000000000000000000000000001"},
+			wantErr: ErrAccountNotFound,
+		},
+		{
+			name:    "missing extra address",
+			cfg:     ProviderConfig{AccountAddr: addrs[0].Hex(), ExtraAccountAddrs: []string{"0x0000000000000000000000000000000000000001"}},
+			wantErr: ErrAccountNotFound,
+		},
+		{
+			name:    "account number out of range",
+			cfg:     ProviderConfig{AccountNum: 2},
+			wantErr: ErrAccountNotFound,
+		},
+		{
+			name:    "negative account number",
+			cfg:     ProviderConfig{AccountNum: -1},
+			wantErr: ErrAccountNotFound,
+		},
+		{
+			name:    "wrong password",
+			cfg:     ProviderConfig{AccountAddr: addrs[0].Hex()},
+			passwd:  "wrong password",
+			wantErr: ErrWrongPassword,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.passwd == "" {
+				tt.passwd = testPasswd
+			}
+			f := genTmpFile(tt.passwd+"\n", t)
+			defer f.Close()
+			tt.cfg.Keydir = keydir
+			tt.cfg.PwdFile = f.Name()
+			lp, err := NewLocalProvider(tt.cfg, NewInMemRetainedQuotesRepository())
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("NewLocalProvider() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tt.want.String(), lp.Address())
+		})
+	}
+}
+
+func TestLocalProviderMultipleAccounts(t *testing.T) {
+	keydir, addrs := newTestKeystore(t, 4)
+	pegin, pegout, extra, unknown := addrs[0], addrs[1], addrs[2], addrs[3]
+	f := genTmpFile(testPasswd+"\n", t)
+	defer f.Close()
+	repository := NewInMemRetainedQuotesRepository()
+	repository.SetLiquidity(types.NewWei(1000))
+	repository.SetPegoutLiquidity(types.NewWei(1000))
+	chainId := big.NewInt(31)
+	lp, err := NewLocalProvider(ProviderConfig{
+		Keydir:            keydir,
+		PwdFile:           f.Name(),
+		ChainId:           chainId,
+		CallFee:           types.NewWei(0),
+		PenaltyFee:        types.NewWei(0),
+		AccountAddr:       pegin.Hex(),
+		PegoutAccountAddr: pegout.Hex(),
+		ExtraAccountAddrs: []string{extra.Hex(), pegin.Hex()},
+	}, repository)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, pegin.String(), lp.Address())
+	assert.Equal(t, pegout.String(), lp.PegoutAddress())
+	assert.ElementsMatch(t, []common.Address{pegin, pegout, extra}, lp.Accounts())
+
+	hash := crypto.Keccak256([]byte("pegin"))
+	sig, err := lp.SignQuote(hash, "abc", types.NewWei(100))
+	assert.Nil(t, err)
+	assert.Nil(t, VerifyQuoteSignature(hash, sig, pegin.Hex()))
+
+	pq, err := lp.GetPegoutQuote(&types.PegoutQuote{}, 0, 0, types.NewWei(0))
+	assert.Nil(t, err)
+	assert.Equal(t, pegout.String(), pq.LPRSKAddr)
+	hash = crypto.Keccak256([]byte("pegout"))
+	sig, err = lp.SignPegoutQuote(hash, types.NewWei(100))
+	assert.Nil(t, err)
+	assert.Nil(t, VerifyQuoteSignature(hash, sig, pegout.Hex()))
+
+	// quotes are signed by the account they were issued for
+	q := newSchemeTestQuote()
+	q.LPRSKAddr = extra.Hex()
+	sig, err = lp.SignQuoteFromQuote(q, "abc", types.NewWei(100))
+	assert.Nil(t, err)
+	hash, _ = q.Hash()
+	assert.Nil(t, VerifyQuoteSignature(hash, sig, extra.Hex()))
+	q.LPRSKAddr = unknown.Hex()
+	_, err = lp.SignQuoteFromQuote(q, "abc", types.NewWei(100))
+	assert.ErrorIs(t, err, ErrAccountNotFound)
+
+	to := common.HexToAddress("0x0000000000000000000000000000000000000002")
+	for _, addr := range []common.Address{pegin, pegout, extra} {
+		tx, err := lp.SignTx(addr, gethTypes.NewTransaction(0, to, big.NewInt(1), 21000, big.NewInt(1), nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sender, err := gethTypes.Sender(gethTypes.NewEIP155Signer(chainId), tx)
+		assert.Nil(t, err)
+		assert.Equal(t, addr, sender)
+	}
+	_, err = lp.SignTx(unknown, gethTypes.NewTransaction(0, to, big.NewInt(1), 21000, big.NewInt(1), nil))
+	assert.ErrorIs(t, err, ErrAccountNotFound)
+}
+
+func TestLocalProviderExternalSignerAccounts(t *testing.T) {
+	k1, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	k2, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := []common.Address{crypto.PubkeyToAddress(k1.PublicKey), crypto.PubkeyToAddress(k2.PublicKey)}
+	endpoint := startStubSignerHTTP(t, k1, k2)
+	lp, err := NewLocalProvider(ProviderConfig{
+		ExternalSigner:    endpoint,
+		AccountAddr:       keys[1].Hex(),
+		PegoutAccountAddr: keys[0].Hex(),
+	}, NewInMemRetainedQuotesRepository())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, keys[1].String(), lp.Address())
+	assert.Equal(t, keys[0].String(), lp.PegoutAddress())
+
+	_, err = NewLocalProvider(ProviderConfig{
+		ExternalSigner: endpoint,
+		AccountAddr:    "0x0000000000000000000000000000000000000001",
+	}, NewInMemRetainedQuotesRepository())
+	assert.ErrorIs(t, err, ErrAccountNotFound)
+}
@@ -0,0 +1,104 @@
+package providers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/rsksmart/liquidity-provider/types"
+)
+
+var ErrInvalidConfirmations = errors.New("invalid confirmations table")
+
+// ConfirmationThreshold requires Confirmations for the quotes whose value is below Below.
+type ConfirmationThreshold struct {
+	Below         *types.Wei
+	Confirmations uint16
+}
+
+// ConfirmationsTable selects the deposit confirmations of a quote by its value. In JSON it maps amounts, as parsed by
+// types.ParseWei, to confirmations: {"1000000": 2, "0.5 rbtc": 6}.
+type ConfirmationsTable []ConfirmationThreshold
+
+func (t *ConfirmationsTable) UnmarshalJSON(b []byte) error {
+	var m map[string]uint16
+	if err := json.Unmarshal(b, &m); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidConfirmations, err)
+	}
+	res := make(ConfirmationsTable, 0, len(m))
+	for k, v := range m {
+		below, err := types.ParseWei(k)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidConfirmations, err)
+		}
+		res = append(res, ConfirmationThreshold{Below: below, Confirmations: v})
+	}
+	res.sort()
+	*t = res
+	return nil
+}
+
+func (t ConfirmationsTable) MarshalJSON() ([]byte, error) {
+	m := make(map[string]uint16, len(t))
+	for _, threshold := range t {
+		m[threshold.Below.String()] = threshold.Confirmations
+	}
+	return json.Marshal(m)
+}
+
+// Check fails unless the thresholds are distinct and positive, and more valuable quotes are never required fewer
+// confirmations, maxConf included. It returns the table sorted by threshold.
+func (t ConfirmationsTable) Check(maxConf uint16) (ConfirmationsTable, error) {
+	res := make(ConfirmationsTable, len(t))
+	copy(res, t)
+	res.sort()
+	for i, threshold := range res {
+		if threshold.Below == nil || threshold.Below.AsBigInt().Sign() <= 0 {
+			return nil, fmt.Errorf("%w: threshold must be positive, got %v", ErrInvalidConfirmations, threshold.Below)
+		}
+		if i == 0 {
+			continue
+		}
+		prev := res[i-1]
+		if threshold.Below.Cmp(prev.Below) == 0 {
+			return nil, fmt.Errorf("%w: threshold %v is repeated", ErrInvalidConfirmations, threshold.Below)
+		}
+		if threshold.Confirmations < prev.Confirmations {
+			return nil, fmt.Errorf("%w: quotes below %v require %v confirmations, fewer than the %v of the quotes below %v",
+				ErrInvalidConfirmations, threshold.Below, threshold.Confirmations, prev.Confirmations, prev.Below)
+		}
+	}
+	if len(res) > 0 && res[len(res)-1].Confirmations > maxConf {
+		last := res[len(res)-1]
+		return nil, fmt.Errorf("%w: quotes below %v require %v confirmations, more than the maximum of %v",
+			ErrInvalidConfirmations, last.Below, last.Confirmations, maxConf)
+	}
+	for i := range res {
+		res[i].Below = res[i].Below.Copy()
+	}
+	return res, nil
+}
+
+// confirmations returns the confirmations required by a quote of the given value, the table must be sorted.
+func (t ConfirmationsTable) confirmations(value *types.Wei, maxConf uint16) (uint16, error) {
+	if value == nil || value.AsBigInt().Sign() < 0 {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidQuoteValue, value)
+	}
+	for _, threshold := range t {
+		if value.Cmp(threshold.Below) < 0 {
+			return threshold.Confirmations, nil
+		}
+	}
+	return maxConf, nil
+}
+
+// sort sorts the table by threshold, nil thresholds first.
+func (t ConfirmationsTable) sort() {
+	sort.SliceStable(t, func(i, j int) bool {
+		if t[i].Below == nil || t[j].Below == nil {
+			return t[i].Below == nil && t[j].Below != nil
+		}
+		return t[i].Below.Cmp(t[j].Below) < 0
+	})
+}
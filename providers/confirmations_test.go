@@ -0,0 +1,150 @@
+package providers
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/rsksmart/liquidity-provider/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func rbtc(n int64) *types.Wei {
+	return types.NewBigWei(new(big.Int).Mul(big.NewInt(n), big.NewInt(1000000000000000000)))
+}
+
+func TestConfirmationsTableJSON(t *testing.T) {
+	var table ConfirmationsTable
+	err := json.Unmarshal([]byte(`{"20 rbtc": 40, "1000000": 2, "0.5 rbtc": 6}`), &table)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, ConfirmationsTable{
+		{Below: types.NewWei(1000000), Confirmations: 2},
+		{Below: types.NewWei(500000000000000000), Confirmations: 6},
+		{Below: rbtc(20), Confirmations: 40},
+	}, table)
+
+	b, err := json.Marshal(table)
+	if assert.NoError(t, err) {
+		assert.JSONEq(t, `{"1000000": 2, "500000000000000000": 6, "20000000000000000000": 40}`, string(b))
+	}
+
+	for _, s := range []string{
+		`{"1.5": 2}`,
+		`{"1 btc": 2}`,
+		`{"-1": 2}`,
+		`{"1000": 70000}`,
+		`{"1000": -1}`,
+		`[2, 6]`,
+	} {
+		assert.ErrorIs(t, json.Unmarshal([]byte(s), &table), ErrInvalidConfirmations, s)
+	}
+}
+
+func TestConfirmationsTableCheck(t *testing.T) {
+	table := ConfirmationsTable{
+		{Below: rbtc(20), Confirmations: 40},
+		{Below: types.NewWei(1000000), Confirmations: 2},
+	}
+	sorted, err := table.Check(60)
+	if assert.NoError(t, err) {
+		assert.Equal(t, types.NewWei(1000000), sorted[0].Below)
+		assert.Equal(t, rbtc(20), sorted[1].Below)
+	}
+	// the table of the configuration is left untouched
+	assert.Equal(t, rbtc(20), table[0].Below)
+
+	for name, table := range map[string]ConfirmationsTable{
+		"decreasing": {
+			{Below: types.NewWei(1000000), Confirmations: 6},
+			{Below: types.NewWei(2000000), Confirmations: 2},
+		},
+		"repeated": {
+			{Below: types.NewWei(1000000000), Confirmations: 2},
+			{Below: mustParseWei(t, "1 gwei"), Confirmations: 2},
+		},
+		"zero":          {{Below: types.NewWei(0), Confirmations: 2}},
+		"negative":      {{Below: types.NewWei(-1), Confirmations: 2}},
+		"nil":           {{Confirmations: 2}},
+		"above maximum": {{Below: types.NewWei(1000000), Confirmations: 61}},
+	} {
+		_, err := table.Check(60)
+		assert.ErrorIs(t, err, ErrInvalidConfirmations, name)
+	}
+
+	sorted, err = ConfirmationsTable(nil).Check(60)
+	if assert.NoError(t, err) {
+		assert.Empty(t, sorted)
+	}
+}
+
+func TestConfirmationsTableConfirmations(t *testing.T) {
+	table, err := ConfirmationsTable{
+		{Below: types.NewWei(1000000), Confirmations: 2},
+		{Below: rbtc(20), Confirmations: 40},
+		{Below: rbtc(100), Confirmations: 50},
+	}.Check(60)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 2^64 wei wrapped around to 0 when the value was compared as an uint64
+	twoTo64 := new(big.Int).Lsh(big.NewInt(1), 64)
+	for value, want := range map[*types.Wei]uint16{
+		types.NewWei(0):           2,
+		types.NewWei(999999):      2,
+		types.NewWei(1000000):     40,
+		types.NewBigWei(twoTo64):  40,
+		rbtc(20):                  50,
+		rbtc(99):                  50,
+		rbtc(100):                 60,
+		rbtc(1000000000000000000): 60,
+		new(types.Wei).Add(rbtc(20), types.NewWei(1)): 50,
+	} {
+		got, err := table.confirmations(value, 60)
+		if assert.NoError(t, err, value) {
+			assert.Equal(t, want, got, value)
+		}
+	}
+
+	_, err = table.confirmations(nil, 60)
+	assert.ErrorIs(t, err, ErrInvalidQuoteValue)
+	_, err = table.confirmations(types.NewWei(-1), 60)
+	assert.ErrorIs(t, err, ErrInvalidQuoteValue)
+}
+
+func TestLocalProviderConfirmations(t *testing.T) {
+	ks, acc := newTestKeystoreAccount(t)
+	cfg := ProviderConfig{
+		MaxConf:    60,
+		CallFee:    types.NewWei(1000),
+		PenaltyFee: types.NewWei(1000000),
+		Confirmations: ConfirmationsTable{
+			{Below: rbtc(20), Confirmations: 40},
+			{Below: types.NewWei(1000000), Confirmations: 2},
+		},
+	}
+	lp, err := NewLocalProviderWithSigner(cfg, NewKeystoreSigner(ks, acc), NewInMemRetainedQuotesRepository())
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := quoteOfValue(0)
+	q.Value = types.NewBigWei(new(big.Int).Lsh(big.NewInt(1), 64))
+	res, err := lp.GetQuote(q, 21000, types.NewWei(1))
+	if assert.NoError(t, err) {
+		assert.EqualValues(t, 40, res.Confirmations)
+	}
+
+	cfg.MaxConf = 20
+	_, err = NewLocalProviderWithSigner(cfg, NewKeystoreSigner(ks, acc), NewInMemRetainedQuotesRepository())
+	assert.ErrorIs(t, err, ErrInvalidConfirmations)
+}
+
+func mustParseWei(t *testing.T, s string) *types.Wei {
+	w, err := types.ParseWei(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
@@ -0,0 +1,226 @@
+package providers
+
+import (
+	"context"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	gethTypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/rsksmart/liquidity-provider/types"
+)
+
+// DefaultReserveTimeout bounds the time a liquidity reservation holds the provider lock when
+// ProviderConfig.ReserveTimeout is not set.
+const DefaultReserveTimeout = 10 * time.Second
+
+// ContextLiquidityProvider is a LiquidityProvider whose operations can be cancelled through a context.
+type ContextLiquidityProvider interface {
+	LiquidityProvider
+	GetQuoteContext(ctx context.Context, q *types.Quote, gas uint64, gasPrice *types.Wei) (*types.Quote, error)
+	SignQuoteContext(ctx context.Context, hash []byte, depositAddr string, reqLiq *types.Wei) ([]byte, error)
+	SignQuoteFromQuoteContext(ctx context.Context, q *types.Quote, depositAddr string, reqLiq *types.Wei) ([]byte, error)
+	SignTxContext(ctx context.Context, address common.Address, tx *gethTypes.Transaction) (*gethTypes.Transaction, error)
+}
+
+// ContextPegoutLiquidityProvider is a PegoutLiquidityProvider whose operations can be cancelled through a context.
+type ContextPegoutLiquidityProvider interface {
+	PegoutLiquidityProvider
+	GetPegoutQuoteContext(ctx context.Context, q *types.PegoutQuote, lastBlock uint64, gas uint64, gasPrice *types.Wei) (*types.PegoutQuote, error)
+	SignPegoutQuoteContext(ctx context.Context, hash []byte, reqLiq *types.Wei) ([]byte, error)
+	SignPegoutQuoteFromQuoteContext(ctx context.Context, q *types.PegoutQuote, reqLiq *types.Wei) ([]byte, error)
+}
+
+// ContextLocalProviderRepository is a LocalProviderRepository whose calls give up when their context is done.
+type ContextLocalProviderRepository interface {
+	LocalProviderRepository
+	HasRetainedQuoteContext(ctx context.Context, hash string) (bool, error)
+	HasLiquidityContext(ctx context.Context, lp LiquidityProvider, wei *types.Wei) (bool, error)
+	ReserveLiquidityContext(ctx context.Context, rq *types.RetainedQuote) error
+}
+
+// ContextPegoutLocalProviderRepository is a PegoutLocalProviderRepository whose calls give up when their context is
+// done.
+type ContextPegoutLocalProviderRepository interface {
+	PegoutLocalProviderRepository
+	HasRetainedPegoutQuoteContext(ctx context.Context, hash string) (bool, error)
+	HasPegoutLiquidityContext(ctx context.Context, lp PegoutLiquidityProvider, wei *types.Wei) (bool, error)
+	ReservePegoutLiquidityContext(ctx context.Context, rq *types.RetainedPegoutQuote) error
+}
+
+// ContextRetainedQuoteStateRepository is a RetainedQuoteStateRepository whose calls give up when their context is
+// done.
+type ContextRetainedQuoteStateRepository interface {
+	RetainedQuoteStateRepository
+	GetRetainedQuotesContext(ctx context.Context, states ...types.RQState) ([]*types.RetainedQuote, error)
+	UpdateRetainedQuoteStateContext(ctx context.Context, hash string, oldState types.RQState, newState types.RQState) error
+}
+
+// ContextRetainedPegoutQuoteStateRepository is a RetainedPegoutQuoteStateRepository whose calls give up when their
+// context is done.
+type ContextRetainedPegoutQuoteStateRepository interface {
+	RetainedPegoutQuoteStateRepository
+	GetRetainedPegoutQuotesContext(ctx context.Context, states ...types.RQState) ([]*types.RetainedPegoutQuote, error)
+	UpdateRetainedPegoutQuoteStateContext(ctx context.Context, hash string, oldState types.RQState, newState types.RQState) error
+}
+
+// ContextQuoteRepository is a QuoteRepository whose calls give up when their context is done.
+type ContextQuoteRepository interface {
+	QuoteRepository
+	InsertQuoteContext(ctx context.Context, hash string, q *types.Quote) error
+	GetQuoteContext(ctx context.Context, hash string) (*types.Quote, error)
+	ReserveQuoteLiquidityContext(ctx context.Context, q *types.Quote, rq *types.RetainedQuote) error
+}
+
+// ContextPegoutQuoteRepository is a PegoutQuoteRepository whose calls give up when their context is done.
+type ContextPegoutQuoteRepository interface {
+	PegoutQuoteRepository
+	InsertPegoutQuoteContext(ctx context.Context, hash string, q *types.PegoutQuote) error
+	GetPegoutQuoteContext(ctx context.Context, hash string) (*types.PegoutQuote, error)
+	ReservePegoutQuoteLiquidityContext(ctx context.Context, q *types.PegoutQuote, rq *types.RetainedPegoutQuote) error
+}
+
+// ContextSigner is a Signer whose requests can be cancelled through a context, e.g. while an external signer waits
+// for an operator to approve them.
+type ContextSigner interface {
+	Signer
+	SignTextContext(ctx context.Context, text []byte) ([]byte, error)
+	SignTypedDataContext(ctx context.Context, td *types.TypedData) ([]byte, error)
+	SignTxContext(ctx context.Context, tx *gethTypes.Transaction, chainId *big.Int) (*gethTypes.Transaction, error)
+}
+
+// ctxMutex is a mutex that stops waiting for the lock when a context is done.
+type ctxMutex chan struct{}
+
+func newCtxMutex() ctxMutex {
+	return make(ctxMutex, 1)
+}
+
+func (m ctxMutex) Lock(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	select {
+	case m <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (m ctxMutex) Unlock() {
+	<-m
+}
+
+// The functions below call the context variants of the repository and signer methods when they are implemented,
+// otherwise they only check that ctx is not done before making the call.
+
+func reserveLiquidity(ctx context.Context, r LocalProviderRepository, rq *types.RetainedQuote) error {
+	if cr, ok := r.(ContextLocalProviderRepository); ok {
+		return cr.ReserveLiquidityContext(ctx, rq)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return r.ReserveLiquidity(rq)
+}
+
+func reservePegoutLiquidity(ctx context.Context, r PegoutLocalProviderRepository, rq *types.RetainedPegoutQuote) error {
+	if cr, ok := r.(ContextPegoutLocalProviderRepository); ok {
+		return cr.ReservePegoutLiquidityContext(ctx, rq)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return r.ReservePegoutLiquidity(rq)
+}
+
+func getRetainedQuotes(ctx context.Context, r RetainedQuoteStateRepository, states ...types.RQState) ([]*types.RetainedQuote, error) {
+	if cr, ok := r.(ContextRetainedQuoteStateRepository); ok {
+		return cr.GetRetainedQuotesContext(ctx, states...)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return r.GetRetainedQuotes(states...)
+}
+
+func updateRetainedQuoteState(ctx context.Context, r RetainedQuoteStateRepository, hash string, oldState types.RQState, newState types.RQState) error {
+	if cr, ok := r.(ContextRetainedQuoteStateRepository); ok {
+		return cr.UpdateRetainedQuoteStateContext(ctx, hash, oldState, newState)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return r.UpdateRetainedQuoteState(hash, oldState, newState)
+}
+
+func getRetainedPegoutQuotes(ctx context.Context, r RetainedPegoutQuoteStateRepository, states ...types.RQState) ([]*types.RetainedPegoutQuote, error) {
+	if cr, ok := r.(ContextRetainedPegoutQuoteStateRepository); ok {
+		return cr.GetRetainedPegoutQuotesContext(ctx, states...)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return r.GetRetainedPegoutQuotes(states...)
+}
+
+func updateRetainedPegoutQuoteState(ctx context.Context, r RetainedPegoutQuoteStateRepository, hash string, oldState types.RQState, newState types.RQState) error {
+	if cr, ok := r.(ContextRetainedPegoutQuoteStateRepository); ok {
+		return cr.UpdateRetainedPegoutQuoteStateContext(ctx, hash, oldState, newState)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return r.UpdateRetainedPegoutQuoteState(hash, oldState, newState)
+}
+
+func reserveQuoteLiquidity(ctx context.Context, r QuoteRepository, q *types.Quote, rq *types.RetainedQuote) error {
+	if cr, ok := r.(ContextQuoteRepository); ok {
+		return cr.ReserveQuoteLiquidityContext(ctx, q, rq)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return r.ReserveQuoteLiquidity(q, rq)
+}
+
+func reservePegoutQuoteLiquidity(ctx context.Context, r PegoutQuoteRepository, q *types.PegoutQuote, rq *types.RetainedPegoutQuote) error {
+	if cr, ok := r.(ContextPegoutQuoteRepository); ok {
+		return cr.ReservePegoutQuoteLiquidityContext(ctx, q, rq)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return r.ReservePegoutQuoteLiquidity(q, rq)
+}
+
+func signText(ctx context.Context, signer Signer, text []byte) ([]byte, error) {
+	if cs, ok := signer.(ContextSigner); ok {
+		return cs.SignTextContext(ctx, text)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return signer.SignText(text)
+}
+
+func signTypedData(ctx context.Context, signer Signer, td *types.TypedData) ([]byte, error) {
+	if cs, ok := signer.(ContextSigner); ok {
+		return cs.SignTypedDataContext(ctx, td)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return signer.SignTypedData(td)
+}
+
+func signTx(ctx context.Context, signer Signer, tx *gethTypes.Transaction, chainId *big.Int) (*gethTypes.Transaction, error) {
+	if cs, ok := signer.(ContextSigner); ok {
+		return cs.SignTxContext(ctx, tx, chainId)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return signer.SignTx(tx, chainId)
+}
@@ -0,0 +1,141 @@
+package providers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/rsksmart/liquidity-provider/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// hungRepository mimics a database that does not answer: reservations block until their context is done, or until
+// release is closed.
+type hungRepository struct {
+	*InMemLocalProviderRepository
+	started chan struct{}
+	release chan struct{}
+}
+
+func newHungRepository() *hungRepository {
+	return &hungRepository{
+		InMemLocalProviderRepository: NewInMemRetainedQuotesRepository(),
+		started:                      make(chan struct{}, 10),
+		release:                      make(chan struct{}),
+	}
+}
+
+func (r *hungRepository) HasRetainedQuoteContext(_ context.Context, hash string) (bool, error) {
+	return r.HasRetainedQuote(hash)
+}
+
+func (r *hungRepository) HasLiquidityContext(_ context.Context, lp LiquidityProvider, wei *types.Wei) (bool, error) {
+	return r.HasLiquidity(lp, wei)
+}
+
+func (r *hungRepository) ReserveLiquidityContext(ctx context.Context, rq *types.RetainedQuote) error {
+	r.started <- struct{}{}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-r.release:
+		return r.ReserveLiquidity(rq)
+	}
+}
+
+// newTestKeystoreAccount returns a new keystore with an unlocked account, using light scrypt parameters.
+func newTestKeystoreAccount(t *testing.T) (*keystore.KeyStore, accounts.Account) {
+	ks := keystore.NewKeyStore(t.TempDir(), keystore.LightScryptN, keystore.LightScryptP)
+	acc, err := ks.NewAccount("passwd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ks.Unlock(acc, "passwd"); err != nil {
+		t.Fatal(err)
+	}
+	return ks, acc
+}
+
+func newContextTestProvider(t *testing.T, repository LocalProviderRepository, reserveTimeout time.Duration) *LocalProvider {
+	ks, acc := newTestKeystoreAccount(t)
+	lp, err := NewLocalProviderWithSigner(ProviderConfig{ReserveTimeout: reserveTimeout}, NewKeystoreSigner(ks, acc), repository)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return lp
+}
+
+func TestLocalProviderReserveTimeout(t *testing.T) {
+	repository := newHungRepository()
+	repository.SetLiquidity(types.NewWei(1000))
+	lp := newContextTestProvider(t, repository, 50*time.Millisecond)
+
+	// the hung reservation gives up at the deadline and releases the lock, so the next one is not blocked forever
+	for _, s := range []string{"a", "b"} {
+		_, err := lp.SignQuote(crypto.Keccak256([]byte(s)), "abc", types.NewWei(100))
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	}
+
+	close(repository.release)
+	_, err := lp.SignQuote(crypto.Keccak256([]byte("c")), "abc", types.NewWei(100))
+	assert.Nil(t, err)
+	assert.EqualValues(t, types.NewWei(900), repository.GetLiquidity())
+}
+
+func TestLocalProviderLockCancellation(t *testing.T) {
+	repository := newHungRepository()
+	repository.SetLiquidity(types.NewWei(1000))
+	lp := newContextTestProvider(t, repository, time.Minute)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := lp.SignQuote(crypto.Keccak256([]byte("a")), "abc", types.NewWei(100))
+		done <- err
+	}()
+	<-repository.started
+
+	// the lock is held by the hung reservation, waiting for it stops with the context
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := lp.SignQuoteContext(ctx, crypto.Keccak256([]byte("b")), "abc", types.NewWei(100))
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	_, err = lp.SignQuoteContext(ctx, crypto.Keccak256([]byte("b")), "abc", types.NewWei(100))
+	assert.ErrorIs(t, err, context.Canceled)
+
+	close(repository.release)
+	select {
+	case err = <-done:
+		assert.Nil(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("SignQuote() did not return after the repository was released")
+	}
+	assert.EqualValues(t, types.NewWei(900), repository.GetLiquidity())
+}
+
+func TestLocalProviderCancelledContext(t *testing.T) {
+	repository := NewInMemRetainedQuotesRepository()
+	repository.SetLiquidity(types.NewWei(1000))
+	lp := newContextTestProvider(t, repository, 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := lp.GetQuoteContext(ctx, newSchemeTestQuote(), 0, types.NewWei(0))
+	assert.ErrorIs(t, err, context.Canceled)
+	_, err = lp.SignQuoteContext(ctx, crypto.Keccak256([]byte("a")), "abc", types.NewWei(100))
+	assert.ErrorIs(t, err, context.Canceled)
+	_, err = lp.SignPegoutQuoteContext(ctx, crypto.Keccak256([]byte("a")), types.NewWei(100))
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.EqualValues(t, types.NewWei(1000), repository.GetLiquidity())
+
+	expirer, err := NewQuoteExpirer(repository, nil, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = expirer.SweepContext(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+}
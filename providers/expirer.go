@@ -0,0 +1,197 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rsksmart/liquidity-provider/types"
+	log "github.com/sirupsen/logrus"
+)
+
+// Clock abstracts the passage of time so the expirer can be driven deterministically.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type SystemClock struct{}
+
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (SystemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// QuoteExpirer periodically moves the retained quotes whose time for deposit elapsed to
+// RQStateTimeForDepositElapsed, releasing their liquidity.
+type QuoteExpirer struct {
+	mu               sync.Mutex
+	repository       RetainedQuoteStateRepository
+	pegoutRepository RetainedPegoutQuoteStateRepository
+	clock            Clock
+	interval         time.Duration
+	stop             chan struct{}
+	done             chan struct{}
+}
+
+var (
+	ErrExpirerRunning         = errors.New("quote expirer is already running")
+	ErrInvalidExpirerInterval = errors.New("quote expirer interval must be positive")
+)
+
+// NewQuoteExpirer returns an expirer sweeping repository every interval, which must be positive. A nil clock
+// defaults to the system clock.
+func NewQuoteExpirer(repository RetainedQuoteStateRepository, clock Clock, interval time.Duration) (*QuoteExpirer, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidExpirerInterval, interval)
+	}
+	if clock == nil {
+		clock = SystemClock{}
+	}
+	e := &QuoteExpirer{
+		repository: repository,
+		clock:      clock,
+		interval:   interval,
+	}
+	if pegoutRepository, ok := repository.(RetainedPegoutQuoteStateRepository); ok {
+		e.pegoutRepository = pegoutRepository
+	}
+	return e, nil
+}
+
+// Start runs a sweep every interval until Stop is called.
+func (e *QuoteExpirer) Start() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.stop != nil {
+		return ErrExpirerRunning
+	}
+	e.stop = make(chan struct{})
+	e.done = make(chan struct{})
+	go e.run(e.stop, e.done)
+	return nil
+}
+
+// Stop stops the expirer, cancelling the sweep in progress, if any, and waits for it to return.
+func (e *QuoteExpirer) Stop() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.stop == nil {
+		return
+	}
+	close(e.stop)
+	<-e.done
+	e.stop = nil
+	e.done = nil
+}
+
+func (e *QuoteExpirer) run(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	// stopping the expirer cancels the sweep in progress
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-e.clock.After(e.interval):
+			if _, err := e.SweepContext(ctx); err != nil && ctx.Err() == nil {
+				log.Error("error expiring retained quotes: ", err)
+			}
+		}
+	}
+}
+
+// Sweep expires the retained quotes waiting for a deposit past their deadline, returning how many were expired and
+// the first error.
+func (e *QuoteExpirer) Sweep() (int, error) {
+	return e.SweepContext(context.Background())
+}
+
+// SweepContext is Sweep, stopping when ctx is done. The quotes expired until then remain expired.
+func (e *QuoteExpirer) SweepContext(ctx context.Context) (int, error) {
+	now := e.clock.Now()
+	expired, err := e.sweepPegin(ctx, now)
+	if e.pegoutRepository == nil || ctx.Err() != nil {
+		return expired, err
+	}
+	n, pegoutErr := e.sweepPegout(ctx, now)
+	if err == nil {
+		err = pegoutErr
+	}
+	return expired + n, err
+}
+
+func (e *QuoteExpirer) sweepPegin(ctx context.Context, now time.Time) (int, error) {
+	rqs, err := getRetainedQuotes(ctx, e.repository, types.RQStateWaitingForDeposit)
+	if err != nil {
+		return 0, err
+	}
+	expired := 0
+	var firstErr error
+	for _, rq := range rqs {
+		if err = ctx.Err(); err != nil {
+			return expired, err
+		}
+		if rq.DepositDeadline().After(now) {
+			continue
+		}
+		oldState := rq.State
+		err = rq.Transition(types.RQStateTimeForDepositElapsed)
+		if err == nil {
+			err = updateRetainedQuoteState(ctx, e.repository, rq.QuoteHash, oldState, rq.State)
+		}
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		log.Debug("retained quote expired: ", rq.QuoteHash)
+		expired++
+	}
+	return expired, firstErr
+}
+
+func (e *QuoteExpirer) sweepPegout(ctx context.Context, now time.Time) (int, error) {
+	rqs, err := getRetainedPegoutQuotes(ctx, e.pegoutRepository, types.RQStateWaitingForDeposit)
+	if err != nil {
+		return 0, err
+	}
+	expired := 0
+	var firstErr error
+	for _, rq := range rqs {
+		if err = ctx.Err(); err != nil {
+			return expired, err
+		}
+		if deadline := rq.DepositDeadline(); deadline.IsZero() || deadline.After(now) {
+			continue
+		}
+		oldState := rq.State
+		err = rq.Transition(types.RQStateTimeForDepositElapsed)
+		if err == nil {
+			err = updateRetainedPegoutQuoteState(ctx, e.pegoutRepository, rq.QuoteHash, oldState, rq.State)
+		}
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		log.Debug("retained peg-out quote expired: ", rq.QuoteHash)
+		expired++
+	}
+	return expired, firstErr
+}
@@ -0,0 +1,174 @@
+package providers
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rsksmart/liquidity-provider/types"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeClock struct {
+	mu    sync.Mutex
+	now   time.Time
+	ticks chan time.Time
+}
+
+func newFakeClock(now time.Time) *fakeClock {
+	return &fakeClock{now: now, ticks: make(chan time.Time)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(_ time.Duration) <-chan time.Time {
+	return c.ticks
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	now := c.now
+	c.mu.Unlock()
+	c.ticks <- now
+}
+
+// Skip moves the clock forward without firing the tickers.
+func (c *fakeClock) Skip(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func retainTestQuotes(repository *InMemLocalProviderRepository, agreementTimestamp uint32) {
+	for hash, timeForDeposit := range map[string]uint32{"a": 60, "b": 120, "c": 3600} {
+		_ = repository.RetainQuote(&types.RetainedQuote{
+			QuoteHash:          hash,
+			ReqLiq:             types.NewWei(10),
+			State:              types.RQStateWaitingForDeposit,
+			AgreementTimestamp: agreementTimestamp,
+			TimeForDeposit:     timeForDeposit,
+		})
+	}
+}
+
+func TestQuoteExpirer_Sweep(t *testing.T) {
+	start := time.Unix(1670441000, 0)
+	repository := NewInMemRetainedQuotesRepository()
+	repository.SetLiquidity(types.NewWei(100))
+	retainTestQuotes(repository, uint32(start.Unix()))
+	assert.Nil(t, repository.SetRetainedQuoteState("b", types.RQStateWaitingForDepositConfirmations))
+	clock := newFakeClock(start)
+	expirer, err := NewQuoteExpirer(repository, clock, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := expirer.Sweep()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+	assert.EqualValues(t, types.NewWei(70), repository.GetLiquidity())
+
+	clock.now = start.Add(time.Hour)
+	n, err = expirer.Sweep()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, types.RQStateTimeForDepositElapsed, repository.retainedQuotes["a"].State)
+	assert.Equal(t, types.RQStateWaitingForDepositConfirmations, repository.retainedQuotes["b"].State)
+	assert.Equal(t, types.RQStateTimeForDepositElapsed, repository.retainedQuotes["c"].State)
+	assert.EqualValues(t, types.NewWei(90), repository.GetLiquidity())
+}
+
+func TestQuoteExpirer_SweepPegout(t *testing.T) {
+	start := time.Unix(1670441000, 0)
+	repository := NewInMemRetainedQuotesRepository()
+	repository.SetLiquidity(types.NewWei(100))
+	repository.SetPegoutLiquidity(types.NewWei(100))
+	retainTestQuotes(repository, uint32(start.Unix()))
+	for hash, depositTime := range map[string]uint32{"a": 60, "b": 3600, "c": 7200} {
+		assert.NoError(t, repository.ReservePegoutLiquidity(&types.RetainedPegoutQuote{
+			QuoteHash:          hash,
+			ReqLiq:             types.NewWei(20),
+			State:              types.RQStateWaitingForDeposit,
+			AgreementTimestamp: uint32(start.Unix()),
+			DepositDateLimit:   uint32(start.Unix()) + depositTime,
+		}))
+	}
+	// a quote retained before its deadline was recorded is never expired
+	assert.NoError(t, repository.ReservePegoutLiquidity(&types.RetainedPegoutQuote{
+		QuoteHash: "d",
+		ReqLiq:    types.NewWei(20),
+		State:     types.RQStateWaitingForDeposit,
+	}))
+	clock := newFakeClock(start.Add(time.Hour))
+	expirer, err := NewQuoteExpirer(repository, clock, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := expirer.Sweep()
+	assert.Nil(t, err)
+	// the three peg-in quotes and the peg-out quotes a and b
+	assert.Equal(t, 5, n)
+	assert.EqualValues(t, types.NewWei(100), repository.GetLiquidity())
+	assert.EqualValues(t, types.NewWei(60), repository.GetPegoutLiquidity())
+	for hash, state := range map[string]types.RQState{
+		"a": types.RQStateTimeForDepositElapsed,
+		"b": types.RQStateTimeForDepositElapsed,
+		"c": types.RQStateWaitingForDeposit,
+		"d": types.RQStateWaitingForDeposit,
+	} {
+		rq, err := repository.GetRetainedPegoutQuote(hash)
+		if assert.NoError(t, err) {
+			assert.Equal(t, state, rq.State, hash)
+		}
+	}
+
+	clock.now = start.Add(2 * time.Hour)
+	n, err = expirer.Sweep()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	assert.EqualValues(t, types.NewWei(80), repository.GetPegoutLiquidity())
+}
+
+func TestQuoteExpirer_StartStop(t *testing.T) {
+	start := time.Unix(1670441000, 0)
+	repository := NewInMemRetainedQuotesRepository()
+	repository.SetLiquidity(types.NewWei(100))
+	retainTestQuotes(repository, uint32(start.Unix()))
+	clock := newFakeClock(start)
+	expirer, err := NewQuoteExpirer(repository, clock, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Nil(t, expirer.Start())
+	assert.ErrorIs(t, expirer.Start(), ErrExpirerRunning)
+
+	clock.Advance(90 * time.Second)
+	// the next tick is only received once the previous sweep finished
+	clock.Advance(0)
+	expirer.Stop()
+	assert.Equal(t, types.RQStateTimeForDepositElapsed, repository.retainedQuotes["a"].State)
+	assert.Equal(t, types.RQStateWaitingForDeposit, repository.retainedQuotes["b"].State)
+	assert.EqualValues(t, types.NewWei(80), repository.GetLiquidity())
+
+	// stopping twice is a no-op, and the expirer can be started again
+	expirer.Stop()
+	assert.Nil(t, expirer.Start())
+	clock.Advance(time.Hour)
+	clock.Advance(0)
+	expirer.Stop()
+	assert.EqualValues(t, types.NewWei(100), repository.GetLiquidity())
+}
+
+func TestNewQuoteExpirer(t *testing.T) {
+	for _, interval := range []time.Duration{0, -time.Minute} {
+		_, err := NewQuoteExpirer(NewInMemRetainedQuotesRepository(), nil, interval)
+		assert.ErrorIs(t, err, ErrInvalidExpirerInterval)
+	}
+}
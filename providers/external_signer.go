@@ -0,0 +1,210 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	gethTypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+	"github.com/rsksmart/liquidity-provider/types"
+)
+
+var (
+	ErrNoSignerAccounts  = errors.New("external signer has no accounts")
+	ErrUnsupportedTxType = errors.New("unsupported transaction type")
+)
+
+// ExternalSigner delegates signing to a Clef compatible signer reached over JSON-RPC, either through HTTP or IPC.
+// The keys never leave the external signer, which may also ask an operator to approve every request.
+type ExternalSigner struct {
+	client  *rpc.Client
+	address common.Address
+}
+
+type signTransactionResult struct {
+	Raw hexutil.Bytes          `json:"raw"`
+	Tx  *gethTypes.Transaction `json:"tx"`
+}
+
+// NewExternalSigner connects to the signer at endpoint and signs with the first account it lists.
+func NewExternalSigner(endpoint string) (*ExternalSigner, error) {
+	return NewExternalSignerContext(context.Background(), endpoint)
+}
+
+// NewExternalSignerContext is NewExternalSigner, giving up connecting when ctx is done.
+func NewExternalSignerContext(ctx context.Context, endpoint string) (*ExternalSigner, error) {
+	client, addrs, err := dialExternalSigner(ctx, endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) == 0 {
+		client.Close()
+		return nil, ErrNoSignerAccounts
+	}
+	return &ExternalSigner{
+		client:  client,
+		address: addrs[0],
+	}, nil
+}
+
+// NewExternalSignerForAccount connects to the signer at endpoint and signs with the account with address addr.
+func NewExternalSignerForAccount(endpoint string, addr common.Address) (*ExternalSigner, error) {
+	return NewExternalSignerForAccountContext(context.Background(), endpoint, addr)
+}
+
+// NewExternalSignerForAccountContext is NewExternalSignerForAccount, giving up connecting when ctx is done.
+func NewExternalSignerForAccountContext(ctx context.Context, endpoint string, addr common.Address) (*ExternalSigner, error) {
+	client, addrs, err := dialExternalSigner(ctx, endpoint)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range addrs {
+		if a == addr {
+			return &ExternalSigner{
+				client:  client,
+				address: addr,
+			}, nil
+		}
+	}
+	client.Close()
+	return nil, fmt.Errorf("%w: %v is not managed by the external signer", ErrAccountNotFound, addr)
+}
+
+func dialExternalSigner(ctx context.Context, endpoint string) (*rpc.Client, []common.Address, error) {
+	client, err := rpc.DialContext(ctx, endpoint)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error connecting to external signer: %v", err)
+	}
+	var version string
+	if err = client.CallContext(ctx, &version, "account_version"); err != nil {
+		client.Close()
+		return nil, nil, fmt.Errorf("error connecting to external signer: %v", err)
+	}
+	var addrs []common.Address
+	if err = client.CallContext(ctx, &addrs, "account_list"); err != nil {
+		client.Close()
+		return nil, nil, fmt.Errorf("error listing external signer accounts: %v", err)
+	}
+	return client, addrs, nil
+}
+
+func (s *ExternalSigner) Address() common.Address {
+	return s.address
+}
+
+func (s *ExternalSigner) SignText(text []byte) ([]byte, error) {
+	return s.SignTextContext(context.Background(), text)
+}
+
+// SignTextContext is SignText, giving up waiting for the signer when ctx is done.
+func (s *ExternalSigner) SignTextContext(ctx context.Context, text []byte) ([]byte, error) {
+	var sig hexutil.Bytes
+	addr := common.NewMixedcaseAddress(s.address)
+	err := s.client.CallContext(ctx, &sig, "account_signData", accounts.MimetypeTextPlain, &addr, hexutil.Encode(text))
+	if err != nil {
+		return nil, err
+	}
+	return s.checkSignature(accounts.TextHash(text), sig)
+}
+
+func (s *ExternalSigner) SignTypedData(td *types.TypedData) ([]byte, error) {
+	return s.SignTypedDataContext(context.Background(), td)
+}
+
+// SignTypedDataContext is SignTypedData, giving up waiting for the signer when ctx is done.
+func (s *ExternalSigner) SignTypedDataContext(ctx context.Context, td *types.TypedData) ([]byte, error) {
+	digest, err := td.Hash()
+	if err != nil {
+		return nil, fmt.Errorf("error hashing typed data: %v", err)
+	}
+	var sig hexutil.Bytes
+	addr := common.NewMixedcaseAddress(s.address)
+	if err = s.client.CallContext(ctx, &sig, "account_signTypedData", &addr, td); err != nil {
+		return nil, err
+	}
+	return s.checkSignature(digest, sig)
+}
+
+func (s *ExternalSigner) SignTx(tx *gethTypes.Transaction, chainId *big.Int) (*gethTypes.Transaction, error) {
+	return s.SignTxContext(context.Background(), tx, chainId)
+}
+
+// SignTxContext is SignTx, giving up waiting for the signer when ctx is done.
+func (s *ExternalSigner) SignTxContext(ctx context.Context, tx *gethTypes.Transaction, chainId *big.Int) (*gethTypes.Transaction, error) {
+	data := hexutil.Bytes(tx.Data())
+	var to *common.MixedcaseAddress
+	if tx.To() != nil {
+		t := common.NewMixedcaseAddress(*tx.To())
+		to = &t
+	}
+	args := &apitypes.SendTxArgs{
+		From:  common.NewMixedcaseAddress(s.address),
+		To:    to,
+		Gas:   hexutil.Uint64(tx.Gas()),
+		Value: hexutil.Big(*tx.Value()),
+		Nonce: hexutil.Uint64(tx.Nonce()),
+		Data:  &data,
+	}
+	switch tx.Type() {
+	case gethTypes.LegacyTxType, gethTypes.AccessListTxType:
+		args.GasPrice = (*hexutil.Big)(tx.GasPrice())
+	case gethTypes.DynamicFeeTxType:
+		args.MaxFeePerGas = (*hexutil.Big)(tx.GasFeeCap())
+		args.MaxPriorityFeePerGas = (*hexutil.Big)(tx.GasTipCap())
+	default:
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedTxType, tx.Type())
+	}
+	if chainId != nil && chainId.Sign() != 0 {
+		args.ChainID = (*hexutil.Big)(chainId)
+	}
+	if tx.Type() != gethTypes.LegacyTxType {
+		accessList := tx.AccessList()
+		args.AccessList = &accessList
+	}
+	var res signTransactionResult
+	if err := s.client.CallContext(ctx, &res, "account_signTransaction", args); err != nil {
+		return nil, err
+	}
+	if res.Tx == nil {
+		return nil, errors.New("external signer returned no transaction")
+	}
+	sender, err := gethTypes.Sender(gethTypes.LatestSignerForChainID(res.Tx.ChainId()), res.Tx)
+	if err != nil {
+		return nil, err
+	}
+	if sender != s.address {
+		return nil, fmt.Errorf("%w: %v", ErrSignerAccountMismatch, sender)
+	}
+	return res.Tx, nil
+}
+
+// Close disconnects from the external signer.
+func (s *ExternalSigner) Close() {
+	s.client.Close()
+}
+
+// checkSignature normalizes the recovery id of sig, which Clef returns as 27 or 28, and checks that it was made by
+// the signer account, so a misconfigured signer is detected before its signature reaches a user.
+func (s *ExternalSigner) checkSignature(digest []byte, sig []byte) ([]byte, error) {
+	if len(sig) != 65 {
+		return nil, ErrInvalidSignatureLength
+	}
+	res := append([]byte(nil), sig...)
+	if res[64] >= 27 {
+		res[64] -= 27
+	}
+	signer, err := recoverSigner(digest, res)
+	if err != nil {
+		return nil, err
+	}
+	if signer != s.address {
+		return nil, fmt.Errorf("%w: %v", ErrSignerAccountMismatch, signer)
+	}
+	return res, nil
+}
@@ -0,0 +1,166 @@
+package providers
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"math/big"
+	"net"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	gethTypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/rsksmart/liquidity-provider/stubsigner"
+	"github.com/rsksmart/liquidity-provider/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func startStubSignerHTTP(t *testing.T, keys ...*ecdsa.PrivateKey) string {
+	server, err := stubsigner.NewServer(keys...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(server)
+	t.Cleanup(func() {
+		ts.Close()
+		server.Stop()
+	})
+	return ts.URL
+}
+
+func startStubSignerIPC(t *testing.T, keys ...*ecdsa.PrivateKey) string {
+	server, err := stubsigner.NewServer(keys...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "signer.ipc")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		_ = server.ServeListener(l)
+	}()
+	t.Cleanup(func() {
+		_ = l.Close()
+		server.Stop()
+	})
+	return path
+}
+
+func TestExternalSigner(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := crypto.PubkeyToAddress(key.PublicKey)
+	chainId := big.NewInt(31)
+
+	for name, start := range map[string]func(*testing.T, ...*ecdsa.PrivateKey) string{
+		"http": startStubSignerHTTP,
+		"ipc":  startStubSignerIPC,
+	} {
+		t.Run(name, func(t *testing.T) {
+			s, err := NewExternalSigner(start(t, key))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+			assert.Equal(t, addr, s.Address())
+
+			text := crypto.Keccak256([]byte("quote"))
+			sig, err := s.SignText(text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected, err := crypto.Sign(accounts.TextHash(text), key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, expected, sig)
+
+			td, err := newSchemeTestQuote().TypedData(chainId)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sig, err = s.SignTypedData(td)
+			if err != nil {
+				t.Fatal(err)
+			}
+			digest, _ := td.Hash()
+			signer, err := recoverSigner(digest, sig)
+			assert.Nil(t, err)
+			assert.Equal(t, addr, signer)
+
+			to := common.HexToAddress("0x0000000000000000000000000000000000000002")
+			tx := gethTypes.NewTransaction(7, to, big.NewInt(1000), 21000, big.NewInt(60000000), []byte{1, 2})
+			signed, err := s.SignTx(tx, chainId)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sender, err := gethTypes.Sender(gethTypes.NewEIP155Signer(chainId), signed)
+			assert.Nil(t, err)
+			assert.Equal(t, addr, sender)
+			assert.Equal(t, tx.Nonce(), signed.Nonce())
+			assert.Equal(t, tx.Data(), signed.Data())
+		})
+	}
+}
+
+func TestExternalSignerNoAccounts(t *testing.T) {
+	_, err := NewExternalSigner(startStubSignerHTTP(t))
+	if !errors.Is(err, ErrNoSignerAccounts) {
+		t.Errorf("NewExternalSigner() error = %v, wantErr %v", err, ErrNoSignerAccounts)
+	}
+	_, err = NewExternalSigner(filepath.Join(t.TempDir(), "missing.ipc"))
+	assert.NotNil(t, err)
+}
+
+func TestLocalProviderWithExternalSigner(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := crypto.PubkeyToAddress(key.PublicKey)
+	chainId := big.NewInt(31)
+	endpoint := startStubSignerHTTP(t, key)
+
+	for _, scheme := range []SignatureScheme{SignatureSchemePersonalSign, SignatureSchemeEIP712} {
+		t.Run(string(scheme), func(t *testing.T) {
+			repository := NewInMemRetainedQuotesRepository()
+			repository.SetLiquidity(types.NewWei(200))
+			lp, err := NewLocalProvider(ProviderConfig{
+				ChainId:         chainId,
+				SignatureScheme: scheme,
+				ExternalSigner:  endpoint,
+			}, repository)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, addr.String(), lp.Address())
+
+			q := newSchemeTestQuote()
+			q.LPRSKAddr = lp.Address()
+			sig, err := lp.SignQuoteFromQuote(q, "abc", types.NewWei(100))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := DetectQuoteSignatureScheme(q, chainId, sig)
+			assert.Nil(t, err)
+			assert.Equal(t, scheme, got)
+
+			to := common.HexToAddress("0x0000000000000000000000000000000000000002")
+			tx := gethTypes.NewTransaction(0, to, big.NewInt(1), 21000, big.NewInt(1), nil)
+			signed, err := lp.SignTx(addr, tx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sender, err := gethTypes.Sender(gethTypes.NewEIP155Signer(chainId), signed)
+			assert.Nil(t, err)
+			assert.Equal(t, addr, sender)
+		})
+	}
+}
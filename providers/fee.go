@@ -0,0 +1,363 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/rsksmart/liquidity-provider/types"
+)
+
+// MaxBps is the number of basis points of the whole value.
+const MaxBps = 10000
+
+var (
+	ErrInvalidFeeConfig    = errors.New("invalid fee configuration")
+	ErrNoFeeTier           = errors.New("quote value is above every fee tier")
+	ErrLiquidityRequired   = errors.New("repository does not report its liquidity")
+	ErrUnknownFeeStrategy  = errors.New("unknown fee strategy")
+	ErrInvalidQuoteValue   = errors.New("invalid quote value")
+	ErrInvalidFeeBreakdown = errors.New("invalid fee breakdown")
+)
+
+// FeeStrategy prices the provider fee of a quote, which is charged on top of the gas cost of the call on behalf of
+// the user.
+type FeeStrategy interface {
+	Fee(ctx context.Context, q *types.Quote) (*types.Wei, error)
+}
+
+// FeeSplitter is implemented by the fee strategies that tell the fixed part of the fee apart from the share of the
+// quote value. The whole fee of the other strategies is itemized as fixed.
+type FeeSplitter interface {
+	SplitFee(ctx context.Context, q *types.Quote) (fixed *types.Wei, percentage *types.Wei, err error)
+}
+
+// LiquidityReader reports the liquidity not reserved by retained quotes.
+type LiquidityReader interface {
+	GetLiquidity() (*types.Wei, error)
+}
+
+// PegoutLiquidityReader reports the peg-out liquidity not reserved by retained peg-out quotes.
+type PegoutLiquidityReader interface {
+	GetPegoutLiquidity() (*types.Wei, error)
+}
+
+type FeeStrategyType string
+
+const (
+	FeeStrategyFlat        FeeStrategyType = "flat"
+	FeeStrategyPercentage  FeeStrategyType = "percentage"
+	FeeStrategyTiered      FeeStrategyType = "tiered"
+	FeeStrategyUtilization FeeStrategyType = "utilization"
+)
+
+// FeeConfig selects one of the built-in fee strategies. Only the fields of the selected strategy are used.
+type FeeConfig struct {
+	Strategy FeeStrategyType
+	// Fixed is the fee of the flat strategy
+	Fixed *types.Wei
+	// Bps is the fee of the percentage strategy, in basis points of the quote value
+	Bps uint64
+	// Min and Max bound the fee of the percentage strategy, nil values do not bound it
+	Min *types.Wei
+	Max *types.Wei
+	// Tiers are the value bands of the tiered strategy
+	Tiers []FeeTier
+	// MinBps and MaxBps are the fees of the utilization strategy when no liquidity is reserved and when all of it is
+	MinBps uint64
+	MaxBps uint64
+	// Capacity is the total liquidity the utilization strategy measures the reserved liquidity against
+	Capacity *types.Wei
+}
+
+// FeeTier prices the quotes whose value is up to UpTo, and above the UpTo of the previous tier. A nil UpTo does not
+// bound the last tier.
+type FeeTier struct {
+	UpTo  *types.Wei
+	Fixed *types.Wei
+	Bps   uint64
+}
+
+// NewFeeStrategy returns the strategy selected by cfg. The utilization strategy reads the available liquidity from
+// liquidity, which may be nil for the other strategies.
+func NewFeeStrategy(cfg FeeConfig, liquidity LiquidityReader) (FeeStrategy, error) {
+	switch cfg.Strategy {
+	case FeeStrategyFlat:
+		return NewFlatFee(cfg.Fixed)
+	case FeeStrategyPercentage:
+		return NewPercentageFee(cfg.Bps, cfg.Min, cfg.Max)
+	case FeeStrategyTiered:
+		return NewTieredFee(cfg.Tiers)
+	case FeeStrategyUtilization:
+		return NewUtilizationFee(cfg.MinBps, cfg.MaxBps, cfg.Capacity, liquidity)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownFeeStrategy, cfg.Strategy)
+	}
+}
+
+// FlatFee charges the same fee for every quote.
+type FlatFee struct {
+	fee *types.Wei
+}
+
+func NewFlatFee(fee *types.Wei) (*FlatFee, error) {
+	if err := checkNonNegative("fixed fee", fee); err != nil {
+		return nil, err
+	}
+	return &FlatFee{fee: fee.Copy()}, nil
+}
+
+func (f *FlatFee) Fee(ctx context.Context, q *types.Quote) (*types.Wei, error) {
+	return sumFee(f.SplitFee(ctx, q))
+}
+
+func (f *FlatFee) SplitFee(_ context.Context, _ *types.Quote) (*types.Wei, *types.Wei, error) {
+	return f.fee.Copy(), types.NewWei(0), nil
+}
+
+// PercentageFee charges a share of the quote value, bounded by a minimum and a maximum fee.
+type PercentageFee struct {
+	bps uint64
+	min *types.Wei
+	max *types.Wei
+}
+
+func NewPercentageFee(bps uint64, min *types.Wei, max *types.Wei) (*PercentageFee, error) {
+	if err := checkBps("bps", bps); err != nil {
+		return nil, err
+	}
+	if min != nil {
+		if err := checkNonNegative("min fee", min); err != nil {
+			return nil, err
+		}
+		min = min.Copy()
+	}
+	if max != nil {
+		if err := checkNonNegative("max fee", max); err != nil {
+			return nil, err
+		}
+		max = max.Copy()
+	}
+	if min != nil && max != nil && min.Cmp(max) > 0 {
+		return nil, fmt.Errorf("%w: min fee %v is greater than max fee %v", ErrInvalidFeeConfig, min, max)
+	}
+	return &PercentageFee{bps: bps, min: min, max: max}, nil
+}
+
+func (f *PercentageFee) Fee(ctx context.Context, q *types.Quote) (*types.Wei, error) {
+	return sumFee(f.SplitFee(ctx, q))
+}
+
+// SplitFee itemizes the whole fee as percentage, also when it is bounded by the minimum or the maximum fee.
+func (f *PercentageFee) SplitFee(_ context.Context, q *types.Quote) (*types.Wei, *types.Wei, error) {
+	fee, err := bpsOf(q.Value, new(big.Int).SetUint64(f.bps), big.NewInt(1))
+	if err != nil {
+		return nil, nil, err
+	}
+	if f.min != nil && fee.Cmp(f.min) < 0 {
+		fee = f.min.Copy()
+	}
+	if f.max != nil && fee.Cmp(f.max) > 0 {
+		fee = f.max.Copy()
+	}
+	return types.NewWei(0), fee, nil
+}
+
+// TieredFee charges a fixed fee plus a share of the quote value that depend on the value band of the quote.
+type TieredFee struct {
+	tiers []FeeTier
+}
+
+// NewTieredFee checks that the tiers are sorted by UpTo, and that only the last one is unbounded.
+func NewTieredFee(tiers []FeeTier) (*TieredFee, error) {
+	if len(tiers) == 0 {
+		return nil, fmt.Errorf("%w: at least one fee tier is required", ErrInvalidFeeConfig)
+	}
+	res := make([]FeeTier, len(tiers))
+	for i, tier := range tiers {
+		if tier.UpTo == nil && i != len(tiers)-1 {
+			return nil, fmt.Errorf("%w: only the last fee tier may be unbounded", ErrInvalidFeeConfig)
+		}
+		var upTo *types.Wei
+		if tier.UpTo != nil {
+			if err := checkNonNegative("tier bound", tier.UpTo); err != nil {
+				return nil, err
+			}
+			if i > 0 && tier.UpTo.Cmp(tiers[i-1].UpTo) <= 0 {
+				return nil, fmt.Errorf("%w: fee tier bound %v is not greater than %v", ErrInvalidFeeConfig, tier.UpTo, tiers[i-1].UpTo)
+			}
+			upTo = tier.UpTo.Copy()
+		}
+		fixed := tier.Fixed
+		if fixed == nil {
+			fixed = types.NewWei(0)
+		}
+		if err := checkNonNegative("tier fee", fixed); err != nil {
+			return nil, err
+		}
+		if err := checkBps("tier bps", tier.Bps); err != nil {
+			return nil, err
+		}
+		res[i] = FeeTier{UpTo: upTo, Fixed: fixed.Copy(), Bps: tier.Bps}
+	}
+	return &TieredFee{tiers: res}, nil
+}
+
+func (f *TieredFee) Fee(ctx context.Context, q *types.Quote) (*types.Wei, error) {
+	return sumFee(f.SplitFee(ctx, q))
+}
+
+func (f *TieredFee) SplitFee(_ context.Context, q *types.Quote) (*types.Wei, *types.Wei, error) {
+	if q.Value == nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidQuoteValue, q.Value)
+	}
+	for _, tier := range f.tiers {
+		if tier.UpTo != nil && q.Value.Cmp(tier.UpTo) > 0 {
+			continue
+		}
+		fee, err := bpsOf(q.Value, new(big.Int).SetUint64(tier.Bps), big.NewInt(1))
+		if err != nil {
+			return nil, nil, err
+		}
+		return tier.Fixed.Copy(), fee, nil
+	}
+	return nil, nil, fmt.Errorf("%w: %v", ErrNoFeeTier, q.Value)
+}
+
+// UtilizationFee charges a share of the quote value that rises linearly from minBps to maxBps with the share of the
+// capacity reserved, counting the quote being priced.
+type UtilizationFee struct {
+	minBps    uint64
+	maxBps    uint64
+	capacity  *types.Wei
+	liquidity LiquidityReader
+}
+
+func NewUtilizationFee(minBps uint64, maxBps uint64, capacity *types.Wei, liquidity LiquidityReader) (*UtilizationFee, error) {
+	if err := checkBps("min bps", minBps); err != nil {
+		return nil, err
+	}
+	if err := checkBps("max bps", maxBps); err != nil {
+		return nil, err
+	}
+	if minBps > maxBps {
+		return nil, fmt.Errorf("%w: min bps %v is greater than max bps %v", ErrInvalidFeeConfig, minBps, maxBps)
+	}
+	if capacity == nil || capacity.AsBigInt().Sign() <= 0 {
+		return nil, fmt.Errorf("%w: capacity must be positive", ErrInvalidFeeConfig)
+	}
+	if liquidity == nil {
+		return nil, ErrLiquidityRequired
+	}
+	return &UtilizationFee{minBps: minBps, maxBps: maxBps, capacity: capacity.Copy(), liquidity: liquidity}, nil
+}
+
+func (f *UtilizationFee) Fee(ctx context.Context, q *types.Quote) (*types.Wei, error) {
+	return sumFee(f.SplitFee(ctx, q))
+}
+
+func (f *UtilizationFee) SplitFee(ctx context.Context, q *types.Quote) (*types.Wei, *types.Wei, error) {
+	if q.Value == nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidQuoteValue, q.Value)
+	}
+	available, err := getLiquidity(ctx, f.liquidity)
+	if err != nil {
+		return nil, nil, err
+	}
+	capacity := f.capacity.AsBigInt()
+	// reserved = capacity - available + value, clamped to [0, capacity]
+	reserved := new(big.Int).Sub(capacity, available.AsBigInt())
+	reserved.Add(reserved, q.Value.AsBigInt())
+	if reserved.Sign() < 0 {
+		reserved.SetInt64(0)
+	}
+	if reserved.Cmp(capacity) > 0 {
+		reserved.Set(capacity)
+	}
+	// bps = minBps + (maxBps - minBps) * reserved / capacity, kept as a fraction over capacity
+	num := new(big.Int).Mul(new(big.Int).SetUint64(f.maxBps-f.minBps), reserved)
+	num.Add(num, new(big.Int).Mul(new(big.Int).SetUint64(f.minBps), capacity))
+	fee, err := bpsOf(q.Value, num, capacity)
+	if err != nil {
+		return nil, nil, err
+	}
+	return types.NewWei(0), fee, nil
+}
+
+// splitFee returns the fixed and percentage parts of the fee priced by s.
+func splitFee(ctx context.Context, s FeeStrategy, q *types.Quote) (*types.Wei, *types.Wei, error) {
+	if fs, ok := s.(FeeSplitter); ok {
+		return fs.SplitFee(ctx, q)
+	}
+	fee, err := s.Fee(ctx, q)
+	if err != nil {
+		return nil, nil, err
+	}
+	return fee, types.NewWei(0), nil
+}
+
+func sumFee(fixed *types.Wei, percentage *types.Wei, err error) (*types.Wei, error) {
+	if err != nil {
+		return nil, err
+	}
+	return fixed.Add(fixed, percentage), nil
+}
+
+// bpsOf returns value * num / (den * MaxBps), rounded down.
+func bpsOf(value *types.Wei, num *big.Int, den *big.Int) (*types.Wei, error) {
+	if value == nil || value.AsBigInt().Sign() < 0 {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidQuoteValue, value)
+	}
+	res := new(big.Int).Mul(value.AsBigInt(), num)
+	res.Quo(res, new(big.Int).Mul(den, big.NewInt(MaxBps)))
+	return types.NewBigWei(res), nil
+}
+
+func getLiquidity(ctx context.Context, r LiquidityReader) (*types.Wei, error) {
+	if cr, ok := r.(interface {
+		GetLiquidityContext(ctx context.Context) (*types.Wei, error)
+	}); ok {
+		return cr.GetLiquidityContext(ctx)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return r.GetLiquidity()
+}
+
+// pegoutLiquidity reads the peg-out liquidity of r as the liquidity of a fee strategy, so the utilization strategy
+// prices peg-out quotes by the reservations of the peg-out pool.
+type pegoutLiquidity struct {
+	r PegoutLiquidityReader
+}
+
+func (l pegoutLiquidity) GetLiquidity() (*types.Wei, error) {
+	return l.r.GetPegoutLiquidity()
+}
+
+func (l pegoutLiquidity) GetLiquidityContext(ctx context.Context) (*types.Wei, error) {
+	if cr, ok := l.r.(interface {
+		GetPegoutLiquidityContext(ctx context.Context) (*types.Wei, error)
+	}); ok {
+		return cr.GetPegoutLiquidityContext(ctx)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return l.r.GetPegoutLiquidity()
+}
+
+func checkNonNegative(name string, wei *types.Wei) error {
+	if wei == nil || wei.AsBigInt().Sign() < 0 {
+		return fmt.Errorf("%w: %v must not be negative, got %v", ErrInvalidFeeConfig, name, wei)
+	}
+	return nil
+}
+
+func checkBps(name string, bps uint64) error {
+	if bps > MaxBps {
+		return fmt.Errorf("%w: %v %v is greater than %v", ErrInvalidFeeConfig, name, bps, MaxBps)
+	}
+	return nil
+}
@@ -0,0 +1,300 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/rsksmart/liquidity-provider/types"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeLiquidity struct {
+	available *types.Wei
+	err       error
+}
+
+func (l *fakeLiquidity) GetLiquidity() (*types.Wei, error) {
+	return l.available, l.err
+}
+
+type fakePegoutLiquidity struct {
+	available *types.Wei
+}
+
+func (l *fakePegoutLiquidity) GetPegoutLiquidity() (*types.Wei, error) {
+	return l.available, nil
+}
+
+type feeStrategyFunc func(ctx context.Context, q *types.Quote) (*types.Wei, error)
+
+func (f feeStrategyFunc) Fee(ctx context.Context, q *types.Quote) (*types.Wei, error) {
+	return f(ctx, q)
+}
+
+func quoteOfValue(value int64) *types.Quote {
+	return &types.Quote{Value: types.NewWei(value)}
+}
+
+func assertFees(t *testing.T, strategy FeeStrategy, fees map[int64]int64) {
+	t.Helper()
+	for value, want := range fees {
+		fee, err := strategy.Fee(context.Background(), quoteOfValue(value))
+		if assert.NoError(t, err, "value %v", value) {
+			assert.Equal(t, types.NewWei(want), fee, "value %v", value)
+		}
+	}
+}
+
+func assertSplitFee(t *testing.T, strategy FeeSplitter, value int64, fixed int64, percentage int64) {
+	t.Helper()
+	gotFixed, gotPercentage, err := strategy.SplitFee(context.Background(), quoteOfValue(value))
+	if assert.NoError(t, err, "value %v", value) {
+		assert.Equal(t, types.NewWei(fixed), gotFixed, "value %v", value)
+		assert.Equal(t, types.NewWei(percentage), gotPercentage, "value %v", value)
+	}
+}
+
+func TestFlatFee(t *testing.T) {
+	strategy, err := NewFlatFee(types.NewWei(1000))
+	if assert.NoError(t, err) {
+		assertFees(t, strategy, map[int64]int64{0: 1000, 5000000: 1000})
+		assertSplitFee(t, strategy, 5000000, 1000, 0)
+	}
+	_, err = NewFlatFee(types.NewWei(-1))
+	assert.ErrorIs(t, err, ErrInvalidFeeConfig)
+	_, err = NewFlatFee(nil)
+	assert.ErrorIs(t, err, ErrInvalidFeeConfig)
+}
+
+func TestPercentageFee(t *testing.T) {
+	strategy, err := NewPercentageFee(25, types.NewWei(100), types.NewWei(5000))
+	if assert.NoError(t, err) {
+		// 0.25% of the value, between 100 and 5000
+		assertFees(t, strategy, map[int64]int64{0: 100, 40000: 100, 100000: 250, 2000000: 5000, 3000000: 5000})
+		assertSplitFee(t, strategy, 100000, 0, 250)
+		assertSplitFee(t, strategy, 0, 0, 100)
+	}
+	strategy, err = NewPercentageFee(25, nil, nil)
+	if assert.NoError(t, err) {
+		assertFees(t, strategy, map[int64]int64{0: 0, 399: 0, 400: 1, 3000000: 7500})
+	}
+	_, err = strategy.Fee(context.Background(), quoteOfValue(-1))
+	assert.ErrorIs(t, err, ErrInvalidQuoteValue)
+
+	_, err = NewPercentageFee(MaxBps+1, nil, nil)
+	assert.ErrorIs(t, err, ErrInvalidFeeConfig)
+	_, err = NewPercentageFee(25, types.NewWei(2), types.NewWei(1))
+	assert.ErrorIs(t, err, ErrInvalidFeeConfig)
+}
+
+func TestTieredFee(t *testing.T) {
+	strategy, err := NewTieredFee([]FeeTier{
+		{UpTo: types.NewWei(1000), Fixed: types.NewWei(10)},
+		{UpTo: types.NewWei(100000), Fixed: types.NewWei(20), Bps: 100},
+		{Bps: 50},
+	})
+	if assert.NoError(t, err) {
+		assertFees(t, strategy, map[int64]int64{0: 10, 1000: 10, 1001: 30, 100000: 1020, 100001: 500, 1000000: 5000})
+		assertSplitFee(t, strategy, 100000, 20, 1000)
+	}
+
+	strategy, err = NewTieredFee([]FeeTier{{UpTo: types.NewWei(1000), Fixed: types.NewWei(10)}})
+	if assert.NoError(t, err) {
+		_, err = strategy.Fee(context.Background(), quoteOfValue(1001))
+		assert.ErrorIs(t, err, ErrNoFeeTier)
+	}
+
+	for name, tiers := range map[string][]FeeTier{
+		"no tiers":          nil,
+		"unbounded tier":    {{Bps: 1}, {UpTo: types.NewWei(1)}},
+		"unsorted tiers":    {{UpTo: types.NewWei(2)}, {UpTo: types.NewWei(2)}},
+		"negative fee":      {{UpTo: types.NewWei(2), Fixed: types.NewWei(-1)}},
+		"too many bps":      {{Bps: MaxBps + 1}},
+		"negative boundary": {{UpTo: types.NewWei(-1)}},
+	} {
+		_, err = NewTieredFee(tiers)
+		assert.ErrorIs(t, err, ErrInvalidFeeConfig, name)
+	}
+}
+
+func TestUtilizationFee(t *testing.T) {
+	liquidity := &fakeLiquidity{available: types.NewWei(1000000)}
+	strategy, err := NewUtilizationFee(10, 110, types.NewWei(1000000), liquidity)
+	if !assert.NoError(t, err) {
+		return
+	}
+	// with all the liquidity free, the quote itself is the only reserved liquidity
+	assertFees(t, strategy, map[int64]int64{0: 0, 100000: 200, 500000: 3000, 1000000: 11000})
+	assertSplitFee(t, strategy, 100000, 0, 200)
+
+	liquidity.available = types.NewWei(500000)
+	assertFees(t, strategy, map[int64]int64{100000: 700, 500000: 5500})
+	// quotes above the free liquidity pay the maximum fee
+	liquidity.available = types.NewWei(0)
+	assertFees(t, strategy, map[int64]int64{100000: 1100})
+	// liquidity above the capacity counts as free
+	liquidity.available = types.NewWei(3000000)
+	assertFees(t, strategy, map[int64]int64{100000: 100})
+
+	liquidity.err = errors.New("database is down")
+	_, err = strategy.Fee(context.Background(), quoteOfValue(1))
+	assert.Equal(t, liquidity.err, err)
+
+	_, err = NewUtilizationFee(20, 10, types.NewWei(1), liquidity)
+	assert.ErrorIs(t, err, ErrInvalidFeeConfig)
+	_, err = NewUtilizationFee(10, 20, types.NewWei(0), liquidity)
+	assert.ErrorIs(t, err, ErrInvalidFeeConfig)
+	_, err = NewUtilizationFee(10, 20, types.NewWei(1), nil)
+	assert.ErrorIs(t, err, ErrLiquidityRequired)
+}
+
+func TestNewFeeStrategy(t *testing.T) {
+	var cfg FeeConfig
+	err := json.Unmarshal([]byte(`{"strategy": "percentage", "bps": 25, "min": 100, "max": 5000}`), &cfg)
+	if !assert.NoError(t, err) {
+		return
+	}
+	strategy, err := NewFeeStrategy(cfg, nil)
+	if assert.NoError(t, err) {
+		assertFees(t, strategy, map[int64]int64{100000: 250})
+	}
+
+	strategy, err = NewFeeStrategy(FeeConfig{Strategy: FeeStrategyFlat, Fixed: types.NewWei(7)}, nil)
+	if assert.NoError(t, err) {
+		assertFees(t, strategy, map[int64]int64{100000: 7})
+	}
+	_, err = NewFeeStrategy(FeeConfig{Strategy: FeeStrategyUtilization, MaxBps: 10, Capacity: types.NewWei(1)}, nil)
+	assert.ErrorIs(t, err, ErrLiquidityRequired)
+	_, err = NewFeeStrategy(FeeConfig{Strategy: "auction"}, nil)
+	assert.ErrorIs(t, err, ErrUnknownFeeStrategy)
+}
+
+func TestLocalProviderFeeStrategy(t *testing.T) {
+	repository := NewInMemRetainedQuotesRepository()
+	newProvider := func(cfg ProviderConfig) *LocalProvider {
+		cfg.PenaltyFee = types.NewWei(1000000)
+		ks, acc := newTestKeystoreAccount(t)
+		lp, err := NewLocalProviderWithSigner(cfg, NewKeystoreSigner(ks, acc), repository)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return lp
+	}
+
+	// the configured strategy replaces the flat CallFee, the gas cost is still charged
+	lp := newProvider(ProviderConfig{
+		CallFee: types.NewWei(1000),
+		Fee:     &FeeConfig{Strategy: FeeStrategyPercentage, Bps: 100},
+	})
+	q, err := lp.GetQuote(quoteOfValue(500000), 21000, types.NewWei(2))
+	if assert.NoError(t, err) {
+		assert.Equal(t, types.NewWei(21000*2+5000), q.CallFee)
+		assert.Equal(t, &types.FeeBreakdown{
+			GasCost:       types.NewWei(21000 * 2),
+			FixedFee:      types.NewWei(0),
+			PercentageFee: types.NewWei(5000),
+			NetworkFee:    types.NewWei(0),
+			PenaltyFee:    types.NewWei(1000000),
+		}, q.FeeBreakdown)
+	}
+
+	strategy, err := NewFlatFee(types.NewWei(3))
+	if !assert.NoError(t, err) {
+		return
+	}
+	lp = newProvider(ProviderConfig{
+		CallFee:     types.NewWei(1000),
+		Fee:         &FeeConfig{Strategy: FeeStrategyPercentage, Bps: 100},
+		FeeStrategy: strategy,
+	})
+	q, err = lp.GetQuote(quoteOfValue(500000), 0, types.NewWei(2))
+	if assert.NoError(t, err) {
+		assert.Equal(t, types.NewWei(3), q.CallFee)
+	}
+
+	// strategies that do not split their fee are itemized as fixed, the network fee is charged on top
+	lp = newProvider(ProviderConfig{
+		FeeStrategy: feeStrategyFunc(func(context.Context, *types.Quote) (*types.Wei, error) {
+			return types.NewWei(30), nil
+		}),
+		NetworkFee: types.NewWei(500),
+	})
+	q, err = lp.GetQuote(quoteOfValue(500000), 10, types.NewWei(2))
+	if assert.NoError(t, err) {
+		assert.Equal(t, types.NewWei(20+30+500), q.CallFee)
+		assert.Equal(t, types.NewWei(30), q.FeeBreakdown.FixedFee)
+		assert.Equal(t, types.NewWei(0), q.FeeBreakdown.PercentageFee)
+		assert.Equal(t, types.NewWei(500), q.FeeBreakdown.NetworkFee)
+	}
+
+	// peg-out quotes are priced and itemized the same way, without a flat CallFee configured
+	repository.SetPegoutLiquidity(types.NewWei(1000000))
+	lp = newProvider(ProviderConfig{
+		Fee:        &FeeConfig{Strategy: FeeStrategyPercentage, Bps: 100},
+		NetworkFee: types.NewWei(500),
+	})
+	pq, err := lp.GetPegoutQuote(&types.PegoutQuote{Value: types.NewWei(500000)}, 0, 21000, types.NewWei(2))
+	if assert.NoError(t, err) {
+		assert.Equal(t, types.NewWei(21000*2+5000+500), pq.CallFee)
+		assert.Equal(t, &types.FeeBreakdown{
+			GasCost:       types.NewWei(21000 * 2),
+			FixedFee:      types.NewWei(0),
+			PercentageFee: types.NewWei(5000),
+			NetworkFee:    types.NewWei(500),
+			PenaltyFee:    types.NewWei(1000000),
+		}, pq.FeeBreakdown)
+	}
+	_, err = lp.GetPegoutQuote(&types.PegoutQuote{}, 0, 21000, types.NewWei(2))
+	assert.ErrorIs(t, err, ErrInvalidQuoteValue)
+
+	ks, acc := newTestKeystoreAccount(t)
+	_, err = NewLocalProviderWithSigner(ProviderConfig{Fee: &FeeConfig{Strategy: "auction"}}, NewKeystoreSigner(ks, acc), repository)
+	assert.ErrorIs(t, err, ErrUnknownFeeStrategy)
+	cfg := ProviderConfig{
+		Fee: &FeeConfig{Strategy: FeeStrategyUtilization, MaxBps: 10, Capacity: types.NewWei(1)},
+	}
+	_, err = NewLocalProviderWithSigner(cfg, NewKeystoreSigner(ks, acc), repository)
+	assert.ErrorIs(t, err, ErrLiquidityRequired)
+
+	// the utilization strategy prices peg-out quotes by the peg-out pool, here fully reserved while the peg-in pool
+	// is not reserved at all
+	pools := struct {
+		LocalProviderRepository
+		PegoutLocalProviderRepository
+		LiquidityReader
+		PegoutLiquidityReader
+	}{repository, repository, &fakeLiquidity{available: types.NewWei(1000000)}, &fakePegoutLiquidity{available: types.NewWei(0)}}
+	cfg = ProviderConfig{
+		Fee:        &FeeConfig{Strategy: FeeStrategyUtilization, MinBps: 100, MaxBps: 1000, Capacity: types.NewWei(1000000)},
+		PenaltyFee: types.NewWei(1000000),
+	}
+	lp, err = NewLocalProviderWithSigner(cfg, NewKeystoreSigner(ks, acc), pools)
+	if !assert.NoError(t, err) {
+		return
+	}
+	q, err = lp.GetQuote(quoteOfValue(500000), 0, types.NewWei(2))
+	if assert.NoError(t, err) {
+		// half of the capacity is reserved once the quote is: 100 + (1000 - 100) / 2 bps
+		assert.Equal(t, types.NewWei(27500), q.FeeBreakdown.PercentageFee)
+	}
+	pq, err = lp.GetPegoutQuote(&types.PegoutQuote{Value: types.NewWei(500000)}, 0, 0, types.NewWei(2))
+	if assert.NoError(t, err) {
+		assert.Equal(t, types.NewWei(50000), pq.FeeBreakdown.PercentageFee)
+	}
+
+	// peg-out quotes are not priced by the peg-in pool when the repository does not report the peg-out one
+	lp, err = NewLocalProviderWithSigner(cfg, NewKeystoreSigner(ks, acc), struct {
+		LocalProviderRepository
+		PegoutLocalProviderRepository
+		LiquidityReader
+	}{pools, pools, pools})
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = lp.GetQuote(quoteOfValue(500000), 0, types.NewWei(2))
+	assert.NoError(t, err)
+	_, err = lp.GetPegoutQuote(&types.PegoutQuote{Value: types.NewWei(500000)}, 0, 0, types.NewWei(2))
+	assert.ErrorIs(t, err, ErrLiquidityRequired)
+}
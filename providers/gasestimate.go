@@ -0,0 +1,144 @@
+package providers
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/rsksmart/liquidity-provider/types"
+)
+
+var (
+	ErrGasLimitExceeded         = errors.New("estimated gas exceeds the gas limit of the quote")
+	ErrCallFailed               = errors.New("call on behalf of the user fails")
+	ErrGasEstimationFailed      = errors.New("error estimating gas")
+	ErrInvalidGasEstimateConfig = errors.New("invalid gas estimate configuration")
+)
+
+// GasEstimator estimates the gas of the call the LBC makes on behalf of the user of a quote.
+type GasEstimator interface {
+	EstimateGas(ctx context.Context, q *types.Quote) (uint64, error)
+}
+
+// GasEstimateConfig configures an estimator over the eth_estimateGas method of an RSK node.
+type GasEstimateConfig struct {
+	// RPCURL is the HTTP, WebSocket or IPC endpoint of the node
+	RPCURL string
+	// Multiplier is applied to the estimate of the node as a safety margin, at least 1, defaults to 1
+	Multiplier float64
+}
+
+// NewGasEstimator returns the estimator configured by cfg, giving up connecting to the node when ctx is done.
+func NewGasEstimator(ctx context.Context, cfg GasEstimateConfig) (*CallGasEstimator, error) {
+	if cfg.RPCURL == "" {
+		return nil, fmt.Errorf("%w: node RPC URL is required", ErrInvalidGasEstimateConfig)
+	}
+	client, err := ethclient.DialContext(ctx, cfg.RPCURL)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to the node at %v: %w", cfg.RPCURL, err)
+	}
+	res, err := NewCallGasEstimator(client, cfg)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	res.close = client.Close
+	return res, nil
+}
+
+// CallGasEstimator estimates the call of a quote as callForUser makes it, from the LBC to the contract address, with
+// the eth_estimateGas method of backend. The intrinsic gas of the transaction is not part of the estimate.
+type CallGasEstimator struct {
+	backend    ethereum.GasEstimator
+	multiplier *big.Rat
+	// close closes the client opened by NewGasEstimator
+	close func()
+}
+
+// NewCallGasEstimator estimates with backend, applying the multiplier of cfg.
+func NewCallGasEstimator(backend ethereum.GasEstimator, cfg GasEstimateConfig) (*CallGasEstimator, error) {
+	if backend == nil {
+		return nil, fmt.Errorf("%w: gas estimation backend is required", ErrInvalidGasEstimateConfig)
+	}
+	multiplier, err := parseMultiplier(cfg.Multiplier)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidGasEstimateConfig, err)
+	}
+	// a margin below 1 would underestimate the call, which then runs out of gas
+	if multiplier.Cmp(big.NewRat(1, 1)) < 0 {
+		return nil, fmt.Errorf("%w: multiplier must be at least 1, got %v", ErrInvalidGasEstimateConfig, cfg.Multiplier)
+	}
+	return &CallGasEstimator{backend: backend, multiplier: multiplier}, nil
+}
+
+// Close closes the connection to the node opened by NewGasEstimator.
+func (e *CallGasEstimator) Close() {
+	if e.close != nil {
+		e.close()
+	}
+}
+
+func (e *CallGasEstimator) EstimateGas(ctx context.Context, q *types.Quote) (uint64, error) {
+	msg, err := callMsg(q)
+	if err != nil {
+		return 0, err
+	}
+	gas, err := e.backend.EstimateGas(ctx, msg)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return 0, ctxErr
+		}
+		// reverts are reported by the node, other errors are not the fault of the call
+		var dataErr rpc.DataError
+		if errors.Is(err, vm.ErrExecutionReverted) || errors.As(err, &dataErr) {
+			return 0, fmt.Errorf("%w: %v", ErrCallFailed, err)
+		}
+		return 0, fmt.Errorf("%w: %v", ErrGasEstimationFailed, err)
+	}
+	intrinsic, err := core.IntrinsicGas(msg.Data, nil, false, true, true)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrGasEstimationFailed, err)
+	}
+	if gas > intrinsic {
+		gas -= intrinsic
+	} else {
+		gas = 0
+	}
+	res := mulCeil(new(big.Int).SetUint64(gas), e.multiplier)
+	if !res.IsUint64() {
+		return 0, fmt.Errorf("%w: %v gas overflows", ErrGasEstimationFailed, res)
+	}
+	return res.Uint64(), nil
+}
+
+// callMsg returns the call the LBC makes on behalf of the user of q.
+func callMsg(q *types.Quote) (ethereum.CallMsg, error) {
+	var msg ethereum.CallMsg
+	for field, addr := range map[string]string{"lbcAddr": q.LBCAddr, "contractAddr": q.ContractAddr} {
+		if !common.IsHexAddress(addr) {
+			return msg, fmt.Errorf("invalid %v: %v", field, addr)
+		}
+	}
+	data, err := hex.DecodeString(strings.TrimPrefix(q.Data, "0x"))
+	if err != nil {
+		return msg, fmt.Errorf("invalid data: %v", err)
+	}
+	value := new(big.Int)
+	if q.Value != nil {
+		if q.Value.AsBigInt().Sign() < 0 {
+			return msg, fmt.Errorf("%w: %v", ErrInvalidQuoteValue, q.Value)
+		}
+		value.Set(q.Value.AsBigInt())
+	}
+	contractAddr := common.HexToAddress(q.ContractAddr)
+	return ethereum.CallMsg{From: common.HexToAddress(q.LBCAddr), To: &contractAddr, Value: value, Data: data}, nil
+}
@@ -0,0 +1,135 @@
+package providers
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/rsksmart/liquidity-provider/types"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	testLBCAddr      = common.HexToAddress("0xC52AbEae2f7A6e2E3C5Ab1C2a7E21B6F4A2F1C10")
+	testUserAddr     = common.HexToAddress("0x7986b3DF570230288501EEa3D890bd66948C9B79")
+	testStorerAddr   = common.HexToAddress("0x0000000000000000000000000000000000000a01")
+	testReverterAddr = common.HexToAddress("0x0000000000000000000000000000000000000a02")
+)
+
+// newTestBackend returns a simulated chain where the LBC holds liquidity, and with two contracts: one that stores
+// the first word of its calldata, and one that always reverts.
+func newTestBackend(t *testing.T) *backends.SimulatedBackend {
+	backend := backends.NewSimulatedBackend(core.GenesisAlloc{
+		testLBCAddr: {Balance: new(big.Int).Mul(big.NewInt(100), big.NewInt(params.Ether))},
+		// PUSH1 0 CALLDATALOAD PUSH1 0 SSTORE STOP
+		testStorerAddr: {Code: common.FromHex("0x60003560005500"), Balance: new(big.Int)},
+		// PUSH1 0 PUSH1 0 REVERT
+		testReverterAddr: {Code: common.FromHex("0x60006000fd"), Balance: new(big.Int)},
+	}, 10000000)
+	t.Cleanup(func() {
+		_ = backend.Close()
+	})
+	return backend
+}
+
+func newEstimateTestQuote(contractAddr common.Address, data string, gasLimit uint32) *types.Quote {
+	return &types.Quote{
+		LBCAddr:      testLBCAddr.Hex(),
+		ContractAddr: contractAddr.Hex(),
+		Data:         data,
+		Value:        types.NewWei(1000000),
+		GasLimit:     gasLimit,
+	}
+}
+
+func TestCallGasEstimator(t *testing.T) {
+	backend := newTestBackend(t)
+	estimator, err := NewCallGasEstimator(backend, GasEstimateConfig{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	ctx := context.Background()
+
+	// a value transfer to an account without code costs nothing beyond the intrinsic gas, which the LBC does not pay
+	gas, err := estimator.EstimateGas(ctx, newEstimateTestQuote(testUserAddr, "", 2300))
+	if assert.NoError(t, err) {
+		assert.EqualValues(t, 0, gas)
+	}
+
+	// writing a new storage slot costs more than the slot, but not the intrinsic gas of the calldata
+	data := "0x" + common.Bytes2Hex(common.LeftPadBytes([]byte{1}, 32))
+	stored, err := estimator.EstimateGas(ctx, newEstimateTestQuote(testStorerAddr, data, 100000))
+	if assert.NoError(t, err) {
+		assert.Greater(t, stored, params.SstoreSetGasEIP2200)
+		assert.Less(t, stored, params.TxGas+params.SstoreSetGasEIP2200)
+	}
+
+	_, err = estimator.EstimateGas(ctx, newEstimateTestQuote(testReverterAddr, "", 100000))
+	assert.ErrorIs(t, err, ErrCallFailed)
+	_, err = estimator.EstimateGas(ctx, newEstimateTestQuote(testUserAddr, "zz", 100000))
+	assert.Error(t, err)
+
+	// the safety margin is applied to the estimate, rounding up
+	estimator, err = NewCallGasEstimator(backend, GasEstimateConfig{Multiplier: 1.25})
+	if !assert.NoError(t, err) {
+		return
+	}
+	gas, err = estimator.EstimateGas(ctx, newEstimateTestQuote(testStorerAddr, data, 100000))
+	if assert.NoError(t, err) {
+		assert.EqualValues(t, (stored*5+3)/4, gas)
+	}
+
+	_, err = NewCallGasEstimator(backend, GasEstimateConfig{Multiplier: -1})
+	assert.ErrorIs(t, err, ErrInvalidGasEstimateConfig)
+	_, err = NewCallGasEstimator(backend, GasEstimateConfig{Multiplier: 0.9})
+	assert.ErrorIs(t, err, ErrInvalidGasEstimateConfig)
+	_, err = NewCallGasEstimator(nil, GasEstimateConfig{})
+	assert.ErrorIs(t, err, ErrInvalidGasEstimateConfig)
+	_, err = NewGasEstimator(ctx, GasEstimateConfig{})
+	assert.ErrorIs(t, err, ErrInvalidGasEstimateConfig)
+}
+
+func TestLocalProviderGasEstimator(t *testing.T) {
+	estimator, err := NewCallGasEstimator(newTestBackend(t), GasEstimateConfig{Multiplier: 1.1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks, acc := newTestKeystoreAccount(t)
+	lp, err := NewLocalProviderWithSigner(ProviderConfig{
+		PenaltyFee:   types.NewWei(1000000),
+		GasEstimator: estimator,
+	}, NewKeystoreSigner(ks, acc), NewInMemRetainedQuotesRepository())
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := "0x" + common.Bytes2Hex(common.LeftPadBytes([]byte{1}, 32))
+	estimate, err := estimator.EstimateGas(context.Background(), newEstimateTestQuote(testStorerAddr, data, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// an underestimated gas is raised to the estimate
+	q, err := lp.GetQuote(newEstimateTestQuote(testStorerAddr, data, 100000), 1000, types.NewWei(1))
+	if assert.NoError(t, err) {
+		assert.Equal(t, types.NewUWei(estimate), q.FeeBreakdown.GasCost)
+	}
+	q, err = lp.GetQuote(newEstimateTestQuote(testStorerAddr, data, 100000), 90000, types.NewWei(1))
+	if assert.NoError(t, err) {
+		assert.Equal(t, types.NewWei(90000), q.FeeBreakdown.GasCost)
+	}
+
+	// the intrinsic gas of a transaction is not estimated, so limits below it are accepted
+	q, err = lp.GetQuote(newEstimateTestQuote(testUserAddr, "", 2300), 2300, types.NewWei(1))
+	if assert.NoError(t, err) {
+		assert.Equal(t, types.NewWei(2300), q.FeeBreakdown.GasCost)
+	}
+
+	_, err = lp.GetQuote(newEstimateTestQuote(testStorerAddr, data, uint32(estimate-1)), 0, types.NewWei(1))
+	assert.ErrorIs(t, err, ErrGasLimitExceeded)
+	_, err = lp.GetQuote(newEstimateTestQuote(testReverterAddr, "", 100000), 0, types.NewWei(1))
+	assert.ErrorIs(t, err, ErrCallFailed)
+}
@@ -0,0 +1,209 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/rsksmart/liquidity-provider/types"
+)
+
+// DefaultGasPriceTTL is how long the cached gas price oracle reuses a gas price.
+const DefaultGasPriceTTL = 30 * time.Second
+
+var (
+	ErrGasPriceRequired      = errors.New("gas price is required when no gas price oracle is configured")
+	ErrGasPriceUnavailable   = errors.New("gas price is not available")
+	ErrInvalidGasPriceConfig = errors.New("invalid gas price configuration")
+)
+
+// GasPriceOracle reports the gas price the provider pays for the transactions it sends.
+type GasPriceOracle interface {
+	GasPrice(ctx context.Context) (*types.Wei, error)
+}
+
+// GasPriceConfig configures a cached oracle over the eth_gasPrice method of an RSK node.
+type GasPriceConfig struct {
+	// RPCURL is the HTTP, WebSocket or IPC endpoint of the node
+	RPCURL string
+	// TTL is how long a gas price is reused, defaults to DefaultGasPriceTTL
+	TTL time.Duration
+	// Multiplier is applied to the gas price reported by the node as a safety margin, defaults to 1
+	Multiplier float64
+	// Floor and Ceiling bound the gas price after applying the multiplier, nil values do not bound it
+	Floor   *types.Wei
+	Ceiling *types.Wei
+}
+
+// NewGasPriceOracle returns the cached oracle configured by cfg, giving up connecting to the node when ctx is done.
+func NewGasPriceOracle(ctx context.Context, cfg GasPriceConfig) (*CachedGasPriceOracle, error) {
+	source, err := NewRPCGasPriceOracleContext(ctx, cfg.RPCURL)
+	if err != nil {
+		return nil, err
+	}
+	res, err := NewCachedGasPriceOracle(source, cfg)
+	if err != nil {
+		source.Close()
+		return nil, err
+	}
+	res.close = source.Close
+	return res, nil
+}
+
+// RPCGasPriceOracle reads the gas price from the eth_gasPrice method of an RSK node.
+type RPCGasPriceOracle struct {
+	client *rpc.Client
+}
+
+func NewRPCGasPriceOracle(endpoint string) (*RPCGasPriceOracle, error) {
+	return NewRPCGasPriceOracleContext(context.Background(), endpoint)
+}
+
+// NewRPCGasPriceOracleContext is NewRPCGasPriceOracle, giving up connecting when ctx is done.
+func NewRPCGasPriceOracleContext(ctx context.Context, endpoint string) (*RPCGasPriceOracle, error) {
+	if endpoint == "" {
+		return nil, fmt.Errorf("%w: node RPC URL is required", ErrInvalidGasPriceConfig)
+	}
+	client, err := rpc.DialContext(ctx, endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to the node at %v: %w", endpoint, err)
+	}
+	return &RPCGasPriceOracle{client: client}, nil
+}
+
+func (o *RPCGasPriceOracle) GasPrice(ctx context.Context) (*types.Wei, error) {
+	var res hexutil.Big
+	if err := o.client.CallContext(ctx, &res, "eth_gasPrice"); err != nil {
+		return nil, err
+	}
+	return types.NewBigWei((*big.Int)(&res)), nil
+}
+
+// Close closes the connection to the node.
+func (o *RPCGasPriceOracle) Close() {
+	o.client.Close()
+}
+
+// CachedGasPriceOracle reuses the gas price of another oracle for a while, applying a safety margin to it.
+// Concurrent calls share a single request to the underlying oracle.
+type CachedGasPriceOracle struct {
+	mu         ctxMutex
+	source     GasPriceOracle
+	ttl        time.Duration
+	multiplier *big.Rat
+	floor      *types.Wei
+	ceiling    *types.Wei
+	now        func() time.Time
+	price      *types.Wei
+	expires    time.Time
+	// close closes the source opened by NewGasPriceOracle
+	close func()
+}
+
+// NewCachedGasPriceOracle wraps source with the TTL, multiplier, floor and ceiling of cfg.
+func NewCachedGasPriceOracle(source GasPriceOracle, cfg GasPriceConfig) (*CachedGasPriceOracle, error) {
+	if source == nil {
+		return nil, fmt.Errorf("%w: gas price source is required", ErrInvalidGasPriceConfig)
+	}
+	if cfg.TTL <= 0 {
+		cfg.TTL = DefaultGasPriceTTL
+	}
+	multiplier, err := parseMultiplier(cfg.Multiplier)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidGasPriceConfig, err)
+	}
+	res := &CachedGasPriceOracle{
+		mu:         newCtxMutex(),
+		source:     source,
+		ttl:        cfg.TTL,
+		multiplier: multiplier,
+		now:        time.Now,
+	}
+	if cfg.Floor != nil {
+		if cfg.Floor.AsBigInt().Sign() < 0 {
+			return nil, fmt.Errorf("%w: floor must not be negative, got %v", ErrInvalidGasPriceConfig, cfg.Floor)
+		}
+		res.floor = cfg.Floor.Copy()
+	}
+	if cfg.Ceiling != nil {
+		if cfg.Ceiling.AsBigInt().Sign() < 0 {
+			return nil, fmt.Errorf("%w: ceiling must not be negative, got %v", ErrInvalidGasPriceConfig, cfg.Ceiling)
+		}
+		res.ceiling = cfg.Ceiling.Copy()
+	}
+	if res.floor != nil && res.ceiling != nil && res.floor.Cmp(res.ceiling) > 0 {
+		return nil, fmt.Errorf("%w: floor %v is greater than ceiling %v", ErrInvalidGasPriceConfig, res.floor, res.ceiling)
+	}
+	return res, nil
+}
+
+// Close closes the connection to the node opened by NewGasPriceOracle.
+func (o *CachedGasPriceOracle) Close() {
+	if o.close != nil {
+		o.close()
+	}
+}
+
+func (o *CachedGasPriceOracle) GasPrice(ctx context.Context) (*types.Wei, error) {
+	if err := o.mu.Lock(ctx); err != nil {
+		return nil, err
+	}
+	defer o.mu.Unlock()
+	if o.price != nil && o.now().Before(o.expires) {
+		return o.price.Copy(), nil
+	}
+	price, err := o.source.GasPrice(ctx)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, fmt.Errorf("%w: %v", ErrGasPriceUnavailable, err)
+	}
+	if price == nil || price.AsBigInt().Sign() < 0 {
+		return nil, fmt.Errorf("%w: invalid gas price %v", ErrGasPriceUnavailable, price)
+	}
+	o.price = o.adjust(price)
+	o.expires = o.now().Add(o.ttl)
+	return o.price.Copy(), nil
+}
+
+// adjust applies the multiplier to price, rounding up, and bounds the result by the floor and the ceiling.
+func (o *CachedGasPriceOracle) adjust(price *types.Wei) *types.Wei {
+	adjusted := types.NewBigWei(mulCeil(price.AsBigInt(), o.multiplier))
+	if o.floor != nil && adjusted.Cmp(o.floor) < 0 {
+		return o.floor.Copy()
+	}
+	if o.ceiling != nil && adjusted.Cmp(o.ceiling) > 0 {
+		return o.ceiling.Copy()
+	}
+	return adjusted
+}
+
+// parseMultiplier returns m as an exact fraction, 0 defaults to 1.
+func parseMultiplier(m float64) (*big.Rat, error) {
+	if m == 0 {
+		m = 1
+	}
+	if m < 0 || math.IsNaN(m) || math.IsInf(m, 0) {
+		return nil, fmt.Errorf("multiplier must be positive, got %v", m)
+	}
+	// the shortest decimal representation keeps multipliers such as 1.1 exact
+	res, ok := new(big.Rat).SetString(strconv.FormatFloat(m, 'g', -1, 64))
+	if !ok {
+		return nil, fmt.Errorf("invalid multiplier %v", m)
+	}
+	return res, nil
+}
+
+// mulCeil returns x * r, rounded up.
+func mulCeil(x *big.Int, r *big.Rat) *big.Int {
+	res := new(big.Int).Mul(x, r.Num())
+	res.Add(res, new(big.Int).Sub(r.Denom(), big.NewInt(1)))
+	return res.Quo(res, r.Denom())
+}
@@ -0,0 +1,226 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/rsksmart/liquidity-provider/providers/providerstest"
+	"github.com/rsksmart/liquidity-provider/types"
+	"github.com/stretchr/testify/assert"
+)
+
+type testEthService struct {
+	mu       sync.Mutex
+	gasPrice *big.Int
+}
+
+func (s *testEthService) GasPrice() (*hexutil.Big, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return (*hexutil.Big)(s.gasPrice), nil
+}
+
+func newTestNode(t *testing.T, gasPrice int64) (*testEthService, string) {
+	service := &testEthService{gasPrice: big.NewInt(gasPrice)}
+	server := rpc.NewServer()
+	if err := server.RegisterName("eth", service); err != nil {
+		t.Fatal(err)
+	}
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(func() {
+		httpServer.Close()
+		server.Stop()
+	})
+	return service, httpServer.URL
+}
+
+// newTestWSNode is newTestNode over WebSocket, whose connections, unlike HTTP ones, are closed by rpc.Client.Close.
+func newTestWSNode(t *testing.T, gasPrice int64) string {
+	server := rpc.NewServer()
+	if err := server.RegisterName("eth", &testEthService{gasPrice: big.NewInt(gasPrice)}); err != nil {
+		t.Fatal(err)
+	}
+	httpServer := httptest.NewServer(server.WebsocketHandler([]string{"*"}))
+	t.Cleanup(func() {
+		httpServer.Close()
+		server.Stop()
+	})
+	return "ws" + strings.TrimPrefix(httpServer.URL, "http")
+}
+
+func TestRPCGasPriceOracle(t *testing.T) {
+	_, url := newTestNode(t, 60000000)
+	oracle, err := NewRPCGasPriceOracle(url)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer oracle.Close()
+
+	price, err := oracle.GasPrice(context.Background())
+	if assert.NoError(t, err) {
+		assert.Equal(t, types.NewWei(60000000), price)
+	}
+
+	_, err = NewRPCGasPriceOracle("")
+	assert.ErrorIs(t, err, ErrInvalidGasPriceConfig)
+}
+
+func newTestCachedOracle(t *testing.T, source GasPriceOracle, cfg GasPriceConfig) (*CachedGasPriceOracle, *time.Time) {
+	oracle, err := NewCachedGasPriceOracle(source, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1670441000, 0)
+	oracle.now = func() time.Time { return now }
+	return oracle, &now
+}
+
+func assertGasPrice(t *testing.T, oracle GasPriceOracle, want int64) {
+	t.Helper()
+	price, err := oracle.GasPrice(context.Background())
+	if assert.NoError(t, err) {
+		assert.Equal(t, types.NewWei(want), price)
+	}
+}
+
+func TestCachedGasPriceOracle(t *testing.T) {
+	source := providerstest.NewFakeGasPriceOracle(types.NewWei(100))
+	oracle, now := newTestCachedOracle(t, source, GasPriceConfig{TTL: time.Minute})
+
+	assertGasPrice(t, oracle, 100)
+	source.Set(types.NewWei(200), nil)
+	assertGasPrice(t, oracle, 100)
+	assert.Equal(t, 1, source.Calls())
+
+	*now = now.Add(time.Minute)
+	assertGasPrice(t, oracle, 200)
+	assert.Equal(t, 2, source.Calls())
+
+	// failures are not cached, and the stale price is not served
+	*now = now.Add(time.Minute)
+	source.Set(nil, errors.New("connection refused"))
+	_, err := oracle.GasPrice(context.Background())
+	assert.ErrorIs(t, err, ErrGasPriceUnavailable)
+	source.Set(types.NewWei(-1), nil)
+	_, err = oracle.GasPrice(context.Background())
+	assert.ErrorIs(t, err, ErrGasPriceUnavailable)
+	source.Set(types.NewWei(300), nil)
+	assertGasPrice(t, oracle, 300)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	*now = now.Add(time.Minute)
+	_, err = oracle.GasPrice(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestCachedGasPriceOracleMargins(t *testing.T) {
+	source := providerstest.NewFakeGasPriceOracle(types.NewWei(100))
+	cfg := GasPriceConfig{TTL: time.Nanosecond, Multiplier: 1.1, Floor: types.NewWei(50), Ceiling: types.NewWei(1000)}
+	oracle, now := newTestCachedOracle(t, source, cfg)
+
+	// the multiplied price is rounded up, then bounded by the floor and the ceiling
+	for price, want := range map[int64]int64{100: 110, 10: 50, 0: 50, 909: 1000, 2000: 1000} {
+		*now = now.Add(time.Second)
+		source.Set(types.NewWei(price), nil)
+		assertGasPrice(t, oracle, want)
+	}
+
+	oracle, _ = newTestCachedOracle(t, source, GasPriceConfig{})
+	source.Set(types.NewWei(123), nil)
+	assertGasPrice(t, oracle, 123)
+
+	for name, cfg := range map[string]GasPriceConfig{
+		"negative multiplier": {Multiplier: -1},
+		"negative floor":      {Floor: types.NewWei(-1)},
+		"negative ceiling":    {Ceiling: types.NewWei(-1)},
+		"floor above ceiling": {Floor: types.NewWei(2), Ceiling: types.NewWei(1)},
+	} {
+		_, err := NewCachedGasPriceOracle(source, cfg)
+		assert.ErrorIs(t, err, ErrInvalidGasPriceConfig, name)
+	}
+	_, err := NewCachedGasPriceOracle(nil, GasPriceConfig{})
+	assert.ErrorIs(t, err, ErrInvalidGasPriceConfig)
+}
+
+func TestCachedGasPriceOracleConcurrency(t *testing.T) {
+	source := providerstest.NewFakeGasPriceOracle(types.NewWei(100))
+	oracle, err := NewCachedGasPriceOracle(source, GasPriceConfig{TTL: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assertGasPrice(t, oracle, 100)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 1, source.Calls())
+}
+
+func TestNewGasPriceOracle(t *testing.T) {
+	node, url := newTestNode(t, 100)
+	oracle, err := NewGasPriceOracle(context.Background(), GasPriceConfig{RPCURL: url, Multiplier: 1.5})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assertGasPrice(t, oracle, 150)
+	node.mu.Lock()
+	node.gasPrice = big.NewInt(200)
+	node.mu.Unlock()
+	assertGasPrice(t, oracle, 150)
+
+	_, err = NewGasPriceOracle(context.Background(), GasPriceConfig{RPCURL: url, Multiplier: -1})
+	assert.ErrorIs(t, err, ErrInvalidGasPriceConfig)
+
+	oracle, err = NewGasPriceOracle(context.Background(), GasPriceConfig{RPCURL: newTestWSNode(t, 100)})
+	if assert.NoError(t, err) {
+		oracle.Close()
+		_, err = oracle.GasPrice(context.Background())
+		assert.ErrorIs(t, err, ErrGasPriceUnavailable)
+	}
+}
+
+func TestLocalProviderClose(t *testing.T) {
+	url := newTestWSNode(t, 100)
+	ks, acc := newTestKeystoreAccount(t)
+	lp, err := NewLocalProviderWithSigner(ProviderConfig{
+		CallFee:     types.NewWei(1),
+		PenaltyFee:  types.NewWei(1),
+		GasPrice:    &GasPriceConfig{RPCURL: url, TTL: time.Nanosecond},
+		GasEstimate: &GasEstimateConfig{RPCURL: url},
+	}, NewKeystoreSigner(ks, acc), NewInMemRetainedQuotesRepository())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the oracle and the estimator connections are closed
+	assert.Len(t, lp.closers, 2)
+	_, err = lp.GetPegoutQuote(&types.PegoutQuote{}, 0, 21000, nil)
+	assert.NoError(t, err)
+	lp.Close()
+	_, err = lp.GetPegoutQuote(&types.PegoutQuote{}, 0, 21000, nil)
+	assert.ErrorIs(t, err, ErrGasPriceUnavailable)
+	// closing again does nothing
+	lp.Close()
+
+	// the oracle passed to the provider is left open
+	lp, err = NewLocalProviderWithSigner(ProviderConfig{
+		PenaltyFee:     types.NewWei(1),
+		GasPriceOracle: providerstest.NewFakeGasPriceOracle(types.NewWei(3)),
+	}, NewKeystoreSigner(ks, acc), NewInMemRetainedQuotesRepository())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, lp.closers)
+}
@@ -0,0 +1,151 @@
+package providers
+
+import (
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/tyler-smith/go-bip39"
+)
+
+const (
+	// RSKDerivationPath is the BIP-44 path of the first RSK mainnet account, coin type 137
+	RSKDerivationPath = "m/44'/137'/0'/0/0"
+	// EthereumDerivationPath is the BIP-44 path of the first Ethereum account, coin type 60
+	EthereumDerivationPath = "m/44'/60'/0'/0/0"
+)
+
+var (
+	ErrInvalidMnemonic   = errors.New("invalid mnemonic")
+	ErrInvalidPrivateKey = errors.New("invalid private key")
+	ErrUnusableChildKey  = errors.New("derivation path results in an invalid key, use the next index")
+)
+
+// NewAccount creates a new account in the keystore, encrypted with passwd.
+func NewAccount(ks *keystore.KeyStore, passwd string) (accounts.Account, error) {
+	if err := validatePasswd(passwd); err != nil {
+		return accounts.Account{}, err
+	}
+	return ks.NewAccount(passwd)
+}
+
+// ImportPrivateKey stores the hex encoded private key in the keystore, encrypted with passwd.
+func ImportPrivateKey(ks *keystore.KeyStore, hexKey string, passwd string) (accounts.Account, error) {
+	if err := validatePasswd(passwd); err != nil {
+		return accounts.Account{}, err
+	}
+	key, err := crypto.HexToECDSA(strings.TrimPrefix(strings.TrimSpace(hexKey), "0x"))
+	if err != nil {
+		// the error of HexToECDSA is not wrapped, as it may include part of the key
+		return accounts.Account{}, ErrInvalidPrivateKey
+	}
+	defer zeroKey(key)
+	return ks.ImportECDSA(key, passwd)
+}
+
+// ImportMnemonic derives the key at path from the BIP-39 mnemonic and optional passphrase, and stores it in the
+// keystore encrypted with passwd.
+func ImportMnemonic(ks *keystore.KeyStore, mnemonic string, passphrase string, path string, passwd string) (accounts.Account, error) {
+	if err := validatePasswd(passwd); err != nil {
+		return accounts.Account{}, err
+	}
+	key, err := DeriveKeyFromMnemonic(mnemonic, passphrase, path)
+	if err != nil {
+		return accounts.Account{}, err
+	}
+	defer zeroKey(key)
+	return ks.ImportECDSA(key, passwd)
+}
+
+// ExportAccount returns the keystore JSON of the account with address addr, re-encrypted with newPasswd.
+func ExportAccount(ks *keystore.KeyStore, addr string, passwd string, newPasswd string) ([]byte, error) {
+	if err := validatePasswd(newPasswd); err != nil {
+		return nil, err
+	}
+	acc, err := findAccount(ks, addr)
+	if err != nil {
+		return nil, err
+	}
+	keyJSON, err := ks.Export(*acc, passwd, newPasswd)
+	if errors.Is(err, keystore.ErrDecrypt) {
+		return nil, fmt.Errorf("%w: %v", ErrWrongPassword, addr)
+	}
+	return keyJSON, err
+}
+
+// DeriveKeyFromMnemonic derives the BIP-32 key at path, e.g. RSKDerivationPath, from the seed of the BIP-39 mnemonic.
+func DeriveKeyFromMnemonic(mnemonic string, passphrase string, path string) (*ecdsa.PrivateKey, error) {
+	mnemonic = strings.Join(strings.Fields(mnemonic), " ")
+	seed, err := bip39.NewSeedWithErrorChecking(mnemonic, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidMnemonic, err)
+	}
+	dp, err := accounts.ParseDerivationPath(path)
+	if err != nil {
+		return nil, err
+	}
+	return deriveKey(seed, dp)
+}
+
+// deriveKey derives the BIP-32 key at path from the master key of seed.
+func deriveKey(seed []byte, path accounts.DerivationPath) (*ecdsa.PrivateKey, error) {
+	mac := hmac.New(sha512.New, []byte("Bitcoin seed"))
+	mac.Write(seed)
+	sum := mac.Sum(nil)
+	k, chainCode := new(big.Int).SetBytes(sum[:32]), sum[32:]
+	if k.Sign() == 0 || k.Cmp(crypto.S256().Params().N) >= 0 {
+		return nil, ErrUnusableChildKey
+	}
+	var err error
+	for _, index := range path {
+		if k, chainCode, err = deriveChild(k, chainCode, index); err != nil {
+			return nil, err
+		}
+	}
+	return crypto.ToECDSA(common.LeftPadBytes(k.Bytes(), 32))
+}
+
+// deriveChild implements the BIP-32 private parent key to private child key derivation.
+func deriveChild(k *big.Int, chainCode []byte, index uint32) (*big.Int, []byte, error) {
+	var data []byte
+	if index >= 0x80000000 {
+		data = append([]byte{0}, common.LeftPadBytes(k.Bytes(), 32)...)
+	} else {
+		x, y := crypto.S256().ScalarBaseMult(common.LeftPadBytes(k.Bytes(), 32))
+		data = crypto.CompressPubkey(&ecdsa.PublicKey{Curve: crypto.S256(), X: x, Y: y})
+	}
+	var i [4]byte
+	binary.BigEndian.PutUint32(i[:], index)
+	data = append(data, i[:]...)
+
+	mac := hmac.New(sha512.New, chainCode)
+	mac.Write(data)
+	sum := mac.Sum(nil)
+	n := crypto.S256().Params().N
+	il := new(big.Int).SetBytes(sum[:32])
+	if il.Cmp(n) >= 0 {
+		return nil, nil, ErrUnusableChildKey
+	}
+	child := il.Add(il, k)
+	child.Mod(child, n)
+	if child.Sign() == 0 {
+		return nil, nil, ErrUnusableChildKey
+	}
+	return child, sum[32:], nil
+}
+
+func zeroKey(k *ecdsa.PrivateKey) {
+	b := k.D.Bits()
+	for i := range b {
+		b[i] = 0
+	}
+}
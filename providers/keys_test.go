@@ -0,0 +1,153 @@
+package providers
+
+import (
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+)
+
+const testMnemonic = "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+
+func TestDeriveKey(t *testing.T) {
+	// BIP-32 test vector 1
+	seed, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "m/0'/1", want: "3c6cb8d0f6a264c91ea8b5030fadaa8e538b020f0a387421a12de9319dc93368"},
+		{path: "m/0'/1/2'", want: "cbce0d719ecf7431d88e6a89fa1483e02e35092af60c042b1df2ff59fa424dca"},
+		{path: "m/0'/1/2'/2", want: "0f479245fb19a38a1954c5c7c0ebab2f9bdfd96a17563ef28a6a4b1a2a764ef4"},
+		{path: "m/0'/1/2'/2/1000000000", want: "471b76e389e528d6de6d816857e012c5455051cad6660850e58372a6c3e6e7c8"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			dp, err := accounts.ParseDerivationPath(tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			key, err := deriveKey(seed, dp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := hex.EncodeToString(crypto.FromECDSA(key)); got != tt.want {
+				t.Errorf("deriveKey() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeriveKeyFromMnemonic(t *testing.T) {
+	tests := []struct {
+		name       string
+		mnemonic   string
+		passphrase string
+		path       string
+		want       string
+		wantErr    error
+		wantAnyErr bool
+	}{
+		{
+			name:     "ethereum path",
+			mnemonic: testMnemonic,
+			path:     EthereumDerivationPath,
+			want:     "0x9858EfFD232B4033E47d90003D41EC34EcaEda94",
+		},
+		{
+			name:     "extra whitespace",
+			mnemonic: "  abandon abandon abandon abandon abandon abandon\nabandon abandon abandon abandon abandon about ",
+			path:     EthereumDerivationPath,
+			want:     "0x9858EfFD232B4033E47d90003D41EC34EcaEda94",
+		},
+		{
+			name:     "invalid checksum",
+			mnemonic: "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon",
+			path:     EthereumDerivationPath,
+			wantErr:  ErrInvalidMnemonic,
+		},
+		{
+			name:       "invalid path",
+			mnemonic:   testMnemonic,
+			path:       "m/44'/abc",
+			wantAnyErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := DeriveKeyFromMnemonic(tt.mnemonic, tt.passphrase, tt.path)
+			if tt.wantErr != nil || tt.wantAnyErr {
+				if err == nil {
+					t.Fatal("DeriveKeyFromMnemonic() did not fail")
+				}
+				if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+					t.Errorf("DeriveKeyFromMnemonic() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := crypto.PubkeyToAddress(key.PublicKey).Hex(); got != tt.want {
+				t.Errorf("DeriveKeyFromMnemonic() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// the RSK coin type and the passphrase result in different accounts
+	eth, _ := DeriveKeyFromMnemonic(testMnemonic, "", EthereumDerivationPath)
+	rsk, err := DeriveKeyFromMnemonic(testMnemonic, "", RSKDerivationPath)
+	assert.Nil(t, err)
+	withPassphrase, err := DeriveKeyFromMnemonic(testMnemonic, "TREZOR", RSKDerivationPath)
+	assert.Nil(t, err)
+	assert.NotEqual(t, eth.D, rsk.D)
+	assert.NotEqual(t, rsk.D, withPassphrase.D)
+}
+
+func TestImportExportAccount(t *testing.T) {
+	ks := keystore.NewKeyStore(t.TempDir(), keystore.LightScryptN, keystore.LightScryptP)
+	const hexKey = "0x4c0883a69102937d6231471b5dbb6204fe5129617082792ae468d01a3f362318"
+
+	_, err := ImportPrivateKey(ks, hexKey, "weak")
+	assert.ErrorIs(t, err, ErrWeakPassword)
+	_, err = ImportPrivateKey(ks, "0x1234", testPasswd)
+	assert.ErrorIs(t, err, ErrInvalidPrivateKey)
+
+	acc, err := ImportPrivateKey(ks, hexKey, testPasswd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "0x2c7536E3605D9C16a7a3D7b1898e529396a65c23", acc.Address.Hex())
+	_, err = ImportPrivateKey(ks, hexKey, testPasswd)
+	assert.ErrorIs(t, err, keystore.ErrAccountAlreadyExists)
+
+	acc, err = ImportMnemonic(ks, testMnemonic, "", EthereumDerivationPath, testPasswd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "0x9858EfFD232B4033E47d90003D41EC34EcaEda94", acc.Address.Hex())
+	_, err = ImportMnemonic(ks, testMnemonic, "", RSKDerivationPath, "weak")
+	assert.ErrorIs(t, err, ErrWeakPassword)
+
+	const newPasswd = "staple battery horse correct"
+	_, err = ExportAccount(ks, acc.Address.Hex(), testPasswd, "weak")
+	assert.ErrorIs(t, err, ErrWeakPassword)
+	_, err = ExportAccount(ks, acc.Address.Hex(), "wrong horse battery staple", newPasswd)
+	assert.ErrorIs(t, err, ErrWrongPassword)
+	_, err = ExportAccount(ks, "0x0000000000000000000000000000000000000001", testPasswd, newPasswd)
+	assert.ErrorIs(t, err, ErrAccountNotFound)
+
+	keyJSON, err := ExportAccount(ks, acc.Address.Hex(), testPasswd, newPasswd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := keystore.DecryptKey(keyJSON, newPasswd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, acc.Address, key.Address)
+}
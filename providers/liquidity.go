@@ -2,15 +2,16 @@ package providers
 
 import (
 	"bufio"
+	"context"
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"math"
 	"math/big"
 	"math/rand"
 	"os"
 	"sort"
 	"strings"
-	"sync"
 	"syscall"
 	"time"
 
@@ -20,32 +21,143 @@ import (
 	"github.com/ethereum/go-ethereum/accounts/keystore"
 	"github.com/ethereum/go-ethereum/common"
 	gethTypes "github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/rsksmart/liquidity-provider/types"
 	log "github.com/sirupsen/logrus"
 	passwordvalidator "github.com/wagslane/go-password-validator"
 	"golang.org/x/term"
 )
 
+var (
+	ErrPegoutNotSupported  = errors.New("provider repository does not support peg-out quotes")
+	ErrAccountNotFound     = errors.New("account not found")
+	ErrWeakPassword        = errors.New("password is not secure enough")
+	ErrWrongPassword       = errors.New("wrong account password")
+	ErrPasswordMismatch    = errors.New("passwords do not match")
+	ErrNotConfirmed        = errors.New("must say yes")
+	ErrSignerRequired      = errors.New("peg-in signer is required")
+	ErrChainIdRequired     = errors.New("chain id is required by the EIP-712 signature scheme")
+	ErrExpireBlockOverflow = errors.New("peg-out quote expire block overflows")
+	ErrSignedValueStore    = errors.New("the signing policy max signed value requires a repository implementing SignedValueRepository")
+)
+
 type LiquidityProvider interface {
 	Address() string
 	GetQuote(*types.Quote, uint64, *types.Wei) (*types.Quote, error)
 	SignQuote(hash []byte, depositAddr string, reqLiq *types.Wei) ([]byte, error)
+	SignQuoteFromQuote(q *types.Quote, depositAddr string, reqLiq *types.Wei) ([]byte, error)
 	SignTx(common.Address, *gethTypes.Transaction) (*gethTypes.Transaction, error)
 }
 
+type PegoutLiquidityProvider interface {
+	PegoutAddress() string
+	GetPegoutQuote(q *types.PegoutQuote, lastBlock uint64, gas uint64, gasPrice *types.Wei) (*types.PegoutQuote, error)
+	SignPegoutQuote(hash []byte, reqLiq *types.Wei) ([]byte, error)
+	SignPegoutQuoteFromQuote(q *types.PegoutQuote, reqLiq *types.Wei) ([]byte, error)
+}
+
 type LocalProviderRepository interface {
-	RetainQuote(rq *types.RetainedQuote) error
 	HasRetainedQuote(hash string) (bool, error)
 	HasLiquidity(lp LiquidityProvider, wei *types.Wei) (bool, error)
+	// ReserveLiquidity atomically retains rq if rq.ReqLiq is available, returning *ErrInsufficientLiquidity or
+	// *ErrInvalidReqLiq otherwise. Reserving a retained quote again is a no-op.
+	ReserveLiquidity(rq *types.RetainedQuote) error
+}
+
+type PegoutLocalProviderRepository interface {
+	HasRetainedPegoutQuote(hash string) (bool, error)
+	HasPegoutLiquidity(lp PegoutLiquidityProvider, wei *types.Wei) (bool, error)
+	// ReservePegoutLiquidity behaves as LocalProviderRepository.ReserveLiquidity for peg-out quotes.
+	ReservePegoutLiquidity(rq *types.RetainedPegoutQuote) error
+}
+
+var (
+	ErrRetainedQuoteNotFound        = errors.New("retained quote not found")
+	ErrUnexpectedRetainedQuoteState = errors.New("retained quote is not in the expected state")
+	ErrQuoteNotFound                = errors.New("quote not found")
+)
+
+type RetainedQuoteStateRepository interface {
+	GetRetainedQuotes(states ...types.RQState) ([]*types.RetainedQuote, error)
+	// UpdateRetainedQuoteState moves the retained quote to newState, only if it is still in oldState. It returns
+	// ErrRetainedQuoteNotFound, ErrUnexpectedRetainedQuoteState or *types.ErrInvalidStateTransition otherwise.
+	UpdateRetainedQuoteState(hash string, oldState types.RQState, newState types.RQState) error
+}
+
+// QuoteRepository stores the quotes signed by the provider along with their reservation.
+type QuoteRepository interface {
+	// InsertQuote stores q under hash, failing if a quote is already stored under hash.
+	InsertQuote(hash string, q *types.Quote) error
+	// GetQuote returns the quote stored under hash, or ErrQuoteNotFound.
+	GetQuote(hash string) (*types.Quote, error)
+	// ReserveQuoteLiquidity is ReserveLiquidity, also storing q under rq.QuoteHash in the same transaction.
+	ReserveQuoteLiquidity(q *types.Quote, rq *types.RetainedQuote) error
+}
+
+// PegoutQuoteRepository behaves as QuoteRepository for peg-out quotes.
+type PegoutQuoteRepository interface {
+	InsertPegoutQuote(hash string, q *types.PegoutQuote) error
+	GetPegoutQuote(hash string) (*types.PegoutQuote, error)
+	ReservePegoutQuoteLiquidity(q *types.PegoutQuote, rq *types.RetainedPegoutQuote) error
+}
+
+// RetainedPegoutQuoteStateRepository behaves as RetainedQuoteStateRepository for retained peg-out quotes.
+type RetainedPegoutQuoteStateRepository interface {
+	GetRetainedPegoutQuotes(states ...types.RQState) ([]*types.RetainedPegoutQuote, error)
+	UpdateRetainedPegoutQuoteState(hash string, oldState types.RQState, newState types.RQState) error
+}
+
+type ErrInsufficientLiquidity struct {
+	Required  *types.Wei
+	Available *types.Wei
+}
+
+func (e *ErrInsufficientLiquidity) Error() string {
+	if e.Available == nil {
+		return fmt.Sprintf("not enough liquidity. required: %v", e.Required)
+	}
+	return fmt.Sprintf("not enough liquidity. required: %v, available: %v", e.Required, e.Available)
+}
+
+type ErrInvalidReqLiq struct {
+	ReqLiq *types.Wei
+}
+
+func (e *ErrInvalidReqLiq) Error() string {
+	return fmt.Sprintf("invalid required liquidity: %v", e.ReqLiq)
+}
+
+// CheckReqLiq returns *ErrInvalidReqLiq unless reqLiq is zero or positive.
+func CheckReqLiq(reqLiq *types.Wei) error {
+	if reqLiq == nil {
+		return &ErrInvalidReqLiq{}
+	}
+	if reqLiq.AsBigInt().Sign() < 0 {
+		return &ErrInvalidReqLiq{ReqLiq: reqLiq.Copy()}
+	}
+	return nil
 }
 
 type LocalProvider struct {
-	mu         sync.Mutex
-	account    *accounts.Account
-	ks         *keystore.KeyStore
-	cfg        ProviderConfig
-	repository LocalProviderRepository
+	// mu serializes the liquidity reservations
+	mu               ctxMutex
+	account          *accounts.Account
+	ks               *keystore.KeyStore
+	signer           Signer
+	pegoutSigner     Signer
+	signers          map[common.Address]Signer
+	policy           *PolicyEngine
+	fees             FeeStrategy
+	pegoutFees       FeeStrategy
+	confirmations    ConfirmationsTable
+	gasPrices        GasPriceOracle
+	gasEstimator     GasEstimator
+	cfg              ProviderConfig
+	repository       LocalProviderRepository
+	pegoutRepository PegoutLocalProviderRepository
+	quotes           QuoteRepository
+	pegoutQuotes     PegoutQuoteRepository
+	// closers close the connections opened by the provider from its configuration
+	closers []func()
 }
 
 type ProviderConfig struct {
@@ -55,52 +167,374 @@ type ProviderConfig struct {
 	PwdFile        string
 	ChainId        *big.Int
 	MaxConf        uint16
-	Confirmations  map[int]uint16
+	Confirmations  ConfirmationsTable
 	TimeForDeposit uint32
 	CallTime       uint32
 	CallFee        *types.Wei
 	PenaltyFee     *types.Wei
+	// AccountAddr is the RSK address of the account that signs peg-in quotes, AccountNum is used when empty
+	AccountAddr string
+	// PegoutAccountAddr is the RSK address of the account that signs peg-out quotes, defaults to AccountAddr
+	PegoutAccountAddr string
+	// ExtraAccountAddrs are unlocked to sign what was issued for them, e.g. while rotating keys
+	ExtraAccountAddrs []string
+	// PasswordSource provides the keystore password, taking precedence over the other password settings
+	PasswordSource SecretSource
+	// PasswordEnv is the name of the environment variable holding the keystore password
+	PasswordEnv string
+	// PasswordFile is the path of a file holding the keystore password, only readable by its owner
+	PasswordFile string
+	// PasswordFD is a file descriptor the keystore password is read from, 0 disables it
+	PasswordFD uintptr
+	// SignatureScheme selects how quotes are signed, defaults to SignatureSchemePersonalSign
+	SignatureScheme SignatureScheme
+	// ExternalSigner is the HTTP URL or IPC path of a Clef compatible signer, the keystore is not used when set
+	ExternalSigner string
+	// Policy restricts what the provider signs, nothing is restricted when nil
+	Policy *SigningPolicy
+	// FeeStrategy prices the provider fee of quotes, taking precedence over Fee, CallFee is charged otherwise
+	FeeStrategy FeeStrategy
+	// Fee selects one of the built-in fee strategies
+	Fee *FeeConfig
+	// NetworkFee is the network fee charged in the call fee of quotes, e.g. for the registerPegIn transaction
+	NetworkFee *types.Wei
+	// GasPriceOracle prices the gas of the quotes, taking precedence over GasPrice
+	GasPriceOracle GasPriceOracle
+	// GasPrice configures an oracle over the eth_gasPrice method of an RSK node
+	GasPrice *GasPriceConfig
+	// GasEstimator estimates the call on behalf of the user of peg-in quotes, taking precedence over GasEstimate
+	GasEstimator GasEstimator
+	// GasEstimate configures an estimator over the eth_estimateGas method of an RSK node
+	GasEstimate *GasEstimateConfig
+	// ReserveTimeout bounds the time a reservation holds the provider lock, defaults to DefaultReserveTimeout
+	ReserveTimeout time.Duration
+
+	PegoutDepositTime           uint32
+	PegoutTransferTime          uint32
+	PegoutExpireTime            uint32
+	PegoutExpireBlocks          uint32
+	PegoutDepositConfirmations  uint16
+	PegoutTransferConfirmations uint16
 }
 
 func NewLocalProvider(config ProviderConfig, repository LocalProviderRepository) (*LocalProvider, error) {
+	return NewLocalProviderContext(context.Background(), config, repository)
+}
+
+// NewLocalProviderContext is NewLocalProvider, giving up connecting to the external signer or unlocking the keystore
+// accounts when ctx is done.
+func NewLocalProviderContext(ctx context.Context, config ProviderConfig, repository LocalProviderRepository) (*LocalProvider, error) {
+	if err := validateSignatureScheme(&config); err != nil {
+		return nil, err
+	}
+	if config.ExternalSigner != "" {
+		signers, err := externalSigners(ctx, config)
+		if err != nil {
+			return nil, err
+		}
+		return buildLocalProvider(ctx, config, signers, nil, repository)
+	}
 	if config.Keydir == "" {
 		config.Keydir = "keystore"
 	}
 	if err := os.MkdirAll(config.Keydir, 0700); err != nil {
 		return nil, err
 	}
+	source := config.PasswordSecretSource()
+	// PwdFile is only read when no source takes precedence, so it is not opened otherwise
 	var f *os.File
-	if config.PwdFile != "" {
+	if source == nil && config.PwdFile != "" {
 		var err error
 		f, err = os.Open(config.PwdFile)
 		if err != nil {
-			return nil, fmt.Errorf("error opening file: %v", config.PwdFile)
+			return nil, fmt.Errorf("error opening password file %v: %w", config.PwdFile, err)
 		}
 		defer func(f *os.File) {
 			_ = f.Close()
 		}(f)
 	}
 
+	if source != nil {
+		log.Info("reading keystore password from ", source)
+	}
 	ks := keystore.NewKeyStore(config.Keydir, keystore.StandardScryptN, keystore.StandardScryptP)
-	acc, err := retrieveOrCreateAccount(ks, config.AccountNum, f)
+	acc, passwd, err := retrieveOrCreateAccount(ks, config.AccountAddr, config.AccountNum, source, f)
+
+	if err != nil {
+		return nil, err
+	}
+	signers := Signers{Pegin: NewKeystoreSigner(ks, *acc)}
+	if config.PegoutAccountAddr != "" {
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+		acc, err := unlockAccount(ks, config.PegoutAccountAddr, passwd)
+		if err != nil {
+			return nil, err
+		}
+		signers.Pegout = NewKeystoreSigner(ks, *acc)
+	}
+	for _, addr := range config.ExtraAccountAddrs {
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+		acc, err := unlockAccount(ks, addr, passwd)
+		if err != nil {
+			return nil, err
+		}
+		signers.Extra = append(signers.Extra, NewKeystoreSigner(ks, *acc))
+	}
+	return buildLocalProvider(ctx, config, signers, ks, repository)
+}
+
+// Signers are the accounts a provider signs with.
+type Signers struct {
+	// Pegin signs peg-in quotes
+	Pegin Signer
+	// Pegout signs peg-out quotes, Pegin is used when nil
+	Pegout Signer
+	// Extra signers only sign quotes and transactions issued for their own accounts
+	Extra []Signer
+}
 
+// NewLocalProviderWithSigner returns a provider that signs quotes and transactions with signer. The keystore
+// settings of config are ignored.
+func NewLocalProviderWithSigner(config ProviderConfig, signer Signer, repository LocalProviderRepository) (*LocalProvider, error) {
+	return NewLocalProviderWithSigners(config, Signers{Pegin: signer}, repository)
+}
+
+// NewLocalProviderWithSigners returns a provider that signs with the signer of each account.
+func NewLocalProviderWithSigners(config ProviderConfig, signers Signers, repository LocalProviderRepository) (*LocalProvider, error) {
+	if err := validateSignatureScheme(&config); err != nil {
+		return nil, err
+	}
+	if signers.Pegin == nil {
+		return nil, ErrSignerRequired
+	}
+	return buildLocalProvider(context.Background(), config, signers, nil, repository)
+}
+
+func buildLocalProvider(ctx context.Context, config ProviderConfig, signers Signers, ks *keystore.KeyStore, repository LocalProviderRepository) (*LocalProvider, error) {
+	fees, err := feeStrategy(config, repository)
+	if err != nil {
+		return nil, err
+	}
+	pegoutFees, err := pegoutFeeStrategy(config, repository, fees)
+	if err != nil {
+		return nil, err
+	}
+	confirmations, err := config.Confirmations.Check(config.MaxConf)
 	if err != nil {
 		return nil, err
 	}
+	policy, err := policyEngine(config, repository)
+	if err != nil {
+		return nil, err
+	}
+	var closers []func()
+	gasPrices := config.GasPriceOracle
+	if gasPrices == nil && config.GasPrice != nil {
+		oracle, err := NewGasPriceOracle(ctx, *config.GasPrice)
+		if err != nil {
+			return nil, err
+		}
+		gasPrices = oracle
+		closers = append(closers, oracle.Close)
+	}
+	gasEstimator := config.GasEstimator
+	if gasEstimator == nil && config.GasEstimate != nil {
+		estimator, err := NewGasEstimator(ctx, *config.GasEstimate)
+		if err != nil {
+			closeAll(closers)
+			return nil, err
+		}
+		gasEstimator = estimator
+		closers = append(closers, estimator.Close)
+	}
+	if signers.Pegout == nil {
+		signers.Pegout = signers.Pegin
+	}
+	if config.ReserveTimeout <= 0 {
+		config.ReserveTimeout = DefaultReserveTimeout
+	}
 	lp := LocalProvider{
-		account:    acc,
-		ks:         ks,
-		cfg:        config,
-		repository: repository,
+		mu:            newCtxMutex(),
+		account:       &accounts.Account{Address: signers.Pegin.Address()},
+		ks:            ks,
+		signer:        signers.Pegin,
+		pegoutSigner:  signers.Pegout,
+		signers:       make(map[common.Address]Signer),
+		policy:        policy,
+		fees:          fees,
+		pegoutFees:    pegoutFees,
+		confirmations: confirmations,
+		gasPrices:     gasPrices,
+		gasEstimator:  gasEstimator,
+		cfg:           config,
+		repository:    repository,
+		closers:       closers,
+	}
+	for _, signer := range append([]Signer{signers.Pegin, signers.Pegout}, signers.Extra...) {
+		if _, ok := lp.signers[signer.Address()]; !ok {
+			lp.signers[signer.Address()] = signer
+		}
+	}
+	// peg-outs are served when the repository is able to retain them
+	if pegoutRepository, ok := repository.(PegoutLocalProviderRepository); ok {
+		lp.pegoutRepository = pegoutRepository
+	}
+	if quotes, ok := repository.(QuoteRepository); ok {
+		lp.quotes = quotes
+	}
+	if pegoutQuotes, ok := repository.(PegoutQuoteRepository); ok {
+		lp.pegoutQuotes = pegoutQuotes
 	}
 	return &lp, nil
 }
 
+// policyEngine returns the engine enforcing config.Policy, nil when there is no policy.
+func policyEngine(config ProviderConfig, repository LocalProviderRepository) (*PolicyEngine, error) {
+	if config.Policy == nil {
+		return nil, nil
+	}
+	if signedValues, ok := repository.(SignedValueRepository); ok {
+		return NewPolicyEngineWithRepository(*config.Policy, SystemClock{}, signedValues), nil
+	}
+	if config.Policy.MaxSignedValue != nil {
+		return nil, ErrSignedValueStore
+	}
+	return NewPolicyEngine(*config.Policy, SystemClock{}), nil
+}
+
+// feeStrategy returns the fee strategy selected by config.
+func feeStrategy(config ProviderConfig, repository LocalProviderRepository) (FeeStrategy, error) {
+	if config.FeeStrategy != nil {
+		return config.FeeStrategy, nil
+	}
+	if config.Fee != nil {
+		liquidity, _ := repository.(LiquidityReader)
+		return NewFeeStrategy(*config.Fee, liquidity)
+	}
+	if config.CallFee == nil {
+		return NewFlatFee(types.NewWei(0))
+	}
+	return NewFlatFee(config.CallFee)
+}
+
+// pegoutFeeStrategy returns the fee strategy of peg-out quotes, nil if it needs a peg-out liquidity the repository
+// does not report.
+func pegoutFeeStrategy(config ProviderConfig, repository LocalProviderRepository, fees FeeStrategy) (FeeStrategy, error) {
+	if config.FeeStrategy != nil || config.Fee == nil || config.Fee.Strategy != FeeStrategyUtilization {
+		return fees, nil
+	}
+	liquidity, ok := repository.(PegoutLiquidityReader)
+	if !ok {
+		return nil, nil
+	}
+	return NewFeeStrategy(*config.Fee, pegoutLiquidity{liquidity})
+}
+
+// Close closes the connections to the node opened for the GasPrice and GasEstimate configurations.
+func (lp *LocalProvider) Close() {
+	closeAll(lp.closers)
+	lp.closers = nil
+}
+
+func closeAll(closers []func()) {
+	for _, c := range closers {
+		c()
+	}
+}
+
+// gasPrice returns the gas price to charge, which is at least the price of the gas price oracle.
+func (lp *LocalProvider) gasPrice(ctx context.Context, gasPrice *types.Wei) (*types.Wei, error) {
+	if lp.gasPrices == nil {
+		if gasPrice == nil {
+			return nil, ErrGasPriceRequired
+		}
+		return gasPrice, nil
+	}
+	price, err := lp.gasPrices.GasPrice(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if gasPrice != nil && gasPrice.Cmp(price) > 0 {
+		return gasPrice, nil
+	}
+	return price, nil
+}
+
+func validateSignatureScheme(config *ProviderConfig) error {
+	switch config.SignatureScheme {
+	case "":
+		config.SignatureScheme = SignatureSchemePersonalSign
+	case SignatureSchemePersonalSign:
+	case SignatureSchemeEIP712:
+		if config.ChainId == nil {
+			return ErrChainIdRequired
+		}
+	default:
+		return fmt.Errorf("%w: %v", ErrUnknownSignatureScheme, config.SignatureScheme)
+	}
+	return nil
+}
+
 func (lp *LocalProvider) Address() string {
 	return lp.account.Address.String()
 }
 
+func (lp *LocalProvider) PegoutAddress() string {
+	return lp.pegoutSigner.Address().String()
+}
+
+// Accounts returns the addresses of all the accounts the provider signs with.
+func (lp *LocalProvider) Accounts() []common.Address {
+	res := make([]common.Address, 0, len(lp.signers))
+	for addr := range lp.signers {
+		res = append(res, addr)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return bytes.Compare(res[i][:], res[j][:]) < 0
+	})
+	return res
+}
+
+// signerFor returns the signer of the account with address addr.
+func (lp *LocalProvider) signerFor(addr string) (Signer, error) {
+	if common.IsHexAddress(addr) {
+		if signer, ok := lp.signers[common.HexToAddress(addr)]; ok {
+			return signer, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %v", ErrAccountNotFound, addr)
+}
+
+// GetQuote prices q, charging gas units at gasPrice for the call on behalf of the user, or the oracle price and the
+// estimated gas when they are higher.
 func (lp *LocalProvider) GetQuote(q *types.Quote, gas uint64, gasPrice *types.Wei) (*types.Quote, error) {
+	return lp.GetQuoteContext(context.Background(), q, gas, gasPrice)
+}
+
+func (lp *LocalProvider) GetQuoteContext(ctx context.Context, q *types.Quote, gas uint64, gasPrice *types.Wei) (*types.Quote, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	gasPrice, err := lp.gasPrice(ctx, gasPrice)
+	if err != nil {
+		return nil, err
+	}
+	if lp.gasEstimator != nil {
+		estimate, err := lp.gasEstimator.EstimateGas(ctx, q)
+		if err != nil {
+			return nil, err
+		}
+		if estimate > uint64(q.GasLimit) {
+			return nil, fmt.Errorf("%w: %v gas estimated, the limit is %v", ErrGasLimitExceeded, estimate, q.GasLimit)
+		}
+		if gas < estimate {
+			gas = estimate
+		}
+	}
 	res := *q
 	res.LPBTCAddr = lp.cfg.BtcAddr
 	res.LPRSKAddr = lp.account.Address.String()
@@ -110,111 +544,499 @@ func (lp *LocalProvider) GetQuote(q *types.Quote, gas uint64, gasPrice *types.We
 	res.CallTime = lp.cfg.CallTime
 	res.PenaltyFee = lp.cfg.PenaltyFee.Copy()
 
-	res.Confirmations = lp.cfg.MaxConf
-	for _, k := range sortedConfirmations(lp.cfg.Confirmations) {
-		v := lp.cfg.Confirmations[k]
-
-		if res.Value.AsBigInt().Uint64() < uint64(k) {
-			res.Confirmations = v
-			break
-		}
+	res.Confirmations, err = lp.confirmations.confirmations(res.Value, lp.cfg.MaxConf)
+	if err != nil {
+		return nil, err
+	}
+	fixed, percentage, err := splitFee(ctx, lp.fees, &res)
+	if err != nil {
+		return nil, err
 	}
-	callCost := new(types.Wei).Mul(gasPrice, types.NewUWei(gas))
-	res.CallFee = new(types.Wei).Add(callCost, lp.cfg.CallFee)
+	res.FeeBreakdown = &types.FeeBreakdown{
+		GasCost:       new(types.Wei).Mul(gasPrice, types.NewUWei(gas)),
+		FixedFee:      fixed,
+		PercentageFee: percentage,
+		NetworkFee:    lp.networkFee(),
+		PenaltyFee:    res.PenaltyFee.Copy(),
+	}
+	res.CallFee = res.FeeBreakdown.Total()
 	return &res, nil
 }
 
+// networkFee returns the configured network fee, or zero when none is.
+func (lp *LocalProvider) networkFee() *types.Wei {
+	if lp.cfg.NetworkFee == nil {
+		return types.NewWei(0)
+	}
+	return lp.cfg.NetworkFee.Copy()
+}
+
+func (lp *LocalProvider) SignatureScheme() SignatureScheme {
+	return lp.cfg.SignatureScheme
+}
+
 func (lp *LocalProvider) SignQuote(hash []byte, depositAddr string, reqLiq *types.Wei) ([]byte, error) {
+	return lp.SignQuoteContext(context.Background(), hash, depositAddr, reqLiq)
+}
+
+func (lp *LocalProvider) SignQuoteContext(ctx context.Context, hash []byte, depositAddr string, reqLiq *types.Wei) ([]byte, error) {
+	if lp.cfg.SignatureScheme != SignatureSchemePersonalSign {
+		return nil, ErrQuoteRequired
+	}
+	release, err := lp.authorizeQuote(hash, nil, reqLiq)
+	if err != nil {
+		return nil, err
+	}
+	signB, err := lp.signText(ctx, lp.signer, hash)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	// the quote is unknown, so the deposit deadline is estimated from the time it is signed
+	signB, err = lp.retainQuote(ctx, hash, nil, signB, depositAddr, reqLiq, uint32(time.Now().Unix()), lp.cfg.TimeForDeposit)
+	if err != nil {
+		release()
+	}
+	return signB, err
+}
+
+func (lp *LocalProvider) SignQuoteFromQuote(q *types.Quote, depositAddr string, reqLiq *types.Wei) ([]byte, error) {
+	return lp.SignQuoteFromQuoteContext(context.Background(), q, depositAddr, reqLiq)
+}
+
+func (lp *LocalProvider) SignQuoteFromQuoteContext(ctx context.Context, q *types.Quote, depositAddr string, reqLiq *types.Wei) ([]byte, error) {
+	hash, err := q.Hash()
+	if err != nil {
+		return nil, fmt.Errorf("error hashing quote: %v", err)
+	}
+	if q.FeeBreakdown != nil {
+		if err = q.FeeBreakdown.Check(q.CallFee); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidFeeBreakdown, err)
+		}
+	}
+	// quotes issued before a key rotation are signed by their own account
+	signer, err := lp.signerFor(q.LPRSKAddr)
+	if err != nil {
+		return nil, err
+	}
+	release, err := lp.authorizeQuote(hash, q, reqLiq)
+	if err != nil {
+		return nil, err
+	}
+	signB, err := lp.signQuote(ctx, signer, q, hash)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	signB, err = lp.retainQuote(ctx, hash, q, signB, depositAddr, reqLiq, q.AgreementTimestamp, q.TimeForDeposit)
+	if err != nil {
+		release()
+	}
+	return signB, err
+}
+
+// signQuote signs the quote with signer under the configured signature scheme.
+func (lp *LocalProvider) signQuote(ctx context.Context, signer Signer, q *types.Quote, hash []byte) ([]byte, error) {
+	if lp.cfg.SignatureScheme == SignatureSchemeEIP712 {
+		return SignQuoteWithContext(ctx, signer, q, lp.cfg.ChainId, SignatureSchemeEIP712)
+	}
+	return lp.signText(ctx, signer, hash)
+}
+
+// authorizeQuote applies the signing policy to the quote, returning a function to release it if signing fails.
+func (lp *LocalProvider) authorizeQuote(hash []byte, q *types.Quote, reqLiq *types.Wei) (func(), error) {
+	if err := CheckReqLiq(reqLiq); err != nil {
+		return nil, err
+	}
+	if lp.policy == nil {
+		return func() {}, nil
+	}
+	var chainId *big.Int
+	if lp.cfg.SignatureScheme == SignatureSchemeEIP712 {
+		chainId = lp.cfg.ChainId
+	}
+	key, err := lp.policy.authorizeQuote(hex.EncodeToString(hash), q, reqLiq, chainId)
+	return func() { lp.policy.release(key) }, err
+}
+
+// retainQuote reserves reqLiq for the signed quote, storing q with the reservation when the repository stores quotes.
+func (lp *LocalProvider) retainQuote(ctx context.Context, hash []byte, q *types.Quote, signB []byte, depositAddr string, reqLiq *types.Wei, agreementTimestamp uint32, timeForDeposit uint32) ([]byte, error) {
 	quoteHash := hex.EncodeToString(hash)
 
-	var buf bytes.Buffer
-	buf.WriteString("\x19Ethereum Signed Message:\n32")
-	buf.Write(hash)
+	ctx, unlock, err := lp.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
 
-	signB, err := lp.ks.SignHash(*lp.account, crypto.Keccak256(buf.Bytes()))
+	var breakdown *types.FeeBreakdown
+	if q != nil {
+		breakdown = q.FeeBreakdown
+	}
+	rq := types.RetainedQuote{
+		QuoteHash:          quoteHash,
+		DepositAddr:        depositAddr,
+		Signature:          hex.EncodeToString(signB),
+		ReqLiq:             reqLiq.Copy(),
+		State:              types.RQStateWaitingForDeposit,
+		AgreementTimestamp: agreementTimestamp,
+		TimeForDeposit:     timeForDeposit,
+		FeeBreakdown:       breakdown.Copy(),
+	}
+	if q != nil && lp.quotes != nil {
+		err = reserveQuoteLiquidity(ctx, lp.quotes, q, &rq)
+	} else {
+		err = reserveLiquidity(ctx, lp.repository, &rq)
+	}
 	if err != nil {
 		return nil, err
 	}
-	signB[len(signB)-1] += 27 // v must be 27 or 28
 
-	lp.mu.Lock()
-	defer lp.mu.Unlock()
+	return signB, nil
+}
+
+// lock acquires the provider lock, returning a context that is done when the reservation timeout elapses.
+func (lp *LocalProvider) lock(ctx context.Context) (context.Context, func(), error) {
+	if err := lp.mu.Lock(ctx); err != nil {
+		return nil, nil, fmt.Errorf("error waiting for the provider lock: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, lp.cfg.ReserveTimeout)
+	return ctx, func() {
+		cancel()
+		lp.mu.Unlock()
+	}, nil
+}
+
+// GetPegoutQuote prices q as GetQuote does, charging gas units at gasPrice.
+func (lp *LocalProvider) GetPegoutQuote(q *types.PegoutQuote, lastBlock uint64, gas uint64, gasPrice *types.Wei) (*types.PegoutQuote, error) {
+	return lp.GetPegoutQuoteContext(context.Background(), q, lastBlock, gas, gasPrice)
+}
 
-	hasRq, err := lp.repository.HasRetainedQuote(quoteHash)
+func (lp *LocalProvider) GetPegoutQuoteContext(ctx context.Context, q *types.PegoutQuote, lastBlock uint64, gas uint64, gasPrice *types.Wei) (*types.PegoutQuote, error) {
+	if err := lp.checkPegout(); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if lp.pegoutFees == nil {
+		return nil, fmt.Errorf("%w: the utilization fee strategy prices peg-out quotes by the peg-out liquidity", ErrLiquidityRequired)
+	}
+	if lastBlock > uint64(math.MaxUint32-lp.cfg.PegoutExpireBlocks) {
+		return nil, fmt.Errorf("%w: block %v plus %v blocks", ErrExpireBlockOverflow, lastBlock, lp.cfg.PegoutExpireBlocks)
+	}
+	gasPrice, err := lp.gasPrice(ctx, gasPrice)
 	if err != nil {
 		return nil, err
 	}
-	if !hasRq {
-		hasLiquidity, err := lp.repository.HasLiquidity(lp, reqLiq)
-		if err != nil {
-			return nil, err
-		}
-		if !hasLiquidity {
-			return nil, fmt.Errorf("not enough liquidity. required: %v", reqLiq)
-		}
+	now := uint32(time.Now().Unix())
+	res := *q
+	res.LPBTCAddr = lp.cfg.BtcAddr
+	res.LPRSKAddr = lp.PegoutAddress()
+	res.AgreementTimestamp = now
+	res.Nonce = int64(rand.Int())
+	res.DepositDateLimit = now + lp.cfg.PegoutDepositTime
+	res.TransferTime = lp.cfg.PegoutTransferTime
+	res.ExpireDate = now + lp.cfg.PegoutExpireTime
+	res.ExpireBlock = uint32(lastBlock) + lp.cfg.PegoutExpireBlocks
+	res.DepositConfirmations = lp.cfg.PegoutDepositConfirmations
+	res.TransferConfirmations = lp.cfg.PegoutTransferConfirmations
+	res.PenaltyFee = lp.cfg.PenaltyFee.Copy()
+
+	fixed, percentage, err := splitFee(ctx, lp.pegoutFees, &types.Quote{Value: res.Value})
+	if err != nil {
+		return nil, err
+	}
+	res.FeeBreakdown = &types.FeeBreakdown{
+		GasCost:       new(types.Wei).Mul(gasPrice, types.NewUWei(gas)),
+		FixedFee:      fixed,
+		PercentageFee: percentage,
+		NetworkFee:    lp.networkFee(),
+		PenaltyFee:    res.PenaltyFee.Copy(),
+	}
+	res.CallFee = res.FeeBreakdown.Total()
+	return &res, nil
+}
+
+func (lp *LocalProvider) SignPegoutQuote(hash []byte, reqLiq *types.Wei) ([]byte, error) {
+	return lp.SignPegoutQuoteContext(context.Background(), hash, reqLiq)
+}
 
-		signature := hex.EncodeToString(signB)
-		rq := types.RetainedQuote{
-			QuoteHash:   quoteHash,
-			DepositAddr: depositAddr,
-			Signature:   signature,
-			ReqLiq:      reqLiq.Copy(),
-			State:       types.RQStateWaitingForDeposit,
+func (lp *LocalProvider) SignPegoutQuoteContext(ctx context.Context, hash []byte, reqLiq *types.Wei) ([]byte, error) {
+	if err := lp.checkPegout(); err != nil {
+		return nil, err
+	}
+	// the quote is unknown, so the deposit deadline is estimated from the time it is signed
+	now := uint32(time.Now().Unix())
+	return lp.signPegoutQuote(ctx, lp.pegoutSigner, hash, nil, reqLiq, now, now+lp.cfg.PegoutDepositTime)
+}
+
+// SignPegoutQuoteFromQuote signs the hash of q with the account q was issued for, retaining it until its deposit date
+// limit.
+func (lp *LocalProvider) SignPegoutQuoteFromQuote(q *types.PegoutQuote, reqLiq *types.Wei) ([]byte, error) {
+	return lp.SignPegoutQuoteFromQuoteContext(context.Background(), q, reqLiq)
+}
+
+func (lp *LocalProvider) SignPegoutQuoteFromQuoteContext(ctx context.Context, q *types.PegoutQuote, reqLiq *types.Wei) ([]byte, error) {
+	if err := lp.checkPegout(); err != nil {
+		return nil, err
+	}
+	hash, err := q.Hash()
+	if err != nil {
+		return nil, fmt.Errorf("error hashing peg-out quote: %v", err)
+	}
+	if q.FeeBreakdown != nil {
+		if err = q.FeeBreakdown.Check(q.CallFee); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidFeeBreakdown, err)
 		}
-		err = lp.repository.RetainQuote(&rq)
+	}
+	signer, err := lp.signerFor(q.LPRSKAddr)
+	if err != nil {
+		return nil, err
+	}
+	return lp.signPegoutQuote(ctx, signer, hash, q, reqLiq, q.AgreementTimestamp, q.DepositDateLimit)
+}
+
+// signPegoutQuote signs the peg-out quote hash with signer and reserves reqLiq for it, storing q when it is known.
+func (lp *LocalProvider) signPegoutQuote(ctx context.Context, signer Signer, hash []byte, q *types.PegoutQuote, reqLiq *types.Wei, agreementTimestamp uint32, depositDateLimit uint32) ([]byte, error) {
+	if err := CheckReqLiq(reqLiq); err != nil {
+		return nil, err
+	}
+	quoteHash := hex.EncodeToString(hash)
+
+	release := func() {}
+	if lp.policy != nil {
+		key, err := lp.policy.authorizePegoutQuote(quoteHash, reqLiq)
 		if err != nil {
 			return nil, err
 		}
+		release = func() { lp.policy.release(key) }
+	}
+	signB, err := lp.signText(ctx, signer, hash)
+	if err != nil {
+		release()
+		return nil, err
 	}
 
+	ctx, unlock, err := lp.lock(ctx)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	defer unlock()
+
+	rq := types.RetainedPegoutQuote{
+		QuoteHash:          quoteHash,
+		Signature:          hex.EncodeToString(signB),
+		ReqLiq:             reqLiq.Copy(),
+		State:              types.RQStateWaitingForDeposit,
+		AgreementTimestamp: agreementTimestamp,
+		DepositDateLimit:   depositDateLimit,
+	}
+	if q != nil && lp.pegoutQuotes != nil {
+		err = reservePegoutQuoteLiquidity(ctx, lp.pegoutQuotes, q, &rq)
+	} else {
+		err = reservePegoutLiquidity(ctx, lp.pegoutRepository, &rq)
+	}
+	if err != nil {
+		release()
+		return nil, err
+	}
+
+	return signB, nil
+}
+
+// checkPegout fails unless the repository supports peg-out quotes and the signature scheme can sign them.
+func (lp *LocalProvider) checkPegout() error {
+	if lp.pegoutRepository == nil {
+		return ErrPegoutNotSupported
+	}
+	if lp.cfg.SignatureScheme != SignatureSchemePersonalSign {
+		return fmt.Errorf("%w: %v", ErrPegoutSignatureScheme, lp.cfg.SignatureScheme)
+	}
+	return nil
+}
+
+// signText signs the quote hash with the personal_sign prefix.
+func (lp *LocalProvider) signText(ctx context.Context, signer Signer, hash []byte) ([]byte, error) {
+	signB, err := signText(ctx, signer, hash)
+	if err != nil {
+		return nil, err
+	}
+	signB[len(signB)-1] += 27 // v must be 27 or 28
 	return signB, nil
 }
 
 func (lp *LocalProvider) SignTx(address common.Address, tx *gethTypes.Transaction) (*gethTypes.Transaction, error) {
-	if !bytes.Equal(address[:], lp.account.Address[:]) {
-		return nil, fmt.Errorf("provider address %v is incorrect", address.Hash())
+	return lp.SignTxContext(context.Background(), address, tx)
+}
+
+func (lp *LocalProvider) SignTxContext(ctx context.Context, address common.Address, tx *gethTypes.Transaction) (*gethTypes.Transaction, error) {
+	return lp.signTx(ctx, address, tx, "tx:"+tx.Hash().Hex())
+}
+
+// SignQuoteTx signs the transaction paying the peg-in quote identified by quoteHash.
+func (lp *LocalProvider) SignQuoteTx(address common.Address, tx *gethTypes.Transaction, quoteHash []byte) (*gethTypes.Transaction, error) {
+	return lp.SignQuoteTxContext(context.Background(), address, tx, quoteHash)
+}
+
+func (lp *LocalProvider) SignQuoteTxContext(ctx context.Context, address common.Address, tx *gethTypes.Transaction, quoteHash []byte) (*gethTypes.Transaction, error) {
+	return lp.signTx(ctx, address, tx, "quote:"+hex.EncodeToString(quoteHash))
+}
+
+// signTx signs tx with the signer of address, accounting its value under key when there is a signing policy.
+func (lp *LocalProvider) signTx(ctx context.Context, address common.Address, tx *gethTypes.Transaction, key string) (*gethTypes.Transaction, error) {
+	signer, ok := lp.signers[address]
+	if !ok {
+		return nil, fmt.Errorf("%w: provider address %v", ErrAccountNotFound, address.Hex())
+	}
+	if lp.policy == nil {
+		return signTx(ctx, signer, tx, lp.cfg.ChainId)
+	}
+	key, err := lp.policy.authorizeTx(tx, lp.cfg.ChainId, key)
+	if err != nil {
+		return nil, err
 	}
-	return lp.ks.SignTx(*lp.account, tx, lp.cfg.ChainId)
+	signed, err := signTx(ctx, signer, tx, lp.cfg.ChainId)
+	if err != nil {
+		lp.policy.release(key)
+		return nil, err
+	}
+	return signed, nil
 }
 
-func retrieveOrCreateAccount(ks *keystore.KeyStore, accountNum int, in *os.File) (*accounts.Account, error) {
-	if cap(ks.Accounts()) == 0 {
+// retrieveOrCreateAccount unlocks the account addr, or the one at accountNum, creating one if the keystore is empty.
+// It returns the password, so other accounts can be unlocked.
+func retrieveOrCreateAccount(ks *keystore.KeyStore, addr string, accountNum int, source SecretSource, in *os.File) (*accounts.Account, string, error) {
+	if addr == "" && len(ks.Accounts()) == 0 {
 		log.Info("no RSK account found")
-		acc, err := createAccount(ks, in)
-		return acc, err
+		return createAccount(ks, source, in)
+	}
+	var acc accounts.Account
+	if addr != "" {
+		found, err := findAccount(ks, addr)
+		if err != nil {
+			return nil, "", err
+		}
+		acc = *found
 	} else {
-		if cap(ks.Accounts()) <= accountNum {
-			return nil, fmt.Errorf("account number %v not found", accountNum)
+		if accountNum < 0 || len(ks.Accounts()) <= accountNum {
+			return nil, "", fmt.Errorf("%w: account number %v", ErrAccountNotFound, accountNum)
 		}
-		acc := ks.Accounts()[accountNum]
-		passwd, err := enterPasswd(in)
+		acc = ks.Accounts()[accountNum]
+	}
+	var passwd string
+	var err error
+	if source != nil {
+		passwd, err = source.Secret()
+	} else {
+		passwd, err = enterPasswd(in)
+	}
 
+	if err != nil {
+		return nil, "", err
+	}
+	if err = unlock(ks, acc, passwd); err != nil {
+		return nil, "", err
+	}
+	return &acc, passwd, nil
+}
+
+func findAccount(ks *keystore.KeyStore, addr string) (*accounts.Account, error) {
+	if !common.IsHexAddress(addr) {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidProviderAddress, addr)
+	}
+	acc, err := ks.Find(accounts.Account{Address: common.HexToAddress(addr)})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v is not in the keystore", ErrAccountNotFound, addr)
+	}
+	return &acc, nil
+}
+
+func unlockAccount(ks *keystore.KeyStore, addr string, passwd string) (*accounts.Account, error) {
+	acc, err := findAccount(ks, addr)
+	if err != nil {
+		return nil, err
+	}
+	if err = unlock(ks, *acc, passwd); err != nil {
+		return nil, err
+	}
+	return acc, nil
+}
+
+// unlock unlocks acc in ks, returning ErrWrongPassword when passwd does not decrypt it.
+func unlock(ks *keystore.KeyStore, acc accounts.Account, passwd string) error {
+	err := ks.Unlock(acc, passwd)
+	if errors.Is(err, keystore.ErrDecrypt) {
+		return fmt.Errorf("%w: %v", ErrWrongPassword, acc.Address.Hex())
+	}
+	if err != nil {
+		return fmt.Errorf("error unlocking account %v: %w", acc.Address.Hex(), err)
+	}
+	return nil
+}
+
+// externalSigners connects to the external signer once per configured account.
+func externalSigners(ctx context.Context, config ProviderConfig) (Signers, error) {
+	var signers Signers
+	var err error
+	if config.AccountAddr == "" {
+		signers.Pegin, err = NewExternalSignerContext(ctx, config.ExternalSigner)
+	} else {
+		signers.Pegin, err = newExternalSignerForAddr(ctx, config.ExternalSigner, config.AccountAddr)
+	}
+	if err != nil {
+		return Signers{}, err
+	}
+	if config.PegoutAccountAddr != "" {
+		if signers.Pegout, err = newExternalSignerForAddr(ctx, config.ExternalSigner, config.PegoutAccountAddr); err != nil {
+			return Signers{}, err
+		}
+	}
+	for _, addr := range config.ExtraAccountAddrs {
+		signer, err := newExternalSignerForAddr(ctx, config.ExternalSigner, addr)
 		if err != nil {
-			return nil, err
+			return Signers{}, err
 		}
-		err = ks.Unlock(acc, passwd)
-		return &acc, err
+		signers.Extra = append(signers.Extra, signer)
 	}
+	return signers, nil
 }
 
-func createAccount(ks *keystore.KeyStore, in *os.File) (*accounts.Account, error) {
-	passwd, err := createPasswd(in)
+func newExternalSignerForAddr(ctx context.Context, endpoint string, addr string) (*ExternalSigner, error) {
+	if !common.IsHexAddress(addr) {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidProviderAddress, addr)
+	}
+	return NewExternalSignerForAccountContext(ctx, endpoint, common.HexToAddress(addr))
+}
+
+func createAccount(ks *keystore.KeyStore, source SecretSource, in *os.File) (*accounts.Account, string, error) {
+	var passwd string
+	var err error
+	if source != nil {
+		passwd, err = source.Secret()
+		if err == nil {
+			err = validatePasswd(passwd)
+		}
+	} else {
+		passwd, err = createPasswd(in)
+	}
 
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 	acc, err := ks.NewAccount(passwd)
 
 	if err != nil {
-		return &acc, err
+		return &acc, "", err
 	}
 	err = ks.Unlock(acc, passwd)
 
 	if err != nil {
-		return &acc, err
+		return &acc, "", err
 	}
 	log.Info("new account created: ", acc.Address)
-	return &acc, err
+	return &acc, passwd, err
 }
 
 func enterPasswd(in *os.File) (string, error) {
@@ -247,7 +1069,7 @@ func createPasswd(in *os.File) (string, error) {
 
 	str, _ := r.ReadString('\n')
 	if str != "yes\n" {
-		return "", errors.New("must say yes")
+		return "", ErrNotConfirmed
 	}
 	fmt.Print("password: ")
 	pwd1, err := readPasswd(r)
@@ -256,10 +1078,8 @@ func createPasswd(in *os.File) (string, error) {
 		return "", err
 	}
 
-	const minEntropyBits = 100
-	err = passwordvalidator.Validate(pwd1, minEntropyBits)
-	if err != nil {
-		return "", errors.New("password is not secure enough: " + err.Error())
+	if err = validatePasswd(pwd1); err != nil {
+		return "", err
 	}
 
 	fmt.Print("repeat password: ")
@@ -269,11 +1089,21 @@ func createPasswd(in *os.File) (string, error) {
 		return "", err
 	}
 	if pwd1 != pwd2 {
-		return "", errors.New("passwords do not match")
+		return "", ErrPasswordMismatch
 	}
 	return pwd1, nil
 }
 
+// validatePasswd checks that the password of a new account is strong enough.
+func validatePasswd(pwd string) error {
+	const minEntropyBits = 100
+	err := passwordvalidator.Validate(pwd, minEntropyBits)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrWeakPassword, err)
+	}
+	return nil
+}
+
 func readPasswdCons(_ *bufio.Reader) (string, error) {
 	pass, err := term.ReadPassword(syscall.Stdin)
 	return string(pass), err
@@ -286,14 +1116,3 @@ func readPasswdReader(r *bufio.Reader) (string, error) {
 	}
 	return strings.Trim(str, "\n"), nil
 }
-
-func sortedConfirmations(m map[int]uint16) []int {
-	keys := make([]int, len(m))
-	i := 0
-	for k := range m {
-		keys[i] = k
-		i++
-	}
-	sort.Ints(keys)
-	return keys
-}
@@ -3,10 +3,14 @@ package providers
 import (
 	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io/ioutil"
+	"math"
 	"math/big"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/rsksmart/liquidity-provider/types"
 	"github.com/stretchr/testify/assert"
@@ -69,14 +73,20 @@ var (
 )
 
 type InMemLocalProviderRepository struct {
-	retainedQuotes map[string]*types.RetainedQuote
-	liquidity      *types.Wei
+	*memSignedValues
+	retainedQuotes       map[string]*types.RetainedQuote
+	liquidity            *types.Wei
+	retainedPegoutQuotes map[string]*types.RetainedPegoutQuote
+	pegoutLiquidity      *types.Wei
 }
 
 func NewInMemRetainedQuotesRepository() *InMemLocalProviderRepository {
 	return &InMemLocalProviderRepository{
-		retainedQuotes: make(map[string]*types.RetainedQuote),
-		liquidity:      types.NewWei(0),
+		memSignedValues:      newMemSignedValues(),
+		retainedQuotes:       make(map[string]*types.RetainedQuote),
+		liquidity:            types.NewWei(0),
+		retainedPegoutQuotes: make(map[string]*types.RetainedPegoutQuote),
+		pegoutLiquidity:      types.NewWei(0),
 	}
 }
 
@@ -94,7 +104,7 @@ func (r *InMemLocalProviderRepository) GetLiquidity() *types.Wei {
 	liq := r.liquidity.Copy()
 
 	for _, rq := range r.retainedQuotes {
-		if rq.State == types.RQStateWaitingForDeposit {
+		if rq.State.LocksLiquidity() {
 			liq.Sub(liq, rq.ReqLiq)
 		}
 	}
@@ -106,15 +116,127 @@ func (r *InMemLocalProviderRepository) HasLiquidity(_ LiquidityProvider, wei *ty
 	return r.GetLiquidity().Cmp(wei) >= 0, nil
 }
 
+func (r *InMemLocalProviderRepository) ReserveLiquidity(rq *types.RetainedQuote) error {
+	if _, ok := r.retainedQuotes[rq.QuoteHash]; ok {
+		return nil
+	}
+	available := r.GetLiquidity()
+	if available.Cmp(rq.ReqLiq) < 0 {
+		return &ErrInsufficientLiquidity{Required: rq.ReqLiq.Copy(), Available: available}
+	}
+	return r.RetainQuote(rq)
+}
+
 func (r *InMemLocalProviderRepository) SetLiquidity(liq *types.Wei) {
 	r.liquidity = liq.Copy()
 }
 
-func (r *InMemLocalProviderRepository) SetRetainedQuoteState(hash string, state types.RQState) {
+func (r *InMemLocalProviderRepository) SetRetainedQuoteState(hash string, state types.RQState) error {
+	q, ok := r.retainedQuotes[hash]
+	if !ok {
+		return fmt.Errorf("retained quote %v not found", hash)
+	}
+	return q.Transition(state)
+}
+
+func (r *InMemLocalProviderRepository) GetRetainedQuotes(states ...types.RQState) ([]*types.RetainedQuote, error) {
+	var res []*types.RetainedQuote
+	for _, rq := range r.retainedQuotes {
+		for _, state := range states {
+			if rq.State == state {
+				q := *rq
+				res = append(res, &q)
+				break
+			}
+		}
+	}
+	return res, nil
+}
+
+func (r *InMemLocalProviderRepository) UpdateRetainedQuoteState(hash string, oldState types.RQState, newState types.RQState) error {
 	q, ok := r.retainedQuotes[hash]
-	if ok {
-		q.State = state
+	if !ok {
+		return ErrRetainedQuoteNotFound
+	}
+	if q.State != oldState {
+		return ErrUnexpectedRetainedQuoteState
+	}
+	return q.Transition(newState)
+}
+
+func (r *InMemLocalProviderRepository) RetainPegoutQuote(quote *types.RetainedPegoutQuote) error {
+	r.retainedPegoutQuotes[quote.QuoteHash] = quote
+	return nil
+}
+
+func (r *InMemLocalProviderRepository) HasRetainedPegoutQuote(hash string) (bool, error) {
+	_, ok := r.retainedPegoutQuotes[hash]
+	return ok, nil
+}
+
+func (r *InMemLocalProviderRepository) GetPegoutLiquidity() *types.Wei {
+	liq := r.pegoutLiquidity.Copy()
+
+	for _, rq := range r.retainedPegoutQuotes {
+		if rq.State.LocksLiquidity() {
+			liq.Sub(liq, rq.ReqLiq)
+		}
+	}
+
+	return liq
+}
+
+func (r *InMemLocalProviderRepository) HasPegoutLiquidity(_ PegoutLiquidityProvider, wei *types.Wei) (bool, error) {
+	return r.GetPegoutLiquidity().Cmp(wei) >= 0, nil
+}
+
+func (r *InMemLocalProviderRepository) ReservePegoutLiquidity(rq *types.RetainedPegoutQuote) error {
+	if _, ok := r.retainedPegoutQuotes[rq.QuoteHash]; ok {
+		return nil
+	}
+	available := r.GetPegoutLiquidity()
+	if available.Cmp(rq.ReqLiq) < 0 {
+		return &ErrInsufficientLiquidity{Required: rq.ReqLiq.Copy(), Available: available}
 	}
+	return r.RetainPegoutQuote(rq)
+}
+
+func (r *InMemLocalProviderRepository) SetPegoutLiquidity(liq *types.Wei) {
+	r.pegoutLiquidity = liq.Copy()
+}
+
+func (r *InMemLocalProviderRepository) GetRetainedPegoutQuote(hash string) (*types.RetainedPegoutQuote, error) {
+	q, ok := r.retainedPegoutQuotes[hash]
+	if !ok {
+		return nil, ErrRetainedQuoteNotFound
+	}
+	res := *q
+	return &res, nil
+}
+
+func (r *InMemLocalProviderRepository) GetRetainedPegoutQuotes(states ...types.RQState) ([]*types.RetainedPegoutQuote, error) {
+	var res []*types.RetainedPegoutQuote
+	for _, rq := range r.retainedPegoutQuotes {
+		for _, state := range states {
+			if rq.State == state {
+				q := *rq
+				res = append(res, &q)
+				break
+			}
+		}
+	}
+	return res, nil
+}
+
+func (r *InMemLocalProviderRepository) UpdateRetainedPegoutQuoteState(hash string, oldState types.RQState, newState types.RQState) error {
+	q, ok := r.retainedPegoutQuotes[hash]
+	if !ok {
+		return ErrRetainedQuoteNotFound
+	}
+	if q.State != oldState {
+		return ErrUnexpectedRetainedQuoteState
+	}
+	return q.Transition(newState)
 }
 
 func testSignature(t *testing.T) {
@@ -145,7 +267,7 @@ func testSignature(t *testing.T) {
 		if hex.EncodeToString(b) != sign.s {
 			t.Errorf("wrong signature. got: %x \n expected: %v", b, sign.s)
 		}
-		repository.SetRetainedQuoteState(sign.h, types.RQStateCallForUserSucceeded)
+		assert.Nil(t, repository.SetRetainedQuoteState(sign.h, types.RQStateCallForUserSucceeded))
 	}
 }
 
@@ -163,22 +285,22 @@ func testCreatePassword(t *testing.T) {
 	f2 := genTmpFile("yes\ncorrect horse battery staple\ncorrect horse battery step\n", t)
 	defer f2.Close()
 	_, err = createPasswd(f2)
-	if err == nil {
-		t.Fatal("did not fail when passwords do not match")
+	if !errors.Is(err, ErrPasswordMismatch) {
+		t.Fatalf("did not fail when passwords do not match, error = %v", err)
 	}
 
 	f3 := genTmpFile("nah\n1234\n1234\n", t)
 	defer f3.Close()
 	_, err = createPasswd(f3)
-	if err == nil {
-		t.Fatal("did not fail when yes is not typed")
+	if !errors.Is(err, ErrNotConfirmed) {
+		t.Fatalf("did not fail when yes is not typed, error = %v", err)
 	}
 
 	f4 := genTmpFile("yes\n1234\n1234\n", t)
 	defer f4.Close()
 	_, err = createPasswd(f4)
-	if err == nil {
-		t.Fatal("did not fail when password is not secure enough")
+	if !errors.Is(err, ErrWeakPassword) {
+		t.Fatalf("did not fail when password is not secure enough, error = %v", err)
 	}
 }
 
@@ -327,17 +449,199 @@ func testSignQuoteLocal(t *testing.T) {
 	assert.EqualValues(t, big.NewInt(20), repository.GetLiquidity())
 }
 
+func testSignQuoteFromQuote(t *testing.T) {
+	repository := NewInMemRetainedQuotesRepository()
+	lp := newLocalProvider(t, repository)
+	repository.SetLiquidity(types.NewWei(220))
+	reqLiq := types.NewWei(200)
+	q := &types.Quote{
+		FedBTCAddr:    "3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy",
+		LBCAddr:       "0xC52AbEae2f7A6e2E3C5Ab1C2a7E21B6F4A2F1C10",
+		LPRSKAddr:     lp.Address(),
+		BTCRefundAddr: "mipcBbFg9gMiCh81Kj8tqqdgoZub1ZJRfn",
+		RSKRefundAddr: "0x0000000000000000000000000000000000000001",
+		LPBTCAddr:     "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2",
+		CallFee:       types.NewWei(501000),
+		PenaltyFee:    types.NewWei(1000000),
+		ContractAddr:  "0x0000000000000000000000000000000000000002",
+		Value:         types.NewWei(3000000),
+	}
+	hash, err := q.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := lp.SignQuoteFromQuote(q, "abc", reqLiq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := lp.SignQuote(hash, "abc", reqLiq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, expected, b)
+
+	hasRq, err := repository.HasRetainedQuote(hex.EncodeToString(hash))
+	assert.Nil(t, err)
+	assert.True(t, hasRq)
+
+	// the fee breakdown is retained along with the quote, as long as it adds up to the call fee
+	q.Nonce = 1
+	q.FeeBreakdown = &types.FeeBreakdown{
+		GasCost:    types.NewWei(500000),
+		FixedFee:   types.NewWei(1000),
+		PenaltyFee: types.NewWei(1000000),
+	}
+	if hash, err = q.Hash(); err != nil {
+		t.Fatal(err)
+	}
+	_, err = lp.SignQuoteFromQuote(q, "abc", types.NewWei(10))
+	assert.Nil(t, err)
+	assert.Equal(t, q.FeeBreakdown, repository.retainedQuotes[hex.EncodeToString(hash)].FeeBreakdown)
+
+	q.Nonce = 2
+	q.FeeBreakdown.NetworkFee = types.NewWei(1)
+	_, err = lp.SignQuoteFromQuote(q, "abc", types.NewWei(10))
+	assert.ErrorIs(t, err, ErrInvalidFeeBreakdown)
+
+	q.LBCAddr = "invalid"
+	_, err = lp.SignQuoteFromQuote(q, "abc", reqLiq)
+	assert.NotNil(t, err)
+}
+
+func testGetPegoutQuoteLocal(t *testing.T) {
+	repository := NewInMemRetainedQuotesRepository()
+	lp := newLocalProviderWithConfig(t, repository, ProviderConfig{
+		CallFee:                     types.NewWei(1000),
+		PenaltyFee:                  types.NewWei(1000000),
+		PegoutDepositTime:           3600,
+		PegoutTransferTime:          7200,
+		PegoutExpireTime:            10800,
+		PegoutExpireBlocks:          500,
+		PegoutDepositConfirmations:  10,
+		PegoutTransferConfirmations: 2,
+	})
+
+	q := &types.PegoutQuote{
+		Value:       types.NewWei(3000000),
+		DepositAddr: "mipcBbFg9gMiCh81Kj8tqqdgoZub1ZJRfn",
+	}
+	nq, err := lp.GetPegoutQuote(q, 1000, 50000, types.NewWei(10))
+	if err != nil {
+		t.Fatal("error getting peg-out quote: ", err)
+	}
+	assert.Equal(t, lp.Address(), nq.LPRSKAddr)
+	assert.Equal(t, btcAddr, nq.LPBTCAddr)
+	assert.Equal(t, q.DepositAddr, nq.DepositAddr)
+	assert.NotZero(t, nq.AgreementTimestamp)
+	assert.NotZero(t, nq.Nonce)
+	assert.Equal(t, nq.AgreementTimestamp+3600, nq.DepositDateLimit)
+	assert.Equal(t, nq.AgreementTimestamp+10800, nq.ExpireDate)
+	assert.EqualValues(t, 1500, nq.ExpireBlock)
+	assert.EqualValues(t, 7200, nq.TransferTime)
+	assert.EqualValues(t, 10, nq.DepositConfirmations)
+	assert.EqualValues(t, 2, nq.TransferConfirmations)
+	assert.EqualValues(t, types.NewWei(501000), nq.CallFee)
+	assert.EqualValues(t, types.NewWei(1000000), nq.PenaltyFee)
+
+	// the expire block must fit in an uint32
+	nq, err = lp.GetPegoutQuote(q, math.MaxUint32-500, 50000, types.NewWei(10))
+	if assert.NoError(t, err) {
+		assert.EqualValues(t, uint32(math.MaxUint32), nq.ExpireBlock)
+	}
+	_, err = lp.GetPegoutQuote(q, math.MaxUint32-499, 50000, types.NewWei(10))
+	assert.ErrorIs(t, err, ErrExpireBlockOverflow)
+	_, err = lp.GetPegoutQuote(q, math.MaxUint64, 50000, types.NewWei(10))
+	assert.ErrorIs(t, err, ErrExpireBlockOverflow)
+}
+
+func testSignPegoutQuoteLocal(t *testing.T) {
+	repository := NewInMemRetainedQuotesRepository()
+	lp := newLocalProvider(t, repository)
+	lp.cfg.PegoutDepositTime = 3600
+	repository.SetLiquidity(types.NewWei(1000))
+	repository.SetPegoutLiquidity(types.NewWei(220))
+	hash := []byte("12345678901234567890123456789012")
+	reqLiq := types.NewWei(200)
+
+	b, err := lp.SignPegoutQuote(hash, reqLiq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := RecoverQuoteSigner(hash, b)
+	assert.Nil(t, err)
+	assert.Equal(t, lp.Address(), signer.String())
+	assert.EqualValues(t, types.NewWei(20), repository.GetPegoutLiquidity())
+	assert.EqualValues(t, types.NewWei(1000), repository.GetLiquidity())
+	rq, err := repository.GetRetainedPegoutQuote(hex.EncodeToString(hash))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.InDelta(t, time.Now().Unix(), rq.AgreementTimestamp, 5)
+	assert.EqualValues(t, rq.AgreementTimestamp+3600, rq.DepositDateLimit)
+
+	// signing again the same quote does not retain more liquidity
+	_, err = lp.SignPegoutQuote(hash, reqLiq)
+	assert.Nil(t, err)
+	assert.EqualValues(t, types.NewWei(20), repository.GetPegoutLiquidity())
+
+	_, err = lp.SignPegoutQuote([]byte("22345678901234567890123456789012"), reqLiq)
+	var liqErr *ErrInsufficientLiquidity
+	assert.ErrorAs(t, err, &liqErr)
+}
+
+func testPegoutNotSupported(t *testing.T) {
+	repository := struct{ LocalProviderRepository }{NewInMemRetainedQuotesRepository()}
+	lp := newLocalProvider(t, repository)
+
+	_, err := lp.GetPegoutQuote(&types.PegoutQuote{}, 0, 0, types.NewWei(0))
+	assert.ErrorIs(t, err, ErrPegoutNotSupported)
+	_, err = lp.SignPegoutQuote([]byte("12345678901234567890123456789012"), types.NewWei(0))
+	assert.ErrorIs(t, err, ErrPegoutNotSupported)
+
+	// peg-out quotes are not signed as EIP-712 typed data
+	lp = newLocalProvider(t, NewInMemRetainedQuotesRepository())
+	lp.cfg.SignatureScheme = SignatureSchemeEIP712
+	_, err = lp.GetPegoutQuote(&types.PegoutQuote{}, 0, 0, types.NewWei(0))
+	assert.ErrorIs(t, err, ErrPegoutSignatureScheme)
+	_, err = lp.SignPegoutQuote([]byte("12345678901234567890123456789012"), types.NewWei(0))
+	assert.ErrorIs(t, err, ErrPegoutSignatureScheme)
+}
+
 func testInsufficientFunds(t *testing.T) {
 	repository := NewInMemRetainedQuotesRepository()
 	lp := newLocalProvider(t, repository)
 	repository.SetLiquidity(types.NewWei(100))
 	reqLiq := types.NewWei(101)
 	_, err := lp.SignQuote([]byte("12345678901234567890123456789012"), "abc", reqLiq)
-	if err != nil {
-		assert.Errorf(t, err, "not enough liquidity. required: %v")
+	var liqErr *ErrInsufficientLiquidity
+	if assert.ErrorAs(t, err, &liqErr) {
+		assert.EqualValues(t, reqLiq, liqErr.Required)
+		assert.EqualValues(t, types.NewWei(100), liqErr.Available)
 	}
 }
 
+func testInvalidReqLiq(t *testing.T) {
+	repository := NewInMemRetainedQuotesRepository()
+	lp := newLocalProvider(t, repository)
+	repository.SetLiquidity(types.NewWei(100))
+	repository.SetPegoutLiquidity(types.NewWei(100))
+	hash := []byte("12345678901234567890123456789012")
+	for _, reqLiq := range []*types.Wei{nil, types.NewWei(-1)} {
+		var reqLiqErr *ErrInvalidReqLiq
+		signB, err := lp.SignQuote(hash, "abc", reqLiq)
+		assert.ErrorAs(t, err, &reqLiqErr)
+		assert.Nil(t, signB)
+		signB, err = lp.SignPegoutQuote(hash, reqLiq)
+		assert.ErrorAs(t, err, &reqLiqErr)
+		assert.Nil(t, signB)
+	}
+	hasQuote, _ := repository.HasRetainedQuote(hex.EncodeToString(hash))
+	assert.False(t, hasQuote)
+	assert.EqualValues(t, types.NewWei(100), repository.GetLiquidity())
+	assert.EqualValues(t, types.NewWei(100), repository.GetPegoutLiquidity())
+}
+
 func testLiquidityFluctuation(t *testing.T) {
 	quoteHash := "12345678901234567890123456789012"
 	repository := NewInMemRetainedQuotesRepository()
@@ -357,7 +661,7 @@ func testLiquidityFluctuation(t *testing.T) {
 
 	assert.EqualValues(t, expectedLiq, repository.GetLiquidity())
 
-	repository.SetRetainedQuoteState(quoteHash, types.RQStateCallForUserSucceeded)
+	assert.Nil(t, repository.SetRetainedQuoteState(quoteHash, types.RQStateCallForUserSucceeded))
 
 	assert.EqualValues(t, initialLiq, repository.GetLiquidity())
 }
@@ -388,7 +692,7 @@ func testLiquidityAbnormalFluctuation(t *testing.T) {
 
 	assert.EqualValues(t, expectedLiq, repository.GetLiquidity())
 
-	repository.SetRetainedQuoteState(quoteHash, types.RQStateCallForUserSucceeded)
+	assert.Nil(t, repository.SetRetainedQuoteState(quoteHash, types.RQStateCallForUserSucceeded))
 
 	assert.EqualValues(t, initialLiq, repository.GetLiquidity())
 }
@@ -401,13 +705,16 @@ func testSetLiquidity(t *testing.T) {
 }
 
 func newLocalProvider(t *testing.T, repository LocalProviderRepository) *LocalProvider {
+	return newLocalProviderWithConfig(t, repository, ProviderConfig{})
+}
+
+// newLocalProviderWithConfig creates a provider with a new account and the rest of cfg.
+func newLocalProviderWithConfig(t *testing.T, repository LocalProviderRepository, cfg ProviderConfig) *LocalProvider {
 	f := genTmpFile("yes\ncorrect horse battery staple\ncorrect horse battery staple\n", t)
-	cfg := ProviderConfig{
-		BtcAddr:    btcAddr,
-		Keydir:     t.TempDir(),
-		AccountNum: 0,
-		PwdFile:    f.Name(),
-	}
+	cfg.BtcAddr = btcAddr
+	cfg.Keydir = t.TempDir()
+	cfg.AccountNum = 0
+	cfg.PwdFile = f.Name()
 	defer f.Close()
 
 	lp, err := NewLocalProvider(cfg, repository)
@@ -440,11 +747,16 @@ func TestLocalProvider(t *testing.T) {
 	t.Run("new", testNewLocal)
 	t.Run("get quote", testGetQuoteLocal)
 	t.Run("sign quote", testSignQuoteLocal)
+	t.Run("sign quote from quote", testSignQuoteFromQuote)
+	t.Run("get pegout quote", testGetPegoutQuoteLocal)
+	t.Run("sign pegout quote", testSignPegoutQuoteLocal)
+	t.Run("pegout not supported", testPegoutNotSupported)
 	t.Run("create password", testCreatePassword)
 	t.Run("create password", testCreatePassword)
 	t.Run("reject weak passwords", testRejectWeakPasswords)
 	t.Run("set liquidity", testSetLiquidity)
 	t.Run("sign quote with insufficient funds", testInsufficientFunds)
+	t.Run("sign quote with invalid required liquidity", testInvalidReqLiq)
 	t.Run("liquidity fluctuation", testLiquidityFluctuation)
 	t.Run("liquidity abnormal fluctuation", testLiquidityAbnormalFluctuation)
 }
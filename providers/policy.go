@@ -0,0 +1,319 @@
+package providers
+
+import (
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	gethTypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/rsksmart/liquidity-provider/types"
+	log "github.com/sirupsen/logrus"
+)
+
+// PolicyWindow is the length of the rolling window of SigningPolicy.MaxSignedValue.
+const PolicyWindow = 24 * time.Hour
+
+type PolicyRule string
+
+const (
+	PolicyRuleMaxQuoteValue        PolicyRule = "max_quote_value"
+	PolicyRuleMaxReqLiq            PolicyRule = "max_req_liq"
+	PolicyRuleMaxSignedValue       PolicyRule = "max_signed_value"
+	PolicyRuleContractAllowlist    PolicyRule = "contract_allowlist"
+	PolicyRuleDestinationAllowlist PolicyRule = "destination_allowlist"
+	PolicyRuleMaxGasLimit          PolicyRule = "max_gas_limit"
+	PolicyRuleMaxGasPrice          PolicyRule = "max_gas_price"
+	PolicyRuleChainId              PolicyRule = "chain_id"
+	PolicyRuleQuoteRequired        PolicyRule = "quote_required"
+)
+
+// SigningPolicy limits what the provider accepts to sign. Zero values disable the corresponding rule.
+type SigningPolicy struct {
+	// MaxQuoteValue is the maximum Value of a quote
+	MaxQuoteValue *types.Wei
+	// MaxReqLiq is the maximum liquidity a single peg-in or peg-out quote may reserve
+	MaxReqLiq *types.Wei
+	// MaxSignedValue caps the liquidity reserved plus the value of transactions signed in the last 24h, it requires a
+	// repository implementing SignedValueRepository
+	MaxSignedValue *types.Wei
+	// AllowedContracts lists the addresses quotes may call through ContractAddr
+	AllowedContracts []common.Address
+	// AllowedDestinations lists the addresses transactions may be sent to
+	AllowedDestinations []common.Address
+	// MaxGasLimit is the maximum gas limit of quotes and transactions
+	MaxGasLimit uint64
+	// MaxGasPrice is the maximum gas price, or fee cap, of transactions
+	MaxGasPrice *types.Wei
+	// AllowedChainIds lists the chains transactions and EIP-712 quotes may be signed for
+	AllowedChainIds []*big.Int
+}
+
+// ErrPolicyViolation is returned when signing is rejected by the SigningPolicy.
+type ErrPolicyViolation struct {
+	Rule   PolicyRule
+	Limit  string
+	Actual string
+}
+
+func (e *ErrPolicyViolation) Error() string {
+	if e.Limit == "" {
+		return fmt.Sprintf("signing policy violation: %v: %v", e.Rule, e.Actual)
+	}
+	return fmt.Sprintf("signing policy violation: %v: %v exceeds %v", e.Rule, e.Actual, e.Limit)
+}
+
+// SignedValueRepository stores the values accounted against SigningPolicy.MaxSignedValue, keyed by what was signed.
+type SignedValueRepository interface {
+	// AddSignedValue atomically accounts value under key, returning *ErrPolicyViolation if the values accounted after
+	// since would exceed limit. A key already accounted only adds the excess of value, and added is false.
+	AddSignedValue(key string, value *types.Wei, at time.Time, since time.Time, limit *types.Wei) (added bool, err error)
+	// RemoveSignedValue forgets the value accounted under key, it is not an error if there is none.
+	RemoveSignedValue(key string) error
+	// GetSignedValue returns the total of the values accounted after since.
+	GetSignedValue(since time.Time) (*types.Wei, error)
+}
+
+type signedValue struct {
+	at    time.Time
+	value *types.Wei
+}
+
+// memSignedValues is an in-memory SignedValueRepository, its values are lost when the process exits.
+type memSignedValues struct {
+	mu     sync.Mutex
+	values map[string]signedValue
+}
+
+func newMemSignedValues() *memSignedValues {
+	return &memSignedValues{values: make(map[string]signedValue)}
+}
+
+func (m *memSignedValues) AddSignedValue(key string, value *types.Wei, at time.Time, since time.Time, limit *types.Wei) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.prune(since)
+	entry, ok := m.values[key]
+	store, err := CheckSignedValue(entry.value, m.total(), value, limit)
+	if !store {
+		return false, err
+	}
+	if !ok {
+		entry.at = at
+	}
+	entry.value = value.Copy()
+	m.values[key] = entry
+	return !ok, nil
+}
+
+func (m *memSignedValues) RemoveSignedValue(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.values, key)
+	return nil
+}
+
+func (m *memSignedValues) GetSignedValue(since time.Time) (*types.Wei, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.prune(since)
+	return m.total(), nil
+}
+
+func (m *memSignedValues) prune(since time.Time) {
+	for key, entry := range m.values {
+		if !entry.at.After(since) {
+			delete(m.values, key)
+		}
+	}
+}
+
+func (m *memSignedValues) total() *types.Wei {
+	total := types.NewWei(0)
+	for _, entry := range m.values {
+		total.Add(total, entry.value)
+	}
+	return total
+}
+
+// CheckSignedValue implements the check of SignedValueRepository.AddSignedValue, reporting whether value must be
+// stored under the key.
+func CheckSignedValue(accounted, total, value, limit *types.Wei) (bool, error) {
+	excess := value.Copy()
+	if accounted != nil {
+		excess.Sub(excess, accounted)
+		if excess.AsBigInt().Sign() <= 0 {
+			return false, nil
+		}
+	}
+	if limit != nil {
+		total = new(types.Wei).Add(total, excess)
+		if total.Cmp(limit) > 0 {
+			return false, &ErrPolicyViolation{Rule: PolicyRuleMaxSignedValue, Limit: limit.String(), Actual: total.String()}
+		}
+	}
+	return true, nil
+}
+
+// PolicyEngine enforces a SigningPolicy, keeping track of the value signed within the rolling window.
+type PolicyEngine struct {
+	policy     SigningPolicy
+	clock      Clock
+	repository SignedValueRepository
+}
+
+// NewPolicyEngine returns a PolicyEngine that keeps the signed value in memory.
+func NewPolicyEngine(policy SigningPolicy, clock Clock) *PolicyEngine {
+	return NewPolicyEngineWithRepository(policy, clock, newMemSignedValues())
+}
+
+// NewPolicyEngineWithRepository returns a PolicyEngine that accounts the signed value in repository.
+func NewPolicyEngineWithRepository(policy SigningPolicy, clock Clock, repository SignedValueRepository) *PolicyEngine {
+	if clock == nil {
+		clock = SystemClock{}
+	}
+	return &PolicyEngine{
+		policy:     policy,
+		clock:      clock,
+		repository: repository,
+	}
+}
+
+// AuthorizeQuote checks the peg-in quote identified by hash and accounts reqLiq in the signed value. q is nil when
+// only the hash is known.
+func (e *PolicyEngine) AuthorizeQuote(hash string, q *types.Quote, reqLiq *types.Wei, chainId *big.Int) error {
+	_, err := e.authorizeQuote(hash, q, reqLiq, chainId)
+	return err
+}
+
+// AuthorizePegoutQuote checks the liquidity reserved by the peg-out quote identified by hash.
+func (e *PolicyEngine) AuthorizePegoutQuote(hash string, reqLiq *types.Wei) error {
+	_, err := e.authorizePegoutQuote(hash, reqLiq)
+	return err
+}
+
+// AuthorizeTx checks the transaction and, when it complies with the policy, accounts its value in the signed value.
+func (e *PolicyEngine) AuthorizeTx(tx *gethTypes.Transaction, chainId *big.Int) error {
+	_, err := e.authorizeTx(tx, chainId, "tx:"+tx.Hash().Hex())
+	return err
+}
+
+// AuthorizeQuoteTx is AuthorizeTx for the transaction paying the peg-in quote identified by hash.
+func (e *PolicyEngine) AuthorizeQuoteTx(tx *gethTypes.Transaction, chainId *big.Int, hash string) error {
+	_, err := e.authorizeTx(tx, chainId, "quote:"+hash)
+	return err
+}
+
+// authorizeQuote implements AuthorizeQuote, returning the key under which the value was accounted, or "" if it
+// already was.
+func (e *PolicyEngine) authorizeQuote(hash string, q *types.Quote, reqLiq *types.Wei, chainId *big.Int) (string, error) {
+	p := &e.policy
+	if q == nil {
+		if p.MaxQuoteValue != nil || len(p.AllowedContracts) > 0 || p.MaxGasLimit > 0 {
+			return "", &ErrPolicyViolation{Rule: PolicyRuleQuoteRequired, Actual: "quote hash " + hash}
+		}
+	} else {
+		if p.MaxQuoteValue != nil && q.Value.Cmp(p.MaxQuoteValue) > 0 {
+			return "", &ErrPolicyViolation{Rule: PolicyRuleMaxQuoteValue, Limit: p.MaxQuoteValue.String(), Actual: q.Value.String()}
+		}
+		if len(p.AllowedContracts) > 0 && !containsAddress(p.AllowedContracts, q.ContractAddr) {
+			return "", &ErrPolicyViolation{Rule: PolicyRuleContractAllowlist, Actual: q.ContractAddr}
+		}
+		if p.MaxGasLimit > 0 && uint64(q.GasLimit) > p.MaxGasLimit {
+			return "", &ErrPolicyViolation{Rule: PolicyRuleMaxGasLimit, Limit: fmt.Sprint(p.MaxGasLimit), Actual: fmt.Sprint(q.GasLimit)}
+		}
+	}
+	if chainId != nil {
+		if err := e.checkChainId(chainId); err != nil {
+			return "", err
+		}
+	}
+	return e.authorizeValue("quote:"+hash, reqLiq, p.MaxReqLiq, PolicyRuleMaxReqLiq)
+}
+
+func (e *PolicyEngine) authorizePegoutQuote(hash string, reqLiq *types.Wei) (string, error) {
+	return e.authorizeValue("pegout:"+hash, reqLiq, e.policy.MaxReqLiq, PolicyRuleMaxReqLiq)
+}
+
+func (e *PolicyEngine) authorizeTx(tx *gethTypes.Transaction, chainId *big.Int, key string) (string, error) {
+	p := &e.policy
+	if tx.Type() != gethTypes.LegacyTxType {
+		chainId = tx.ChainId()
+	}
+	if err := e.checkChainId(chainId); err != nil {
+		return "", err
+	}
+	if len(p.AllowedDestinations) > 0 {
+		if tx.To() == nil {
+			return "", &ErrPolicyViolation{Rule: PolicyRuleDestinationAllowlist, Actual: "contract creation"}
+		}
+		if !containsAddress(p.AllowedDestinations, tx.To().Hex()) {
+			return "", &ErrPolicyViolation{Rule: PolicyRuleDestinationAllowlist, Actual: tx.To().Hex()}
+		}
+	}
+	if p.MaxGasLimit > 0 && tx.Gas() > p.MaxGasLimit {
+		return "", &ErrPolicyViolation{Rule: PolicyRuleMaxGasLimit, Limit: fmt.Sprint(p.MaxGasLimit), Actual: fmt.Sprint(tx.Gas())}
+	}
+	if p.MaxGasPrice != nil && tx.GasFeeCap().Cmp(p.MaxGasPrice.AsBigInt()) > 0 {
+		return "", &ErrPolicyViolation{Rule: PolicyRuleMaxGasPrice, Limit: p.MaxGasPrice.String(), Actual: tx.GasFeeCap().String()}
+	}
+	return e.authorizeValue(key, types.NewBigWei(tx.Value()), nil, "")
+}
+
+// SignedValue returns the value signed within the rolling window.
+func (e *PolicyEngine) SignedValue() (*types.Wei, error) {
+	return e.repository.GetSignedValue(e.windowStart())
+}
+
+// release forgets the value accounted under key, used when signing fails after the policy authorized it.
+func (e *PolicyEngine) release(key string) {
+	if key == "" {
+		return
+	}
+	if err := e.repository.RemoveSignedValue(key); err != nil {
+		log.Errorf("error releasing signed value %v: %v", key, err)
+	}
+}
+
+// authorizeValue accounts value under key, returning the key, or "" if the value was already accounted under it.
+func (e *PolicyEngine) authorizeValue(key string, value *types.Wei, max *types.Wei, rule PolicyRule) (string, error) {
+	if max != nil && value.Cmp(max) > 0 {
+		return "", &ErrPolicyViolation{Rule: rule, Limit: max.String(), Actual: value.String()}
+	}
+	added, err := e.repository.AddSignedValue(key, value, e.clock.Now(), e.windowStart(), e.policy.MaxSignedValue)
+	if err != nil || !added {
+		return "", err
+	}
+	return key, nil
+}
+
+func (e *PolicyEngine) checkChainId(chainId *big.Int) error {
+	if len(e.policy.AllowedChainIds) == 0 {
+		return nil
+	}
+	for _, id := range e.policy.AllowedChainIds {
+		if chainId != nil && id.Cmp(chainId) == 0 {
+			return nil
+		}
+	}
+	return &ErrPolicyViolation{Rule: PolicyRuleChainId, Actual: fmt.Sprint(chainId)}
+}
+
+// windowStart returns the moment values signed at or before are no longer accounted.
+func (e *PolicyEngine) windowStart() time.Time {
+	return e.clock.Now().Add(-PolicyWindow)
+}
+
+func containsAddress(addrs []common.Address, addr string) bool {
+	if !common.IsHexAddress(addr) {
+		return false
+	}
+	a := common.HexToAddress(addr)
+	for _, allowed := range addrs {
+		if allowed == a {
+			return true
+		}
+	}
+	return false
+}
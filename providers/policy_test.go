@@ -0,0 +1,292 @@
+package providers
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	gethTypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/rsksmart/liquidity-provider/types"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	policyContract    = common.HexToAddress("0x0000000000000000000000000000000000000002")
+	policyDestination = common.HexToAddress("0x0000000000000000000000000000000000000003")
+)
+
+func newTestPolicy() SigningPolicy {
+	return SigningPolicy{
+		MaxQuoteValue:       types.NewWei(1000),
+		MaxReqLiq:           types.NewWei(1500),
+		MaxSignedValue:      types.NewWei(3000),
+		AllowedContracts:    []common.Address{policyContract},
+		AllowedDestinations: []common.Address{policyDestination},
+		MaxGasLimit:         100000,
+		MaxGasPrice:         types.NewWei(60000000),
+		AllowedChainIds:     []*big.Int{big.NewInt(31)},
+	}
+}
+
+func assertPolicyViolation(t *testing.T, err error, rule PolicyRule) {
+	t.Helper()
+	if rule == "" {
+		assert.Nil(t, err)
+		return
+	}
+	var violation *ErrPolicyViolation
+	if assert.ErrorAs(t, err, &violation) {
+		assert.Equal(t, rule, violation.Rule)
+	}
+}
+
+func TestPolicyEngine_AuthorizeQuote(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(q *types.Quote)
+		reqLiq  int64
+		chainId *big.Int
+		nilQ    bool
+		want    PolicyRule
+	}{
+		{name: "allowed", reqLiq: 1000},
+		{name: "allowed chain id", reqLiq: 1000, chainId: big.NewInt(31)},
+		{name: "quote value", modify: func(q *types.Quote) { q.Value = types.NewWei(1001) }, reqLiq: 1000, want: PolicyRuleMaxQuoteValue},
+		{name: "required liquidity", reqLiq: 1501, want: PolicyRuleMaxReqLiq},
+		{name: "contract", modify: func(q *types.Quote) { q.ContractAddr = "0x0000000000000000000000000000000000000004" }, reqLiq: 1000, want: PolicyRuleContractAllowlist},
+		{name: "invalid contract", modify: func(q *types.Quote) { q.ContractAddr = "abc" }, reqLiq: 1000, want: PolicyRuleContractAllowlist},
+		{name: "gas limit", modify: func(q *types.Quote) { q.GasLimit = 100001 }, reqLiq: 1000, want: PolicyRuleMaxGasLimit},
+		{name: "chain id", reqLiq: 1000, chainId: big.NewInt(30), want: PolicyRuleChainId},
+		{name: "quote required", reqLiq: 1000, nilQ: true, want: PolicyRuleQuoteRequired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewPolicyEngine(newTestPolicy(), nil)
+			q := &types.Quote{
+				ContractAddr: policyContract.Hex(),
+				GasLimit:     50000,
+				Value:        types.NewWei(1000),
+			}
+			if tt.modify != nil {
+				tt.modify(q)
+			}
+			if tt.nilQ {
+				q = nil
+			}
+			err := e.AuthorizeQuote("a", q, types.NewWei(tt.reqLiq), tt.chainId)
+			assertPolicyViolation(t, err, tt.want)
+		})
+	}
+}
+
+func TestPolicyEngine_AuthorizeTx(t *testing.T) {
+	chainId := big.NewInt(31)
+	tests := []struct {
+		name    string
+		tx      *gethTypes.Transaction
+		chainId *big.Int
+		want    PolicyRule
+	}{
+		{
+			name:    "allowed",
+			tx:      gethTypes.NewTransaction(0, policyDestination, big.NewInt(10), 21000, big.NewInt(60000000), nil),
+			chainId: chainId,
+		},
+		{
+			name:    "destination",
+			tx:      gethTypes.NewTransaction(0, policyContract, big.NewInt(10), 21000, big.NewInt(60000000), nil),
+			chainId: chainId,
+			want:    PolicyRuleDestinationAllowlist,
+		},
+		{
+			name:    "contract creation",
+			tx:      gethTypes.NewContractCreation(0, big.NewInt(10), 21000, big.NewInt(60000000), nil),
+			chainId: chainId,
+			want:    PolicyRuleDestinationAllowlist,
+		},
+		{
+			name:    "gas limit",
+			tx:      gethTypes.NewTransaction(0, policyDestination, big.NewInt(10), 100001, big.NewInt(60000000), nil),
+			chainId: chainId,
+			want:    PolicyRuleMaxGasLimit,
+		},
+		{
+			name:    "gas price",
+			tx:      gethTypes.NewTransaction(0, policyDestination, big.NewInt(10), 21000, big.NewInt(60000001), nil),
+			chainId: chainId,
+			want:    PolicyRuleMaxGasPrice,
+		},
+		{
+			name: "fee cap",
+			tx: gethTypes.NewTx(&gethTypes.DynamicFeeTx{
+				ChainID: chainId, To: &policyDestination, Gas: 21000, GasTipCap: big.NewInt(1), GasFeeCap: big.NewInt(60000001),
+			}),
+			want: PolicyRuleMaxGasPrice,
+		},
+		{
+			name:    "chain id",
+			tx:      gethTypes.NewTransaction(0, policyDestination, big.NewInt(10), 21000, big.NewInt(60000000), nil),
+			chainId: big.NewInt(30),
+			want:    PolicyRuleChainId,
+		},
+		{
+			name: "typed transaction chain id",
+			tx: gethTypes.NewTx(&gethTypes.DynamicFeeTx{
+				ChainID: big.NewInt(30), To: &policyDestination, Gas: 21000, GasTipCap: big.NewInt(1), GasFeeCap: big.NewInt(1),
+			}),
+			chainId: chainId,
+			want:    PolicyRuleChainId,
+		},
+		{
+			name:    "signed value",
+			tx:      gethTypes.NewTransaction(0, policyDestination, big.NewInt(3001), 21000, big.NewInt(60000000), nil),
+			chainId: chainId,
+			want:    PolicyRuleMaxSignedValue,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewPolicyEngine(newTestPolicy(), nil)
+			assertPolicyViolation(t, e.AuthorizeTx(tt.tx, tt.chainId), tt.want)
+		})
+	}
+}
+
+func TestPolicyEngine_RollingWindow(t *testing.T) {
+	clock := newFakeClock(time.Unix(1600000000, 0))
+	e := NewPolicyEngine(SigningPolicy{MaxSignedValue: types.NewWei(3000)}, clock)
+	assert.Nil(t, e.AuthorizeQuote("a", nil, types.NewWei(1500), nil))
+	clock.Skip(time.Hour)
+	assert.Nil(t, e.AuthorizePegoutQuote("b", types.NewWei(1500)))
+	// the same quote is only accounted once
+	assert.Nil(t, e.AuthorizeQuote("a", nil, types.NewWei(1500), nil))
+	assertSignedValue(t, e, 3000)
+
+	assertPolicyViolation(t, e.AuthorizeQuote("c", nil, types.NewWei(1), nil), PolicyRuleMaxSignedValue)
+
+	clock.Skip(PolicyWindow - time.Hour)
+	assertSignedValue(t, e, 1500)
+	assert.Nil(t, e.AuthorizeQuote("c", nil, types.NewWei(1500), nil))
+	assertPolicyViolation(t, e.AuthorizeQuote("d", nil, types.NewWei(1), nil), PolicyRuleMaxSignedValue)
+
+	clock.Skip(time.Hour)
+	assert.Nil(t, e.AuthorizeQuote("d", nil, types.NewWei(1), nil))
+	assertSignedValue(t, e, 1501)
+}
+
+func TestPolicyEngine_AuthorizeQuoteTx(t *testing.T) {
+	e := NewPolicyEngine(SigningPolicy{MaxSignedValue: types.NewWei(3000)}, nil)
+	assert.Nil(t, e.AuthorizeQuote("a", nil, types.NewWei(1500), nil))
+
+	// the transaction paying the quote is accounted with its liquidity
+	tx := gethTypes.NewTransaction(0, policyDestination, big.NewInt(1500), 21000, big.NewInt(1), nil)
+	assert.Nil(t, e.AuthorizeQuoteTx(tx, nil, "a"))
+	assertSignedValue(t, e, 1500)
+	// only the value exceeding the liquidity of the quote is added
+	tx = gethTypes.NewTransaction(1, policyDestination, big.NewInt(2000), 21000, big.NewInt(1), nil)
+	assert.Nil(t, e.AuthorizeQuoteTx(tx, nil, "a"))
+	assertSignedValue(t, e, 2000)
+	tx = gethTypes.NewTransaction(2, policyDestination, big.NewInt(3001), 21000, big.NewInt(1), nil)
+	assertPolicyViolation(t, e.AuthorizeQuoteTx(tx, nil, "a"), PolicyRuleMaxSignedValue)
+	assertSignedValue(t, e, 2000)
+
+	// the same transaction signed without its quote is accounted on its own
+	tx = gethTypes.NewTransaction(3, policyDestination, big.NewInt(1000), 21000, big.NewInt(1), nil)
+	assert.Nil(t, e.AuthorizeTx(tx, nil))
+	assertSignedValue(t, e, 3000)
+}
+
+func assertSignedValue(t *testing.T, e *PolicyEngine, want int64) {
+	t.Helper()
+	value, err := e.SignedValue()
+	if assert.NoError(t, err) {
+		assert.EqualValues(t, types.NewWei(want), value)
+	}
+}
+
+func TestLocalProviderSigningPolicy(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := NewExternalSigner(startStubSignerHTTP(t, key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer signer.Close()
+
+	repository := NewInMemRetainedQuotesRepository()
+	repository.SetLiquidity(types.NewWei(1000))
+	repository.SetPegoutLiquidity(types.NewWei(1000))
+	lp, err := NewLocalProviderWithSigner(ProviderConfig{
+		ChainId: big.NewInt(31),
+		Policy: &SigningPolicy{
+			MaxReqLiq:           types.NewWei(800),
+			MaxSignedValue:      types.NewWei(1500),
+			AllowedDestinations: []common.Address{policyDestination},
+		},
+	}, signer, repository)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash := crypto.Keccak256([]byte("a"))
+	_, err = lp.SignQuote(hash, "abc", types.NewWei(801))
+	assertPolicyViolation(t, err, PolicyRuleMaxReqLiq)
+	_, err = lp.SignQuote(hash, "abc", types.NewWei(800))
+	assert.Nil(t, err)
+
+	// the value of quotes rejected by the repository is not accounted
+	hash = crypto.Keccak256([]byte("b"))
+	_, err = lp.SignQuote(hash, "abc", types.NewWei(600))
+	var liqErr *ErrInsufficientLiquidity
+	assert.True(t, errors.As(err, &liqErr))
+	assertSignedValue(t, lp.policy, 800)
+
+	_, err = lp.SignPegoutQuote(hash, types.NewWei(600))
+	assert.Nil(t, err)
+	_, err = lp.SignPegoutQuote(crypto.Keccak256([]byte("c")), types.NewWei(200))
+	assertPolicyViolation(t, err, PolicyRuleMaxSignedValue)
+
+	addr := crypto.PubkeyToAddress(key.PublicKey)
+	_, err = lp.SignTx(addr, gethTypes.NewTransaction(0, policyContract, big.NewInt(1), 21000, big.NewInt(1), nil))
+	assertPolicyViolation(t, err, PolicyRuleDestinationAllowlist)
+	_, err = lp.SignTx(addr, gethTypes.NewTransaction(0, policyDestination, big.NewInt(100), 21000, big.NewInt(1), nil))
+	assert.Nil(t, err)
+	assertSignedValue(t, lp.policy, 1500)
+
+	// the transaction paying the first quote is covered by its liquidity
+	_, err = lp.SignQuoteTx(addr, gethTypes.NewTransaction(1, policyDestination, big.NewInt(800), 21000, big.NewInt(1), nil), crypto.Keccak256([]byte("a")))
+	assert.Nil(t, err)
+	assertSignedValue(t, lp.policy, 1500)
+	_, err = lp.SignTx(addr, gethTypes.NewTransaction(1, policyDestination, big.NewInt(800), 21000, big.NewInt(1), nil))
+	assertPolicyViolation(t, err, PolicyRuleMaxSignedValue)
+
+	// the signed value is kept by the repository
+	lp, err = NewLocalProviderWithSigner(ProviderConfig{
+		ChainId: big.NewInt(31),
+		Policy:  &SigningPolicy{MaxSignedValue: types.NewWei(1500)},
+	}, signer, repository)
+	if assert.NoError(t, err) {
+		assertSignedValue(t, lp.policy, 1500)
+	}
+}
+
+type noSignedValueRepository struct {
+	LocalProviderRepository
+}
+
+func TestLocalProviderSignedValueRepository(t *testing.T) {
+	ks, acc := newTestKeystoreAccount(t)
+	repository := noSignedValueRepository{NewInMemRetainedQuotesRepository()}
+	cfg := ProviderConfig{Policy: &SigningPolicy{MaxSignedValue: types.NewWei(1500)}}
+	_, err := NewLocalProviderWithSigner(cfg, NewKeystoreSigner(ks, acc), repository)
+	assert.ErrorIs(t, err, ErrSignedValueStore)
+
+	cfg.Policy = &SigningPolicy{MaxReqLiq: types.NewWei(1500)}
+	_, err = NewLocalProviderWithSigner(cfg, NewKeystoreSigner(ks, acc), repository)
+	assert.NoError(t, err)
+}
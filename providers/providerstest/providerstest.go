@@ -0,0 +1,54 @@
+// Package providerstest provides fakes of the provider dependencies for tests. It does not import the providers
+// package, so the tests of providers can use it too.
+package providerstest
+
+import (
+	"context"
+	"sync"
+
+	"github.com/rsksmart/liquidity-provider/types"
+)
+
+// FakeGasPriceOracle is a providers.GasPriceOracle for tests. It returns the gas price or the error it is set to, and
+// counts the calls it serves.
+type FakeGasPriceOracle struct {
+	mu    sync.Mutex
+	price *types.Wei
+	err   error
+	calls int
+}
+
+func NewFakeGasPriceOracle(price *types.Wei) *FakeGasPriceOracle {
+	return &FakeGasPriceOracle{price: price}
+}
+
+// Set changes the gas price and the error returned by the next calls.
+func (o *FakeGasPriceOracle) Set(price *types.Wei, err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.price = price
+	o.err = err
+}
+
+// Calls returns the number of calls served so far.
+func (o *FakeGasPriceOracle) Calls() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.calls
+}
+
+func (o *FakeGasPriceOracle) GasPrice(ctx context.Context) (*types.Wei, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.calls++
+	if o.err != nil {
+		return nil, o.err
+	}
+	if o.price == nil {
+		return nil, nil
+	}
+	return o.price.Copy(), nil
+}
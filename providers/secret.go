@@ -0,0 +1,126 @@
+package providers
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"syscall"
+)
+
+var (
+	ErrSecretNotSet       = errors.New("secret is not set")
+	ErrInsecureSecretFile = errors.New("secret file must not be accessible by group or others")
+)
+
+// SecretSource provides a secret, such as the keystore password, without user interaction. String describes where
+// the secret comes from and must never include the secret itself.
+type SecretSource interface {
+	Secret() (string, error)
+	String() string
+}
+
+// EnvSecretSource reads the secret from an environment variable, which is unset once read so it is not inherited by
+// child processes.
+type EnvSecretSource struct {
+	Name string
+}
+
+func (s EnvSecretSource) Secret() (string, error) {
+	secret, ok := os.LookupEnv(s.Name)
+	if !ok {
+		return "", fmt.Errorf("%w: environment variable %v", ErrSecretNotSet, s.Name)
+	}
+	if err := os.Unsetenv(s.Name); err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+func (s EnvSecretSource) String() string {
+	return "environment variable " + s.Name
+}
+
+// FileSecretSource reads the secret from a regular file that only its owner can access. A single trailing newline is
+// ignored.
+type FileSecretSource struct {
+	Path string
+}
+
+func (s FileSecretSource) Secret() (string, error) {
+	// the checks are made on the opened file, so the path cannot be swapped between checking and reading it. Opening
+	// without blocking keeps a FIFO from hanging until it is rejected.
+	f, err := os.OpenFile(s.Path, os.O_RDONLY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return "", err
+	}
+	defer func(f *os.File) {
+		_ = f.Close()
+	}(f)
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	if !info.Mode().IsRegular() {
+		return "", fmt.Errorf("secret file %v is not a regular file", s.Path)
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		return "", fmt.Errorf("%w: %v has mode %v", ErrInsecureSecretFile, s.Path, info.Mode().Perm())
+	}
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		return "", err
+	}
+	return trimSecret(string(b)), nil
+}
+
+func (s FileSecretSource) String() string {
+	return "file " + s.Path
+}
+
+// FDSecretSource reads the secret from an inherited file descriptor, e.g. a pipe set up by the process supervisor,
+// until EOF. The descriptor is closed afterwards, so the secret can only be read once.
+type FDSecretSource struct {
+	FD uintptr
+}
+
+func (s FDSecretSource) Secret() (string, error) {
+	f := os.NewFile(s.FD, fmt.Sprintf("fd%v", s.FD))
+	if f == nil {
+		return "", fmt.Errorf("invalid file descriptor %v", s.FD)
+	}
+	defer func(f *os.File) {
+		_ = f.Close()
+	}(f)
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		return "", fmt.Errorf("error reading file descriptor %v: %v", s.FD, err)
+	}
+	return trimSecret(string(b)), nil
+}
+
+func (s FDSecretSource) String() string {
+	return fmt.Sprintf("file descriptor %v", s.FD)
+}
+
+// PasswordSecretSource returns the configured source of the keystore password with the highest precedence, or nil.
+func (cfg *ProviderConfig) PasswordSecretSource() SecretSource {
+	switch {
+	case cfg.PasswordSource != nil:
+		return cfg.PasswordSource
+	case cfg.PasswordEnv != "":
+		return EnvSecretSource{Name: cfg.PasswordEnv}
+	case cfg.PasswordFile != "":
+		return FileSecretSource{Path: cfg.PasswordFile}
+	case cfg.PasswordFD != 0:
+		return FDSecretSource{FD: cfg.PasswordFD}
+	default:
+		return nil
+	}
+}
+
+func trimSecret(s string) string {
+	s = strings.TrimSuffix(s, "\n")
+	return strings.TrimSuffix(s, "\r")
+}
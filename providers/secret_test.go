@@ -0,0 +1,161 @@
+package providers
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeSecretFile(t *testing.T, content string, perm os.FileMode) string {
+	path := filepath.Join(t.TempDir(), "secret")
+	if err := ioutil.WriteFile(path, []byte(content), perm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(path, perm); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestEnvSecretSource(t *testing.T) {
+	const name = "LP_TEST_SECRET"
+	if err := os.Setenv(name, testPasswd); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Unsetenv(name)
+
+	source := EnvSecretSource{Name: name}
+	got, err := source.Secret()
+	assert.Nil(t, err)
+	assert.Equal(t, testPasswd, got)
+	_, ok := os.LookupEnv(name)
+	assert.False(t, ok, "environment variable was not unset")
+
+	_, err = source.Secret()
+	assert.ErrorIs(t, err, ErrSecretNotSet)
+	assert.NotContains(t, source.String(), testPasswd)
+}
+
+func TestFileSecretSource(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		perm    os.FileMode
+		want    string
+		wantErr error
+	}{
+		{name: "owner only", content: testPasswd, perm: 0600, want: testPasswd},
+		{name: "read only", content: testPasswd + "\n", perm: 0400, want: testPasswd},
+		{name: "windows newline", content: testPasswd + "\r\n", perm: 0600, want: testPasswd},
+		{name: "group readable", content: testPasswd, perm: 0640, wantErr: ErrInsecureSecretFile},
+		{name: "world readable", content: testPasswd, perm: 0604, wantErr: ErrInsecureSecretFile},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := FileSecretSource{Path: writeSecretFile(t, tt.content, tt.perm)}
+			got, err := source.Secret()
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Secret() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				if err != nil && strings.Contains(err.Error(), testPasswd) {
+					t.Errorf("Secret() error reveals the secret: %v", err)
+				}
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	_, err := FileSecretSource{Path: filepath.Join(t.TempDir(), "missing")}.Secret()
+	assert.NotNil(t, err)
+	_, err = FileSecretSource{Path: t.TempDir()}.Secret()
+	assert.NotNil(t, err)
+}
+
+func TestFDSecretSource(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		_, _ = w.WriteString(testPasswd + "\n")
+		_ = w.Close()
+	}()
+	source := FDSecretSource{FD: r.Fd()}
+	got, err := source.Secret()
+	assert.Nil(t, err)
+	assert.Equal(t, testPasswd, got)
+	assert.NotContains(t, source.String(), testPasswd)
+}
+
+func TestPasswordSourcePrecedence(t *testing.T) {
+	custom := EnvSecretSource{Name: "CUSTOM"}
+	tests := []struct {
+		name string
+		cfg  ProviderConfig
+		want SecretSource
+	}{
+		{name: "none", cfg: ProviderConfig{PwdFile: "pwd"}, want: nil},
+		{name: "fd", cfg: ProviderConfig{PasswordFD: 3, PwdFile: "pwd"}, want: FDSecretSource{FD: 3}},
+		{name: "file", cfg: ProviderConfig{PasswordFile: "secret", PasswordFD: 3}, want: FileSecretSource{Path: "secret"}},
+		{name: "env", cfg: ProviderConfig{PasswordEnv: "LP_PASSWORD", PasswordFile: "secret", PasswordFD: 3}, want: EnvSecretSource{Name: "LP_PASSWORD"}},
+		{name: "custom", cfg: ProviderConfig{PasswordSource: custom, PasswordEnv: "LP_PASSWORD"}, want: custom},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.cfg.PasswordSecretSource())
+		})
+	}
+}
+
+func TestNewLocalProviderPasswordSource(t *testing.T) {
+	keydir, addrs := newTestKeystore(t, 2)
+	lp, err := NewLocalProvider(ProviderConfig{
+		Keydir:            keydir,
+		AccountAddr:       addrs[0].Hex(),
+		ExtraAccountAddrs: []string{addrs[1].Hex()},
+		PasswordFile:      writeSecretFile(t, testPasswd+"\n", 0600),
+	}, NewInMemRetainedQuotesRepository())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, addrs[0].String(), lp.Address())
+
+	// the password file of the terminal prompt is not opened when a source takes precedence
+	_, err = NewLocalProvider(ProviderConfig{
+		Keydir:       keydir,
+		AccountAddr:  addrs[0].Hex(),
+		PasswordFile: writeSecretFile(t, testPasswd+"\n", 0600),
+		PwdFile:      filepath.Join(t.TempDir(), "missing"),
+	}, NewInMemRetainedQuotesRepository())
+	assert.NoError(t, err)
+	_, err = NewLocalProvider(ProviderConfig{
+		Keydir:      keydir,
+		AccountAddr: addrs[0].Hex(),
+		PwdFile:     filepath.Join(t.TempDir(), "missing"),
+	}, NewInMemRetainedQuotesRepository())
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	_, err = NewLocalProvider(ProviderConfig{
+		Keydir:       keydir,
+		AccountAddr:  addrs[0].Hex(),
+		PasswordFile: writeSecretFile(t, "wrong horse battery staple\n", 0600),
+	}, NewInMemRetainedQuotesRepository())
+	assert.NotNil(t, err)
+
+	// new accounts must have a strong password as well
+	_, err = NewLocalProvider(ProviderConfig{
+		Keydir:       t.TempDir(),
+		PasswordFile: writeSecretFile(t, "weak", 0600),
+	}, NewInMemRetainedQuotesRepository())
+	if assert.ErrorIs(t, err, ErrWeakPassword) {
+		assert.NotContains(t, err.Error(), "weak")
+	}
+}
@@ -0,0 +1,178 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/rsksmart/liquidity-provider/types"
+)
+
+type SignatureScheme string
+
+const (
+	// SignatureSchemePersonalSign signs the LBC quote hash prefixed with "\x19Ethereum Signed Message:\n32".
+	SignatureSchemePersonalSign SignatureScheme = "personal_sign"
+	// SignatureSchemeEIP712 signs the quote as an EIP-712 PeginQuote typed data struct.
+	SignatureSchemeEIP712 SignatureScheme = "eip712"
+)
+
+var (
+	ErrInvalidQuoteHash       = errors.New("quote hash must be 32 bytes long")
+	ErrInvalidSignatureLength = errors.New("signature must be 65 bytes long")
+	ErrInvalidSignatureV      = errors.New("signature recovery id must be 0, 1, 27 or 28")
+	ErrMalleableSignature     = errors.New("signature s value is in the upper half of the curve order")
+	ErrInvalidSignature       = errors.New("invalid signature")
+	ErrInvalidProviderAddress = errors.New("invalid provider address")
+	ErrWrongSigner            = errors.New("quote was not signed by the expected provider")
+	ErrUnknownSignatureScheme = errors.New("unknown signature scheme")
+	ErrQuoteRequired          = errors.New("signature scheme requires the full quote instead of its hash")
+	ErrPegoutSignatureScheme  = errors.New("peg-out quotes can only be signed with personal_sign")
+)
+
+var secp256k1HalfN = new(big.Int).Rsh(crypto.S256().Params().N, 1)
+
+// RecoverQuoteSigner returns the address of the account that signed the quote hash. The signature is expected in
+// the format produced by SignQuote, although a recovery id of 0 or 1 is also accepted.
+func RecoverQuoteSigner(hash []byte, sig []byte) (common.Address, error) {
+	if len(hash) != 32 {
+		return common.Address{}, ErrInvalidQuoteHash
+	}
+	return recoverSigner(quoteDigest(hash), sig)
+}
+
+// RecoverQuoteSignerWithScheme returns the address of the account that signed the quote using the given scheme.
+// The chainId is only used by the EIP-712 scheme.
+func RecoverQuoteSignerWithScheme(q *types.Quote, chainId *big.Int, sig []byte, scheme SignatureScheme) (common.Address, error) {
+	digest, err := QuoteDigest(q, chainId, scheme)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return recoverSigner(digest, sig)
+}
+
+// DetectQuoteSignatureScheme returns the scheme under which sig is a valid signature of the quote made by its LPRSKAddr.
+func DetectQuoteSignatureScheme(q *types.Quote, chainId *big.Int, sig []byte) (SignatureScheme, error) {
+	if !common.IsHexAddress(q.LPRSKAddr) {
+		return "", fmt.Errorf("%w: %v", ErrInvalidProviderAddress, q.LPRSKAddr)
+	}
+	for _, scheme := range []SignatureScheme{SignatureSchemePersonalSign, SignatureSchemeEIP712} {
+		if scheme == SignatureSchemeEIP712 && chainId == nil {
+			continue
+		}
+		signer, err := RecoverQuoteSignerWithScheme(q, chainId, sig, scheme)
+		if err != nil {
+			return "", err
+		}
+		if signer == common.HexToAddress(q.LPRSKAddr) {
+			return scheme, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %v", ErrWrongSigner, q.LPRSKAddr)
+}
+
+// QuoteDigest returns the digest that is signed for the quote under the given scheme.
+func QuoteDigest(q *types.Quote, chainId *big.Int, scheme SignatureScheme) ([]byte, error) {
+	switch scheme {
+	case SignatureSchemePersonalSign:
+		hash, err := q.Hash()
+		if err != nil {
+			return nil, err
+		}
+		return quoteDigest(hash), nil
+	case SignatureSchemeEIP712:
+		return q.TypedDataHash(chainId)
+	default:
+		return nil, fmt.Errorf("%w: %v", ErrUnknownSignatureScheme, scheme)
+	}
+}
+
+// SignQuoteWith signs the quote with signer under the given scheme, producing the signature SignQuoteFromQuote would
+// without retaining the quote. The chainId is only used by the EIP-712 scheme.
+func SignQuoteWith(signer Signer, q *types.Quote, chainId *big.Int, scheme SignatureScheme) ([]byte, error) {
+	return SignQuoteWithContext(context.Background(), signer, q, chainId, scheme)
+}
+
+// SignQuoteWithContext is SignQuoteWith, giving up when ctx is done.
+func SignQuoteWithContext(ctx context.Context, signer Signer, q *types.Quote, chainId *big.Int, scheme SignatureScheme) ([]byte, error) {
+	var signB []byte
+	switch scheme {
+	case SignatureSchemePersonalSign:
+		hash, err := q.Hash()
+		if err != nil {
+			return nil, fmt.Errorf("error hashing quote: %v", err)
+		}
+		if signB, err = signText(ctx, signer, hash); err != nil {
+			return nil, err
+		}
+	case SignatureSchemeEIP712:
+		if chainId == nil {
+			return nil, ErrChainIdRequired
+		}
+		td, err := q.TypedData(chainId)
+		if err != nil {
+			return nil, fmt.Errorf("error hashing quote: %v", err)
+		}
+		if signB, err = signTypedData(ctx, signer, td); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("%w: %v", ErrUnknownSignatureScheme, scheme)
+	}
+	signB[len(signB)-1] += 27 // v must be 27 or 28
+	return signB, nil
+}
+
+func recoverSigner(digest []byte, sig []byte) (common.Address, error) {
+	if len(sig) != crypto.SignatureLength {
+		return common.Address{}, ErrInvalidSignatureLength
+	}
+	s := make([]byte, crypto.SignatureLength)
+	copy(s, sig)
+	v := s[crypto.RecoveryIDOffset]
+	switch v {
+	case 0, 1:
+	case 27, 28:
+		s[crypto.RecoveryIDOffset] = v - 27
+	default:
+		return common.Address{}, ErrInvalidSignatureV
+	}
+	r, sv := new(big.Int).SetBytes(s[:32]), new(big.Int).SetBytes(s[32:64])
+	if sv.Cmp(secp256k1HalfN) > 0 {
+		return common.Address{}, ErrMalleableSignature
+	}
+	if !crypto.ValidateSignatureValues(s[crypto.RecoveryIDOffset], r, sv, true) {
+		return common.Address{}, ErrInvalidSignature
+	}
+	pub, err := crypto.SigToPub(digest, s)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	return crypto.PubkeyToAddress(*pub), nil
+}
+
+// VerifyQuoteSignature checks that sig is a valid signature of the quote hash made by the expectedLP account.
+func VerifyQuoteSignature(hash []byte, sig []byte, expectedLP string) error {
+	if !common.IsHexAddress(expectedLP) {
+		return fmt.Errorf("%w: %v", ErrInvalidProviderAddress, expectedLP)
+	}
+	signer, err := RecoverQuoteSigner(hash, sig)
+	if err != nil {
+		return err
+	}
+	if signer != common.HexToAddress(expectedLP) {
+		return fmt.Errorf("%w: expected %v, got %v", ErrWrongSigner, common.HexToAddress(expectedLP), signer)
+	}
+	return nil
+}
+
+func quoteDigest(hash []byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("\x19Ethereum Signed Message:\n32")
+	buf.Write(hash)
+	return crypto.Keccak256(buf.Bytes())
+}
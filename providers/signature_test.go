@@ -0,0 +1,265 @@
+package providers
+
+import (
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/rsksmart/liquidity-provider/types"
+)
+
+const testLPAddr = "0xd562c283d2260c62110fa3da885842afbe16bda2"
+
+func TestRecoverQuoteSigner(t *testing.T) {
+	for _, sign := range expectedSign {
+		h, _ := hex.DecodeString(sign.h)
+		s, _ := hex.DecodeString(sign.s)
+		got, err := RecoverQuoteSigner(h, s)
+		if err != nil {
+			t.Fatalf("RecoverQuoteSigner() error = %v", err)
+		}
+		if got != common.HexToAddress(testLPAddr) {
+			t.Errorf("RecoverQuoteSigner() = %v, want %v", got, testLPAddr)
+		}
+
+		// a recovery id of 0 or 1 must recover the same signer
+		s[len(s)-1] -= 27
+		got, err = RecoverQuoteSigner(h, s)
+		if err != nil {
+			t.Fatalf("RecoverQuoteSigner() error = %v", err)
+		}
+		if got != common.HexToAddress(testLPAddr) {
+			t.Errorf("RecoverQuoteSigner() = %v, want %v", got, testLPAddr)
+		}
+	}
+}
+
+func TestVerifyQuoteSignature(t *testing.T) {
+	h, _ := hex.DecodeString(expectedSign[0].h)
+	s, _ := hex.DecodeString(expectedSign[0].s)
+
+	tests := []struct {
+		name       string
+		hash       []byte
+		sig        func() []byte
+		expectedLP string
+		wantErr    error
+	}{
+		{
+			name:       "valid signature",
+			hash:       h,
+			sig:        func() []byte { return s },
+			expectedLP: testLPAddr,
+		},
+		{
+			name:       "wrong signer",
+			hash:       h,
+			sig:        func() []byte { return s },
+			expectedLP: "0x0000000000000000000000000000000000000001",
+			wantErr:    ErrWrongSigner,
+		},
+		{
+			name:       "invalid provider address",
+			hash:       h,
+			sig:        func() []byte { return s },
+			expectedLP: "abc",
+			wantErr:    ErrInvalidProviderAddress,
+		},
+		{
+			name:       "invalid hash",
+			hash:       h[:31],
+			sig:        func() []byte { return s },
+			expectedLP: testLPAddr,
+			wantErr:    ErrInvalidQuoteHash,
+		},
+		{
+			name:       "invalid signature length",
+			hash:       h,
+			sig:        func() []byte { return s[:64] },
+			expectedLP: testLPAddr,
+			wantErr:    ErrInvalidSignatureLength,
+		},
+		{
+			name: "invalid v",
+			hash: h,
+			sig: func() []byte {
+				b := append([]byte{}, s...)
+				b[64] = 29
+				return b
+			},
+			expectedLP: testLPAddr,
+			wantErr:    ErrInvalidSignatureV,
+		},
+		{
+			name: "high s",
+			hash: h,
+			sig: func() []byte {
+				b := append([]byte{}, s...)
+				sv := new(big.Int).Sub(crypto.S256().Params().N, new(big.Int).SetBytes(b[32:64]))
+				copy(b[32:64], common.LeftPadBytes(sv.Bytes(), 32))
+				b[64] = 27 + 28 - b[64]
+				return b
+			},
+			expectedLP: testLPAddr,
+			wantErr:    ErrMalleableSignature,
+		},
+		{
+			name: "zero r",
+			hash: h,
+			sig: func() []byte {
+				b := append([]byte{}, s...)
+				copy(b[:32], make([]byte, 32))
+				return b
+			},
+			expectedLP: testLPAddr,
+			wantErr:    ErrInvalidSignature,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifyQuoteSignature(tt.hash, tt.sig(), tt.expectedLP)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("VerifyQuoteSignature() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func newSchemeTestQuote() *types.Quote {
+	return &types.Quote{
+		FedBTCAddr:    "3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy",
+		LBCAddr:       "0xC52AbEae2f7A6e2E3C5Ab1C2a7E21B6F4A2F1C10",
+		LPRSKAddr:     testLPAddr,
+		BTCRefundAddr: "mipcBbFg9gMiCh81Kj8tqqdgoZub1ZJRfn",
+		RSKRefundAddr: "0x0000000000000000000000000000000000000001",
+		LPBTCAddr:     "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2",
+		CallFee:       types.NewWei(501000),
+		PenaltyFee:    types.NewWei(1000000),
+		ContractAddr:  "0x0000000000000000000000000000000000000002",
+		Value:         types.NewWei(3000000),
+	}
+}
+
+func TestSignatureSchemes(t *testing.T) {
+	chainId := big.NewInt(31)
+	for _, scheme := range []SignatureScheme{SignatureSchemePersonalSign, SignatureSchemeEIP712} {
+		t.Run(string(scheme), func(t *testing.T) {
+			f := genTmpFile("correct horse battery staple\n", t)
+			defer f.Close()
+			repository := NewInMemRetainedQuotesRepository()
+			repository.SetLiquidity(types.NewWei(200))
+			lp, err := NewLocalProvider(ProviderConfig{
+				Keydir:          "./testdata/keystore/keystore",
+				PwdFile:         f.Name(),
+				ChainId:         chainId,
+				SignatureScheme: scheme,
+			}, repository)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if lp.SignatureScheme() != scheme {
+				t.Fatalf("SignatureScheme() = %v, want %v", lp.SignatureScheme(), scheme)
+			}
+
+			q := newSchemeTestQuote()
+			sig, err := lp.SignQuoteFromQuote(q, "abc", types.NewWei(100))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := DetectQuoteSignatureScheme(q, chainId, sig)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != scheme {
+				t.Errorf("DetectQuoteSignatureScheme() = %v, want %v", got, scheme)
+			}
+			signer, err := RecoverQuoteSignerWithScheme(q, chainId, sig, scheme)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if signer != common.HexToAddress(testLPAddr) {
+				t.Errorf("RecoverQuoteSignerWithScheme() = %v, want %v", signer, testLPAddr)
+			}
+
+			q.Nonce++
+			if _, err = DetectQuoteSignatureScheme(q, chainId, sig); !errors.Is(err, ErrWrongSigner) {
+				t.Errorf("DetectQuoteSignatureScheme() error = %v, wantErr %v", err, ErrWrongSigner)
+			}
+
+			hash, _ := q.Hash()
+			_, err = lp.SignQuote(hash, "abc", types.NewWei(100))
+			if scheme == SignatureSchemeEIP712 && !errors.Is(err, ErrQuoteRequired) {
+				t.Errorf("SignQuote() error = %v, wantErr %v", err, ErrQuoteRequired)
+			}
+			if scheme == SignatureSchemePersonalSign && err != nil {
+				t.Errorf("SignQuote() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestSignQuoteWith(t *testing.T) {
+	chainId := big.NewInt(31)
+	ks := keystore.NewKeyStore("./testdata/keystore/keystore", keystore.StandardScryptN, keystore.StandardScryptP)
+	if _, err := UnlockKeystoreSigner(ks, testLPAddr, "wrong password"); err == nil {
+		t.Fatal("UnlockKeystoreSigner() did not fail with a wrong password")
+	}
+	signer, err := UnlockKeystoreSigner(ks, testLPAddr, "correct horse battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := newSchemeTestQuote()
+	for _, scheme := range []SignatureScheme{SignatureSchemePersonalSign, SignatureSchemeEIP712} {
+		sig, err := SignQuoteWith(signer, q, chainId, scheme)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := DetectQuoteSignatureScheme(q, chainId, sig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != scheme {
+			t.Errorf("DetectQuoteSignatureScheme() = %v, want %v", got, scheme)
+		}
+	}
+	if _, err = SignQuoteWith(signer, q, nil, SignatureSchemeEIP712); err == nil {
+		t.Error("SignQuoteWith() did not fail without chain id")
+	}
+	if _, err = SignQuoteWith(signer, q, chainId, "eth_sign"); !errors.Is(err, ErrUnknownSignatureScheme) {
+		t.Errorf("SignQuoteWith() error = %v, wantErr %v", err, ErrUnknownSignatureScheme)
+	}
+}
+
+func TestNewLocalProviderSignatureScheme(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     ProviderConfig
+		wantErr error
+	}{
+		{
+			name:    "unknown scheme",
+			cfg:     ProviderConfig{SignatureScheme: "eth_sign"},
+			wantErr: ErrUnknownSignatureScheme,
+		},
+		{
+			name: "eip712 without chain id",
+			cfg:  ProviderConfig{SignatureScheme: SignatureSchemeEIP712},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.Keydir = t.TempDir()
+			_, err := NewLocalProvider(tt.cfg, NewInMemRetainedQuotesRepository())
+			if err == nil {
+				t.Fatal("NewLocalProvider() did not fail")
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("NewLocalProvider() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	gethTypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/rsksmart/liquidity-provider/types"
+)
+
+var ErrSignerAccountMismatch = errors.New("signature was not made by the signer account")
+
+// Signer signs quotes and transactions on behalf of a single RSK account. Signatures are 65 bytes long, with a
+// recovery id of 0 or 1.
+type Signer interface {
+	Address() common.Address
+	// SignText signs keccak256("\x19Ethereum Signed Message:\n" + len(text) + text).
+	SignText(text []byte) ([]byte, error)
+	// SignTypedData signs the EIP-712 digest of the typed data.
+	SignTypedData(td *types.TypedData) ([]byte, error)
+	SignTx(tx *gethTypes.Transaction, chainId *big.Int) (*gethTypes.Transaction, error)
+}
+
+// KeystoreSigner signs with an account unlocked in a local keystore.
+type KeystoreSigner struct {
+	ks      *keystore.KeyStore
+	account accounts.Account
+}
+
+// NewKeystoreSigner returns a signer for acc, which must be unlocked in ks.
+func NewKeystoreSigner(ks *keystore.KeyStore, acc accounts.Account) *KeystoreSigner {
+	return &KeystoreSigner{
+		ks:      ks,
+		account: acc,
+	}
+}
+
+// UnlockKeystoreSigner unlocks the account with address addr in ks and returns its signer.
+func UnlockKeystoreSigner(ks *keystore.KeyStore, addr string, passwd string) (*KeystoreSigner, error) {
+	acc, err := unlockAccount(ks, addr, passwd)
+	if err != nil {
+		return nil, err
+	}
+	return NewKeystoreSigner(ks, *acc), nil
+}
+
+func (s *KeystoreSigner) Address() common.Address {
+	return s.account.Address
+}
+
+func (s *KeystoreSigner) SignText(text []byte) ([]byte, error) {
+	return s.ks.SignHash(s.account, accounts.TextHash(text))
+}
+
+func (s *KeystoreSigner) SignTypedData(td *types.TypedData) ([]byte, error) {
+	digest, err := td.Hash()
+	if err != nil {
+		return nil, fmt.Errorf("error hashing typed data: %v", err)
+	}
+	return s.ks.SignHash(s.account, digest)
+}
+
+func (s *KeystoreSigner) SignTx(tx *gethTypes.Transaction, chainId *big.Int) (*gethTypes.Transaction, error) {
+	return s.ks.SignTx(s.account, tx, chainId)
+}
+
+// The keystore signs locally without blocking, so the context variants only check that ctx is not done.
+
+func (s *KeystoreSigner) SignTextContext(ctx context.Context, text []byte) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return s.SignText(text)
+}
+
+func (s *KeystoreSigner) SignTypedDataContext(ctx context.Context, td *types.TypedData) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return s.SignTypedData(td)
+}
+
+func (s *KeystoreSigner) SignTxContext(ctx context.Context, tx *gethTypes.Transaction, chainId *big.Int) (*gethTypes.Transaction, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return s.SignTx(tx, chainId)
+}
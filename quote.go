@@ -0,0 +1,291 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	gethTypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/rsksmart/liquidity-provider/providers"
+	"github.com/rsksmart/liquidity-provider/repository/inmem"
+	"github.com/rsksmart/liquidity-provider/types"
+)
+
+type quoteOutput struct {
+	Hash  string       `json:"hash"`
+	Quote *types.Quote `json:"quote"`
+}
+
+type signatureOutput struct {
+	Hash      string                    `json:"hash"`
+	Address   string                    `json:"address"`
+	Scheme    providers.SignatureScheme `json:"scheme"`
+	Signature string                    `json:"signature"`
+}
+
+// loadConfig reads the provider configuration from a JSON file, in the format of providers/testdata/test_config.json.
+func loadConfig(path string) (providers.ProviderConfig, error) {
+	var cfg providers.ProviderConfig
+	if path == "" {
+		return cfg, errors.New("-config is required")
+	}
+	b, err := readInput(path)
+	if err != nil {
+		return cfg, err
+	}
+	if err = json.Unmarshal(b, &cfg); err != nil {
+		return cfg, fmt.Errorf("error decoding config %v: %v", path, err)
+	}
+	return cfg, nil
+}
+
+// readQuote reads a JSON quote from path, or from stdin when path is "-".
+func readQuote(path string) (*types.Quote, error) {
+	if path == "" {
+		return nil, errors.New("-quote is required")
+	}
+	b, err := readInput(path)
+	if err != nil {
+		return nil, err
+	}
+	var q types.Quote
+	if err = json.Unmarshal(b, &q); err != nil {
+		return nil, fmt.Errorf("error decoding quote %v: %v", path, err)
+	}
+	return &q, nil
+}
+
+func readInput(path string) ([]byte, error) {
+	if path == "-" {
+		return ioutil.ReadAll(os.Stdin)
+	}
+	return ioutil.ReadFile(path)
+}
+
+func quoteHash(q *types.Quote) (string, error) {
+	hash, err := q.Hash()
+	if err != nil {
+		return "", fmt.Errorf("error hashing quote: %v", err)
+	}
+	return hex.EncodeToString(hash), nil
+}
+
+func quotePrice(args []string, stdout io.Writer) error {
+	fs := newFlagSet("quote price")
+	config := fs.String("config", "", "provider configuration JSON file")
+	quote := fs.String("quote", "", "JSON file of the quote requested by the user, - reads it from stdin")
+	gas := fs.Uint64("gas", 0, "gas used by the call on behalf of the user, 0 charges the gas limit of the quote")
+	gasPrice := fs.String("gas-price", "", "gas price in wei, read from the configured gas price oracle when empty")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	cfg, err := loadConfig(*config)
+	if err != nil {
+		return err
+	}
+	q, err := readQuote(*quote)
+	if err != nil {
+		return err
+	}
+	addr, err := priceAccount(cfg)
+	if err != nil {
+		return err
+	}
+	var price *types.Wei
+	if *gasPrice != "" {
+		p, ok := new(big.Int).SetString(*gasPrice, 10)
+		if !ok || p.Sign() < 0 {
+			return fmt.Errorf("invalid gas price: %v", *gasPrice)
+		}
+		price = types.NewBigWei(p)
+	}
+	lp, err := providers.NewLocalProviderWithSigner(cfg, addressSigner(addr), inmem.NewRepository())
+	if err != nil {
+		return err
+	}
+	defer lp.Close()
+	if *gas == 0 {
+		*gas = uint64(q.GasLimit)
+	}
+	res, err := lp.GetQuote(q, *gas, price)
+	if err != nil {
+		return err
+	}
+	hash, err := quoteHash(res)
+	if err != nil {
+		return err
+	}
+	return writeJSON(stdout, quoteOutput{Hash: hash, Quote: res})
+}
+
+// errPriceOnly is returned by the signer of quote price, which knows the address of the provider but not its keys.
+var errPriceOnly = errors.New("quote price does not sign")
+
+// addressSigner identifies the account quotes are priced for, so they are priced without unlocking or creating keys.
+type addressSigner common.Address
+
+func (s addressSigner) Address() common.Address {
+	return common.Address(s)
+}
+
+func (addressSigner) SignText([]byte) ([]byte, error) {
+	return nil, errPriceOnly
+}
+
+func (addressSigner) SignTypedData(*types.TypedData) ([]byte, error) {
+	return nil, errPriceOnly
+}
+
+func (addressSigner) SignTx(*gethTypes.Transaction, *big.Int) (*gethTypes.Transaction, error) {
+	return nil, errPriceOnly
+}
+
+// priceAccount returns the account quotes are priced for: the configured AccountAddr, or the account at AccountNum
+// of the keystore, which is neither unlocked nor created when the keystore is empty.
+func priceAccount(cfg providers.ProviderConfig) (common.Address, error) {
+	if cfg.AccountAddr != "" {
+		if !common.IsHexAddress(cfg.AccountAddr) {
+			return common.Address{}, fmt.Errorf("%w: %v", providers.ErrInvalidProviderAddress, cfg.AccountAddr)
+		}
+		return common.HexToAddress(cfg.AccountAddr), nil
+	}
+	if cfg.ExternalSigner != "" {
+		return common.Address{}, errors.New("accountAddr is required to price quotes for an external signer")
+	}
+	keydir := cfg.Keydir
+	if keydir == "" {
+		keydir = "keystore"
+	}
+	accs := openKeystore(keydir).Accounts()
+	if cfg.AccountNum < 0 || len(accs) <= cfg.AccountNum {
+		return common.Address{}, fmt.Errorf("%w: account number %v in %v", providers.ErrAccountNotFound, cfg.AccountNum, keydir)
+	}
+	return accs[cfg.AccountNum].Address, nil
+}
+
+// quoteSign signs a quote with the keystore account of its LPRSKAddr, without retaining it or reserving liquidity.
+func quoteSign(args []string, stdout io.Writer) error {
+	fs := newFlagSet("quote sign")
+	config := fs.String("config", "", "provider configuration JSON file")
+	quote := fs.String("quote", "", "JSON file of the quote to sign, - reads it from stdin")
+	password := addSecretFlags(fs, "password", "keystore password, taking precedence over the configured sources")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	cfg, err := loadConfig(*config)
+	if err != nil {
+		return err
+	}
+	q, err := readQuote(*quote)
+	if err != nil {
+		return err
+	}
+	if cfg.SignatureScheme == "" {
+		cfg.SignatureScheme = providers.SignatureSchemePersonalSign
+	}
+	if !common.IsHexAddress(q.LPRSKAddr) {
+		return fmt.Errorf("%w: %v", providers.ErrInvalidProviderAddress, q.LPRSKAddr)
+	}
+
+	var signer providers.Signer
+	if cfg.ExternalSigner != "" {
+		s, err := providers.NewExternalSignerForAccount(cfg.ExternalSigner, common.HexToAddress(q.LPRSKAddr))
+		if err != nil {
+			return err
+		}
+		defer s.Close()
+		signer = s
+	} else {
+		var passwd string
+		if source := cfg.PasswordSecretSource(); source != nil && !password.isSet() {
+			passwd, err = source.Secret()
+		} else {
+			passwd, err = password.read("password")
+		}
+		if err != nil {
+			return err
+		}
+		keydir := cfg.Keydir
+		if keydir == "" {
+			keydir = "keystore"
+		}
+		if signer, err = providers.UnlockKeystoreSigner(openKeystore(keydir), q.LPRSKAddr, passwd); err != nil {
+			return err
+		}
+	}
+
+	sig, err := providers.SignQuoteWith(signer, q, cfg.ChainId, cfg.SignatureScheme)
+	if err != nil {
+		return err
+	}
+	hash, err := quoteHash(q)
+	if err != nil {
+		return err
+	}
+	return writeJSON(stdout, signatureOutput{
+		Hash:      hash,
+		Address:   signer.Address().Hex(),
+		Scheme:    cfg.SignatureScheme,
+		Signature: hex.EncodeToString(sig),
+	})
+}
+
+// quoteVerify checks that a signature of the quote was made by its LPRSKAddr, detecting the signature scheme unless
+// -scheme is given.
+func quoteVerify(args []string, stdout io.Writer) error {
+	fs := newFlagSet("quote verify")
+	quote := fs.String("quote", "", "JSON file of the signed quote, - reads it from stdin")
+	signature := fs.String("signature", "", "hex encoded quote signature")
+	chainId := fs.Int64("chain-id", 0, "chain id of EIP-712 signatures, 0 only accepts personal_sign signatures")
+	scheme := fs.String("scheme", "", "signature scheme, detected when empty")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	q, err := readQuote(*quote)
+	if err != nil {
+		return err
+	}
+	sig, err := hex.DecodeString(strings.TrimPrefix(*signature, "0x"))
+	if err != nil {
+		return fmt.Errorf("invalid signature: %v", err)
+	}
+	var id *big.Int
+	if *chainId != 0 {
+		id = big.NewInt(*chainId)
+	}
+
+	s := providers.SignatureScheme(*scheme)
+	if s == "" {
+		if s, err = providers.DetectQuoteSignatureScheme(q, id, sig); err != nil {
+			return err
+		}
+	} else {
+		if !common.IsHexAddress(q.LPRSKAddr) {
+			return fmt.Errorf("%w: %v", providers.ErrInvalidProviderAddress, q.LPRSKAddr)
+		}
+		signer, err := providers.RecoverQuoteSignerWithScheme(q, id, sig, s)
+		if err != nil {
+			return err
+		}
+		if signer != common.HexToAddress(q.LPRSKAddr) {
+			return fmt.Errorf("%w: expected %v, got %v", providers.ErrWrongSigner, common.HexToAddress(q.LPRSKAddr), signer)
+		}
+	}
+	hash, err := quoteHash(q)
+	if err != nil {
+		return err
+	}
+	return writeJSON(stdout, signatureOutput{
+		Hash:      hash,
+		Address:   common.HexToAddress(q.LPRSKAddr).Hex(),
+		Scheme:    s,
+		Signature: hex.EncodeToString(sig),
+	})
+}
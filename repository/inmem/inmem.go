@@ -0,0 +1,517 @@
+// Package inmem implements thread safe provider repositories that keep their data in memory, which can be saved to
+// and restored from a snapshot file.
+package inmem
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/rsksmart/liquidity-provider/providers"
+	"github.com/rsksmart/liquidity-provider/types"
+)
+
+var ErrInvalidSnapshot = errors.New("invalid repository snapshot")
+
+type Repository struct {
+	mu                   sync.RWMutex
+	retainedQuotes       map[string]*types.RetainedQuote
+	liquidity            *types.Wei
+	retainedPegoutQuotes map[string]*types.RetainedPegoutQuote
+	pegoutLiquidity      *types.Wei
+	signedValues         map[string]*signedValue
+}
+
+// signedValue is a value accounted by the signing policy.
+type signedValue struct {
+	Key   string     `json:"key"`
+	At    time.Time  `json:"at"`
+	Value *types.Wei `json:"value"`
+}
+
+// snapshot is the serialized form of the repository.
+type snapshot struct {
+	RetainedQuotes       []*types.RetainedQuote       `json:"retainedQuotes"`
+	Liquidity            *types.Wei                   `json:"liquidity"`
+	RetainedPegoutQuotes []*types.RetainedPegoutQuote `json:"retainedPegoutQuotes"`
+	PegoutLiquidity      *types.Wei                   `json:"pegoutLiquidity"`
+	SignedValues         []*signedValue               `json:"signedValues"`
+}
+
+func NewRepository() *Repository {
+	return &Repository{
+		retainedQuotes:       make(map[string]*types.RetainedQuote),
+		liquidity:            types.NewWei(0),
+		retainedPegoutQuotes: make(map[string]*types.RetainedPegoutQuote),
+		pegoutLiquidity:      types.NewWei(0),
+		signedValues:         make(map[string]*signedValue),
+	}
+}
+
+func (r *Repository) HasRetainedQuote(hash string) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, ok := r.retainedQuotes[hash]
+	return ok, nil
+}
+
+func (r *Repository) HasLiquidity(_ providers.LiquidityProvider, wei *types.Wei) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.availableLiquidity().Cmp(wei) >= 0, nil
+}
+
+func (r *Repository) ReserveLiquidity(rq *types.RetainedQuote) error {
+	if err := providers.CheckReqLiq(rq.ReqLiq); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.retainedQuotes[rq.QuoteHash]; ok {
+		return nil
+	}
+	available := r.availableLiquidity()
+	if available.Cmp(rq.ReqLiq) < 0 {
+		return &providers.ErrInsufficientLiquidity{Required: rq.ReqLiq.Copy(), Available: available}
+	}
+	r.retainedQuotes[rq.QuoteHash] = copyRetainedQuote(rq)
+	return nil
+}
+
+func (r *Repository) GetRetainedQuote(hash string) (*types.RetainedQuote, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	rq, ok := r.retainedQuotes[hash]
+	if !ok {
+		return nil, providers.ErrRetainedQuoteNotFound
+	}
+	return copyRetainedQuote(rq), nil
+}
+
+func (r *Repository) GetRetainedQuotes(states ...types.RQState) ([]*types.RetainedQuote, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var res []*types.RetainedQuote
+	for _, rq := range r.retainedQuotes {
+		for _, state := range states {
+			if rq.State == state {
+				res = append(res, copyRetainedQuote(rq))
+				break
+			}
+		}
+	}
+	return res, nil
+}
+
+func (r *Repository) UpdateRetainedQuoteState(hash string, oldState types.RQState, newState types.RQState) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rq, ok := r.retainedQuotes[hash]
+	if !ok {
+		return providers.ErrRetainedQuoteNotFound
+	}
+	if rq.State != oldState {
+		return providers.ErrUnexpectedRetainedQuoteState
+	}
+	return rq.Transition(newState)
+}
+
+// GetLiquidity returns the total liquidity minus the liquidity locked by retained quotes.
+func (r *Repository) GetLiquidity() (*types.Wei, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.availableLiquidity(), nil
+}
+
+// SetLiquidity sets the total liquidity of the provider.
+func (r *Repository) SetLiquidity(liq *types.Wei) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.liquidity = liq.Copy()
+	return nil
+}
+
+func (r *Repository) HasRetainedPegoutQuote(hash string) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, ok := r.retainedPegoutQuotes[hash]
+	return ok, nil
+}
+
+func (r *Repository) HasPegoutLiquidity(_ providers.PegoutLiquidityProvider, wei *types.Wei) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.availablePegoutLiquidity().Cmp(wei) >= 0, nil
+}
+
+func (r *Repository) ReservePegoutLiquidity(rq *types.RetainedPegoutQuote) error {
+	if err := providers.CheckReqLiq(rq.ReqLiq); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.retainedPegoutQuotes[rq.QuoteHash]; ok {
+		return nil
+	}
+	available := r.availablePegoutLiquidity()
+	if available.Cmp(rq.ReqLiq) < 0 {
+		return &providers.ErrInsufficientLiquidity{Required: rq.ReqLiq.Copy(), Available: available}
+	}
+	r.retainedPegoutQuotes[rq.QuoteHash] = copyRetainedPegoutQuote(rq)
+	return nil
+}
+
+func (r *Repository) GetRetainedPegoutQuote(hash string) (*types.RetainedPegoutQuote, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	rq, ok := r.retainedPegoutQuotes[hash]
+	if !ok {
+		return nil, providers.ErrRetainedQuoteNotFound
+	}
+	return copyRetainedPegoutQuote(rq), nil
+}
+
+func (r *Repository) GetRetainedPegoutQuotes(states ...types.RQState) ([]*types.RetainedPegoutQuote, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var res []*types.RetainedPegoutQuote
+	for _, rq := range r.retainedPegoutQuotes {
+		for _, state := range states {
+			if rq.State == state {
+				res = append(res, copyRetainedPegoutQuote(rq))
+				break
+			}
+		}
+	}
+	return res, nil
+}
+
+func (r *Repository) UpdateRetainedPegoutQuoteState(hash string, oldState types.RQState, newState types.RQState) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rq, ok := r.retainedPegoutQuotes[hash]
+	if !ok {
+		return providers.ErrRetainedQuoteNotFound
+	}
+	if rq.State != oldState {
+		return providers.ErrUnexpectedRetainedQuoteState
+	}
+	return rq.Transition(newState)
+}
+
+// GetPegoutLiquidity returns the total peg-out liquidity minus the liquidity locked by retained peg-out quotes.
+func (r *Repository) GetPegoutLiquidity() (*types.Wei, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.availablePegoutLiquidity(), nil
+}
+
+// SetPegoutLiquidity sets the total peg-out liquidity of the provider.
+func (r *Repository) SetPegoutLiquidity(liq *types.Wei) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pegoutLiquidity = liq.Copy()
+	return nil
+}
+
+func (r *Repository) AddSignedValue(key string, value *types.Wei, at time.Time, since time.Time, limit *types.Wei) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pruneSignedValues(since)
+	var accounted *types.Wei
+	sv, ok := r.signedValues[key]
+	if ok {
+		accounted = sv.Value
+	}
+	store, err := providers.CheckSignedValue(accounted, r.signedValue(), value, limit)
+	if !store {
+		return false, err
+	}
+	if !ok {
+		sv = &signedValue{Key: key, At: at}
+		r.signedValues[key] = sv
+	}
+	sv.Value = value.Copy()
+	return !ok, nil
+}
+
+func (r *Repository) RemoveSignedValue(key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.signedValues, key)
+	return nil
+}
+
+func (r *Repository) GetSignedValue(since time.Time) (*types.Wei, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pruneSignedValues(since)
+	return r.signedValue(), nil
+}
+
+// The context variants only check that ctx is not done, the repository never blocks on anything but its own lock.
+
+func (r *Repository) HasRetainedQuoteContext(ctx context.Context, hash string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	return r.HasRetainedQuote(hash)
+}
+
+func (r *Repository) HasLiquidityContext(ctx context.Context, lp providers.LiquidityProvider, wei *types.Wei) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	return r.HasLiquidity(lp, wei)
+}
+
+func (r *Repository) ReserveLiquidityContext(ctx context.Context, rq *types.RetainedQuote) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return r.ReserveLiquidity(rq)
+}
+
+func (r *Repository) GetRetainedQuotesContext(ctx context.Context, states ...types.RQState) ([]*types.RetainedQuote, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return r.GetRetainedQuotes(states...)
+}
+
+func (r *Repository) UpdateRetainedQuoteStateContext(ctx context.Context, hash string, oldState types.RQState, newState types.RQState) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return r.UpdateRetainedQuoteState(hash, oldState, newState)
+}
+
+func (r *Repository) GetLiquidityContext(ctx context.Context) (*types.Wei, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return r.GetLiquidity()
+}
+
+func (r *Repository) HasRetainedPegoutQuoteContext(ctx context.Context, hash string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	return r.HasRetainedPegoutQuote(hash)
+}
+
+func (r *Repository) HasPegoutLiquidityContext(ctx context.Context, lp providers.PegoutLiquidityProvider, wei *types.Wei) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	return r.HasPegoutLiquidity(lp, wei)
+}
+
+func (r *Repository) ReservePegoutLiquidityContext(ctx context.Context, rq *types.RetainedPegoutQuote) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return r.ReservePegoutLiquidity(rq)
+}
+
+func (r *Repository) GetRetainedPegoutQuotesContext(ctx context.Context, states ...types.RQState) ([]*types.RetainedPegoutQuote, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return r.GetRetainedPegoutQuotes(states...)
+}
+
+func (r *Repository) UpdateRetainedPegoutQuoteStateContext(ctx context.Context, hash string, oldState types.RQState, newState types.RQState) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return r.UpdateRetainedPegoutQuoteState(hash, oldState, newState)
+}
+
+// Snapshot writes the repository contents to w as JSON.
+func (r *Repository) Snapshot(w io.Writer) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	s := snapshot{
+		RetainedQuotes:       make([]*types.RetainedQuote, 0, len(r.retainedQuotes)),
+		Liquidity:            r.liquidity,
+		RetainedPegoutQuotes: make([]*types.RetainedPegoutQuote, 0, len(r.retainedPegoutQuotes)),
+		PegoutLiquidity:      r.pegoutLiquidity,
+		SignedValues:         make([]*signedValue, 0, len(r.signedValues)),
+	}
+	for _, rq := range r.retainedQuotes {
+		s.RetainedQuotes = append(s.RetainedQuotes, rq)
+	}
+	for _, rq := range r.retainedPegoutQuotes {
+		s.RetainedPegoutQuotes = append(s.RetainedPegoutQuotes, rq)
+	}
+	for _, sv := range r.signedValues {
+		s.SignedValues = append(s.SignedValues, sv)
+	}
+	return json.NewEncoder(w).Encode(&s)
+}
+
+// Restore replaces the repository contents with the snapshot read from rd.
+func (r *Repository) Restore(rd io.Reader) error {
+	var s snapshot
+	if err := json.NewDecoder(rd).Decode(&s); err != nil {
+		return err
+	}
+	retainedQuotes := make(map[string]*types.RetainedQuote, len(s.RetainedQuotes))
+	for i, rq := range s.RetainedQuotes {
+		if rq == nil {
+			return fmt.Errorf("%w: retained quote %v is null", ErrInvalidSnapshot, i)
+		}
+		if err := checkSnapshotEntry(rq.QuoteHash, rq.ReqLiq); err != nil {
+			return fmt.Errorf("%w: retained quote %v: %v", ErrInvalidSnapshot, i, err)
+		}
+		if _, ok := retainedQuotes[rq.QuoteHash]; ok {
+			return fmt.Errorf("%w: retained quote %v is repeated", ErrInvalidSnapshot, rq.QuoteHash)
+		}
+		retainedQuotes[rq.QuoteHash] = rq
+	}
+	retainedPegoutQuotes := make(map[string]*types.RetainedPegoutQuote, len(s.RetainedPegoutQuotes))
+	for i, rq := range s.RetainedPegoutQuotes {
+		if rq == nil {
+			return fmt.Errorf("%w: retained peg-out quote %v is null", ErrInvalidSnapshot, i)
+		}
+		if err := checkSnapshotEntry(rq.QuoteHash, rq.ReqLiq); err != nil {
+			return fmt.Errorf("%w: retained peg-out quote %v: %v", ErrInvalidSnapshot, i, err)
+		}
+		if _, ok := retainedPegoutQuotes[rq.QuoteHash]; ok {
+			return fmt.Errorf("%w: retained peg-out quote %v is repeated", ErrInvalidSnapshot, rq.QuoteHash)
+		}
+		retainedPegoutQuotes[rq.QuoteHash] = rq
+	}
+	signedValues := make(map[string]*signedValue, len(s.SignedValues))
+	for i, sv := range s.SignedValues {
+		if sv == nil {
+			return fmt.Errorf("%w: signed value %v is null", ErrInvalidSnapshot, i)
+		}
+		if sv.Key == "" || sv.Value == nil || sv.Value.AsBigInt().Sign() < 0 {
+			return fmt.Errorf("%w: invalid signed value %v", ErrInvalidSnapshot, i)
+		}
+		if _, ok := signedValues[sv.Key]; ok {
+			return fmt.Errorf("%w: signed value %v is repeated", ErrInvalidSnapshot, sv.Key)
+		}
+		signedValues[sv.Key] = sv
+	}
+	if s.Liquidity == nil {
+		s.Liquidity = types.NewWei(0)
+	}
+	if s.PegoutLiquidity == nil {
+		s.PegoutLiquidity = types.NewWei(0)
+	}
+	if s.Liquidity.AsBigInt().Sign() < 0 || s.PegoutLiquidity.AsBigInt().Sign() < 0 {
+		return fmt.Errorf("%w: negative liquidity", ErrInvalidSnapshot)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.retainedQuotes = retainedQuotes
+	r.liquidity = s.Liquidity
+	r.retainedPegoutQuotes = retainedPegoutQuotes
+	r.pegoutLiquidity = s.PegoutLiquidity
+	r.signedValues = signedValues
+	return nil
+}
+
+// SaveFile writes a snapshot to path. The snapshot is written to a temporary file first, so an existing snapshot is
+// never left half written.
+func (r *Repository) SaveFile(path string) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer func(name string) {
+		_ = os.Remove(name)
+	}(f.Name())
+	if err = r.Snapshot(f); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// LoadFile restores the snapshot saved at path.
+func (r *Repository) LoadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func(f *os.File) {
+		_ = f.Close()
+	}(f)
+	return r.Restore(f)
+}
+
+// checkSnapshotEntry fails unless a retained quote of a snapshot has a hash and the liquidity it requires.
+func checkSnapshotEntry(hash string, reqLiq *types.Wei) error {
+	if hash == "" {
+		return errors.New("quote hash is empty")
+	}
+	if reqLiq == nil || reqLiq.AsBigInt().Sign() < 0 {
+		return fmt.Errorf("invalid required liquidity %v", reqLiq)
+	}
+	return nil
+}
+
+// pruneSignedValues drops the signed values accounted at or before since.
+func (r *Repository) pruneSignedValues(since time.Time) {
+	for key, sv := range r.signedValues {
+		if !sv.At.After(since) {
+			delete(r.signedValues, key)
+		}
+	}
+}
+
+func (r *Repository) signedValue() *types.Wei {
+	total := types.NewWei(0)
+	for _, sv := range r.signedValues {
+		total.Add(total, sv.Value)
+	}
+	return total
+}
+
+func (r *Repository) availableLiquidity() *types.Wei {
+	liq := r.liquidity.Copy()
+	for _, rq := range r.retainedQuotes {
+		if rq.State.LocksLiquidity() {
+			liq.Sub(liq, rq.ReqLiq)
+		}
+	}
+	return liq
+}
+
+func (r *Repository) availablePegoutLiquidity() *types.Wei {
+	liq := r.pegoutLiquidity.Copy()
+	for _, rq := range r.retainedPegoutQuotes {
+		if rq.State.LocksLiquidity() {
+			liq.Sub(liq, rq.ReqLiq)
+		}
+	}
+	return liq
+}
+
+func copyRetainedQuote(rq *types.RetainedQuote) *types.RetainedQuote {
+	res := *rq
+	res.ReqLiq = rq.ReqLiq.Copy()
+	res.FeeBreakdown = rq.FeeBreakdown.Copy()
+	return &res
+}
+
+func copyRetainedPegoutQuote(rq *types.RetainedPegoutQuote) *types.RetainedPegoutQuote {
+	res := *rq
+	res.ReqLiq = rq.ReqLiq.Copy()
+	return &res
+}
@@ -0,0 +1,258 @@
+package inmem
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rsksmart/liquidity-provider/providers"
+	"github.com/rsksmart/liquidity-provider/repository/repotest"
+	"github.com/rsksmart/liquidity-provider/types"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	_ providers.LocalProviderRepository            = (*Repository)(nil)
+	_ providers.PegoutLocalProviderRepository      = (*Repository)(nil)
+	_ providers.RetainedQuoteStateRepository       = (*Repository)(nil)
+	_ providers.RetainedPegoutQuoteStateRepository = (*Repository)(nil)
+
+	_ providers.ContextLocalProviderRepository            = (*Repository)(nil)
+	_ providers.ContextPegoutLocalProviderRepository      = (*Repository)(nil)
+	_ providers.ContextRetainedQuoteStateRepository       = (*Repository)(nil)
+	_ providers.ContextRetainedPegoutQuoteStateRepository = (*Repository)(nil)
+)
+
+func newTestRetainedQuote(hash string, reqLiq int64) *types.RetainedQuote {
+	return &types.RetainedQuote{
+		QuoteHash:          hash,
+		DepositAddr:        "abc",
+		Signature:          "def",
+		ReqLiq:             types.NewWei(reqLiq),
+		State:              types.RQStateWaitingForDeposit,
+		AgreementTimestamp: 1670441000,
+		TimeForDeposit:     3600,
+	}
+}
+
+func TestRepository_ReserveLiquidity(t *testing.T) {
+	r := NewRepository()
+	assert.Nil(t, r.SetLiquidity(types.NewWei(200)))
+
+	rq := newTestRetainedQuote("a", 90)
+	assert.Nil(t, r.ReserveLiquidity(rq))
+	assert.Nil(t, r.ReserveLiquidity(rq))
+	liq, _ := r.GetLiquidity()
+	assert.EqualValues(t, types.NewWei(110), liq)
+
+	// the repository keeps its own copy of the retained quote
+	rq.ReqLiq.Add(rq.ReqLiq, types.NewWei(1000))
+	rq.State = types.RQStateCallForUserSucceeded
+	liq, _ = r.GetLiquidity()
+	assert.EqualValues(t, types.NewWei(110), liq)
+
+	var liqErr *providers.ErrInsufficientLiquidity
+	if assert.ErrorAs(t, r.ReserveLiquidity(newTestRetainedQuote("b", 111)), &liqErr) {
+		assert.EqualValues(t, types.NewWei(110), liqErr.Available)
+	}
+	hasRq, _ := r.HasRetainedQuote("b")
+	assert.False(t, hasRq)
+	hasLiq, _ := r.HasLiquidity(nil, types.NewWei(110))
+	assert.True(t, hasLiq)
+}
+
+func TestRepository_UpdateRetainedQuoteState(t *testing.T) {
+	r := NewRepository()
+	assert.Nil(t, r.SetLiquidity(types.NewWei(100)))
+	assert.Nil(t, r.ReserveLiquidity(newTestRetainedQuote("a", 90)))
+
+	assert.Nil(t, r.UpdateRetainedQuoteState("a", types.RQStateWaitingForDeposit, types.RQStateWaitingForDepositConfirmations))
+	liq, _ := r.GetLiquidity()
+	assert.EqualValues(t, types.NewWei(10), liq)
+
+	assert.ErrorIs(t, r.UpdateRetainedQuoteState("a", types.RQStateWaitingForDeposit, types.RQStateTimeForDepositElapsed), providers.ErrUnexpectedRetainedQuoteState)
+	assert.ErrorIs(t, r.UpdateRetainedQuoteState("b", types.RQStateWaitingForDeposit, types.RQStateTimeForDepositElapsed), providers.ErrRetainedQuoteNotFound)
+	var transitionErr *types.ErrInvalidStateTransition
+	assert.ErrorAs(t, r.UpdateRetainedQuoteState("a", types.RQStateWaitingForDepositConfirmations, types.RQStateWaitingForDeposit), &transitionErr)
+
+	assert.Nil(t, r.UpdateRetainedQuoteState("a", types.RQStateWaitingForDepositConfirmations, types.RQStateCallForUserFailed))
+	liq, _ = r.GetLiquidity()
+	assert.EqualValues(t, types.NewWei(100), liq)
+
+	rqs, _ := r.GetRetainedQuotes(types.RQStateCallForUserFailed)
+	if assert.Len(t, rqs, 1) {
+		assert.Equal(t, types.RQStateCallForUserFailed, rqs[0].State)
+	}
+	rq, err := r.GetRetainedQuote("a")
+	assert.Nil(t, err)
+	assert.Equal(t, types.RQStateCallForUserFailed, rq.State)
+	_, err = r.GetRetainedQuote("b")
+	assert.ErrorIs(t, err, providers.ErrRetainedQuoteNotFound)
+}
+
+func TestRepository_Pegout(t *testing.T) {
+	r := NewRepository()
+	assert.Nil(t, r.SetPegoutLiquidity(types.NewWei(100)))
+	rq := &types.RetainedPegoutQuote{QuoteHash: "a", ReqLiq: types.NewWei(60), State: types.RQStateWaitingForDeposit}
+	assert.Nil(t, r.ReservePegoutLiquidity(rq))
+	assert.Nil(t, r.ReservePegoutLiquidity(rq))
+	var liqErr *providers.ErrInsufficientLiquidity
+	assert.ErrorAs(t, r.ReservePegoutLiquidity(&types.RetainedPegoutQuote{QuoteHash: "b", ReqLiq: types.NewWei(60)}), &liqErr)
+
+	liq, _ := r.GetPegoutLiquidity()
+	assert.EqualValues(t, types.NewWei(40), liq)
+	liq, _ = r.GetLiquidity()
+	assert.Zero(t, liq.Cmp(types.NewWei(0)))
+
+	assert.Nil(t, r.UpdateRetainedPegoutQuoteState("a", types.RQStateWaitingForDeposit, types.RQStateSendPegoutSucceeded))
+	liq, _ = r.GetPegoutLiquidity()
+	assert.EqualValues(t, types.NewWei(100), liq)
+	got, err := r.GetRetainedPegoutQuote("a")
+	assert.Nil(t, err)
+	assert.Equal(t, types.RQStateSendPegoutSucceeded, got.State)
+}
+
+func TestRepository_SnapshotRestore(t *testing.T) {
+	r := NewRepository()
+	assert.Nil(t, r.SetLiquidity(types.NewWei(200)))
+	assert.Nil(t, r.SetPegoutLiquidity(types.NewWei(300)))
+	assert.Nil(t, r.ReserveLiquidity(newTestRetainedQuote("a", 90)))
+	assert.Nil(t, r.ReserveLiquidity(newTestRetainedQuote("b", 10)))
+	assert.Nil(t, r.UpdateRetainedQuoteState("b", types.RQStateWaitingForDeposit, types.RQStateTimeForDepositElapsed))
+	assert.Nil(t, r.ReservePegoutLiquidity(&types.RetainedPegoutQuote{QuoteHash: "c", ReqLiq: types.NewWei(50)}))
+	signedAt := time.Unix(1600000000, 0)
+	_, err := r.AddSignedValue("quote:a", types.NewWei(90), signedAt, signedAt.Add(-time.Hour), nil)
+	assert.Nil(t, err)
+
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	assert.Nil(t, r.SaveFile(path))
+	// saving again replaces the previous snapshot
+	assert.Nil(t, r.SaveFile(path))
+
+	restored := NewRepository()
+	assert.Nil(t, restored.LoadFile(path))
+	liq, _ := restored.GetLiquidity()
+	assert.EqualValues(t, types.NewWei(110), liq)
+	liq, _ = restored.GetPegoutLiquidity()
+	assert.EqualValues(t, types.NewWei(250), liq)
+	for _, hash := range []string{"a", "b"} {
+		want, _ := r.GetRetainedQuote(hash)
+		got, err := restored.GetRetainedQuote(hash)
+		assert.Nil(t, err)
+		assert.EqualValues(t, want, got)
+	}
+	signed, err := restored.GetSignedValue(signedAt.Add(-time.Hour))
+	assert.Nil(t, err)
+	assert.EqualValues(t, types.NewWei(90), signed)
+
+	assert.NotNil(t, restored.Restore(bytes.NewBufferString("{")))
+	assert.NotNil(t, restored.LoadFile(filepath.Join(t.TempDir(), "missing.json")))
+}
+
+func TestRepository_RestoreInvalid(t *testing.T) {
+	r := NewRepository()
+	assert.Nil(t, r.SetLiquidity(types.NewWei(200)))
+	for _, snapshot := range []string{
+		`{"retainedQuotes": [null]}`,
+		`{"retainedQuotes": [{"quoteHash": "a"}]}`,
+		`{"retainedQuotes": [{"quoteHash": "a", "reqLiq": -1}]}`,
+		`{"retainedQuotes": [{"reqLiq": 1}]}`,
+		`{"retainedQuotes": [{"quoteHash": "a", "reqLiq": 1}, {"quoteHash": "a", "reqLiq": 2}]}`,
+		`{"retainedPegoutQuotes": [null]}`,
+		`{"retainedPegoutQuotes": [{"quoteHash": "a"}]}`,
+		`{"liquidity": -1}`,
+		`{"signedValues": [null]}`,
+		`{"signedValues": [{"value": 1}]}`,
+		`{"signedValues": [{"key": "a"}]}`,
+		`{"signedValues": [{"key": "a", "value": 1}, {"key": "a", "value": 2}]}`,
+	} {
+		assert.ErrorIs(t, r.Restore(bytes.NewBufferString(snapshot)), ErrInvalidSnapshot, snapshot)
+	}
+	// the contents are left untouched
+	liq, _ := r.GetLiquidity()
+	assert.EqualValues(t, types.NewWei(200), liq)
+}
+
+func TestRepository_Concurrency(t *testing.T) {
+	r := NewRepository()
+	assert.Nil(t, r.SetLiquidity(types.NewWei(100)))
+
+	var wg sync.WaitGroup
+	errs := make([]error, 50)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			hash := fmt.Sprint(i)
+			errs[i] = r.ReserveLiquidity(newTestRetainedQuote(hash, 10))
+			if errs[i] == nil && i%2 == 0 {
+				errs[i] = r.UpdateRetainedQuoteState(hash, types.RQStateWaitingForDeposit, types.RQStateTimeForDepositElapsed)
+			}
+			_, _ = r.GetLiquidity()
+			_ = r.Snapshot(&bytes.Buffer{})
+		}(i)
+	}
+	wg.Wait()
+
+	var locked int64
+	rqs, _ := r.GetRetainedQuotes(types.LiquidityLockingStates()...)
+	for _, rq := range rqs {
+		locked += rq.ReqLiq.AsBigInt().Int64()
+	}
+	liq, _ := r.GetLiquidity()
+	assert.LessOrEqual(t, locked, int64(100))
+	assert.EqualValues(t, 100-locked, liq.AsBigInt().Int64())
+}
+
+func TestRepository_LocalProvider(t *testing.T) {
+	r := NewRepository()
+	assert.Nil(t, r.SetLiquidity(types.NewWei(200)))
+	assert.Nil(t, r.SetPegoutLiquidity(types.NewWei(100)))
+	pwdFile := filepath.Join(t.TempDir(), "pwd")
+	if err := ioutil.WriteFile(pwdFile, []byte("yes\ncorrect horse battery staple\ncorrect horse battery staple\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	lp, err := providers.NewLocalProvider(providers.ProviderConfig{
+		Keydir:  t.TempDir(),
+		PwdFile: pwdFile,
+	}, r)
+	if err != nil {
+		t.Fatal("error creating local provider: ", err)
+	}
+
+	hash := "12345678901234567890123456789012"
+	qb, _ := hex.DecodeString(hash)
+	reqLiq := types.NewWei(90)
+	_, err = lp.SignQuote(qb, "abc", reqLiq)
+	assert.Nil(t, err)
+	_, err = lp.SignQuote(qb, "abc", reqLiq)
+	assert.Nil(t, err)
+	liq, _ := r.GetLiquidity()
+	assert.EqualValues(t, types.NewWei(110), liq)
+
+	_, err = lp.SignQuote([]byte("12345678901234567890123456789012"), "abc", types.NewWei(111))
+	var liqErr *providers.ErrInsufficientLiquidity
+	assert.ErrorAs(t, err, &liqErr)
+
+	assert.Nil(t, r.UpdateRetainedQuoteState(hash, types.RQStateWaitingForDeposit, types.RQStateCallForUserSucceeded))
+	liq, _ = r.GetLiquidity()
+	assert.EqualValues(t, types.NewWei(200), liq)
+
+	_, err = lp.SignPegoutQuote(qb, types.NewWei(60))
+	assert.Nil(t, err)
+	liq, _ = r.GetPegoutLiquidity()
+	assert.EqualValues(t, types.NewWei(40), liq)
+	_, err = lp.SignPegoutQuote([]byte("12345678901234567890123456789013"), types.NewWei(41))
+	assert.ErrorAs(t, err, &liqErr)
+}
+
+func TestConformance(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) repotest.Repository {
+		return NewRepository()
+	})
+}
@@ -0,0 +1,734 @@
+// Package repotest provides a conformance test suite for LocalProviderRepository implementations.
+//
+// An implementation proves it behaves like the reference repositories by running the suite from its own tests:
+//
+//	func TestConformance(t *testing.T) {
+//		repotest.Run(t, func(t *testing.T) repotest.Repository {
+//			return NewRepository()
+//		})
+//	}
+package repotest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rsksmart/liquidity-provider/providers"
+	"github.com/rsksmart/liquidity-provider/types"
+)
+
+// Repository is the set of methods exercised by the suite. SetLiquidity and GetLiquidity are used to set the total
+// liquidity of the provider and read back the liquidity that is not locked by retained quotes.
+type Repository interface {
+	providers.LocalProviderRepository
+	providers.RetainedQuoteStateRepository
+	SetLiquidity(liq *types.Wei) error
+	GetLiquidity() (*types.Wei, error)
+}
+
+// PegoutRepository is the set of peg-out methods exercised by the suite. The peg-out tests are skipped for
+// repositories that do not implement it.
+type PegoutRepository interface {
+	providers.PegoutLocalProviderRepository
+	GetRetainedPegoutQuote(hash string) (*types.RetainedPegoutQuote, error)
+	GetRetainedPegoutQuotes(states ...types.RQState) ([]*types.RetainedPegoutQuote, error)
+	UpdateRetainedPegoutQuoteState(hash string, oldState types.RQState, newState types.RQState) error
+	SetPegoutLiquidity(liq *types.Wei) error
+	GetPegoutLiquidity() (*types.Wei, error)
+}
+
+// Factory returns a new, empty repository. Every test of the suite calls it once.
+type Factory func(t *testing.T) Repository
+
+// Run runs the conformance suite against the repositories created by factory.
+func Run(t *testing.T, factory Factory) {
+	tests := []struct {
+		name string
+		test func(*testing.T, Repository)
+	}{
+		{"reserve liquidity", testReserveLiquidity},
+		{"reserve all the available liquidity", testReserveAvailableLiquidity},
+		{"insufficient liquidity", testInsufficientLiquidity},
+		{"invalid required liquidity", testInvalidReqLiq},
+		{"idempotent reservation", testIdempotentReservation},
+		{"retained quote fields", testRetainedQuoteFields},
+		{"retained fee breakdown", testRetainedFeeBreakdown},
+		{"release liquidity", testReleaseLiquidity},
+		{"deposit confirmations lock liquidity", testDepositConfirmationsLockLiquidity},
+		{"update state errors", testUpdateStateErrors},
+		{"get retained quotes by state", testGetRetainedQuotes},
+		{"concurrent reservations", testConcurrentReservations},
+		{"concurrent reservations of the same quote", testConcurrentIdempotentReservations},
+		{"cancelled reservation", testCancelledReservation},
+		{"reserve peg-out liquidity", testReservePegoutLiquidity},
+		{"peg-out state transitions", testPegoutStateTransitions},
+		{"concurrent peg-out reservations", testConcurrentPegoutReservations},
+		{"signed value window", testSignedValueWindow},
+		{"concurrent signed values", testConcurrentSignedValues},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, factory(t))
+		})
+	}
+}
+
+func newRetainedQuote(hash string, reqLiq int64) *types.RetainedQuote {
+	return &types.RetainedQuote{
+		QuoteHash:          hash,
+		DepositAddr:        "2N2JD6wb56AfK4tfmM6PwdVmoYk2dCKf4Br",
+		Signature:          "329389e8c4cb329cdcb88e44e524abedc7492a8d9b210037879874ce8103d5a2491f947010a18f7fab43d91b35e8ec8cf7760f6ab8806f53ef1c7644e7bf8b741b",
+		ReqLiq:             types.NewWei(reqLiq),
+		State:              types.RQStateWaitingForDeposit,
+		AgreementTimestamp: 1670441000,
+		TimeForDeposit:     3600,
+	}
+}
+
+func setLiquidity(t *testing.T, r Repository, liq int64) {
+	t.Helper()
+	if err := r.SetLiquidity(types.NewWei(liq)); err != nil {
+		t.Fatalf("SetLiquidity() error = %v", err)
+	}
+}
+
+func reserve(t *testing.T, r Repository, rq *types.RetainedQuote) {
+	t.Helper()
+	if err := r.ReserveLiquidity(rq); err != nil {
+		t.Fatalf("ReserveLiquidity(%v) error = %v", rq.QuoteHash, err)
+	}
+}
+
+func updateState(t *testing.T, r Repository, hash string, oldState, newState types.RQState) {
+	t.Helper()
+	if err := r.UpdateRetainedQuoteState(hash, oldState, newState); err != nil {
+		t.Fatalf("UpdateRetainedQuoteState(%v, %v, %v) error = %v", hash, oldState, newState, err)
+	}
+}
+
+func assertLiquidity(t *testing.T, r Repository, want int64) {
+	t.Helper()
+	got, err := r.GetLiquidity()
+	if err != nil {
+		t.Fatalf("GetLiquidity() error = %v", err)
+	}
+	if got.Cmp(types.NewWei(want)) != 0 {
+		t.Errorf("GetLiquidity() = %v, want %v", got, want)
+	}
+}
+
+func assertHasRetainedQuote(t *testing.T, r Repository, hash string, want bool) {
+	t.Helper()
+	got, err := r.HasRetainedQuote(hash)
+	if err != nil {
+		t.Fatalf("HasRetainedQuote() error = %v", err)
+	}
+	if got != want {
+		t.Errorf("HasRetainedQuote(%v) = %v, want %v", hash, got, want)
+	}
+}
+
+func getRetainedQuote(t *testing.T, r Repository, hash string) *types.RetainedQuote {
+	t.Helper()
+	rqs, err := r.GetRetainedQuotes(allStates()...)
+	if err != nil {
+		t.Fatalf("GetRetainedQuotes() error = %v", err)
+	}
+	for _, rq := range rqs {
+		if rq.QuoteHash == hash {
+			return rq
+		}
+	}
+	t.Fatalf("retained quote %v not found", hash)
+	return nil
+}
+
+func allStates() []types.RQState {
+	var states []types.RQState
+	for s := types.RQStateWaitingForDeposit; s <= types.RQStateRefundPegOutFailed; s++ {
+		states = append(states, s)
+	}
+	return states
+}
+
+func testReserveLiquidity(t *testing.T, r Repository) {
+	setLiquidity(t, r, 220)
+	assertHasRetainedQuote(t, r, "a", false)
+	reserve(t, r, newRetainedQuote("a", 200))
+	assertHasRetainedQuote(t, r, "a", true)
+	assertLiquidity(t, r, 20)
+
+	hasLiq, err := r.HasLiquidity(nil, types.NewWei(20))
+	if err != nil || !hasLiq {
+		t.Errorf("HasLiquidity(20) = %v, %v, want true", hasLiq, err)
+	}
+	hasLiq, err = r.HasLiquidity(nil, types.NewWei(21))
+	if err != nil || hasLiq {
+		t.Errorf("HasLiquidity(21) = %v, %v, want false", hasLiq, err)
+	}
+}
+
+func testReserveAvailableLiquidity(t *testing.T, r Repository) {
+	setLiquidity(t, r, 100)
+	reserve(t, r, newRetainedQuote("a", 40))
+	reserve(t, r, newRetainedQuote("b", 60))
+	assertLiquidity(t, r, 0)
+}
+
+func testInsufficientLiquidity(t *testing.T, r Repository) {
+	setLiquidity(t, r, 100)
+	err := r.ReserveLiquidity(newRetainedQuote("a", 101))
+	var liqErr *providers.ErrInsufficientLiquidity
+	if !errors.As(err, &liqErr) {
+		t.Fatalf("ReserveLiquidity() error = %v, want *providers.ErrInsufficientLiquidity", err)
+	}
+	if liqErr.Required == nil || liqErr.Required.Cmp(types.NewWei(101)) != 0 {
+		t.Errorf("ErrInsufficientLiquidity.Required = %v, want 101", liqErr.Required)
+	}
+	if liqErr.Available != nil && liqErr.Available.Cmp(types.NewWei(100)) != 0 {
+		t.Errorf("ErrInsufficientLiquidity.Available = %v, want 100", liqErr.Available)
+	}
+	assertHasRetainedQuote(t, r, "a", false)
+	assertLiquidity(t, r, 100)
+}
+
+func testInvalidReqLiq(t *testing.T, r Repository) {
+	setLiquidity(t, r, 100)
+	for _, reqLiq := range []*types.Wei{nil, types.NewWei(-1)} {
+		rq := newRetainedQuote("a", 0)
+		rq.ReqLiq = reqLiq
+		err := r.ReserveLiquidity(rq)
+		var reqLiqErr *providers.ErrInvalidReqLiq
+		if !errors.As(err, &reqLiqErr) {
+			t.Errorf("ReserveLiquidity(%v) error = %v, want *providers.ErrInvalidReqLiq", reqLiq, err)
+		}
+	}
+	assertHasRetainedQuote(t, r, "a", false)
+	assertLiquidity(t, r, 100)
+
+	if pr, ok := r.(PegoutRepository); ok {
+		setPegoutLiquidity(t, pr, 100)
+		for _, reqLiq := range []*types.Wei{nil, types.NewWei(-1)} {
+			rq := newRetainedPegoutQuote("a", 0)
+			rq.ReqLiq = reqLiq
+			err := pr.ReservePegoutLiquidity(rq)
+			var reqLiqErr *providers.ErrInvalidReqLiq
+			if !errors.As(err, &reqLiqErr) {
+				t.Errorf("ReservePegoutLiquidity(%v) error = %v, want *providers.ErrInvalidReqLiq", reqLiq, err)
+			}
+		}
+		assertPegoutLiquidity(t, pr, 100)
+	}
+}
+
+// testIdempotentReservation mirrors signing the same quote hash twice, which must not retain liquidity twice.
+func testIdempotentReservation(t *testing.T, r Repository) {
+	setLiquidity(t, r, 200)
+	reserve(t, r, newRetainedQuote("a", 90))
+	assertLiquidity(t, r, 110)
+	reserve(t, r, newRetainedQuote("a", 90))
+	assertLiquidity(t, r, 110)
+
+	// the quote is already retained, so even a reservation above the available liquidity is a no-op
+	reserve(t, r, newRetainedQuote("a", 1000))
+	assertLiquidity(t, r, 110)
+
+	updateState(t, r, "a", types.RQStateWaitingForDeposit, types.RQStateCallForUserSucceeded)
+	assertLiquidity(t, r, 200)
+}
+
+func testRetainedQuoteFields(t *testing.T, r Repository) {
+	setLiquidity(t, r, 100)
+	want := newRetainedQuote("a", 100)
+	reserve(t, r, want)
+	got := getRetainedQuote(t, r, "a")
+	if got.QuoteHash != want.QuoteHash || got.DepositAddr != want.DepositAddr || got.Signature != want.Signature ||
+		got.ReqLiq.Cmp(want.ReqLiq) != 0 || got.State != want.State ||
+		got.AgreementTimestamp != want.AgreementTimestamp || got.TimeForDeposit != want.TimeForDeposit {
+		t.Errorf("retained quote = %+v, want %+v", got, want)
+	}
+}
+
+func testRetainedFeeBreakdown(t *testing.T, r Repository) {
+	setLiquidity(t, r, 200)
+	rq := newRetainedQuote("a", 100)
+	rq.FeeBreakdown = &types.FeeBreakdown{
+		GasCost:       types.NewWei(210000),
+		FixedFee:      types.NewWei(1000),
+		PercentageFee: types.NewWei(750),
+		NetworkFee:    types.NewWei(5000),
+		PenaltyFee:    types.NewWei(1000000),
+	}
+	reserve(t, r, rq)
+	reserve(t, r, newRetainedQuote("b", 100))
+
+	got := getRetainedQuote(t, r, "a").FeeBreakdown
+	if got == nil {
+		t.Fatal("retained quote has no fee breakdown")
+	}
+	want := rq.FeeBreakdown
+	if got.GasCost.Cmp(want.GasCost) != 0 || got.FixedFee.Cmp(want.FixedFee) != 0 ||
+		got.PercentageFee.Cmp(want.PercentageFee) != 0 || got.NetworkFee.Cmp(want.NetworkFee) != 0 ||
+		got.PenaltyFee.Cmp(want.PenaltyFee) != 0 {
+		t.Errorf("fee breakdown = %+v, want %+v", got, want)
+	}
+	if got := getRetainedQuote(t, r, "b").FeeBreakdown; got != nil {
+		t.Errorf("fee breakdown = %+v, want nil", got)
+	}
+}
+
+// testReleaseLiquidity checks that liquidity is released when a quote leaves the states that lock it.
+func testReleaseLiquidity(t *testing.T, r Repository) {
+	setLiquidity(t, r, 100)
+	reserve(t, r, newRetainedQuote("a", 10))
+	reserve(t, r, newRetainedQuote("b", 20))
+	reserve(t, r, newRetainedQuote("c", 30))
+	assertLiquidity(t, r, 40)
+
+	updateState(t, r, "a", types.RQStateWaitingForDeposit, types.RQStateCallForUserSucceeded)
+	assertLiquidity(t, r, 50)
+	updateState(t, r, "b", types.RQStateWaitingForDeposit, types.RQStateTimeForDepositElapsed)
+	assertLiquidity(t, r, 70)
+	updateState(t, r, "c", types.RQStateWaitingForDeposit, types.RQStateCallForUserFailed)
+	assertLiquidity(t, r, 100)
+	updateState(t, r, "c", types.RQStateCallForUserFailed, types.RQStateRegisterPegInSucceeded)
+	assertLiquidity(t, r, 100)
+}
+
+func testDepositConfirmationsLockLiquidity(t *testing.T, r Repository) {
+	setLiquidity(t, r, 100)
+	reserve(t, r, newRetainedQuote("a", 10))
+	updateState(t, r, "a", types.RQStateWaitingForDeposit, types.RQStateWaitingForDepositConfirmations)
+	assertLiquidity(t, r, 90)
+	updateState(t, r, "a", types.RQStateWaitingForDepositConfirmations, types.RQStateCallForUserSucceeded)
+	assertLiquidity(t, r, 100)
+}
+
+func testUpdateStateErrors(t *testing.T, r Repository) {
+	setLiquidity(t, r, 100)
+	reserve(t, r, newRetainedQuote("a", 10))
+	updateState(t, r, "a", types.RQStateWaitingForDeposit, types.RQStateCallForUserSucceeded)
+
+	err := r.UpdateRetainedQuoteState("missing", types.RQStateWaitingForDeposit, types.RQStateTimeForDepositElapsed)
+	if !errors.Is(err, providers.ErrRetainedQuoteNotFound) {
+		t.Errorf("UpdateRetainedQuoteState() error = %v, want %v", err, providers.ErrRetainedQuoteNotFound)
+	}
+	err = r.UpdateRetainedQuoteState("a", types.RQStateWaitingForDeposit, types.RQStateTimeForDepositElapsed)
+	if !errors.Is(err, providers.ErrUnexpectedRetainedQuoteState) {
+		t.Errorf("UpdateRetainedQuoteState() error = %v, want %v", err, providers.ErrUnexpectedRetainedQuoteState)
+	}
+	// moving back to waiting for deposit would lock the liquidity again
+	err = r.UpdateRetainedQuoteState("a", types.RQStateCallForUserSucceeded, types.RQStateWaitingForDeposit)
+	var transitionErr *types.ErrInvalidStateTransition
+	if !errors.As(err, &transitionErr) {
+		t.Errorf("UpdateRetainedQuoteState() error = %v, want *types.ErrInvalidStateTransition", err)
+	}
+	if got := getRetainedQuote(t, r, "a").State; got != types.RQStateCallForUserSucceeded {
+		t.Errorf("state = %v, want %v", got, types.RQStateCallForUserSucceeded)
+	}
+	assertLiquidity(t, r, 100)
+}
+
+func testGetRetainedQuotes(t *testing.T, r Repository) {
+	setLiquidity(t, r, 100)
+	reserve(t, r, newRetainedQuote("a", 10))
+	reserve(t, r, newRetainedQuote("b", 10))
+	reserve(t, r, newRetainedQuote("c", 10))
+	updateState(t, r, "b", types.RQStateWaitingForDeposit, types.RQStateWaitingForDepositConfirmations)
+	updateState(t, r, "c", types.RQStateWaitingForDeposit, types.RQStateTimeForDepositElapsed)
+
+	tests := []struct {
+		states []types.RQState
+		want   []string
+	}{
+		{[]types.RQState{types.RQStateWaitingForDeposit}, []string{"a"}},
+		{[]types.RQState{types.RQStateWaitingForDeposit, types.RQStateWaitingForDepositConfirmations}, []string{"a", "b"}},
+		{[]types.RQState{types.RQStateTimeForDepositElapsed}, []string{"c"}},
+		{[]types.RQState{types.RQStateCallForUserSucceeded}, nil},
+	}
+	for _, tt := range tests {
+		rqs, err := r.GetRetainedQuotes(tt.states...)
+		if err != nil {
+			t.Fatalf("GetRetainedQuotes(%v) error = %v", tt.states, err)
+		}
+		got := make(map[string]bool)
+		for _, rq := range rqs {
+			got[rq.QuoteHash] = true
+		}
+		if len(got) != len(tt.want) || len(rqs) != len(tt.want) {
+			t.Errorf("GetRetainedQuotes(%v) = %v quotes, want %v", tt.states, len(rqs), tt.want)
+			continue
+		}
+		for _, hash := range tt.want {
+			if !got[hash] {
+				t.Errorf("GetRetainedQuotes(%v) is missing %v", tt.states, hash)
+			}
+		}
+	}
+}
+
+func testConcurrentReservations(t *testing.T, r Repository) {
+	setLiquidity(t, r, 100)
+	const n = 30
+	var wg sync.WaitGroup
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = r.ReserveLiquidity(newRetainedQuote(fmt.Sprintf("quote-%v", i), 10))
+		}(i)
+	}
+	wg.Wait()
+
+	reserved := 0
+	for _, err := range errs {
+		var liqErr *providers.ErrInsufficientLiquidity
+		switch {
+		case err == nil:
+			reserved++
+		case !errors.As(err, &liqErr):
+			t.Fatalf("ReserveLiquidity() error = %v", err)
+		}
+	}
+	if reserved != 10 {
+		t.Errorf("reserved %v quotes, want 10", reserved)
+	}
+	assertLiquidity(t, r, 0)
+}
+
+func testConcurrentIdempotentReservations(t *testing.T, r Repository) {
+	setLiquidity(t, r, 100)
+	const n = 10
+	var wg sync.WaitGroup
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = r.ReserveLiquidity(newRetainedQuote("a", 30))
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			t.Fatalf("ReserveLiquidity() error = %v", err)
+		}
+	}
+	assertLiquidity(t, r, 70)
+}
+
+// testCancelledReservation checks that repositories with context variants do not reserve liquidity once the context
+// is done. Repositories without them are skipped.
+func testCancelledReservation(t *testing.T, r Repository) {
+	cr, ok := r.(providers.ContextLocalProviderRepository)
+	if !ok {
+		t.Skip("repository does not implement providers.ContextLocalProviderRepository")
+	}
+	setLiquidity(t, r, 100)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := cr.ReserveLiquidityContext(ctx, newRetainedQuote("a", 40)); !errors.Is(err, context.Canceled) {
+		t.Errorf("ReserveLiquidityContext() error = %v, want context.Canceled", err)
+	}
+	assertHasRetainedQuote(t, r, "a", false)
+	assertLiquidity(t, r, 100)
+
+	if err := cr.ReserveLiquidityContext(context.Background(), newRetainedQuote("a", 40)); err != nil {
+		t.Fatalf("ReserveLiquidityContext() error = %v", err)
+	}
+	assertLiquidity(t, r, 60)
+}
+
+func pegoutRepository(t *testing.T, r Repository) PegoutRepository {
+	t.Helper()
+	pr, ok := r.(PegoutRepository)
+	if !ok {
+		t.Skip("repository does not implement repotest.PegoutRepository")
+	}
+	return pr
+}
+
+func newRetainedPegoutQuote(hash string, reqLiq int64) *types.RetainedPegoutQuote {
+	return &types.RetainedPegoutQuote{
+		QuoteHash:          hash,
+		Signature:          "329389e8c4cb329cdcb88e44e524abedc7492a8d9b210037879874ce8103d5a2491f947010a18f7fab43d91b35e8ec8cf7760f6ab8806f53ef1c7644e7bf8b741b",
+		ReqLiq:             types.NewWei(reqLiq),
+		State:              types.RQStateWaitingForDeposit,
+		AgreementTimestamp: 1670441000,
+		DepositDateLimit:   1670444600,
+	}
+}
+
+func setPegoutLiquidity(t *testing.T, r PegoutRepository, liq int64) {
+	t.Helper()
+	if err := r.SetPegoutLiquidity(types.NewWei(liq)); err != nil {
+		t.Fatalf("SetPegoutLiquidity() error = %v", err)
+	}
+}
+
+func reservePegout(t *testing.T, r PegoutRepository, rq *types.RetainedPegoutQuote) {
+	t.Helper()
+	if err := r.ReservePegoutLiquidity(rq); err != nil {
+		t.Fatalf("ReservePegoutLiquidity(%v) error = %v", rq.QuoteHash, err)
+	}
+}
+
+func updatePegoutState(t *testing.T, r PegoutRepository, hash string, oldState, newState types.RQState) {
+	t.Helper()
+	if err := r.UpdateRetainedPegoutQuoteState(hash, oldState, newState); err != nil {
+		t.Fatalf("UpdateRetainedPegoutQuoteState(%v, %v, %v) error = %v", hash, oldState, newState, err)
+	}
+}
+
+func assertPegoutLiquidity(t *testing.T, r PegoutRepository, want int64) {
+	t.Helper()
+	got, err := r.GetPegoutLiquidity()
+	if err != nil {
+		t.Fatalf("GetPegoutLiquidity() error = %v", err)
+	}
+	if got.Cmp(types.NewWei(want)) != 0 {
+		t.Errorf("GetPegoutLiquidity() = %v, want %v", got, want)
+	}
+}
+
+func testReservePegoutLiquidity(t *testing.T, r Repository) {
+	pr := pegoutRepository(t, r)
+	setLiquidity(t, r, 1000)
+	setPegoutLiquidity(t, pr, 100)
+
+	if ok, err := pr.HasRetainedPegoutQuote("a"); err != nil || ok {
+		t.Errorf("HasRetainedPegoutQuote(a) = %v, %v, want false", ok, err)
+	}
+	want := newRetainedPegoutQuote("a", 60)
+	reservePegout(t, pr, want)
+	if ok, err := pr.HasRetainedPegoutQuote("a"); err != nil || !ok {
+		t.Errorf("HasRetainedPegoutQuote(a) = %v, %v, want true", ok, err)
+	}
+	got, err := pr.GetRetainedPegoutQuote("a")
+	if err != nil {
+		t.Fatalf("GetRetainedPegoutQuote() error = %v", err)
+	}
+	if got.QuoteHash != want.QuoteHash || got.Signature != want.Signature || got.ReqLiq.Cmp(want.ReqLiq) != 0 ||
+		got.State != want.State || got.AgreementTimestamp != want.AgreementTimestamp ||
+		got.DepositDateLimit != want.DepositDateLimit {
+		t.Errorf("retained peg-out quote = %+v, want %+v", got, want)
+	}
+	// peg-in and peg-out liquidity are accounted separately
+	assertPegoutLiquidity(t, pr, 40)
+	assertLiquidity(t, r, 1000)
+	assertHasRetainedQuote(t, r, "a", false)
+
+	hasLiq, err := pr.HasPegoutLiquidity(nil, types.NewWei(40))
+	if err != nil || !hasLiq {
+		t.Errorf("HasPegoutLiquidity(40) = %v, %v, want true", hasLiq, err)
+	}
+	hasLiq, err = pr.HasPegoutLiquidity(nil, types.NewWei(41))
+	if err != nil || hasLiq {
+		t.Errorf("HasPegoutLiquidity(41) = %v, %v, want false", hasLiq, err)
+	}
+
+	// reserving the same quote again is a no-op, even above the available liquidity
+	reservePegout(t, pr, newRetainedPegoutQuote("a", 1000))
+	assertPegoutLiquidity(t, pr, 40)
+
+	err = pr.ReservePegoutLiquidity(newRetainedPegoutQuote("b", 41))
+	var liqErr *providers.ErrInsufficientLiquidity
+	if !errors.As(err, &liqErr) {
+		t.Fatalf("ReservePegoutLiquidity() error = %v, want *providers.ErrInsufficientLiquidity", err)
+	}
+	if liqErr.Required == nil || liqErr.Required.Cmp(types.NewWei(41)) != 0 {
+		t.Errorf("ErrInsufficientLiquidity.Required = %v, want 41", liqErr.Required)
+	}
+	if ok, err := pr.HasRetainedPegoutQuote("b"); err != nil || ok {
+		t.Errorf("HasRetainedPegoutQuote(b) = %v, %v, want false", ok, err)
+	}
+	reservePegout(t, pr, newRetainedPegoutQuote("b", 40))
+	assertPegoutLiquidity(t, pr, 0)
+}
+
+func testPegoutStateTransitions(t *testing.T, r Repository) {
+	pr := pegoutRepository(t, r)
+	setPegoutLiquidity(t, pr, 100)
+	reservePegout(t, pr, newRetainedPegoutQuote("a", 10))
+	reservePegout(t, pr, newRetainedPegoutQuote("b", 20))
+	reservePegout(t, pr, newRetainedPegoutQuote("c", 30))
+	assertPegoutLiquidity(t, pr, 40)
+
+	updatePegoutState(t, pr, "a", types.RQStateWaitingForDeposit, types.RQStateWaitingForDepositConfirmations)
+	assertPegoutLiquidity(t, pr, 40)
+	updatePegoutState(t, pr, "a", types.RQStateWaitingForDepositConfirmations, types.RQStateSendPegoutSucceeded)
+	assertPegoutLiquidity(t, pr, 50)
+	updatePegoutState(t, pr, "a", types.RQStateSendPegoutSucceeded, types.RQStateRefundPegOutSucceeded)
+	updatePegoutState(t, pr, "b", types.RQStateWaitingForDeposit, types.RQStateTimeForDepositElapsed)
+	assertPegoutLiquidity(t, pr, 70)
+	updatePegoutState(t, pr, "c", types.RQStateWaitingForDeposit, types.RQStateSendPegoutFailed)
+	assertPegoutLiquidity(t, pr, 100)
+
+	err := pr.UpdateRetainedPegoutQuoteState("missing", types.RQStateWaitingForDeposit, types.RQStateSendPegoutSucceeded)
+	if !errors.Is(err, providers.ErrRetainedQuoteNotFound) {
+		t.Errorf("UpdateRetainedPegoutQuoteState() error = %v, want %v", err, providers.ErrRetainedQuoteNotFound)
+	}
+	err = pr.UpdateRetainedPegoutQuoteState("c", types.RQStateWaitingForDeposit, types.RQStateSendPegoutSucceeded)
+	if !errors.Is(err, providers.ErrUnexpectedRetainedQuoteState) {
+		t.Errorf("UpdateRetainedPegoutQuoteState() error = %v, want %v", err, providers.ErrUnexpectedRetainedQuoteState)
+	}
+	// the peg-in states are not part of the peg-out state graph
+	reservePegout(t, pr, newRetainedPegoutQuote("d", 10))
+	err = pr.UpdateRetainedPegoutQuoteState("d", types.RQStateWaitingForDeposit, types.RQStateCallForUserSucceeded)
+	var transitionErr *types.ErrInvalidStateTransition
+	if !errors.As(err, &transitionErr) {
+		t.Errorf("UpdateRetainedPegoutQuoteState() error = %v, want *types.ErrInvalidStateTransition", err)
+	}
+	rq, err := pr.GetRetainedPegoutQuote("d")
+	if err != nil {
+		t.Fatalf("GetRetainedPegoutQuote() error = %v", err)
+	}
+	if rq.State != types.RQStateWaitingForDeposit {
+		t.Errorf("state = %v, want %v", rq.State, types.RQStateWaitingForDeposit)
+	}
+	assertPegoutLiquidity(t, pr, 90)
+
+	rqs, err := pr.GetRetainedPegoutQuotes(types.RQStateWaitingForDeposit, types.RQStateTimeForDepositElapsed)
+	if err != nil {
+		t.Fatalf("GetRetainedPegoutQuotes() error = %v", err)
+	}
+	got := make(map[string]bool)
+	for _, rq := range rqs {
+		got[rq.QuoteHash] = true
+	}
+	if len(rqs) != 2 || !got["b"] || !got["d"] {
+		t.Errorf("GetRetainedPegoutQuotes() = %v quotes, want b and d", len(rqs))
+	}
+}
+
+func testConcurrentPegoutReservations(t *testing.T, r Repository) {
+	pr := pegoutRepository(t, r)
+	setPegoutLiquidity(t, pr, 100)
+	const n = 30
+	var wg sync.WaitGroup
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = pr.ReservePegoutLiquidity(newRetainedPegoutQuote(fmt.Sprintf("quote-%v", i), 10))
+		}(i)
+	}
+	wg.Wait()
+
+	reserved := 0
+	for _, err := range errs {
+		var liqErr *providers.ErrInsufficientLiquidity
+		switch {
+		case err == nil:
+			reserved++
+		case !errors.As(err, &liqErr):
+			t.Fatalf("ReservePegoutLiquidity() error = %v", err)
+		}
+	}
+	if reserved != 10 {
+		t.Errorf("reserved %v quotes, want 10", reserved)
+	}
+	assertPegoutLiquidity(t, pr, 0)
+}
+
+func signedValueRepository(t *testing.T, r Repository) providers.SignedValueRepository {
+	t.Helper()
+	sr, ok := r.(providers.SignedValueRepository)
+	if !ok {
+		t.Skip("repository does not implement providers.SignedValueRepository")
+	}
+	return sr
+}
+
+func assertSignedValue(t *testing.T, r providers.SignedValueRepository, since time.Time, want int64) {
+	t.Helper()
+	value, err := r.GetSignedValue(since)
+	if err != nil {
+		t.Fatalf("GetSignedValue() error = %v", err)
+	}
+	if value.Cmp(types.NewWei(want)) != 0 {
+		t.Errorf("signed value = %v, want %v", value, want)
+	}
+}
+
+func addSignedValue(t *testing.T, r providers.SignedValueRepository, key string, value int64, at time.Time, limit int64) (bool, error) {
+	t.Helper()
+	return r.AddSignedValue(key, types.NewWei(value), at, at.Add(-providers.PolicyWindow), types.NewWei(limit))
+}
+
+func testSignedValueWindow(t *testing.T, r Repository) {
+	sr := signedValueRepository(t, r)
+	start := time.Unix(1600000000, 0)
+	if added, err := addSignedValue(t, sr, "a", 1000, start, 3000); err != nil || !added {
+		t.Fatalf("AddSignedValue(a) = %v, %v, want true, <nil>", added, err)
+	}
+	// an accounted key only adds the excess over its value
+	if added, err := addSignedValue(t, sr, "a", 500, start.Add(time.Hour), 3000); err != nil || added {
+		t.Fatalf("AddSignedValue(a) = %v, %v, want false, <nil>", added, err)
+	}
+	if added, err := addSignedValue(t, sr, "a", 1500, start.Add(time.Hour), 3000); err != nil || added {
+		t.Fatalf("AddSignedValue(a) = %v, %v, want false, <nil>", added, err)
+	}
+	assertSignedValue(t, sr, start.Add(-time.Hour), 1500)
+
+	if _, err := addSignedValue(t, sr, "b", 1500, start.Add(time.Hour), 3000); err != nil {
+		t.Fatalf("AddSignedValue(b) error = %v", err)
+	}
+	_, err := addSignedValue(t, sr, "c", 1, start.Add(time.Hour), 3000)
+	var violation *providers.ErrPolicyViolation
+	if !errors.As(err, &violation) || violation.Rule != providers.PolicyRuleMaxSignedValue {
+		t.Fatalf("AddSignedValue(c) error = %v, want *providers.ErrPolicyViolation", err)
+	}
+	assertSignedValue(t, sr, start.Add(-time.Hour), 3000)
+
+	// a keeps the time it was first accounted at, so it leaves the window first
+	assertSignedValue(t, sr, start, 1500)
+	if _, err = addSignedValue(t, sr, "c", 1500, start.Add(providers.PolicyWindow), 3000); err != nil {
+		t.Fatalf("AddSignedValue(c) error = %v", err)
+	}
+	if err = sr.RemoveSignedValue("b"); err != nil {
+		t.Fatalf("RemoveSignedValue(b) error = %v", err)
+	}
+	if err = sr.RemoveSignedValue("missing"); err != nil {
+		t.Fatalf("RemoveSignedValue(missing) error = %v", err)
+	}
+	assertSignedValue(t, sr, start, 1500)
+}
+
+func testConcurrentSignedValues(t *testing.T, r Repository) {
+	sr := signedValueRepository(t, r)
+	at := time.Unix(1600000000, 0)
+	const n = 30
+	var wg sync.WaitGroup
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = addSignedValue(t, sr, fmt.Sprintf("value-%v", i), 10, at, 100)
+		}(i)
+	}
+	wg.Wait()
+
+	added := 0
+	for _, err := range errs {
+		var violation *providers.ErrPolicyViolation
+		switch {
+		case err == nil:
+			added++
+		case !errors.As(err, &violation):
+			t.Fatalf("AddSignedValue() error = %v", err)
+		}
+	}
+	if added != 10 {
+		t.Errorf("added %v values, want 10", added)
+	}
+	assertSignedValue(t, sr, at.Add(-time.Hour), 100)
+}
@@ -0,0 +1,130 @@
+package sqlrepo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// migrations are applied in order and recorded in the schema_migrations table. Released migrations must never be
+// modified, new schema changes are appended instead.
+var migrations = []string{
+	`CREATE TABLE IF NOT EXISTS quotes (
+		quote_hash VARCHAR(64) PRIMARY KEY,
+		fed_addr TEXT NOT NULL,
+		lbc_addr TEXT NOT NULL,
+		lp_rsk_addr TEXT NOT NULL,
+		btc_refund_addr TEXT NOT NULL,
+		rsk_refund_addr TEXT NOT NULL,
+		lp_btc_addr TEXT NOT NULL,
+		call_fee TEXT NOT NULL,
+		penalty_fee TEXT NOT NULL,
+		contract_addr TEXT NOT NULL,
+		data TEXT NOT NULL,
+		gas_limit BIGINT NOT NULL,
+		nonce BIGINT NOT NULL,
+		value TEXT NOT NULL,
+		agreement_timestamp BIGINT NOT NULL,
+		time_for_deposit BIGINT NOT NULL,
+		call_time BIGINT NOT NULL,
+		confirmations INTEGER NOT NULL,
+		call_on_register BOOLEAN NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS retained_quotes (
+		quote_hash VARCHAR(64) PRIMARY KEY,
+		deposit_addr TEXT NOT NULL,
+		signature TEXT NOT NULL,
+		req_liq TEXT NOT NULL,
+		state BIGINT NOT NULL,
+		agreement_timestamp BIGINT NOT NULL,
+		time_for_deposit BIGINT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS retained_quotes_state ON retained_quotes (state)`,
+	`CREATE TABLE IF NOT EXISTS liquidity (
+		id INTEGER PRIMARY KEY,
+		total TEXT NOT NULL
+	)`,
+	`INSERT INTO liquidity (id, total) SELECT 1, '0' WHERE NOT EXISTS (SELECT 1 FROM liquidity WHERE id = 1)`,
+	`ALTER TABLE retained_quotes ADD COLUMN fee_breakdown TEXT`,
+	`ALTER TABLE quotes ADD COLUMN fee_breakdown TEXT`,
+	`CREATE TABLE IF NOT EXISTS signed_values (
+		value_key VARCHAR(80) PRIMARY KEY,
+		value TEXT NOT NULL,
+		signed_at BIGINT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS signed_values_signed_at ON signed_values (signed_at)`,
+	`CREATE TABLE IF NOT EXISTS pegout_quotes (
+		quote_hash VARCHAR(64) PRIMARY KEY,
+		lbc_addr TEXT NOT NULL,
+		lp_rsk_addr TEXT NOT NULL,
+		btc_refund_addr TEXT NOT NULL,
+		rsk_refund_addr TEXT NOT NULL,
+		lp_btc_addr TEXT NOT NULL,
+		call_fee TEXT NOT NULL,
+		penalty_fee TEXT NOT NULL,
+		nonce BIGINT NOT NULL,
+		deposit_addr TEXT NOT NULL,
+		value TEXT NOT NULL,
+		agreement_timestamp BIGINT NOT NULL,
+		deposit_date_limit BIGINT NOT NULL,
+		deposit_confirmations INTEGER NOT NULL,
+		transfer_confirmations INTEGER NOT NULL,
+		transfer_time BIGINT NOT NULL,
+		expire_date BIGINT NOT NULL,
+		expire_block BIGINT NOT NULL,
+		fee_breakdown TEXT
+	)`,
+	`CREATE TABLE IF NOT EXISTS retained_pegout_quotes (
+		quote_hash VARCHAR(64) PRIMARY KEY,
+		signature TEXT NOT NULL,
+		req_liq TEXT NOT NULL,
+		state BIGINT NOT NULL,
+		agreement_timestamp BIGINT NOT NULL,
+		deposit_date_limit BIGINT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS retained_pegout_quotes_state ON retained_pegout_quotes (state)`,
+	`ALTER TABLE liquidity ADD COLUMN pegout_total TEXT NOT NULL DEFAULT '0'`,
+}
+
+// migrate applies the pending migrations in a single transaction, which holds a write lock on schema_migrations from
+// the start, so repositories created concurrently over the same database apply them once.
+func (r *Repository) migrate(ctx context.Context) error {
+	_, err := r.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY)`)
+	if err != nil {
+		return fmt.Errorf("error creating schema_migrations table: %v", err)
+	}
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+	if err = r.lockMigrations(ctx, tx); err != nil {
+		return fmt.Errorf("error locking schema_migrations table: %v", err)
+	}
+	var current int
+	err = tx.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current)
+	if err != nil {
+		return fmt.Errorf("error reading schema version: %v", err)
+	}
+	for i := current; i < len(migrations); i++ {
+		if _, err = tx.ExecContext(ctx, migrations[i]); err != nil {
+			return fmt.Errorf("error applying migration %v: %v", i+1, err)
+		}
+		if _, err = tx.ExecContext(ctx, r.rebind(`INSERT INTO schema_migrations (version) VALUES (?)`), i+1); err != nil {
+			return fmt.Errorf("error recording migration %v: %v", i+1, err)
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *Repository) lockMigrations(ctx context.Context, tx *sql.Tx) error {
+	if r.dialect == DialectDollar {
+		_, err := tx.ExecContext(ctx, `LOCK TABLE schema_migrations IN EXCLUSIVE MODE`)
+		return err
+	}
+	// SQLite has no table locks, but the no-op update takes the database write lock
+	_, err := tx.ExecContext(ctx, `UPDATE schema_migrations SET version = version WHERE version < 0`)
+	return err
+}
@@ -0,0 +1,725 @@
+// Package sqlrepo implements the provider repositories on top of database/sql.
+package sqlrepo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rsksmart/liquidity-provider/providers"
+	"github.com/rsksmart/liquidity-provider/types"
+)
+
+// Dialect selects the bind parameter syntax of the underlying driver.
+type Dialect int
+
+const (
+	// DialectQuestion uses ? placeholders, as SQLite and MySQL do
+	DialectQuestion Dialect = iota
+	// DialectDollar uses $1, $2... placeholders, as PostgreSQL does
+	DialectDollar
+)
+
+const retainedQuoteColumns = "quote_hash, deposit_addr, signature, req_liq, state, agreement_timestamp, time_for_deposit, " +
+	"fee_breakdown"
+
+const quoteColumns = "fed_addr, lbc_addr, lp_rsk_addr, btc_refund_addr, rsk_refund_addr, lp_btc_addr, call_fee, " +
+	"penalty_fee, contract_addr, data, gas_limit, nonce, value, agreement_timestamp, time_for_deposit, call_time, " +
+	"confirmations, call_on_register, fee_breakdown"
+
+const retainedPegoutQuoteColumns = "quote_hash, signature, req_liq, state, agreement_timestamp, deposit_date_limit"
+
+const pegoutQuoteColumns = "lbc_addr, lp_rsk_addr, btc_refund_addr, rsk_refund_addr, lp_btc_addr, call_fee, penalty_fee, " +
+	"nonce, deposit_addr, value, agreement_timestamp, deposit_date_limit, deposit_confirmations, transfer_confirmations, " +
+	"transfer_time, expire_date, expire_block, fee_breakdown"
+
+// ErrQuoteNotFound is providers.ErrQuoteNotFound, returned by GetQuote and GetPegoutQuote.
+var ErrQuoteNotFound = providers.ErrQuoteNotFound
+
+type Repository struct {
+	db      *sql.DB
+	dialect Dialect
+}
+
+// NewRepository returns a repository backed by db, applying the pending schema migrations.
+func NewRepository(db *sql.DB, dialect Dialect) (*Repository, error) {
+	return NewRepositoryContext(context.Background(), db, dialect)
+}
+
+// NewRepositoryContext is NewRepository, giving up applying the migrations when ctx is done.
+func NewRepositoryContext(ctx context.Context, db *sql.DB, dialect Dialect) (*Repository, error) {
+	r := &Repository{
+		db:      db,
+		dialect: dialect,
+	}
+	if err := r.migrate(ctx); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *Repository) HasRetainedQuote(hash string) (bool, error) {
+	return r.HasRetainedQuoteContext(context.Background(), hash)
+}
+
+func (r *Repository) HasRetainedQuoteContext(ctx context.Context, hash string) (bool, error) {
+	var n int
+	err := r.db.QueryRowContext(ctx, r.rebind(`SELECT COUNT(*) FROM retained_quotes WHERE quote_hash = ?`), hash).Scan(&n)
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func (r *Repository) HasLiquidity(lp providers.LiquidityProvider, wei *types.Wei) (bool, error) {
+	return r.HasLiquidityContext(context.Background(), lp, wei)
+}
+
+func (r *Repository) HasLiquidityContext(ctx context.Context, _ providers.LiquidityProvider, wei *types.Wei) (bool, error) {
+	liq, err := r.GetLiquidityContext(ctx)
+	if err != nil {
+		return false, err
+	}
+	return liq.Cmp(wei) >= 0, nil
+}
+
+func (r *Repository) ReserveLiquidity(rq *types.RetainedQuote) error {
+	return r.ReserveLiquidityContext(context.Background(), rq)
+}
+
+// ReserveLiquidityContext is ReserveLiquidity, rolling the reservation back when ctx is done before it is committed.
+func (r *Repository) ReserveLiquidityContext(ctx context.Context, rq *types.RetainedQuote) error {
+	return r.reserveLiquidity(ctx, nil, rq)
+}
+
+func (r *Repository) ReserveQuoteLiquidity(q *types.Quote, rq *types.RetainedQuote) error {
+	return r.ReserveQuoteLiquidityContext(context.Background(), q, rq)
+}
+
+func (r *Repository) ReserveQuoteLiquidityContext(ctx context.Context, q *types.Quote, rq *types.RetainedQuote) error {
+	return r.reserveLiquidity(ctx, q, rq)
+}
+
+// reserveLiquidity reserves rq and stores q, when it is not nil, in a single transaction.
+func (r *Repository) reserveLiquidity(ctx context.Context, q *types.Quote, rq *types.RetainedQuote) error {
+	if err := providers.CheckReqLiq(rq.ReqLiq); err != nil {
+		return err
+	}
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	// the no-op update takes a write lock on the liquidity row, so concurrent reservations are serialized
+	if _, err = tx.ExecContext(ctx, `UPDATE liquidity SET total = total WHERE id = 1`); err != nil {
+		return err
+	}
+	var n int
+	err = tx.QueryRowContext(ctx, r.rebind(`SELECT COUNT(*) FROM retained_quotes WHERE quote_hash = ?`), rq.QuoteHash).Scan(&n)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+	available, err := availableLiquidity(ctx, tx, "total", "retained_quotes")
+	if err != nil {
+		return err
+	}
+	if available.Cmp(rq.ReqLiq) < 0 {
+		return &providers.ErrInsufficientLiquidity{Required: rq.ReqLiq.Copy(), Available: available}
+	}
+	if q != nil {
+		err = tx.QueryRowContext(ctx, r.rebind(`SELECT COUNT(*) FROM quotes WHERE quote_hash = ?`), rq.QuoteHash).Scan(&n)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			if err = r.insertQuote(ctx, tx, rq.QuoteHash, q); err != nil {
+				return err
+			}
+		}
+	}
+	breakdown, err := feeBreakdownValue(rq.FeeBreakdown)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, r.rebind(`INSERT INTO retained_quotes (`+retainedQuoteColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`),
+		rq.QuoteHash, rq.DepositAddr, rq.Signature, rq.ReqLiq, int64(rq.State), int64(rq.AgreementTimestamp), int64(rq.TimeForDeposit),
+		breakdown)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *Repository) GetRetainedQuote(hash string) (*types.RetainedQuote, error) {
+	return r.GetRetainedQuoteContext(context.Background(), hash)
+}
+
+func (r *Repository) GetRetainedQuoteContext(ctx context.Context, hash string) (*types.RetainedQuote, error) {
+	row := r.db.QueryRowContext(ctx, r.rebind(`SELECT `+retainedQuoteColumns+` FROM retained_quotes WHERE quote_hash = ?`), hash)
+	rq, err := scanRetainedQuote(row)
+	if err == sql.ErrNoRows {
+		return nil, providers.ErrRetainedQuoteNotFound
+	}
+	return rq, err
+}
+
+func (r *Repository) GetRetainedQuotes(states ...types.RQState) ([]*types.RetainedQuote, error) {
+	return r.GetRetainedQuotesContext(context.Background(), states...)
+}
+
+func (r *Repository) GetRetainedQuotesContext(ctx context.Context, states ...types.RQState) ([]*types.RetainedQuote, error) {
+	if len(states) == 0 {
+		return nil, nil
+	}
+	args := make([]interface{}, len(states))
+	for i, state := range states {
+		args[i] = int64(state)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(states)), ", ")
+	rows, err := r.db.QueryContext(ctx, r.rebind(`SELECT `+retainedQuoteColumns+` FROM retained_quotes WHERE state IN (`+placeholders+`)`), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func(rows *sql.Rows) {
+		_ = rows.Close()
+	}(rows)
+	var res []*types.RetainedQuote
+	for rows.Next() {
+		rq, err := scanRetainedQuote(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, rq)
+	}
+	return res, rows.Err()
+}
+
+func (r *Repository) UpdateRetainedQuoteState(hash string, oldState types.RQState, newState types.RQState) error {
+	return r.UpdateRetainedQuoteStateContext(context.Background(), hash, oldState, newState)
+}
+
+func (r *Repository) UpdateRetainedQuoteStateContext(ctx context.Context, hash string, oldState types.RQState, newState types.RQState) error {
+	rq := types.RetainedQuote{State: oldState}
+	if err := rq.Transition(newState); err != nil {
+		return err
+	}
+	res, err := r.db.ExecContext(ctx, r.rebind(`UPDATE retained_quotes SET state = ? WHERE quote_hash = ? AND state = ?`),
+		int64(newState), hash, int64(oldState))
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+	if _, err = r.GetRetainedQuoteContext(ctx, hash); err != nil {
+		return err
+	}
+	return providers.ErrUnexpectedRetainedQuoteState
+}
+
+// GetLiquidity returns the total liquidity minus the liquidity locked by retained quotes.
+func (r *Repository) GetLiquidity() (*types.Wei, error) {
+	return r.GetLiquidityContext(context.Background())
+}
+
+func (r *Repository) GetLiquidityContext(ctx context.Context) (*types.Wei, error) {
+	return availableLiquidity(ctx, r.db, "total", "retained_quotes")
+}
+
+// SetLiquidity sets the total liquidity of the provider.
+func (r *Repository) SetLiquidity(liq *types.Wei) error {
+	_, err := r.db.Exec(r.rebind(`UPDATE liquidity SET total = ? WHERE id = 1`), liq)
+	return err
+}
+
+func (r *Repository) HasRetainedPegoutQuote(hash string) (bool, error) {
+	return r.HasRetainedPegoutQuoteContext(context.Background(), hash)
+}
+
+func (r *Repository) HasRetainedPegoutQuoteContext(ctx context.Context, hash string) (bool, error) {
+	var n int
+	err := r.db.QueryRowContext(ctx, r.rebind(`SELECT COUNT(*) FROM retained_pegout_quotes WHERE quote_hash = ?`), hash).Scan(&n)
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func (r *Repository) HasPegoutLiquidity(lp providers.PegoutLiquidityProvider, wei *types.Wei) (bool, error) {
+	return r.HasPegoutLiquidityContext(context.Background(), lp, wei)
+}
+
+func (r *Repository) HasPegoutLiquidityContext(ctx context.Context, _ providers.PegoutLiquidityProvider, wei *types.Wei) (bool, error) {
+	liq, err := r.GetPegoutLiquidityContext(ctx)
+	if err != nil {
+		return false, err
+	}
+	return liq.Cmp(wei) >= 0, nil
+}
+
+func (r *Repository) ReservePegoutLiquidity(rq *types.RetainedPegoutQuote) error {
+	return r.ReservePegoutLiquidityContext(context.Background(), rq)
+}
+
+// ReservePegoutLiquidityContext is ReservePegoutLiquidity, rolling the reservation back when ctx is done before it is
+// committed.
+func (r *Repository) ReservePegoutLiquidityContext(ctx context.Context, rq *types.RetainedPegoutQuote) error {
+	return r.reservePegoutLiquidity(ctx, nil, rq)
+}
+
+func (r *Repository) ReservePegoutQuoteLiquidity(q *types.PegoutQuote, rq *types.RetainedPegoutQuote) error {
+	return r.ReservePegoutQuoteLiquidityContext(context.Background(), q, rq)
+}
+
+func (r *Repository) ReservePegoutQuoteLiquidityContext(ctx context.Context, q *types.PegoutQuote, rq *types.RetainedPegoutQuote) error {
+	return r.reservePegoutLiquidity(ctx, q, rq)
+}
+
+func (r *Repository) reservePegoutLiquidity(ctx context.Context, q *types.PegoutQuote, rq *types.RetainedPegoutQuote) error {
+	if err := providers.CheckReqLiq(rq.ReqLiq); err != nil {
+		return err
+	}
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	// the peg-in and peg-out reservations share the lock on the liquidity row
+	if _, err = tx.ExecContext(ctx, `UPDATE liquidity SET total = total WHERE id = 1`); err != nil {
+		return err
+	}
+	var n int
+	err = tx.QueryRowContext(ctx, r.rebind(`SELECT COUNT(*) FROM retained_pegout_quotes WHERE quote_hash = ?`), rq.QuoteHash).Scan(&n)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+	available, err := availableLiquidity(ctx, tx, "pegout_total", "retained_pegout_quotes")
+	if err != nil {
+		return err
+	}
+	if available.Cmp(rq.ReqLiq) < 0 {
+		return &providers.ErrInsufficientLiquidity{Required: rq.ReqLiq.Copy(), Available: available}
+	}
+	if q != nil {
+		err = tx.QueryRowContext(ctx, r.rebind(`SELECT COUNT(*) FROM pegout_quotes WHERE quote_hash = ?`), rq.QuoteHash).Scan(&n)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			if err = r.insertPegoutQuote(ctx, tx, rq.QuoteHash, q); err != nil {
+				return err
+			}
+		}
+	}
+	_, err = tx.ExecContext(ctx, r.rebind(`INSERT INTO retained_pegout_quotes (`+retainedPegoutQuoteColumns+`) VALUES (?, ?, ?, ?, ?, ?)`),
+		rq.QuoteHash, rq.Signature, rq.ReqLiq, int64(rq.State), int64(rq.AgreementTimestamp), int64(rq.DepositDateLimit))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *Repository) GetRetainedPegoutQuote(hash string) (*types.RetainedPegoutQuote, error) {
+	return r.GetRetainedPegoutQuoteContext(context.Background(), hash)
+}
+
+func (r *Repository) GetRetainedPegoutQuoteContext(ctx context.Context, hash string) (*types.RetainedPegoutQuote, error) {
+	row := r.db.QueryRowContext(ctx, r.rebind(`SELECT `+retainedPegoutQuoteColumns+` FROM retained_pegout_quotes WHERE quote_hash = ?`), hash)
+	rq, err := scanRetainedPegoutQuote(row)
+	if err == sql.ErrNoRows {
+		return nil, providers.ErrRetainedQuoteNotFound
+	}
+	return rq, err
+}
+
+func (r *Repository) GetRetainedPegoutQuotes(states ...types.RQState) ([]*types.RetainedPegoutQuote, error) {
+	return r.GetRetainedPegoutQuotesContext(context.Background(), states...)
+}
+
+func (r *Repository) GetRetainedPegoutQuotesContext(ctx context.Context, states ...types.RQState) ([]*types.RetainedPegoutQuote, error) {
+	if len(states) == 0 {
+		return nil, nil
+	}
+	args := make([]interface{}, len(states))
+	for i, state := range states {
+		args[i] = int64(state)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(states)), ", ")
+	rows, err := r.db.QueryContext(ctx, r.rebind(`SELECT `+retainedPegoutQuoteColumns+` FROM retained_pegout_quotes WHERE state IN (`+placeholders+`)`), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func(rows *sql.Rows) {
+		_ = rows.Close()
+	}(rows)
+	var res []*types.RetainedPegoutQuote
+	for rows.Next() {
+		rq, err := scanRetainedPegoutQuote(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, rq)
+	}
+	return res, rows.Err()
+}
+
+func (r *Repository) UpdateRetainedPegoutQuoteState(hash string, oldState types.RQState, newState types.RQState) error {
+	return r.UpdateRetainedPegoutQuoteStateContext(context.Background(), hash, oldState, newState)
+}
+
+func (r *Repository) UpdateRetainedPegoutQuoteStateContext(ctx context.Context, hash string, oldState types.RQState, newState types.RQState) error {
+	rq := types.RetainedPegoutQuote{State: oldState}
+	if err := rq.Transition(newState); err != nil {
+		return err
+	}
+	res, err := r.db.ExecContext(ctx, r.rebind(`UPDATE retained_pegout_quotes SET state = ? WHERE quote_hash = ? AND state = ?`),
+		int64(newState), hash, int64(oldState))
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+	if _, err = r.GetRetainedPegoutQuoteContext(ctx, hash); err != nil {
+		return err
+	}
+	return providers.ErrUnexpectedRetainedQuoteState
+}
+
+// GetPegoutLiquidity returns the total peg-out liquidity minus the liquidity locked by retained peg-out quotes.
+func (r *Repository) GetPegoutLiquidity() (*types.Wei, error) {
+	return r.GetPegoutLiquidityContext(context.Background())
+}
+
+func (r *Repository) GetPegoutLiquidityContext(ctx context.Context) (*types.Wei, error) {
+	return availableLiquidity(ctx, r.db, "pegout_total", "retained_pegout_quotes")
+}
+
+// SetPegoutLiquidity sets the total peg-out liquidity of the provider.
+func (r *Repository) SetPegoutLiquidity(liq *types.Wei) error {
+	_, err := r.db.Exec(r.rebind(`UPDATE liquidity SET pegout_total = ? WHERE id = 1`), liq)
+	return err
+}
+
+func (r *Repository) AddSignedValue(key string, value *types.Wei, at time.Time, since time.Time, limit *types.Wei) (bool, error) {
+	ctx := context.Background()
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	// the no-op update takes a write lock on the liquidity row, so concurrent additions are serialized
+	if _, err = tx.ExecContext(ctx, `UPDATE liquidity SET total = total WHERE id = 1`); err != nil {
+		return false, err
+	}
+	if _, err = tx.ExecContext(ctx, r.rebind(`DELETE FROM signed_values WHERE signed_at <= ?`), since.UnixNano()); err != nil {
+		return false, err
+	}
+	var accounted *types.Wei
+	stored := new(types.Wei)
+	err = tx.QueryRowContext(ctx, r.rebind(`SELECT value FROM signed_values WHERE value_key = ?`), key).Scan(stored)
+	switch {
+	case err == nil:
+		accounted = stored
+	case err != sql.ErrNoRows:
+		return false, err
+	}
+	total, err := r.signedValue(ctx, tx, since)
+	if err != nil {
+		return false, err
+	}
+	store, err := providers.CheckSignedValue(accounted, total, value, limit)
+	if !store {
+		return false, err
+	}
+	if accounted == nil {
+		_, err = tx.ExecContext(ctx, r.rebind(`INSERT INTO signed_values (value_key, value, signed_at) VALUES (?, ?, ?)`),
+			key, value, at.UnixNano())
+	} else {
+		_, err = tx.ExecContext(ctx, r.rebind(`UPDATE signed_values SET value = ? WHERE value_key = ?`), value, key)
+	}
+	if err != nil {
+		return false, err
+	}
+	return accounted == nil, tx.Commit()
+}
+
+func (r *Repository) RemoveSignedValue(key string) error {
+	_, err := r.db.Exec(r.rebind(`DELETE FROM signed_values WHERE value_key = ?`), key)
+	return err
+}
+
+func (r *Repository) GetSignedValue(since time.Time) (*types.Wei, error) {
+	return r.signedValue(context.Background(), r.db, since)
+}
+
+// InsertQuote stores the full quote record identified by its hash.
+func (r *Repository) InsertQuote(hash string, q *types.Quote) error {
+	return r.InsertQuoteContext(context.Background(), hash, q)
+}
+
+func (r *Repository) InsertQuoteContext(ctx context.Context, hash string, q *types.Quote) error {
+	return r.insertQuote(ctx, r.db, hash, q)
+}
+
+func (r *Repository) insertQuote(ctx context.Context, db execer, hash string, q *types.Quote) error {
+	breakdown, err := feeBreakdownValue(q.FeeBreakdown)
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx, r.rebind(`INSERT INTO quotes (quote_hash, `+quoteColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`),
+		hash, q.FedBTCAddr, q.LBCAddr, q.LPRSKAddr, q.BTCRefundAddr, q.RSKRefundAddr, q.LPBTCAddr, q.CallFee, q.PenaltyFee,
+		q.ContractAddr, q.Data, int64(q.GasLimit), q.Nonce, q.Value, int64(q.AgreementTimestamp), int64(q.TimeForDeposit),
+		int64(q.CallTime), int64(q.Confirmations), q.CallOnRegister, breakdown)
+	return err
+}
+
+func (r *Repository) GetQuote(hash string) (*types.Quote, error) {
+	return r.GetQuoteContext(context.Background(), hash)
+}
+
+func (r *Repository) GetQuoteContext(ctx context.Context, hash string) (*types.Quote, error) {
+	q := types.Quote{
+		CallFee:    new(types.Wei),
+		PenaltyFee: new(types.Wei),
+		Value:      new(types.Wei),
+	}
+	var gasLimit, agreementTimestamp, timeForDeposit, callTime, confirmations int64
+	var breakdown sql.NullString
+	err := r.db.QueryRowContext(ctx, r.rebind(`SELECT `+quoteColumns+` FROM quotes WHERE quote_hash = ?`), hash).Scan(
+		&q.FedBTCAddr, &q.LBCAddr, &q.LPRSKAddr, &q.BTCRefundAddr, &q.RSKRefundAddr, &q.LPBTCAddr, q.CallFee, q.PenaltyFee,
+		&q.ContractAddr, &q.Data, &gasLimit, &q.Nonce, q.Value, &agreementTimestamp, &timeForDeposit, &callTime,
+		&confirmations, &q.CallOnRegister, &breakdown)
+	if err == sql.ErrNoRows {
+		return nil, ErrQuoteNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if q.FeeBreakdown, err = parseFeeBreakdown(breakdown); err != nil {
+		return nil, err
+	}
+	q.GasLimit = uint32(gasLimit)
+	q.AgreementTimestamp = uint32(agreementTimestamp)
+	q.TimeForDeposit = uint32(timeForDeposit)
+	q.CallTime = uint32(callTime)
+	q.Confirmations = uint16(confirmations)
+	return &q, nil
+}
+
+// InsertPegoutQuote stores the full peg-out quote record identified by its hash.
+func (r *Repository) InsertPegoutQuote(hash string, q *types.PegoutQuote) error {
+	return r.InsertPegoutQuoteContext(context.Background(), hash, q)
+}
+
+func (r *Repository) InsertPegoutQuoteContext(ctx context.Context, hash string, q *types.PegoutQuote) error {
+	return r.insertPegoutQuote(ctx, r.db, hash, q)
+}
+
+func (r *Repository) insertPegoutQuote(ctx context.Context, db execer, hash string, q *types.PegoutQuote) error {
+	breakdown, err := feeBreakdownValue(q.FeeBreakdown)
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx, r.rebind(`INSERT INTO pegout_quotes (quote_hash, `+pegoutQuoteColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`),
+		hash, q.LBCAddr, q.LPRSKAddr, q.BTCRefundAddr, q.RSKRefundAddr, q.LPBTCAddr, q.CallFee, q.PenaltyFee, q.Nonce,
+		q.DepositAddr, q.Value, int64(q.AgreementTimestamp), int64(q.DepositDateLimit), int64(q.DepositConfirmations),
+		int64(q.TransferConfirmations), int64(q.TransferTime), int64(q.ExpireDate), int64(q.ExpireBlock), breakdown)
+	return err
+}
+
+func (r *Repository) GetPegoutQuote(hash string) (*types.PegoutQuote, error) {
+	return r.GetPegoutQuoteContext(context.Background(), hash)
+}
+
+func (r *Repository) GetPegoutQuoteContext(ctx context.Context, hash string) (*types.PegoutQuote, error) {
+	q := types.PegoutQuote{
+		CallFee:    new(types.Wei),
+		PenaltyFee: new(types.Wei),
+		Value:      new(types.Wei),
+	}
+	var agreementTimestamp, depositDateLimit, depositConfirmations, transferConfirmations, transferTime, expireDate,
+		expireBlock int64
+	var breakdown sql.NullString
+	err := r.db.QueryRowContext(ctx, r.rebind(`SELECT `+pegoutQuoteColumns+` FROM pegout_quotes WHERE quote_hash = ?`), hash).Scan(
+		&q.LBCAddr, &q.LPRSKAddr, &q.BTCRefundAddr, &q.RSKRefundAddr, &q.LPBTCAddr, q.CallFee, q.PenaltyFee, &q.Nonce,
+		&q.DepositAddr, q.Value, &agreementTimestamp, &depositDateLimit, &depositConfirmations, &transferConfirmations,
+		&transferTime, &expireDate, &expireBlock, &breakdown)
+	if err == sql.ErrNoRows {
+		return nil, ErrQuoteNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if q.FeeBreakdown, err = parseFeeBreakdown(breakdown); err != nil {
+		return nil, err
+	}
+	q.AgreementTimestamp = uint32(agreementTimestamp)
+	q.DepositDateLimit = uint32(depositDateLimit)
+	q.DepositConfirmations = uint16(depositConfirmations)
+	q.TransferConfirmations = uint16(transferConfirmations)
+	q.TransferTime = uint32(transferTime)
+	q.ExpireDate = uint32(expireDate)
+	q.ExpireBlock = uint32(expireBlock)
+	return &q, nil
+}
+
+type queryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// availableLiquidity returns the liquidity stored in the totalColumn of the liquidity row minus the liquidity locked
+// by the quotes retained in table.
+func availableLiquidity(ctx context.Context, db queryer, totalColumn string, table string) (*types.Wei, error) {
+	liq := new(types.Wei)
+	if err := db.QueryRowContext(ctx, `SELECT `+totalColumn+` FROM liquidity WHERE id = 1`).Scan(liq); err != nil {
+		return nil, err
+	}
+	// the states are trusted integers, inlining them keeps the query independent of the dialect
+	states := make([]string, 0)
+	for _, state := range types.LiquidityLockingStates() {
+		states = append(states, strconv.FormatUint(uint64(state), 10))
+	}
+	rows, err := db.QueryContext(ctx, `SELECT req_liq FROM `+table+` WHERE state IN (`+strings.Join(states, ", ")+`)`)
+	if err != nil {
+		return nil, err
+	}
+	defer func(rows *sql.Rows) {
+		_ = rows.Close()
+	}(rows)
+	for rows.Next() {
+		reqLiq := new(types.Wei)
+		if err = rows.Scan(reqLiq); err != nil {
+			return nil, err
+		}
+		liq.Sub(liq, reqLiq)
+	}
+	return liq, rows.Err()
+}
+
+// signedValue returns the total of the values signed after since.
+func (r *Repository) signedValue(ctx context.Context, db queryer, since time.Time) (*types.Wei, error) {
+	rows, err := db.QueryContext(ctx, r.rebind(`SELECT value FROM signed_values WHERE signed_at > ?`), since.UnixNano())
+	if err != nil {
+		return nil, err
+	}
+	defer func(rows *sql.Rows) {
+		_ = rows.Close()
+	}(rows)
+	total := types.NewWei(0)
+	for rows.Next() {
+		value := new(types.Wei)
+		if err = rows.Scan(value); err != nil {
+			return nil, err
+		}
+		total.Add(total, value)
+	}
+	return total, rows.Err()
+}
+
+func scanRetainedQuote(row scanner) (*types.RetainedQuote, error) {
+	rq := types.RetainedQuote{ReqLiq: new(types.Wei)}
+	var state, agreementTimestamp, timeForDeposit int64
+	var breakdown sql.NullString
+	err := row.Scan(&rq.QuoteHash, &rq.DepositAddr, &rq.Signature, rq.ReqLiq, &state, &agreementTimestamp, &timeForDeposit, &breakdown)
+	if err != nil {
+		return nil, err
+	}
+	if rq.FeeBreakdown, err = parseFeeBreakdown(breakdown); err != nil {
+		return nil, err
+	}
+	rq.State = types.RQState(state)
+	rq.AgreementTimestamp = uint32(agreementTimestamp)
+	rq.TimeForDeposit = uint32(timeForDeposit)
+	return &rq, nil
+}
+
+func scanRetainedPegoutQuote(row scanner) (*types.RetainedPegoutQuote, error) {
+	rq := types.RetainedPegoutQuote{ReqLiq: new(types.Wei)}
+	var state, agreementTimestamp, depositDateLimit int64
+	err := row.Scan(&rq.QuoteHash, &rq.Signature, rq.ReqLiq, &state, &agreementTimestamp, &depositDateLimit)
+	if err != nil {
+		return nil, err
+	}
+	rq.State = types.RQState(state)
+	rq.AgreementTimestamp = uint32(agreementTimestamp)
+	rq.DepositDateLimit = uint32(depositDateLimit)
+	return &rq, nil
+}
+
+// feeBreakdownValue returns the JSON encoding of b, stored as NULL when b is nil.
+func feeBreakdownValue(b *types.FeeBreakdown) (interface{}, error) {
+	if b == nil {
+		return nil, nil
+	}
+	res, err := json.Marshal(b)
+	if err != nil {
+		return nil, err
+	}
+	return string(res), nil
+}
+
+func parseFeeBreakdown(s sql.NullString) (*types.FeeBreakdown, error) {
+	if !s.Valid {
+		return nil, nil
+	}
+	var res types.FeeBreakdown
+	if err := json.Unmarshal([]byte(s.String), &res); err != nil {
+		return nil, fmt.Errorf("error decoding fee breakdown: %v", err)
+	}
+	return &res, nil
+}
+
+// rebind converts the ? placeholders of query to the syntax of the repository dialect.
+func (r *Repository) rebind(query string) string {
+	if r.dialect != DialectDollar {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, c := range query {
+		if c == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+		} else {
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
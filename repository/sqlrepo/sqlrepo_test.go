@@ -0,0 +1,395 @@
+package sqlrepo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/rsksmart/liquidity-provider/providers"
+	"github.com/rsksmart/liquidity-provider/repository/repotest"
+	"github.com/rsksmart/liquidity-provider/types"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	_ providers.ContextLocalProviderRepository            = (*Repository)(nil)
+	_ providers.ContextPegoutLocalProviderRepository      = (*Repository)(nil)
+	_ providers.ContextRetainedQuoteStateRepository       = (*Repository)(nil)
+	_ providers.ContextRetainedPegoutQuoteStateRepository = (*Repository)(nil)
+	_ providers.ContextQuoteRepository                    = (*Repository)(nil)
+	_ providers.ContextPegoutQuoteRepository              = (*Repository)(nil)
+)
+
+func newTestRepository(t *testing.T) *Repository {
+	db, err := sql.Open("sqlite3", "file:"+filepath.Join(t.TempDir(), "lp.db")+"?_busy_timeout=5000&_txlock=immediate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+	r, err := NewRepository(db, DialectQuestion)
+	if err != nil {
+		t.Fatal("error creating repository: ", err)
+	}
+	return r
+}
+
+func newTestRetainedQuote(hash string, reqLiq int64) *types.RetainedQuote {
+	return &types.RetainedQuote{
+		QuoteHash:          hash,
+		DepositAddr:        "abc",
+		Signature:          "def",
+		ReqLiq:             types.NewWei(reqLiq),
+		State:              types.RQStateWaitingForDeposit,
+		AgreementTimestamp: 1670441000,
+		TimeForDeposit:     3600,
+	}
+}
+
+func TestMigrations(t *testing.T) {
+	r := newTestRepository(t)
+	assert.Nil(t, r.SetLiquidity(types.NewWei(100)))
+
+	// migrating again keeps the data and does not fail
+	assert.Nil(t, r.migrate(context.Background()))
+	liq, err := r.GetLiquidity()
+	assert.Nil(t, err)
+	assert.EqualValues(t, types.NewWei(100), liq)
+
+	var version int
+	assert.Nil(t, r.db.QueryRow(`SELECT MAX(version) FROM schema_migrations`).Scan(&version))
+	assert.Equal(t, len(migrations), version)
+}
+
+func TestConcurrentMigrations(t *testing.T) {
+	// deferred transactions, so the migrations take the write lock themselves
+	dsn := "file:" + filepath.Join(t.TempDir(), "lp.db") + "?_busy_timeout=5000"
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < cap(errs); i++ {
+		db, err := sql.Open("sqlite3", dsn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			_ = db.Close()
+		})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := NewRepository(db, DialectQuestion)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		assert.Nil(t, err)
+	}
+
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var version, rows int
+	assert.Nil(t, db.QueryRow(`SELECT MAX(version) FROM schema_migrations`).Scan(&version))
+	assert.Equal(t, len(migrations), version)
+	assert.Nil(t, db.QueryRow(`SELECT COUNT(*) FROM liquidity`).Scan(&rows))
+	assert.Equal(t, 1, rows)
+}
+
+func TestRepository_ReserveLiquidity(t *testing.T) {
+	r := newTestRepository(t)
+	assert.Nil(t, r.SetLiquidity(types.NewWei(200)))
+
+	rq := newTestRetainedQuote("a", 90)
+	assert.Nil(t, r.ReserveLiquidity(rq))
+	liq, err := r.GetLiquidity()
+	assert.Nil(t, err)
+	assert.EqualValues(t, types.NewWei(110), liq)
+
+	// reserving the same quote again does not retain more liquidity
+	assert.Nil(t, r.ReserveLiquidity(rq))
+	liq, _ = r.GetLiquidity()
+	assert.EqualValues(t, types.NewWei(110), liq)
+
+	var liqErr *providers.ErrInsufficientLiquidity
+	err = r.ReserveLiquidity(newTestRetainedQuote("b", 111))
+	if assert.ErrorAs(t, err, &liqErr) {
+		assert.EqualValues(t, types.NewWei(111), liqErr.Required)
+		assert.EqualValues(t, types.NewWei(110), liqErr.Available)
+	}
+	hasRq, err := r.HasRetainedQuote("b")
+	assert.Nil(t, err)
+	assert.False(t, hasRq)
+
+	got, err := r.GetRetainedQuote("a")
+	assert.Nil(t, err)
+	assert.EqualValues(t, rq, got)
+	hasLiq, err := r.HasLiquidity(nil, types.NewWei(110))
+	assert.Nil(t, err)
+	assert.True(t, hasLiq)
+}
+
+func TestRepository_UpdateRetainedQuoteState(t *testing.T) {
+	r := newTestRepository(t)
+	assert.Nil(t, r.SetLiquidity(types.NewWei(100)))
+	assert.Nil(t, r.ReserveLiquidity(newTestRetainedQuote("a", 90)))
+
+	assert.Nil(t, r.UpdateRetainedQuoteState("a", types.RQStateWaitingForDeposit, types.RQStateWaitingForDepositConfirmations))
+	liq, _ := r.GetLiquidity()
+	assert.EqualValues(t, types.NewWei(10), liq)
+
+	assert.ErrorIs(t, r.UpdateRetainedQuoteState("a", types.RQStateWaitingForDeposit, types.RQStateTimeForDepositElapsed), providers.ErrUnexpectedRetainedQuoteState)
+	assert.ErrorIs(t, r.UpdateRetainedQuoteState("b", types.RQStateWaitingForDeposit, types.RQStateTimeForDepositElapsed), providers.ErrRetainedQuoteNotFound)
+	var transitionErr *types.ErrInvalidStateTransition
+	assert.ErrorAs(t, r.UpdateRetainedQuoteState("a", types.RQStateWaitingForDepositConfirmations, types.RQStateWaitingForDeposit), &transitionErr)
+
+	assert.Nil(t, r.UpdateRetainedQuoteState("a", types.RQStateWaitingForDepositConfirmations, types.RQStateCallForUserSucceeded))
+	liq, _ = r.GetLiquidity()
+	assert.EqualValues(t, types.NewWei(100), liq)
+
+	rqs, err := r.GetRetainedQuotes(types.RQStateCallForUserSucceeded, types.RQStateCallForUserFailed)
+	assert.Nil(t, err)
+	if assert.Len(t, rqs, 1) {
+		assert.Equal(t, "a", rqs[0].QuoteHash)
+		assert.Equal(t, types.RQStateCallForUserSucceeded, rqs[0].State)
+	}
+	rqs, err = r.GetRetainedQuotes(types.RQStateWaitingForDeposit)
+	assert.Nil(t, err)
+	assert.Empty(t, rqs)
+}
+
+func TestRepository_ConcurrentReservations(t *testing.T) {
+	r := newTestRepository(t)
+	assert.Nil(t, r.SetLiquidity(types.NewWei(100)))
+
+	var wg sync.WaitGroup
+	errs := make([]error, 20)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = r.ReserveLiquidity(newTestRetainedQuote(hex.EncodeToString([]byte{byte(i)}), 10))
+		}(i)
+	}
+	wg.Wait()
+
+	reserved := 0
+	for _, err := range errs {
+		var liqErr *providers.ErrInsufficientLiquidity
+		if err == nil {
+			reserved++
+		} else if !assert.ErrorAs(t, err, &liqErr) {
+			t.Fatal(err)
+		}
+	}
+	assert.Equal(t, 10, reserved)
+	liq, _ := r.GetLiquidity()
+	assert.Zero(t, liq.Cmp(types.NewWei(0)))
+}
+
+func TestRepository_Quote(t *testing.T) {
+	r := newTestRepository(t)
+	q := &types.Quote{
+		FedBTCAddr:         "3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy",
+		LBCAddr:            "0xC52AbEae2f7A6e2E3C5Ab1C2a7E21B6F4A2F1C10",
+		LPRSKAddr:          "0xd562c283d2260c62110fa3da885842afbe16bda2",
+		BTCRefundAddr:      "mipcBbFg9gMiCh81Kj8tqqdgoZub1ZJRfn",
+		RSKRefundAddr:      "0x0000000000000000000000000000000000000001",
+		LPBTCAddr:          "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2",
+		CallFee:            types.NewWei(501000),
+		PenaltyFee:         types.NewWei(1000000),
+		ContractAddr:       "0x0000000000000000000000000000000000000002",
+		Data:               "0xa9059cbb",
+		GasLimit:           50000,
+		Nonce:              -8373381263192041574,
+		Value:              types.NewBigWei(new(types.Wei).Mul(types.NewUWei(1<<63), types.NewWei(10)).AsBigInt()),
+		AgreementTimestamp: 4294967295,
+		TimeForDeposit:     3600,
+		CallTime:           7200,
+		Confirmations:      65535,
+		CallOnRegister:     true,
+		FeeBreakdown: &types.FeeBreakdown{
+			GasCost:       types.NewWei(400000),
+			FixedFee:      types.NewWei(1000),
+			PercentageFee: types.NewWei(90000),
+			NetworkFee:    types.NewWei(10000),
+			PenaltyFee:    types.NewWei(1000000),
+		},
+	}
+	assert.Nil(t, r.InsertQuote("a", q))
+	assert.NotNil(t, r.InsertQuote("a", q))
+
+	got, err := r.GetQuote("a")
+	assert.Nil(t, err)
+	assert.EqualValues(t, q, got)
+
+	q.FeeBreakdown = nil
+	assert.Nil(t, r.InsertQuote("c", q))
+	got, err = r.GetQuote("c")
+	assert.Nil(t, err)
+	assert.EqualValues(t, q, got)
+
+	_, err = r.GetQuote("b")
+	assert.ErrorIs(t, err, ErrQuoteNotFound)
+}
+
+func TestRepository_PegoutQuote(t *testing.T) {
+	r := newTestRepository(t)
+	q := &types.PegoutQuote{
+		LBCAddr:               "0xC52AbEae2f7A6e2E3C5Ab1C2a7E21B6F4A2F1C10",
+		LPRSKAddr:             "0xd562c283d2260c62110fa3da885842afbe16bda2",
+		BTCRefundAddr:         "mipcBbFg9gMiCh81Kj8tqqdgoZub1ZJRfn",
+		RSKRefundAddr:         "0x0000000000000000000000000000000000000001",
+		LPBTCAddr:             "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2",
+		CallFee:               types.NewWei(501000),
+		PenaltyFee:            types.NewWei(1000000),
+		Nonce:                 -8373381263192041574,
+		DepositAddr:           "3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy",
+		Value:                 types.NewBigWei(new(types.Wei).Mul(types.NewUWei(1<<63), types.NewWei(10)).AsBigInt()),
+		AgreementTimestamp:    4294967295,
+		DepositDateLimit:      3600,
+		DepositConfirmations:  65535,
+		TransferConfirmations: 10,
+		TransferTime:          7200,
+		ExpireDate:            1670444600,
+		ExpireBlock:           4294967295,
+		FeeBreakdown: &types.FeeBreakdown{
+			GasCost:       types.NewWei(400000),
+			FixedFee:      types.NewWei(1000),
+			PercentageFee: types.NewWei(90000),
+			NetworkFee:    types.NewWei(10000),
+			PenaltyFee:    types.NewWei(1000000),
+		},
+	}
+	assert.Nil(t, r.InsertPegoutQuote("a", q))
+	assert.NotNil(t, r.InsertPegoutQuote("a", q))
+
+	got, err := r.GetPegoutQuote("a")
+	assert.Nil(t, err)
+	assert.EqualValues(t, q, got)
+
+	q.FeeBreakdown = nil
+	assert.Nil(t, r.InsertPegoutQuote("c", q))
+	got, err = r.GetPegoutQuote("c")
+	assert.Nil(t, err)
+	assert.EqualValues(t, q, got)
+
+	// peg-in and peg-out quotes are stored apart
+	_, err = r.GetQuote("a")
+	assert.ErrorIs(t, err, ErrQuoteNotFound)
+	_, err = r.GetPegoutQuote("b")
+	assert.ErrorIs(t, err, ErrQuoteNotFound)
+}
+
+func TestRepository_LocalProvider(t *testing.T) {
+	r := newTestRepository(t)
+	assert.Nil(t, r.SetLiquidity(types.NewWei(200)))
+	pwdFile := filepath.Join(t.TempDir(), "pwd")
+	if err := ioutil.WriteFile(pwdFile, []byte("yes\ncorrect horse battery staple\ncorrect horse battery staple\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	lp, err := providers.NewLocalProvider(providers.ProviderConfig{
+		Keydir:  t.TempDir(),
+		PwdFile: pwdFile,
+	}, r)
+	if err != nil {
+		t.Fatal("error creating local provider: ", err)
+	}
+
+	hash := "12345678901234567890123456789012"
+	qb, _ := hex.DecodeString(hash)
+	reqLiq := types.NewWei(90)
+	_, err = lp.SignQuote(qb, "abc", reqLiq)
+	assert.Nil(t, err)
+	_, err = lp.SignQuote(qb, "abc", reqLiq)
+	assert.Nil(t, err)
+	liq, _ := r.GetLiquidity()
+	assert.EqualValues(t, types.NewWei(110), liq)
+
+	_, err = lp.SignQuote([]byte("12345678901234567890123456789012"), "abc", types.NewWei(111))
+	var liqErr *providers.ErrInsufficientLiquidity
+	assert.ErrorAs(t, err, &liqErr)
+
+	assert.Nil(t, r.UpdateRetainedQuoteState(hash, types.RQStateWaitingForDeposit, types.RQStateCallForUserSucceeded))
+	liq, _ = r.GetLiquidity()
+	assert.EqualValues(t, types.NewWei(200), liq)
+
+	// the quotes signed from the quote itself are stored along with their retained quote, once
+	q := &types.Quote{
+		FedBTCAddr:    "3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy",
+		LBCAddr:       "0xC52AbEae2f7A6e2E3C5Ab1C2a7E21B6F4A2F1C10",
+		LPRSKAddr:     lp.Address(),
+		BTCRefundAddr: "mipcBbFg9gMiCh81Kj8tqqdgoZub1ZJRfn",
+		RSKRefundAddr: "0x0000000000000000000000000000000000000001",
+		LPBTCAddr:     "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2",
+		ContractAddr:  "0x0000000000000000000000000000000000000002",
+		CallFee:       types.NewWei(1),
+		PenaltyFee:    types.NewWei(1),
+		Value:         types.NewWei(90),
+	}
+	for i := 0; i < 2; i++ {
+		_, err = lp.SignQuoteFromQuote(q, "abc", reqLiq)
+		assert.Nil(t, err)
+	}
+	qb, _ = q.Hash()
+	got, err := r.GetQuote(hex.EncodeToString(qb))
+	assert.Nil(t, err)
+	assert.EqualValues(t, q, got)
+	liq, _ = r.GetLiquidity()
+	assert.EqualValues(t, types.NewWei(110), liq)
+
+	// a quote whose liquidity cannot be reserved is not stored
+	q.Nonce = 1
+	_, err = lp.SignQuoteFromQuote(q, "abc", types.NewWei(111))
+	assert.ErrorAs(t, err, &liqErr)
+	qb, _ = q.Hash()
+	_, err = r.GetQuote(hex.EncodeToString(qb))
+	assert.ErrorIs(t, err, ErrQuoteNotFound)
+
+	assert.Nil(t, r.SetPegoutLiquidity(types.NewWei(100)))
+	pq := &types.PegoutQuote{
+		LBCAddr:          "0xC52AbEae2f7A6e2E3C5Ab1C2a7E21B6F4A2F1C10",
+		LPRSKAddr:        lp.Address(),
+		BTCRefundAddr:    "mipcBbFg9gMiCh81Kj8tqqdgoZub1ZJRfn",
+		RSKRefundAddr:    "0x0000000000000000000000000000000000000001",
+		LPBTCAddr:        "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2",
+		DepositAddr:      "3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy",
+		CallFee:          types.NewWei(1),
+		PenaltyFee:       types.NewWei(1),
+		Value:            types.NewWei(60),
+		DepositDateLimit: 1670444600,
+	}
+	_, err = lp.SignPegoutQuoteFromQuote(pq, types.NewWei(60))
+	assert.Nil(t, err)
+	qb, _ = pq.Hash()
+	gotPegout, err := r.GetPegoutQuote(hex.EncodeToString(qb))
+	assert.Nil(t, err)
+	assert.EqualValues(t, pq, gotPegout)
+	rq, err := r.GetRetainedPegoutQuote(hex.EncodeToString(qb))
+	assert.Nil(t, err)
+	assert.EqualValues(t, pq.DepositDateLimit, rq.DepositDateLimit)
+	pegoutLiq, _ := r.GetPegoutLiquidity()
+	assert.EqualValues(t, types.NewWei(40), pegoutLiq)
+
+	pq.Nonce = 1
+	_, err = lp.SignPegoutQuoteFromQuote(pq, types.NewWei(41))
+	assert.ErrorAs(t, err, &liqErr)
+	qb, _ = pq.Hash()
+	_, err = r.GetPegoutQuote(hex.EncodeToString(qb))
+	assert.ErrorIs(t, err, ErrQuoteNotFound)
+}
+
+func TestConformance(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) repotest.Repository {
+		return newTestRepository(t)
+	})
+}
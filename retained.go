@@ -0,0 +1,141 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/rsksmart/liquidity-provider/repository/inmem"
+	"github.com/rsksmart/liquidity-provider/repository/sqlrepo"
+	"github.com/rsksmart/liquidity-provider/types"
+)
+
+// retainedRepository is implemented by the repositories retained quotes can be read from.
+type retainedRepository interface {
+	GetRetainedQuote(hash string) (*types.RetainedQuote, error)
+	GetRetainedQuotes(states ...types.RQState) ([]*types.RetainedQuote, error)
+}
+
+// quoteRepository is implemented by the repositories that also store the quotes themselves.
+type quoteRepository interface {
+	GetQuote(hash string) (*types.Quote, error)
+}
+
+type retainedOutput struct {
+	*types.RetainedQuote
+	Quote *types.Quote `json:"quote,omitempty"`
+}
+
+// openRepository opens the repository described by spec, either sqlite3:<dsn> for a SQLite database or
+// snapshot:<path> for a snapshot of the in-memory repository. The returned function closes it.
+func openRepository(spec string) (retainedRepository, func(), error) {
+	kind, location := spec, ""
+	if i := strings.Index(spec, ":"); i >= 0 {
+		kind, location = spec[:i], spec[i+1:]
+	}
+	if location == "" {
+		return nil, nil, errors.New("-repo must be sqlite3:<dsn> or snapshot:<path>")
+	}
+	switch kind {
+	case "sqlite3":
+		db, err := sql.Open("sqlite3", location)
+		if err != nil {
+			return nil, nil, err
+		}
+		r, err := sqlrepo.NewRepository(db, sqlrepo.DialectQuestion)
+		if err != nil {
+			_ = db.Close()
+			return nil, nil, err
+		}
+		return r, func() { _ = db.Close() }, nil
+	case "snapshot":
+		r := inmem.NewRepository()
+		if err := r.LoadFile(location); err != nil {
+			return nil, nil, err
+		}
+		return r, func() {}, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown repository type %v, must be sqlite3 or snapshot", kind)
+	}
+}
+
+// parseStates parses a comma separated list of retained quote state names, returning every state when empty.
+func parseStates(s string) ([]types.RQState, error) {
+	var states []types.RQState
+	if s == "" {
+		for state := types.RQState(0); ; state++ {
+			if _, err := state.MarshalText(); err != nil {
+				return states, nil
+			}
+			states = append(states, state)
+		}
+	}
+	for _, name := range strings.Split(s, ",") {
+		var state types.RQState
+		if err := state.UnmarshalText([]byte(strings.TrimSpace(name))); err != nil {
+			return nil, err
+		}
+		states = append(states, state)
+	}
+	return states, nil
+}
+
+func retainedList(args []string, stdout io.Writer) error {
+	fs := newFlagSet("retained list")
+	repo := fs.String("repo", "", "repository to read, sqlite3:<dsn> or snapshot:<path>")
+	state := fs.String("state", "", "comma separated states to list, e.g. WaitingForDeposit, all states when empty")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	states, err := parseStates(*state)
+	if err != nil {
+		return err
+	}
+	r, closeRepo, err := openRepository(*repo)
+	if err != nil {
+		return err
+	}
+	defer closeRepo()
+	rqs, err := r.GetRetainedQuotes(states...)
+	if err != nil {
+		return err
+	}
+	if rqs == nil {
+		rqs = []*types.RetainedQuote{}
+	}
+	return writeJSON(stdout, rqs)
+}
+
+func retainedShow(args []string, stdout io.Writer) error {
+	fs := newFlagSet("retained show")
+	repo := fs.String("repo", "", "repository to read, sqlite3:<dsn> or snapshot:<path>")
+	hash := fs.String("hash", "", "hex encoded hash of the retained quote")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *hash == "" {
+		return errors.New("-hash is required")
+	}
+	r, closeRepo, err := openRepository(*repo)
+	if err != nil {
+		return err
+	}
+	defer closeRepo()
+	rq, err := r.GetRetainedQuote(strings.TrimPrefix(*hash, "0x"))
+	if err != nil {
+		return err
+	}
+	out := retainedOutput{RetainedQuote: rq}
+	// the quote is included when the repository stores it
+	if qr, ok := r.(quoteRepository); ok {
+		q, err := qr.GetQuote(rq.QuoteHash)
+		if err != nil && !errors.Is(err, sqlrepo.ErrQuoteNotFound) {
+			return err
+		}
+		out.Quote = q
+	}
+	return writeJSON(stdout, out)
+}
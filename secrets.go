@@ -0,0 +1,60 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"syscall"
+
+	"github.com/rsksmart/liquidity-provider/providers"
+	"golang.org/x/term"
+)
+
+// secretFlags are the flags that select where a secret is read from. Secrets are never taken from the command line,
+// where they would be visible to other users of the host.
+type secretFlags struct {
+	name string
+	env  string
+	file string
+	fd   uint
+}
+
+func addSecretFlags(fs *flag.FlagSet, name string, desc string) *secretFlags {
+	f := secretFlags{name: name}
+	fs.StringVar(&f.env, name+"-env", "", "environment variable holding the "+desc)
+	fs.StringVar(&f.file, name+"-file", "", "file holding the "+desc+", only readable by its owner")
+	fs.UintVar(&f.fd, name+"-fd", 0, "file descriptor the "+desc+" is read from")
+	return &f
+}
+
+// source returns the configured source with the highest precedence: environment variable, file and file descriptor.
+func (f *secretFlags) source() providers.SecretSource {
+	switch {
+	case f.env != "":
+		return providers.EnvSecretSource{Name: f.env}
+	case f.file != "":
+		return providers.FileSecretSource{Path: f.file}
+	case f.fd != 0:
+		return providers.FDSecretSource{FD: uintptr(f.fd)}
+	default:
+		return nil
+	}
+}
+
+func (f *secretFlags) isSet() bool {
+	return f.source() != nil
+}
+
+// read returns the secret from its configured source, prompting for it when stdin is a terminal.
+func (f *secretFlags) read(prompt string) (string, error) {
+	if source := f.source(); source != nil {
+		return source.Secret()
+	}
+	if !term.IsTerminal(syscall.Stdin) {
+		return "", fmt.Errorf("one of -%v-env, -%v-file or -%v-fd is required", f.name, f.name, f.name)
+	}
+	fmt.Fprint(os.Stderr, prompt+": ")
+	b, err := term.ReadPassword(syscall.Stdin)
+	fmt.Fprintln(os.Stderr)
+	return string(b), err
+}
@@ -0,0 +1,35 @@
+package server
+
+import "github.com/rsksmart/liquidity-provider/types"
+
+// GetQuoteRequest wraps the requested quote, which is priced at the gas price of the provider oracle.
+type GetQuoteRequest struct {
+	Quote *types.Quote `json:"quote" description:"Quote requested by the user, the provider fields are filled by the provider"`
+}
+
+type GetQuoteResponse struct {
+	Quote     *types.Quote `json:"quote" description:"Priced quote"`
+	QuoteHash string       `json:"quoteHash" example:"4a3eca107f22707e5dbc79964f3e6c21ec5e354e0903391245d9fdbe6bd2b2f0" description:"LBC hash of the quote, used to accept it"`
+}
+
+type AcceptQuoteRequest struct {
+	QuoteHash   string `json:"quoteHash" example:"4a3eca107f22707e5dbc79964f3e6c21ec5e354e0903391245d9fdbe6bd2b2f0" description:"LBC hash of a quote returned by getQuote"`
+	DepositAddr string `json:"depositAddr" example:"2N5muMepJizJE1gR7FbHJU6CD18V3BpNF9p" description:"BTC address the user deposits to"`
+}
+
+type AcceptQuoteResponse struct {
+	Signature string `json:"signature" example:"abababababababababababababababababababababababababababababababababababababababababababababababababababababababababababababababab1b" description:"Provider signature of the quote"`
+}
+
+type LiquidityResponse struct {
+	Available *types.Wei `json:"available" example:"5000000000000000000" description:"Liquidity in wei not reserved by accepted quotes"`
+}
+
+type HealthResponse struct {
+	Status string `json:"status" example:"ok" description:"ok when the provider is able to serve quotes"`
+}
+
+type ErrorResponse struct {
+	Code  string `json:"code" example:"insufficient_liquidity" description:"Stable code of the error"`
+	Error string `json:"error" example:"not enough liquidity" description:"Error message"`
+}
@@ -0,0 +1,432 @@
+// Package server exposes a LiquidityProvider through an HTTP JSON API, so users can request and accept peg-in quotes.
+package server
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/rsksmart/liquidity-provider/providers"
+	"github.com/rsksmart/liquidity-provider/types"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// MaxRequestSize is the maximum size of a request body.
+	MaxRequestSize = 64 * 1024
+	// DefaultRequestTimeout bounds the time spent serving a request when Config.RequestTimeout is not set.
+	DefaultRequestTimeout = 20 * time.Second
+	// DefaultMaxIssuedQuotes bounds the quotes waiting to be accepted when Config.MaxIssuedQuotes is not set.
+	DefaultMaxIssuedQuotes = 10000
+)
+
+var (
+	ErrQuoteNotFound = errors.New("quote not found")
+	ErrQuoteExpired  = errors.New("quote expired")
+	ErrUnhealthy     = errors.New("provider is unhealthy")
+	ErrTooManyQuotes = errors.New("too many quotes waiting to be accepted")
+)
+
+// Codes of the error responses, which unlike the messages do not change between versions.
+const (
+	CodeInvalidRequest        = "invalid_request"
+	CodeInsufficientLiquidity = "insufficient_liquidity"
+	CodePolicyViolation       = "policy_violation"
+	CodeQuoteNotFound         = "quote_not_found"
+	CodeQuoteExpired          = "quote_expired"
+	CodeUnhealthy             = "unhealthy"
+	CodeTimeout               = "timeout"
+	CodeGasPriceUnavailable   = "gas_price_unavailable"
+	CodeGasEstimationFailed   = "gas_estimation_failed"
+	CodeTooManyQuotes         = "too_many_quotes"
+	CodeNotFound              = "not_found"
+	CodeMethodNotAllowed      = "method_not_allowed"
+	CodeInternal              = "internal"
+)
+
+// Repository provides the liquidity quotes are checked against.
+type Repository interface {
+	HasLiquidity(lp providers.LiquidityProvider, wei *types.Wei) (bool, error)
+	// GetLiquidity returns the liquidity not reserved by retained quotes.
+	GetLiquidity() (*types.Wei, error)
+}
+
+// ContextRepository is a Repository whose calls give up when the request is cancelled or times out.
+type ContextRepository interface {
+	Repository
+	HasLiquidityContext(ctx context.Context, lp providers.LiquidityProvider, wei *types.Wei) (bool, error)
+	GetLiquidityContext(ctx context.Context) (*types.Wei, error)
+}
+
+type Config struct {
+	// Providers are listed by GET /providers, which lists only the served provider when empty
+	Providers []types.GlobalProvider
+	// Clock decides when issued quotes expire, defaults to the system clock
+	Clock providers.Clock
+	// RequestTimeout bounds the time spent serving a request, defaults to DefaultRequestTimeout
+	RequestTimeout time.Duration
+	// MaxIssuedQuotes bounds the issued quotes waiting to be accepted, defaults to DefaultMaxIssuedQuotes
+	MaxIssuedQuotes int
+}
+
+// errBadRequest wraps the errors caused by an invalid request.
+type errBadRequest struct {
+	err error
+}
+
+func (e *errBadRequest) Error() string {
+	return e.err.Error()
+}
+
+func (e *errBadRequest) Unwrap() error {
+	return e.err
+}
+
+func badRequest(format string, a ...interface{}) error {
+	return &errBadRequest{err: fmt.Errorf(format, a...)}
+}
+
+// issuedQuote is a quote returned by getQuote, kept until it is accepted or its time for deposit elapses.
+type issuedQuote struct {
+	quote  *types.Quote
+	reqLiq *types.Wei
+}
+
+type Server struct {
+	lp         providers.LiquidityProvider
+	repository Repository
+	cfg        Config
+	mux        *http.ServeMux
+	srv        *http.Server
+
+	mu     sync.Mutex
+	quotes map[string]issuedQuote
+}
+
+func New(lp providers.LiquidityProvider, repository Repository, cfg Config) *Server {
+	if cfg.Clock == nil {
+		cfg.Clock = providers.SystemClock{}
+	}
+	if cfg.RequestTimeout <= 0 {
+		cfg.RequestTimeout = DefaultRequestTimeout
+	}
+	if cfg.MaxIssuedQuotes <= 0 {
+		cfg.MaxIssuedQuotes = DefaultMaxIssuedQuotes
+	}
+	s := &Server{
+		lp:         lp,
+		repository: repository,
+		cfg:        cfg,
+		mux:        http.NewServeMux(),
+		quotes:     make(map[string]issuedQuote),
+	}
+	s.srv = &http.Server{
+		Handler:           s,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		WriteTimeout:      30 * time.Second,
+	}
+	handlers := map[string]handlerFunc{
+		"/pegin/getQuote":    s.getQuote,
+		"/pegin/acceptQuote": s.acceptQuote,
+		"/providers":         s.getProviders,
+		"/health":            s.health,
+		"/liquidity":         s.getLiquidity,
+	}
+	for _, e := range Endpoints() {
+		s.handle(e.Path, e.Method, handlers[e.Path])
+	}
+	s.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Code: CodeNotFound, Error: "not found: " + r.URL.Path})
+	})
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// ListenAndServe serves the API on addr until Shutdown is called, in which case it returns nil.
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve serves the API on l until Shutdown is called, in which case it returns nil.
+func (s *Server) Serve(l net.Listener) error {
+	log.Info("serving provider API on ", l.Addr())
+	err := s.srv.Serve(l)
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+// Shutdown stops accepting connections and waits for the requests in progress to complete, or for ctx to be done.
+// The server cannot be started again afterwards.
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.srv.Shutdown(ctx)
+}
+
+type handlerFunc func(r *http.Request) (interface{}, error)
+
+func (s *Server) handle(path string, method string, h handlerFunc) {
+	s.mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Code: CodeMethodNotAllowed, Error: "method not allowed: " + r.Method})
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), s.cfg.RequestTimeout)
+		defer cancel()
+		res, err := h(r.WithContext(ctx))
+		if err != nil {
+			status, code := errorCode(err)
+			msg := err.Error()
+			if status == http.StatusInternalServerError {
+				log.Error("error serving ", path, ": ", err)
+				msg = http.StatusText(status)
+			}
+			writeJSON(w, status, ErrorResponse{Code: code, Error: msg})
+			return
+		}
+		writeJSON(w, http.StatusOK, res)
+	})
+}
+
+// errorCode maps err to the HTTP status and the stable code of its error response.
+func errorCode(err error) (int, string) {
+	var insufficientLiquidity *providers.ErrInsufficientLiquidity
+	var policyViolation *providers.ErrPolicyViolation
+	var invalidRequest *errBadRequest
+	switch {
+	case errors.As(err, &invalidRequest), errors.Is(err, providers.ErrNoFeeTier),
+		errors.Is(err, providers.ErrGasLimitExceeded), errors.Is(err, providers.ErrCallFailed):
+		return http.StatusBadRequest, CodeInvalidRequest
+	case errors.As(err, &insufficientLiquidity):
+		return http.StatusConflict, CodeInsufficientLiquidity
+	case errors.As(err, &policyViolation):
+		return http.StatusForbidden, CodePolicyViolation
+	case errors.Is(err, ErrQuoteNotFound):
+		return http.StatusNotFound, CodeQuoteNotFound
+	case errors.Is(err, ErrQuoteExpired):
+		return http.StatusGone, CodeQuoteExpired
+	case errors.Is(err, ErrUnhealthy):
+		return http.StatusServiceUnavailable, CodeUnhealthy
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusServiceUnavailable, CodeTimeout
+	case errors.Is(err, providers.ErrGasPriceUnavailable), errors.Is(err, providers.ErrGasPriceRequired):
+		return http.StatusServiceUnavailable, CodeGasPriceUnavailable
+	case errors.Is(err, ErrTooManyQuotes):
+		return http.StatusServiceUnavailable, CodeTooManyQuotes
+	case errors.Is(err, providers.ErrGasEstimationFailed):
+		return http.StatusServiceUnavailable, CodeGasEstimationFailed
+	default:
+		return http.StatusInternalServerError, CodeInternal
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Error("error writing response: ", err)
+	}
+}
+
+func decodeRequest(r *http.Request, v interface{}) error {
+	dec := json.NewDecoder(http.MaxBytesReader(nil, r.Body, MaxRequestSize))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return badRequest("invalid request body: %v", err)
+	}
+	if dec.More() {
+		return badRequest("invalid request body: unexpected data after the request")
+	}
+	return nil
+}
+
+func (s *Server) getQuote(r *http.Request) (interface{}, error) {
+	var req GetQuoteRequest
+	if err := decodeRequest(r, &req); err != nil {
+		return nil, err
+	}
+	if err := validateGetQuoteRequest(&req); err != nil {
+		return nil, err
+	}
+
+	// the gas is always priced by the provider, so users cannot lower the gas cost they are charged
+	q, err := s.getLPQuote(r.Context(), req.Quote, uint64(req.Quote.GasLimit), nil)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := q.Hash()
+	if err != nil {
+		return nil, badRequest("invalid quote: %v", err)
+	}
+	// the provider sends the value and pays for the gas of the call on behalf of the user
+	if q.FeeBreakdown == nil || q.FeeBreakdown.GasCost == nil {
+		return nil, errors.New("the provider did not report the gas cost of the quote")
+	}
+	reqLiq := new(types.Wei).Add(q.FeeBreakdown.GasCost, q.Value)
+	ok, err := s.hasLiquidity(r.Context(), reqLiq)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, &providers.ErrInsufficientLiquidity{Required: reqLiq}
+	}
+
+	quoteHash := hex.EncodeToString(hash)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.quotes[quoteHash]; !ok && len(s.quotes) >= s.cfg.MaxIssuedQuotes {
+		s.pruneQuotes()
+		if len(s.quotes) >= s.cfg.MaxIssuedQuotes {
+			return nil, ErrTooManyQuotes
+		}
+	}
+	s.quotes[quoteHash] = issuedQuote{quote: q, reqLiq: reqLiq}
+	return GetQuoteResponse{Quote: q, QuoteHash: quoteHash}, nil
+}
+
+func validateGetQuoteRequest(req *GetQuoteRequest) error {
+	q := req.Quote
+	if q == nil {
+		return badRequest("quote is required")
+	}
+	if q.Value == nil || q.Value.AsBigInt().Sign() < 0 {
+		return badRequest("invalid value: %v", q.Value)
+	}
+	for field, addr := range map[string]string{
+		"lbcAddr":       q.LBCAddr,
+		"rskRefundAddr": q.RSKRefundAddr,
+		"contractAddr":  q.ContractAddr,
+	} {
+		if !common.IsHexAddress(addr) {
+			return badRequest("invalid %v: %v", field, addr)
+		}
+	}
+	if _, err := types.DecodeBTCAddress(q.BTCRefundAddr); err != nil {
+		return badRequest("invalid btcRefundAddr: %v", err)
+	}
+	if _, err := types.DecodeBTCAddress(q.FedBTCAddr); err != nil {
+		return badRequest("invalid fedBTCAddr: %v", err)
+	}
+	if _, err := hex.DecodeString(strings.TrimPrefix(q.Data, "0x")); err != nil {
+		return badRequest("invalid data: %v", err)
+	}
+	return nil
+}
+
+func (s *Server) acceptQuote(r *http.Request) (interface{}, error) {
+	var req AcceptQuoteRequest
+	if err := decodeRequest(r, &req); err != nil {
+		return nil, err
+	}
+	quoteHash := strings.ToLower(strings.TrimPrefix(req.QuoteHash, "0x"))
+	if _, err := types.DecodeBTCAddress(req.DepositAddr); err != nil {
+		return nil, badRequest("invalid depositAddr: %v", err)
+	}
+
+	s.mu.Lock()
+	iq, ok := s.quotes[quoteHash]
+	s.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %v", ErrQuoteNotFound, req.QuoteHash)
+	}
+	if s.expired(iq.quote) {
+		return nil, fmt.Errorf("%w: %v", ErrQuoteExpired, req.QuoteHash)
+	}
+	sig, err := s.signQuote(r.Context(), iq.quote, req.DepositAddr, iq.reqLiq)
+	if err != nil {
+		return nil, err
+	}
+	// the quote is retained by the provider once accepted, it no longer needs to be kept here
+	s.mu.Lock()
+	delete(s.quotes, quoteHash)
+	s.mu.Unlock()
+	return AcceptQuoteResponse{Signature: hex.EncodeToString(sig)}, nil
+}
+
+func (s *Server) getProviders(_ *http.Request) (interface{}, error) {
+	if len(s.cfg.Providers) > 0 {
+		return s.cfg.Providers, nil
+	}
+	return []types.GlobalProvider{{
+		Provider:     s.lp.Address(),
+		Status:       true,
+		ProviderType: "pegin",
+	}}, nil
+}
+
+func (s *Server) health(r *http.Request) (interface{}, error) {
+	if _, err := s.getRepositoryLiquidity(r.Context()); err != nil {
+		log.Error("health check failed reading liquidity: ", err)
+		return nil, ErrUnhealthy
+	}
+	return HealthResponse{Status: "ok"}, nil
+}
+
+func (s *Server) getLiquidity(r *http.Request) (interface{}, error) {
+	liq, err := s.getRepositoryLiquidity(r.Context())
+	if err != nil {
+		return nil, err
+	}
+	return LiquidityResponse{Available: liq}, nil
+}
+
+// The methods below pass the request context to the provider and the repository when they accept one.
+
+func (s *Server) getLPQuote(ctx context.Context, q *types.Quote, gas uint64, gasPrice *types.Wei) (*types.Quote, error) {
+	if lp, ok := s.lp.(providers.ContextLiquidityProvider); ok {
+		return lp.GetQuoteContext(ctx, q, gas, gasPrice)
+	}
+	return s.lp.GetQuote(q, gas, gasPrice)
+}
+
+func (s *Server) signQuote(ctx context.Context, q *types.Quote, depositAddr string, reqLiq *types.Wei) ([]byte, error) {
+	if lp, ok := s.lp.(providers.ContextLiquidityProvider); ok {
+		return lp.SignQuoteFromQuoteContext(ctx, q, depositAddr, reqLiq)
+	}
+	return s.lp.SignQuoteFromQuote(q, depositAddr, reqLiq)
+}
+
+func (s *Server) hasLiquidity(ctx context.Context, wei *types.Wei) (bool, error) {
+	if repository, ok := s.repository.(ContextRepository); ok {
+		return repository.HasLiquidityContext(ctx, s.lp, wei)
+	}
+	return s.repository.HasLiquidity(s.lp, wei)
+}
+
+func (s *Server) getRepositoryLiquidity(ctx context.Context) (*types.Wei, error) {
+	if repository, ok := s.repository.(ContextRepository); ok {
+		return repository.GetLiquidityContext(ctx)
+	}
+	return s.repository.GetLiquidity()
+}
+
+func (s *Server) expired(q *types.Quote) bool {
+	deadline := time.Unix(int64(q.AgreementTimestamp)+int64(q.TimeForDeposit), 0)
+	return s.cfg.Clock.Now().After(deadline)
+}
+
+// pruneQuotes forgets the issued quotes that can no longer be accepted, s.mu must be held.
+func (s *Server) pruneQuotes() {
+	for hash, iq := range s.quotes {
+		if s.expired(iq.quote) {
+			delete(s.quotes, hash)
+		}
+	}
+}
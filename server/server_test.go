@@ -0,0 +1,419 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/rsksmart/liquidity-provider/providers"
+	"github.com/rsksmart/liquidity-provider/providers/providerstest"
+	"github.com/rsksmart/liquidity-provider/repository/inmem"
+	"github.com/rsksmart/liquidity-provider/types"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+func newTestServer(t *testing.T, liquidity int64, cfg Config, options ...func(*providers.ProviderConfig)) (*Server, *providers.LocalProvider, *inmem.Repository) {
+	ks := keystore.NewKeyStore(t.TempDir(), keystore.LightScryptN, keystore.LightScryptP)
+	acc, err := ks.NewAccount("passwd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ks.Unlock(acc, "passwd"); err != nil {
+		t.Fatal(err)
+	}
+	repository := inmem.NewRepository()
+	if err = repository.SetLiquidity(types.NewWei(liquidity)); err != nil {
+		t.Fatal(err)
+	}
+	providerCfg := providers.ProviderConfig{
+		BtcAddr:        "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2",
+		TimeForDeposit: 3600,
+		CallTime:       7200,
+		CallFee:        types.NewWei(1000),
+		PenaltyFee:     types.NewWei(1000000),
+		MaxConf:        10,
+		GasPriceOracle: providerstest.NewFakeGasPriceOracle(types.NewWei(10)),
+	}
+	for _, option := range options {
+		option(&providerCfg)
+	}
+	lp, err := providers.NewLocalProviderWithSigner(providerCfg, providers.NewKeystoreSigner(ks, acc), repository)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return New(lp, repository, cfg), lp, repository
+}
+
+func newTestQuoteRequest() GetQuoteRequest {
+	return GetQuoteRequest{
+		Quote: &types.Quote{
+			FedBTCAddr:    "3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy",
+			LBCAddr:       "0xC52AbEae2f7A6e2E3C5Ab1C2a7E21B6F4A2F1C10",
+			BTCRefundAddr: "mipcBbFg9gMiCh81Kj8tqqdgoZub1ZJRfn",
+			RSKRefundAddr: "0x0000000000000000000000000000000000000001",
+			ContractAddr:  "0x0000000000000000000000000000000000000002",
+			GasLimit:      21000,
+			Value:         types.NewWei(3000000),
+		},
+	}
+}
+
+func doRequest(t *testing.T, s *Server, method string, path string, body interface{}, res interface{}) int {
+	var b []byte
+	switch v := body.(type) {
+	case nil:
+	case string:
+		b = []byte(v)
+	default:
+		var err error
+		if b, err = json.Marshal(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(method, path, bytes.NewReader(b)))
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	if res != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), res); err != nil {
+			t.Fatalf("error decoding %v response %q: %v", path, rec.Body.String(), err)
+		}
+	}
+	return rec.Code
+}
+
+func TestGetAndAcceptQuote(t *testing.T) {
+	s, lp, repository := newTestServer(t, 5000000, Config{})
+
+	var quote GetQuoteResponse
+	status := doRequest(t, s, http.MethodPost, "/pegin/getQuote", newTestQuoteRequest(), &quote)
+	if !assert.Equal(t, http.StatusOK, status) {
+		return
+	}
+	assert.Equal(t, lp.Address(), quote.Quote.LPRSKAddr)
+	assert.Equal(t, types.NewWei(211000), quote.Quote.CallFee)
+	breakdown := &types.FeeBreakdown{
+		GasCost:       types.NewWei(21000 * 10),
+		FixedFee:      types.NewWei(1000),
+		PercentageFee: types.NewWei(0),
+		NetworkFee:    types.NewWei(0),
+		PenaltyFee:    types.NewWei(1000000),
+	}
+	if assert.NotNil(t, quote.Quote.FeeBreakdown) {
+		assert.Equal(t, breakdown.Total(), quote.Quote.FeeBreakdown.Total())
+		assert.Equal(t, breakdown.PenaltyFee, quote.Quote.FeeBreakdown.PenaltyFee)
+	}
+	hash, err := quote.Quote.Hash()
+	if assert.NoError(t, err) {
+		assert.Equal(t, hex.EncodeToString(hash), quote.QuoteHash)
+	}
+
+	var accepted AcceptQuoteResponse
+	status = doRequest(t, s, http.MethodPost, "/pegin/acceptQuote", AcceptQuoteRequest{
+		QuoteHash:   quote.QuoteHash,
+		DepositAddr: "2N5muMepJizJE1gR7FbHJU6CD18V3BpNF9p",
+	}, &accepted)
+	if !assert.Equal(t, http.StatusOK, status) {
+		return
+	}
+	sig, err := hex.DecodeString(accepted.Signature)
+	if assert.NoError(t, err) {
+		assert.NoError(t, providers.VerifyQuoteSignature(hash, sig, lp.Address()))
+	}
+	rq, err := repository.GetRetainedQuote(quote.QuoteHash)
+	if assert.NoError(t, err) {
+		assert.Equal(t, types.NewWei(3000000+21000*10), rq.ReqLiq)
+		assert.Equal(t, breakdown, rq.FeeBreakdown)
+	}
+
+	var liq LiquidityResponse
+	assert.Equal(t, http.StatusOK, doRequest(t, s, http.MethodGet, "/liquidity", nil, &liq))
+	assert.Equal(t, types.NewWei(5000000-3000000-21000*10), liq.Available)
+}
+
+func TestGetQuoteGasPriceOracle(t *testing.T) {
+	oracle := providerstest.NewFakeGasPriceOracle(types.NewWei(20))
+	s, _, _ := newTestServer(t, 5000000, Config{}, func(cfg *providers.ProviderConfig) {
+		cfg.GasPriceOracle = oracle
+	})
+	req := newTestQuoteRequest()
+
+	var quote GetQuoteResponse
+	if !assert.Equal(t, http.StatusOK, doRequest(t, s, http.MethodPost, "/pegin/getQuote", req, &quote)) {
+		return
+	}
+	assert.Equal(t, types.NewWei(21000*20+1000), quote.Quote.CallFee)
+	var accepted AcceptQuoteResponse
+	assert.Equal(t, http.StatusOK, doRequest(t, s, http.MethodPost, "/pegin/acceptQuote", AcceptQuoteRequest{
+		QuoteHash:   quote.QuoteHash,
+		DepositAddr: "2N5muMepJizJE1gR7FbHJU6CD18V3BpNF9p",
+	}, &accepted))
+	var liq LiquidityResponse
+	assert.Equal(t, http.StatusOK, doRequest(t, s, http.MethodGet, "/liquidity", nil, &liq))
+	assert.Equal(t, types.NewWei(5000000-3000000-21000*20), liq.Available)
+
+	oracle.Set(nil, fmt.Errorf("%w: connection refused", providers.ErrGasPriceUnavailable))
+	var res ErrorResponse
+	assert.Equal(t, http.StatusServiceUnavailable, doRequest(t, s, http.MethodPost, "/pegin/getQuote", req, &res))
+	assert.Equal(t, CodeGasPriceUnavailable, res.Code)
+
+	// quotes cannot be priced without an oracle
+	s, _, _ = newTestServer(t, 5000000, Config{}, func(cfg *providers.ProviderConfig) {
+		cfg.GasPriceOracle = nil
+	})
+	assert.Equal(t, http.StatusServiceUnavailable, doRequest(t, s, http.MethodPost, "/pegin/getQuote", req, &res))
+	assert.Equal(t, CodeGasPriceUnavailable, res.Code)
+}
+
+func TestGetQuoteUserGasPrice(t *testing.T) {
+	s, _, _ := newTestServer(t, 5000000, Config{}, func(cfg *providers.ProviderConfig) {
+		cfg.GasPriceOracle = providerstest.NewFakeGasPriceOracle(types.NewWei(20))
+	})
+	// users cannot price the gas of their quotes
+	var res ErrorResponse
+	body := map[string]interface{}{"quote": newTestQuoteRequest().Quote, "gasPrice": "0"}
+	assert.Equal(t, http.StatusBadRequest, doRequest(t, s, http.MethodPost, "/pegin/getQuote", body, &res))
+	assert.Equal(t, CodeInvalidRequest, res.Code)
+
+	var quote GetQuoteResponse
+	if assert.Equal(t, http.StatusOK, doRequest(t, s, http.MethodPost, "/pegin/getQuote", newTestQuoteRequest(), &quote)) {
+		assert.Equal(t, types.NewWei(21000*20), quote.Quote.FeeBreakdown.GasCost)
+	}
+}
+
+type fakeGasEstimator struct {
+	gas uint64
+	err error
+}
+
+func (e *fakeGasEstimator) EstimateGas(context.Context, *types.Quote) (uint64, error) {
+	return e.gas, e.err
+}
+
+func TestGetQuoteGasEstimator(t *testing.T) {
+	estimator := &fakeGasEstimator{gas: 30000}
+	s, _, _ := newTestServer(t, 5000000, Config{}, func(cfg *providers.ProviderConfig) {
+		cfg.GasEstimator = estimator
+	})
+	for _, tt := range []struct {
+		name   string
+		err    error
+		status int
+		code   string
+	}{
+		{name: "estimate above the gas limit", status: http.StatusBadRequest, code: CodeInvalidRequest},
+		{name: "reverted call", err: providers.ErrCallFailed, status: http.StatusBadRequest, code: CodeInvalidRequest},
+		{name: "node unavailable", err: providers.ErrGasEstimationFailed, status: http.StatusServiceUnavailable, code: CodeGasEstimationFailed},
+	} {
+		estimator.err = tt.err
+		var res ErrorResponse
+		assert.Equal(t, tt.status, doRequest(t, s, http.MethodPost, "/pegin/getQuote", newTestQuoteRequest(), &res), tt.name)
+		assert.Equal(t, tt.code, res.Code, tt.name)
+	}
+}
+
+func TestGetQuoteErrors(t *testing.T) {
+	s, _, _ := newTestServer(t, 1000, Config{})
+	tests := []struct {
+		name   string
+		body   interface{}
+		modify func(req *GetQuoteRequest)
+		status int
+		code   string
+	}{
+		{name: "malformed", body: "{", status: http.StatusBadRequest},
+		{name: "unknown field", body: `{"quote": {}, "gasPrice": 1, "gas": 1}`, status: http.StatusBadRequest},
+		{name: "missing quote", body: `{}`, status: http.StatusBadRequest},
+		{name: "gas price", body: map[string]interface{}{"quote": newTestQuoteRequest().Quote, "gasPrice": "0"}, status: http.StatusBadRequest},
+		{name: "negative value", modify: func(req *GetQuoteRequest) { req.Quote.Value = types.NewWei(-1) }, status: http.StatusBadRequest},
+		{name: "invalid refund address", modify: func(req *GetQuoteRequest) { req.Quote.RSKRefundAddr = "0x1" }, status: http.StatusBadRequest},
+		{name: "invalid btc refund address", modify: func(req *GetQuoteRequest) { req.Quote.BTCRefundAddr = "1234" }, status: http.StatusBadRequest},
+		{name: "invalid data", modify: func(req *GetQuoteRequest) { req.Quote.Data = "zz" }, status: http.StatusBadRequest},
+		{name: "insufficient liquidity", status: http.StatusConflict, code: CodeInsufficientLiquidity},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := tt.body
+			if body == nil {
+				req := newTestQuoteRequest()
+				if tt.modify != nil {
+					tt.modify(&req)
+				}
+				body = req
+			}
+			var res ErrorResponse
+			assert.Equal(t, tt.status, doRequest(t, s, http.MethodPost, "/pegin/getQuote", body, &res))
+			assert.NotEmpty(t, res.Error)
+			code := tt.code
+			if code == "" {
+				code = CodeInvalidRequest
+			}
+			assert.Equal(t, code, res.Code)
+		})
+	}
+}
+
+func TestAcceptQuoteErrors(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	s, _, repository := newTestServer(t, 5000000, Config{Clock: clock})
+	var quote GetQuoteResponse
+	if !assert.Equal(t, http.StatusOK, doRequest(t, s, http.MethodPost, "/pegin/getQuote", newTestQuoteRequest(), &quote)) {
+		return
+	}
+	depositAddr := "2N5muMepJizJE1gR7FbHJU6CD18V3BpNF9p"
+
+	var res ErrorResponse
+	status := doRequest(t, s, http.MethodPost, "/pegin/acceptQuote", AcceptQuoteRequest{QuoteHash: "ab", DepositAddr: depositAddr}, &res)
+	assert.Equal(t, http.StatusNotFound, status)
+	assert.Equal(t, CodeQuoteNotFound, res.Code)
+	status = doRequest(t, s, http.MethodPost, "/pegin/acceptQuote", AcceptQuoteRequest{QuoteHash: quote.QuoteHash, DepositAddr: "1234"}, &res)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, CodeInvalidRequest, res.Code)
+
+	// the liquidity is taken by someone else between getQuote and acceptQuote
+	assert.NoError(t, repository.SetLiquidity(types.NewWei(1000)))
+	status = doRequest(t, s, http.MethodPost, "/pegin/acceptQuote", AcceptQuoteRequest{QuoteHash: quote.QuoteHash, DepositAddr: depositAddr}, &res)
+	assert.Equal(t, http.StatusConflict, status)
+	assert.Equal(t, CodeInsufficientLiquidity, res.Code)
+
+	clock.now = clock.now.Add(2 * time.Hour)
+	status = doRequest(t, s, http.MethodPost, "/pegin/acceptQuote", AcceptQuoteRequest{QuoteHash: quote.QuoteHash, DepositAddr: depositAddr}, &res)
+	assert.Equal(t, http.StatusGone, status)
+	assert.Equal(t, CodeQuoteExpired, res.Code)
+}
+
+func TestIssuedQuotes(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	s, _, _ := newTestServer(t, 50000000, Config{Clock: clock, MaxIssuedQuotes: 2})
+	getQuote := func(value int64) (int, GetQuoteResponse, ErrorResponse) {
+		req := newTestQuoteRequest()
+		req.Quote.Value = types.NewWei(value)
+		var body json.RawMessage
+		status := doRequest(t, s, http.MethodPost, "/pegin/getQuote", req, &body)
+		var quote GetQuoteResponse
+		var res ErrorResponse
+		if status == http.StatusOK {
+			assert.NoError(t, json.Unmarshal(body, &quote))
+		} else {
+			assert.NoError(t, json.Unmarshal(body, &res))
+		}
+		return status, quote, res
+	}
+	accept := func(hash string) int {
+		var res json.RawMessage
+		return doRequest(t, s, http.MethodPost, "/pegin/acceptQuote", AcceptQuoteRequest{
+			QuoteHash:   hash,
+			DepositAddr: "2N5muMepJizJE1gR7FbHJU6CD18V3BpNF9p",
+		}, &res)
+	}
+
+	status, first, _ := getQuote(1000000)
+	assert.Equal(t, http.StatusOK, status)
+	status, _, _ = getQuote(2000000)
+	assert.Equal(t, http.StatusOK, status)
+	status, _, res := getQuote(3000000)
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, CodeTooManyQuotes, res.Code)
+
+	// accepted quotes are forgotten, so they can only be accepted once
+	assert.Equal(t, http.StatusOK, accept(first.QuoteHash))
+	assert.Equal(t, http.StatusNotFound, accept(first.QuoteHash))
+	status, _, _ = getQuote(3000000)
+	assert.Equal(t, http.StatusOK, status)
+	status, _, _ = getQuote(4000000)
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+
+	// expired quotes are dropped to make room for new ones
+	clock.now = clock.now.Add(2 * time.Hour)
+	status, _, _ = getQuote(4000000)
+	assert.Equal(t, http.StatusOK, status)
+}
+
+func TestProvidersHealthAndRouting(t *testing.T) {
+	s, lp, _ := newTestServer(t, 1000, Config{})
+	var list []types.GlobalProvider
+	assert.Equal(t, http.StatusOK, doRequest(t, s, http.MethodGet, "/providers", nil, &list))
+	assert.Equal(t, []types.GlobalProvider{{Provider: lp.Address(), Status: true, ProviderType: "pegin"}}, list)
+
+	configured := []types.GlobalProvider{{Id: 1, Provider: lp.Address(), Name: "lp", ApiBaseUrl: "https://lp.example.com", Status: true, ProviderType: "pegin"}}
+	s, _, _ = newTestServer(t, 1000, Config{Providers: configured})
+	assert.Equal(t, http.StatusOK, doRequest(t, s, http.MethodGet, "/providers", nil, &list))
+	assert.Equal(t, configured, list)
+
+	var health HealthResponse
+	assert.Equal(t, http.StatusOK, doRequest(t, s, http.MethodGet, "/health", nil, &health))
+	assert.Equal(t, "ok", health.Status)
+
+	var res ErrorResponse
+	assert.Equal(t, http.StatusMethodNotAllowed, doRequest(t, s, http.MethodGet, "/pegin/getQuote", nil, &res))
+	assert.Equal(t, CodeMethodNotAllowed, res.Code)
+	assert.Equal(t, http.StatusNotFound, doRequest(t, s, http.MethodGet, "/unknown", nil, &res))
+	assert.Equal(t, CodeNotFound, res.Code)
+}
+
+// hungRepository never answers the liquidity queries that accept a context.
+type hungRepository struct {
+	*inmem.Repository
+}
+
+func (r hungRepository) GetLiquidityContext(ctx context.Context) (*types.Wei, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestRequestTimeout(t *testing.T) {
+	_, lp, repository := newTestServer(t, 1000, Config{})
+	s := New(lp, hungRepository{repository}, Config{RequestTimeout: 50 * time.Millisecond})
+	var res ErrorResponse
+	assert.Equal(t, http.StatusServiceUnavailable, doRequest(t, s, http.MethodGet, "/liquidity", nil, &res))
+	assert.Equal(t, CodeTimeout, res.Code)
+}
+
+func TestServerShutdown(t *testing.T) {
+	s, _, _ := newTestServer(t, 1000, Config{})
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Serve(l)
+	}()
+
+	res, err := http.Get("http://" + l.Addr().String() + "/health")
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		_ = res.Body.Close()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.NoError(t, s.Shutdown(ctx))
+	select {
+	case err = <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve() did not return after Shutdown()")
+	}
+	_, err = http.Get("http://" + l.Addr().String() + "/health")
+	assert.Error(t, err)
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/rsksmart/liquidity-provider/openapi"
+	"github.com/rsksmart/liquidity-provider/types"
+)
+
+// APIVersion is the version of the API reported in its OpenAPI document.
+const APIVersion = "1.0.0"
+
+// Endpoints returns the endpoints served by the API, along with their request and response bodies.
+func Endpoints() []openapi.Endpoint {
+	return []openapi.Endpoint{
+		{
+			Method:   http.MethodPost,
+			Path:     "/pegin/getQuote",
+			Summary:  "Prices a peg-in quote, which can be accepted until its time for deposit elapses",
+			Request:  GetQuoteRequest{},
+			Response: GetQuoteResponse{},
+			Errors: []int{http.StatusBadRequest, http.StatusConflict, http.StatusInternalServerError,
+				http.StatusServiceUnavailable},
+			ErrorResponse: ErrorResponse{},
+		},
+		{
+			Method:   http.MethodPost,
+			Path:     "/pegin/acceptQuote",
+			Summary:  "Accepts a quote returned by getQuote, reserving its liquidity and returning the provider signature",
+			Request:  AcceptQuoteRequest{},
+			Response: AcceptQuoteResponse{},
+			Errors: []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusConflict,
+				http.StatusGone, http.StatusInternalServerError, http.StatusServiceUnavailable},
+			ErrorResponse: ErrorResponse{},
+		},
+		{
+			Method:        http.MethodGet,
+			Path:          "/providers",
+			Summary:       "Lists the liquidity providers",
+			Response:      []types.GlobalProvider{},
+			Errors:        []int{http.StatusInternalServerError},
+			ErrorResponse: ErrorResponse{},
+		},
+		{
+			Method:        http.MethodGet,
+			Path:          "/health",
+			Summary:       "Reports whether the provider is able to serve quotes",
+			Response:      HealthResponse{},
+			Errors:        []int{http.StatusServiceUnavailable},
+			ErrorResponse: ErrorResponse{},
+		},
+		{
+			Method:        http.MethodGet,
+			Path:          "/liquidity",
+			Summary:       "Returns the liquidity available for new quotes",
+			Response:      LiquidityResponse{},
+			Errors:        []int{http.StatusInternalServerError},
+			ErrorResponse: ErrorResponse{},
+		},
+	}
+}
+
+// Spec returns the OpenAPI document of the API. It also describes the types clients exchange with the provider
+// outside of this API, such as the provider registration request.
+func Spec() (*openapi.Document, error) {
+	g := openapi.NewGenerator(openapi.Info{
+		Title:       "Liquidity Provider API",
+		Description: "Peg-in quotes served by a liquidity provider of the RSK Liquidity Bridge Contract",
+		Version:     APIVersion,
+	})
+	for _, e := range Endpoints() {
+		if err := g.AddEndpoint(e); err != nil {
+			return nil, err
+		}
+	}
+	for _, v := range []interface{}{types.ProviderRegisterRequest{}, types.UserQuoteRequest{}, types.UserEvents{}} {
+		if err := g.AddSchema(v); err != nil {
+			return nil, err
+		}
+	}
+	return g.Document(), nil
+}
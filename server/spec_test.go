@@ -0,0 +1,177 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/rsksmart/liquidity-provider/openapi"
+	"github.com/stretchr/testify/assert"
+)
+
+var update = flag.Bool("update", false, "update the checked in OpenAPI document")
+
+const specFile = "testdata/openapi.json"
+
+// TestSpec checks that the checked in OpenAPI document matches the Go types, run go test -update after changing them.
+func TestSpec(t *testing.T) {
+	doc, err := Spec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = append(got, '\n')
+	if *update {
+		if err = ioutil.WriteFile(specFile, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := ioutil.ReadFile(specFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, string(want), string(got), "the OpenAPI document is outdated, run go test ./server -update")
+}
+
+func TestSpecMatchesRoutes(t *testing.T) {
+	s, _, _ := newTestServer(t, 1000, Config{})
+	for _, e := range Endpoints() {
+		status := doRequest(t, s, e.Method, e.Path, "{}", nil)
+		assert.NotEqual(t, 404, status, e.Path)
+		assert.NotEqual(t, 405, status, e.Path)
+	}
+}
+
+// TestSpecMatchesResponses checks the responses of the server against the schemas of the OpenAPI document.
+func TestSpecMatchesResponses(t *testing.T) {
+	doc, err := Spec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, _, _ := newTestServer(t, 5000000, Config{})
+	do := func(method string, path string, body interface{}) []byte {
+		var b []byte
+		if body != nil {
+			if b, err = json.Marshal(body); err != nil {
+				t.Fatal(err)
+			}
+		}
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest(method, path, bytes.NewReader(b)))
+		op := doc.Paths[path][strings.ToLower(method)]
+		if !assert.NotNil(t, op, path) {
+			return rec.Body.Bytes()
+		}
+		res := op.Responses[strconv.Itoa(rec.Code)]
+		if !assert.NotNil(t, res, "%v responded %v", path, rec.Code) {
+			return rec.Body.Bytes()
+		}
+		dec := json.NewDecoder(bytes.NewReader(rec.Body.Bytes()))
+		dec.UseNumber()
+		var v interface{}
+		if assert.NoError(t, dec.Decode(&v), path) {
+			assert.NoError(t, checkSchema(doc, res.Content["application/json"].Schema, v, path), rec.Body.String())
+		}
+		return rec.Body.Bytes()
+	}
+
+	var quote GetQuoteResponse
+	if err = json.Unmarshal(do(http.MethodPost, "/pegin/getQuote", newTestQuoteRequest()), &quote); err != nil {
+		t.Fatal(err)
+	}
+	do(http.MethodPost, "/pegin/acceptQuote", AcceptQuoteRequest{QuoteHash: quote.QuoteHash, DepositAddr: "2N5muMepJizJE1gR7FbHJU6CD18V3BpNF9p"})
+	do(http.MethodPost, "/pegin/acceptQuote", AcceptQuoteRequest{QuoteHash: "ab", DepositAddr: "2N5muMepJizJE1gR7FbHJU6CD18V3BpNF9p"})
+	do(http.MethodGet, "/providers", nil)
+	do(http.MethodGet, "/health", nil)
+	do(http.MethodGet, "/liquidity", nil)
+}
+
+// checkSchema checks v, decoded with json.Decoder.UseNumber, against the subset of the schema used by the document.
+func checkSchema(doc *openapi.Document, schema *openapi.Schema, v interface{}, path string) error {
+	if schema.Ref != "" {
+		return checkSchema(doc, doc.Components.Schemas[strings.TrimPrefix(schema.Ref, "#/components/schemas/")], v, path)
+	}
+	if v == nil {
+		if !schema.Nullable {
+			return fmt.Errorf("%v is null", path)
+		}
+		return nil
+	}
+	for _, s := range schema.AllOf {
+		if err := checkSchema(doc, s, v, path); err != nil {
+			return err
+		}
+	}
+	switch schema.Type {
+	case "object":
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%v is not an object", path)
+		}
+		for _, name := range schema.Required {
+			if _, ok = obj[name]; !ok {
+				return fmt.Errorf("%v.%v is missing", path, name)
+			}
+		}
+		for name, field := range obj {
+			fs, ok := schema.Properties[name]
+			if !ok {
+				fs = schema.AdditionalProperties
+			}
+			if fs == nil {
+				return fmt.Errorf("%v.%v is not in the schema", path, name)
+			}
+			if err := checkSchema(doc, fs, field, path+"."+name); err != nil {
+				return err
+			}
+		}
+	case "array":
+		items, ok := v.([]interface{})
+		if !ok {
+			return fmt.Errorf("%v is not an array", path)
+		}
+		for i, item := range items {
+			if err := checkSchema(doc, schema.Items, item, fmt.Sprintf("%v[%v]", path, i)); err != nil {
+				return err
+			}
+		}
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("%v is not a string", path)
+		}
+		if schema.Pattern != "" && !regexp.MustCompile(schema.Pattern).MatchString(str) {
+			return fmt.Errorf("%v does not match %v", path, schema.Pattern)
+		}
+	case "integer":
+		n, ok := v.(json.Number)
+		if !ok {
+			return fmt.Errorf("%v is not a number", path)
+		}
+		i, ok := new(big.Int).SetString(n.String(), 10)
+		if !ok || (schema.Format != "" && !i.IsInt64()) {
+			return fmt.Errorf("%v is not an integer of format %q", path, schema.Format)
+		}
+	case "number":
+		if _, ok := v.(json.Number); !ok {
+			return fmt.Errorf("%v is not a number", path)
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return fmt.Errorf("%v is not a boolean", path)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+// Package stubsigner implements the subset of the Clef external API used by providers.ExternalSigner. It signs every
+// request without asking for approval, so it must only be used in tests and local development.
+package stubsigner
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	gethTypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+	"github.com/rsksmart/liquidity-provider/types"
+)
+
+// Version is the Clef external API version reported by the stub.
+const Version = "6.1.0"
+
+var (
+	ErrUnknownAccount     = errors.New("unknown account")
+	ErrUnsupportedContent = errors.New("unsupported content type")
+	ErrChainIdRequired    = errors.New("chain id is required")
+)
+
+// Service is the "account" namespace of the signer API.
+type Service struct {
+	keys  map[common.Address]*ecdsa.PrivateKey
+	addrs []common.Address
+}
+
+type SignTransactionResult struct {
+	Raw hexutil.Bytes          `json:"raw"`
+	Tx  *gethTypes.Transaction `json:"tx"`
+}
+
+// NewService returns a service that signs with keys, listing their accounts in the given order.
+func NewService(keys ...*ecdsa.PrivateKey) *Service {
+	s := Service{
+		keys: make(map[common.Address]*ecdsa.PrivateKey, len(keys)),
+	}
+	for _, key := range keys {
+		addr := crypto.PubkeyToAddress(key.PublicKey)
+		s.keys[addr] = key
+		s.addrs = append(s.addrs, addr)
+	}
+	return &s
+}
+
+// NewServer returns a JSON-RPC server exposing the service, which can be served over HTTP or IPC.
+func NewServer(keys ...*ecdsa.PrivateKey) (*rpc.Server, error) {
+	server := rpc.NewServer()
+	if err := server.RegisterName("account", NewService(keys...)); err != nil {
+		return nil, err
+	}
+	return server, nil
+}
+
+func (s *Service) Version(_ context.Context) (string, error) {
+	return Version, nil
+}
+
+func (s *Service) List(_ context.Context) ([]common.Address, error) {
+	return s.addrs, nil
+}
+
+// SignData signs text/plain data with the personal_sign prefix, returning v as 27 or 28 like Clef does.
+func (s *Service) SignData(_ context.Context, contentType string, addr common.MixedcaseAddress, data interface{}) (hexutil.Bytes, error) {
+	if contentType != accounts.MimetypeTextPlain {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedContent, contentType)
+	}
+	str, ok := data.(string)
+	if !ok {
+		return nil, fmt.Errorf("expected hex encoded data, got %T", data)
+	}
+	text, err := hexutil.Decode(str)
+	if err != nil {
+		return nil, err
+	}
+	return s.sign(addr.Address(), accounts.TextHash(text))
+}
+
+// SignTypedData signs the EIP-712 digest of the typed data, returning v as 27 or 28 like Clef does.
+func (s *Service) SignTypedData(_ context.Context, addr common.MixedcaseAddress, td types.TypedData) (hexutil.Bytes, error) {
+	digest, err := td.Hash()
+	if err != nil {
+		return nil, err
+	}
+	return s.sign(addr.Address(), digest)
+}
+
+func (s *Service) SignTransaction(_ context.Context, args apitypes.SendTxArgs, _ *string) (*SignTransactionResult, error) {
+	key, ok := s.keys[args.From.Address()]
+	if !ok {
+		return nil, fmt.Errorf("%w: %v", ErrUnknownAccount, args.From.Address())
+	}
+	if args.ChainID == nil {
+		return nil, ErrChainIdRequired
+	}
+	tx, err := gethTypes.SignTx(args.ToTransaction(), gethTypes.LatestSignerForChainID(args.ChainID.ToInt()), key)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := tx.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return &SignTransactionResult{Raw: raw, Tx: tx}, nil
+}
+
+func (s *Service) sign(addr common.Address, digest []byte) (hexutil.Bytes, error) {
+	key, ok := s.keys[addr]
+	if !ok {
+		return nil, fmt.Errorf("%w: %v", ErrUnknownAccount, addr)
+	}
+	sig, err := crypto.Sign(digest, key)
+	if err != nil {
+		return nil, err
+	}
+	sig[crypto.RecoveryIDOffset] += 27
+	return sig, nil
+}
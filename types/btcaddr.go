@@ -0,0 +1,61 @@
+package types
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+var bFiftyEight = big.NewInt(58)
+
+// DecodeBTCAddressWithVersion decodes a base58check encoded BTC address and returns the version byte followed by
+// the 20 bytes hash, which is the format the LBC expects for refund and LP addresses.
+func DecodeBTCAddressWithVersion(addr string) ([]byte, error) {
+	b, err := decodeBase58(addr)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) != 25 {
+		return nil, fmt.Errorf("invalid BTC address length: %v", addr)
+	}
+	payload, checksum := b[:21], b[21:]
+	h1 := sha256.Sum256(payload)
+	h2 := sha256.Sum256(h1[:])
+	if !bytes.Equal(h2[:4], checksum) {
+		return nil, fmt.Errorf("invalid BTC address checksum: %v", addr)
+	}
+	return payload, nil
+}
+
+// DecodeBTCAddress decodes a base58check encoded BTC address and returns the 20 bytes hash without the version byte.
+func DecodeBTCAddress(addr string) ([]byte, error) {
+	b, err := DecodeBTCAddressWithVersion(addr)
+	if err != nil {
+		return nil, err
+	}
+	return b[1:], nil
+}
+
+func decodeBase58(s string) ([]byte, error) {
+	if s == "" {
+		return nil, errors.New("empty base58 string")
+	}
+	n := new(big.Int)
+	for _, c := range s {
+		i := bytes.IndexRune([]byte(base58Alphabet), c)
+		if i < 0 {
+			return nil, fmt.Errorf("invalid base58 character: %q", c)
+		}
+		n.Mul(n, bFiftyEight)
+		n.Add(n, big.NewInt(int64(i)))
+	}
+	var zeros int
+	for zeros < len(s) && s[zeros] == base58Alphabet[0] {
+		zeros++
+	}
+	return append(make([]byte, zeros), n.Bytes()...), nil
+}
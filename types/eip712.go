@@ -0,0 +1,85 @@
+package types
+
+import (
+	"errors"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/signer/core"
+)
+
+const (
+	EIP712DomainName    = "LiquidityBridgeContract"
+	EIP712DomainVersion = "1"
+	PeginQuoteTypeName  = "PeginQuote"
+)
+
+var eip712DomainType = []core.Type{
+	{Name: "name", Type: "string"},
+	{Name: "version", Type: "string"},
+	{Name: "chainId", Type: "uint256"},
+	{Name: "verifyingContract", Type: "address"},
+}
+
+// PeginQuoteType returns the EIP-712 encoded type of a peg-in quote, which has the same fields as the LBC Quote struct.
+func PeginQuoteType() string {
+	td := core.TypedData{Types: core.Types{PeginQuoteTypeName: peginQuoteType()}}
+	return string(td.EncodeType(PeginQuoteTypeName))
+}
+
+func peginQuoteType() []core.Type {
+	fields := make([]core.Type, len(quoteArguments))
+	for i, arg := range quoteArguments {
+		fields[i] = core.Type{Name: arg.Name, Type: arg.Type.String()}
+	}
+	return fields
+}
+
+// EIP712DomainSeparator returns the hash of the EIP-712 domain used to sign quotes for the given chain and LBC.
+func EIP712DomainSeparator(chainId *big.Int, lbcAddr string) ([]byte, error) {
+	domain, err := eip712Domain(chainId, lbcAddr)
+	if err != nil {
+		return nil, err
+	}
+	td := TypedData{Types: core.Types{"EIP712Domain": eip712DomainType}, Domain: domain}
+	return td.domainSeparator()
+}
+
+func eip712Domain(chainId *big.Int, lbcAddr string) (core.TypedDataDomain, error) {
+	if chainId == nil {
+		return core.TypedDataDomain{}, errors.New("chainId is <nil>")
+	}
+	verifyingContract, err := parseRSKAddr("lbcAddr", lbcAddr)
+	if err != nil {
+		return core.TypedDataDomain{}, err
+	}
+	return core.TypedDataDomain{
+		Name:              EIP712DomainName,
+		Version:           EIP712DomainVersion,
+		ChainId:           (*math.HexOrDecimal256)(new(big.Int).Set(chainId)),
+		VerifyingContract: verifyingContract.Hex(),
+	}, nil
+}
+
+// StructHash returns the EIP-712 hashStruct of the quote as a PeginQuote.
+func (q *Quote) StructHash() ([]byte, error) {
+	message, err := q.typedMessage()
+	if err != nil {
+		return nil, err
+	}
+	// the domain is not part of the struct hash, but go-ethereum refuses to encode data without one
+	td := core.TypedData{
+		Types:  core.Types{PeginQuoteTypeName: peginQuoteType()},
+		Domain: core.TypedDataDomain{Name: EIP712DomainName, Version: EIP712DomainVersion},
+	}
+	return td.HashStruct(PeginQuoteTypeName, message)
+}
+
+// TypedDataHash returns the EIP-712 digest of the quote, using the quote LBCAddr as the verifying contract.
+func (q *Quote) TypedDataHash(chainId *big.Int) ([]byte, error) {
+	td, err := q.TypedData(chainId)
+	if err != nil {
+		return nil, err
+	}
+	return td.Hash()
+}
@@ -0,0 +1,89 @@
+package types
+
+import (
+	"encoding/hex"
+	"math/big"
+	"testing"
+)
+
+func TestPeginQuoteType(t *testing.T) {
+	want := "PeginQuote(bytes20 fedBtcAddress,address lbcAddress,address liquidityProviderRskAddress,bytes btcRefundAddress," +
+		"address rskRefundAddress,bytes liquidityProviderBtcAddress,uint256 callFee,uint256 penaltyFee,address contractAddress," +
+		"bytes data,uint32 gasLimit,int64 nonce,uint256 value,uint32 agreementTimestamp,uint32 timeForDeposit,uint32 callTime," +
+		"uint16 depositConfirmations,bool callOnRegister)"
+	if got := PeginQuoteType(); got != want {
+		t.Errorf("PeginQuoteType() = %v, want %v", got, want)
+	}
+}
+
+func TestEIP712DomainSeparator(t *testing.T) {
+	tests := []struct {
+		name    string
+		chainId *big.Int
+		lbcAddr string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "domain separator",
+			chainId: big.NewInt(31),
+			lbcAddr: "0xC52AbEae2f7A6e2E3C5Ab1C2a7E21B6F4A2F1C10",
+			want:    "ba5b3b73e51d900960d8b5b0ea3f1e0d345ff99dab3c8f08728682cccf1a988e",
+		},
+		{
+			name:    "<nil> chain id",
+			chainId: nil,
+			lbcAddr: "0xC52AbEae2f7A6e2E3C5Ab1C2a7E21B6F4A2F1C10",
+			wantErr: true,
+		},
+		{
+			name:    "invalid lbc address",
+			chainId: big.NewInt(31),
+			lbcAddr: "abc",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := EIP712DomainSeparator(tt.chainId, tt.lbcAddr)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("EIP712DomainSeparator() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && hex.EncodeToString(got) != tt.want {
+				t.Errorf("EIP712DomainSeparator() = %x, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuote_StructHash(t *testing.T) {
+	q := newTestQuote()
+	q.Nonce = -5
+	q.Data = "0xa9059cbb"
+	q.CallOnRegister = true
+	got, err := q.StructHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "8c5876ca13c446a065a0089dd78f55b1b90abb0e4c3ffe413b37e017c690cda4"; hex.EncodeToString(got) != want {
+		t.Errorf("StructHash() = %x, want %v", got, want)
+	}
+}
+
+func TestQuote_TypedDataHash(t *testing.T) {
+	q := newTestQuote()
+	q.Nonce = -5
+	q.Data = "0xa9059cbb"
+	q.CallOnRegister = true
+	got, err := q.TypedDataHash(big.NewInt(31))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "281b761940eb555c95785c759a5e414f621e4f8adeb38a2b25ac51ad8f4484aa"; hex.EncodeToString(got) != want {
+		t.Errorf("TypedDataHash() = %x, want %v", got, want)
+	}
+	if _, err = q.TypedDataHash(nil); err == nil {
+		t.Error("TypedDataHash() did not fail with <nil> chain id")
+	}
+}
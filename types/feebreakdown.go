@@ -0,0 +1,51 @@
+package types
+
+import "fmt"
+
+// FeeBreakdown itemizes the call fee of a quote, the sum of every fee but the penalty fee.
+type FeeBreakdown struct {
+	GasCost       *Wei `json:"gasCost"`
+	FixedFee      *Wei `json:"fixedFee"`
+	PercentageFee *Wei `json:"percentageFee"`
+	NetworkFee    *Wei `json:"networkFee"`
+	PenaltyFee    *Wei `json:"penaltyFee"`
+}
+
+// Total returns the call fee itemized by the breakdown. Nil charges count as zero.
+func (b *FeeBreakdown) Total() *Wei {
+	res := NewWei(0)
+	for _, w := range []*Wei{b.GasCost, b.FixedFee, b.PercentageFee, b.NetworkFee} {
+		if w != nil {
+			res.Add(res, w)
+		}
+	}
+	return res
+}
+
+// Check fails if the breakdown does not add up to callFee.
+func (b *FeeBreakdown) Check(callFee *Wei) error {
+	if callFee == nil || b.Total().Cmp(callFee) != 0 {
+		return fmt.Errorf("fee breakdown adds up to %v, the call fee is %v", b.Total(), callFee)
+	}
+	return nil
+}
+
+func (b *FeeBreakdown) Copy() *FeeBreakdown {
+	if b == nil {
+		return nil
+	}
+	return &FeeBreakdown{
+		GasCost:       copyWei(b.GasCost),
+		FixedFee:      copyWei(b.FixedFee),
+		PercentageFee: copyWei(b.PercentageFee),
+		NetworkFee:    copyWei(b.NetworkFee),
+		PenaltyFee:    copyWei(b.PenaltyFee),
+	}
+}
+
+func copyWei(w *Wei) *Wei {
+	if w == nil {
+		return nil
+	}
+	return w.Copy()
+}
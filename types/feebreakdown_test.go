@@ -0,0 +1,84 @@
+package types
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestFeeBreakdown_Total(t *testing.T) {
+	b := &FeeBreakdown{
+		GasCost:       NewWei(210000),
+		FixedFee:      NewWei(1000),
+		PercentageFee: NewWei(750),
+		NetworkFee:    NewWei(5000),
+		PenaltyFee:    NewWei(1000000),
+	}
+	if got, want := b.Total(), NewWei(216750); got.Cmp(want) != 0 {
+		t.Errorf("Total() = %v, want %v", got, want)
+	}
+	if err := b.Check(NewWei(216750)); err != nil {
+		t.Errorf("Check() error = %v", err)
+	}
+	if err := b.Check(NewWei(216751)); err == nil {
+		t.Error("Check() did not fail with a different call fee")
+	}
+	if err := b.Check(nil); err == nil {
+		t.Error("Check() did not fail without call fee")
+	}
+
+	b = &FeeBreakdown{GasCost: NewWei(10)}
+	if got, want := b.Total(), NewWei(10); got.Cmp(want) != 0 {
+		t.Errorf("Total() = %v, want %v", got, want)
+	}
+}
+
+func TestFeeBreakdown_JSON(t *testing.T) {
+	b := &FeeBreakdown{
+		GasCost:       NewWei(210000),
+		FixedFee:      NewWei(1000),
+		PercentageFee: NewWei(0),
+		NetworkFee:    NewWei(5000),
+		PenaltyFee:    NewWei(1000000),
+	}
+	res, err := json.Marshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"gasCost":"210000","fixedFee":"1000","percentageFee":"0","networkFee":"5000","penaltyFee":"1000000"}`
+	if string(res) != want {
+		t.Errorf("json.Marshal() = %s, want %v", res, want)
+	}
+
+	var got FeeBreakdown
+	if err = json.Unmarshal(res, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Total().Cmp(b.Total()) != 0 || got.PenaltyFee.Cmp(b.PenaltyFee) != 0 {
+		t.Errorf("json.Unmarshal() = %+v, want %+v", got, b)
+	}
+
+	// quotes without a breakdown omit it
+	if res, err = json.Marshal(&Quote{}); err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]interface{}
+	if err = json.Unmarshal(res, &fields); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fields["feeBreakdown"]; ok {
+		t.Errorf("json.Marshal() = %s, want no feeBreakdown", res)
+	}
+}
+
+func TestFeeBreakdown_Copy(t *testing.T) {
+	var b *FeeBreakdown
+	if b.Copy() != nil {
+		t.Error("Copy() of nil breakdown is not nil")
+	}
+	b = &FeeBreakdown{GasCost: NewWei(1), PenaltyFee: NewWei(2)}
+	c := b.Copy()
+	c.GasCost.Add(c.GasCost, NewWei(1))
+	if b.GasCost.Cmp(NewWei(1)) != 0 || c.FixedFee != nil {
+		t.Errorf("Copy() = %+v, original %+v", c, b)
+	}
+}
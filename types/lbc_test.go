@@ -0,0 +1,112 @@
+package types
+
+import (
+	"context"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+var (
+	lbcRPC  = flag.String("lbc-rpc", "", "RSK node used to check the quote hashes against a deployed LBC")
+	lbcAddr = flag.String("lbc-addr", "", "address of the LBC deployed on the node given by -lbc-rpc")
+)
+
+// pegoutQuoteStructArguments are the fields of the LBC PegOutQuote struct, in the order they are declared. It differs
+// from the order hashPegoutQuote encodes them in, as the nonce follows the penalty fee.
+var pegoutQuoteStructArguments = concatArguments(
+	pegoutQuotePart1Arguments[:7],
+	pegoutQuotePart2Arguments[len(pegoutQuotePart2Arguments)-1:],
+	pegoutQuotePart1Arguments[7:],
+	pegoutQuotePart2Arguments[:len(pegoutQuotePart2Arguments)-1],
+)
+
+// TestQuote_HashMatchesLBC checks the quote hash vectors against the hashQuote function of a deployed LBC, run
+// go test ./types -lbc-rpc <node> -lbc-addr <lbc> after changing them.
+func TestQuote_HashMatchesLBC(t *testing.T) {
+	client, lbc := dialLBC(t)
+	for _, v := range quoteHashVectors {
+		values, err := v.q().abiValues()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := callLBCHash(client, lbc, "hashQuote", quoteArguments, values)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != v.want {
+			t.Errorf("%v: hashQuote() = %v, want %v", v.name, got, v.want)
+		}
+	}
+}
+
+// TestPegoutQuote_HashMatchesLBC checks the peg-out quote hash vectors against the hashPegoutQuote function of a
+// deployed LBC, run go test ./types -lbc-rpc <node> -lbc-addr <lbc> after changing them.
+func TestPegoutQuote_HashMatchesLBC(t *testing.T) {
+	client, lbc := dialLBC(t)
+	for _, v := range pegoutQuoteHashVectors {
+		values, err := v.q().abiValues()
+		if err != nil {
+			t.Fatal(err)
+		}
+		// move the nonce from the end of the encoding to its place in the struct
+		nonce := values[len(values)-1]
+		values = append(values[:7], append([]interface{}{nonce}, values[7:len(values)-1]...)...)
+		got, err := callLBCHash(client, lbc, "hashPegoutQuote", pegoutQuoteStructArguments, values)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != v.want {
+			t.Errorf("%v: hashPegoutQuote() = %v, want %v", v.name, got, v.want)
+		}
+	}
+}
+
+func dialLBC(t *testing.T) (*ethclient.Client, common.Address) {
+	if *lbcRPC == "" || *lbcAddr == "" {
+		t.Skip("set -lbc-rpc and -lbc-addr to check the hashes against a deployed LBC")
+	}
+	if !common.IsHexAddress(*lbcAddr) {
+		t.Fatalf("invalid -lbc-addr: %v", *lbcAddr)
+	}
+	client, err := ethclient.Dial(*lbcRPC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(client.Close)
+	return client, common.HexToAddress(*lbcAddr)
+}
+
+// callLBCHash calls the LBC function method, which takes a single struct with the fields args and returns a bytes32,
+// and returns the hex encoding of the result.
+func callLBCHash(client *ethclient.Client, lbc common.Address, method string, args abi.Arguments,
+	values []interface{}) (string, error) {
+	typeNames := make([]string, len(args))
+	for i, a := range args {
+		typeNames[i] = a.Type.String()
+	}
+	selector := crypto.Keccak256([]byte(fmt.Sprintf("%v((%v))", method, strings.Join(typeNames, ","))))[:4]
+	fields, err := args.Pack(values...)
+	if err != nil {
+		return "", err
+	}
+	// the struct is dynamic, so the call data holds its offset followed by its fields
+	offset := common.LeftPadBytes([]byte{32}, 32)
+	data := append(append(selector, offset...), fields...)
+	res, err := client.CallContract(context.Background(), ethereum.CallMsg{To: &lbc, Data: data}, nil)
+	if err != nil {
+		return "", fmt.Errorf("%v: %v", method, err)
+	}
+	if len(res) != 32 {
+		return "", fmt.Errorf("%v returned %x", method, res)
+	}
+	return hex.EncodeToString(res), nil
+}
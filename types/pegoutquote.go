@@ -0,0 +1,135 @@
+package types
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+type PegoutQuote struct {
+	LBCAddr               string `json:"lbcAddr" db:"lbc_addr"`
+	LPRSKAddr             string `json:"lpRSKAddr" db:"lp_rsk_addr"`
+	BTCRefundAddr         string `json:"btcRefundAddr" db:"btc_refund_addr"`
+	RSKRefundAddr         string `json:"rskRefundAddr" db:"rsk_refund_addr"`
+	LPBTCAddr             string `json:"lpBTCAddr" db:"lp_btc_addr"`
+	CallFee               *Wei   `json:"callFee" db:"call_fee"`
+	PenaltyFee            *Wei   `json:"penaltyFee" db:"penalty_fee"`
+	Nonce                 int64  `json:"nonce" db:"nonce"`
+	DepositAddr           string `json:"depositAddr" db:"deposit_addr"`
+	Value                 *Wei   `json:"value" db:"value"`
+	AgreementTimestamp    uint32 `json:"agreementTimestamp" db:"agreement_timestamp"`
+	DepositDateLimit      uint32 `json:"depositDateLimit" db:"deposit_date_limit"`
+	DepositConfirmations  uint16 `json:"depositConfirmations" db:"deposit_confirmations"`
+	TransferConfirmations uint16 `json:"transferConfirmations" db:"transfer_confirmations"`
+	TransferTime          uint32 `json:"transferTime" db:"transfer_time"`
+	ExpireDate            uint32 `json:"expireDate" db:"expire_date"`
+	ExpireBlock           uint32 `json:"expireBlock" db:"expire_block"`
+	// FeeBreakdown itemizes CallFee, it is not part of the quote signed by the provider
+	FeeBreakdown *FeeBreakdown `json:"feeBreakdown,omitempty" db:"fee_breakdown"`
+}
+
+// pegoutQuotePart1Arguments and pegoutQuotePart2Arguments mirror the two parts the LBC hashPegoutQuote function
+// encodes a PegOutQuote in.
+var (
+	pegoutQuotePart1Arguments = abi.Arguments{
+		{Name: "lbcAddress", Type: mustNewType("address")},
+		{Name: "lpRskAddress", Type: mustNewType("address")},
+		{Name: "btcRefundAddress", Type: mustNewType("bytes")},
+		{Name: "rskRefundAddress", Type: mustNewType("address")},
+		{Name: "lpBtcAddress", Type: mustNewType("bytes")},
+		{Name: "callFee", Type: mustNewType("uint256")},
+		{Name: "penaltyFee", Type: mustNewType("uint256")},
+		{Name: "deposityAddress", Type: mustNewType("bytes")},
+	}
+	pegoutQuotePart2Arguments = abi.Arguments{
+		{Name: "value", Type: mustNewType("uint256")},
+		{Name: "agreementTimestamp", Type: mustNewType("uint32")},
+		{Name: "depositDateLimit", Type: mustNewType("uint32")},
+		{Name: "depositConfirmations", Type: mustNewType("uint16")},
+		{Name: "transferConfirmations", Type: mustNewType("uint16")},
+		{Name: "transferTime", Type: mustNewType("uint32")},
+		{Name: "expireDate", Type: mustNewType("uint32")},
+		{Name: "expireBlock", Type: mustNewType("uint32")},
+		{Name: "nonce", Type: mustNewType("int64")},
+	}
+)
+
+// Encode returns the ABI encoding of the peg-out quote as the LiquidityBridgeContract encodes it before hashing.
+func (q *PegoutQuote) Encode() ([]byte, error) {
+	args, err := q.abiValues()
+	if err != nil {
+		return nil, err
+	}
+	return encodeParts(pegoutQuotePart1Arguments, pegoutQuotePart2Arguments, args)
+}
+
+// abiValues returns the peg-out quote fields converted to the Go types expected by pegoutQuotePart1Arguments and
+// pegoutQuotePart2Arguments, in the same order.
+func (q *PegoutQuote) abiValues() ([]interface{}, error) {
+	lbcAddr, err := parseRSKAddr("lbcAddr", q.LBCAddr)
+	if err != nil {
+		return nil, err
+	}
+	lpRSKAddr, err := parseRSKAddr("lpRSKAddr", q.LPRSKAddr)
+	if err != nil {
+		return nil, err
+	}
+	btcRefundAddr, err := DecodeBTCAddressWithVersion(q.BTCRefundAddr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid btcRefundAddr: %v", err)
+	}
+	rskRefundAddr, err := parseRSKAddr("rskRefundAddr", q.RSKRefundAddr)
+	if err != nil {
+		return nil, err
+	}
+	lpBTCAddr, err := DecodeBTCAddressWithVersion(q.LPBTCAddr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid lpBTCAddr: %v", err)
+	}
+	depositAddr, err := DecodeBTCAddressWithVersion(q.DepositAddr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid depositAddr: %v", err)
+	}
+	callFee, err := weiArg("callFee", q.CallFee)
+	if err != nil {
+		return nil, err
+	}
+	penaltyFee, err := weiArg("penaltyFee", q.PenaltyFee)
+	if err != nil {
+		return nil, err
+	}
+	value, err := weiArg("value", q.Value)
+	if err != nil {
+		return nil, err
+	}
+	return []interface{}{
+		lbcAddr,
+		lpRSKAddr,
+		btcRefundAddr,
+		rskRefundAddr,
+		lpBTCAddr,
+		callFee,
+		penaltyFee,
+		depositAddr,
+		value,
+		q.AgreementTimestamp,
+		q.DepositDateLimit,
+		q.DepositConfirmations,
+		q.TransferConfirmations,
+		q.TransferTime,
+		q.ExpireDate,
+		q.ExpireBlock,
+		q.Nonce,
+	}, nil
+}
+
+// Hash returns the keccak256 hash of the encoded peg-out quote, which matches the result of the LBC hashPegoutQuote
+// function.
+func (q *PegoutQuote) Hash() ([]byte, error) {
+	b, err := q.Encode()
+	if err != nil {
+		return nil, err
+	}
+	return crypto.Keccak256(b), nil
+}
@@ -0,0 +1,136 @@
+package types
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func newTestPegoutQuote() *PegoutQuote {
+	return &PegoutQuote{
+		LBCAddr:               "0xC52AbEae2f7A6e2E3C5Ab1C2a7E21B6F4A2F1C10",
+		LPRSKAddr:             "0xd562c283d2260c62110fa3da885842afbe16bda2",
+		BTCRefundAddr:         "mipcBbFg9gMiCh81Kj8tqqdgoZub1ZJRfn",
+		RSKRefundAddr:         "0x0000000000000000000000000000000000000001",
+		LPBTCAddr:             "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2",
+		CallFee:               NewWei(501000),
+		PenaltyFee:            NewWei(1000000),
+		Nonce:                 8373381263192041574,
+		DepositAddr:           "2N2JD6wb56AfK4tfmM6PwdVmoYk2dCKf4Br",
+		Value:                 NewWei(3000000),
+		AgreementTimestamp:    1670441000,
+		DepositDateLimit:      1670444600,
+		DepositConfirmations:  10,
+		TransferConfirmations: 2,
+		TransferTime:          7200,
+		ExpireDate:            1670448200,
+		ExpireBlock:           4000000,
+	}
+}
+
+// pegoutQuoteHashVectors are peg-out quotes with their expected hashes. TestPegoutQuote_HashMatchesLBC checks them
+// against the hashPegoutQuote function of a deployed LBC, and the hashes are the keccak256 of the encoding written out
+// word by word in TestPegoutQuote_Encode, which follows the layout of the LBC encodePegOutQuote:
+// abi.encode(encodePegOutPart1(quote), encodePegOutPart2(quote)).
+var pegoutQuoteHashVectors = []struct {
+	name string
+	q    func() *PegoutQuote
+	want string
+}{
+	{
+		name: "peg-out quote hash",
+		q:    newTestPegoutQuote,
+		want: "3cc384caa602db27c94713e2b469682bd7968ae459f5ca17d82f23959873329c",
+	},
+}
+
+func TestPegoutQuote_Hash(t *testing.T) {
+	type hashTest struct {
+		name    string
+		q       func() *PegoutQuote
+		want    string
+		wantErr bool
+	}
+	tests := []hashTest{
+		{
+			name: "invalid deposit address",
+			q: func() *PegoutQuote {
+				q := newTestPegoutQuote()
+				q.DepositAddr = "0x0000000000000000000000000000000000000001"
+				return q
+			},
+			wantErr: true,
+		},
+		{
+			name: "<nil> value",
+			q: func() *PegoutQuote {
+				q := newTestPegoutQuote()
+				q.Value = nil
+				return q
+			},
+			wantErr: true,
+		},
+	}
+	for _, v := range pegoutQuoteHashVectors {
+		tests = append(tests, hashTest{name: v.name, q: v.q, want: v.want})
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.q().Hash()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Hash() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && hex.EncodeToString(got) != tt.want {
+				t.Errorf("Hash() = %x, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPegoutQuote_Encode(t *testing.T) {
+	want := strings.Join([]string{
+		// abi.encode(part1, part2): the offsets of both parts
+		"0000000000000000000000000000000000000000000000000000000000000040",
+		"0000000000000000000000000000000000000000000000000000000000000220",
+		// part1, 448 bytes
+		"00000000000000000000000000000000000000000000000000000000000001c0",
+		"000000000000000000000000c52abeae2f7a6e2e3c5ab1c2a7e21b6f4a2f1c10",
+		"000000000000000000000000d562c283d2260c62110fa3da885842afbe16bda2",
+		// the offset of btcRefundAddress within part1
+		"0000000000000000000000000000000000000000000000000000000000000100",
+		"0000000000000000000000000000000000000000000000000000000000000001",
+		// the offset of lpBtcAddress within part1
+		"0000000000000000000000000000000000000000000000000000000000000140",
+		"000000000000000000000000000000000000000000000000000000000007a508",
+		"00000000000000000000000000000000000000000000000000000000000f4240",
+		// the offset of deposityAddress within part1
+		"0000000000000000000000000000000000000000000000000000000000000180",
+		// btcRefundAddress, lpBtcAddress and deposityAddress, 21 bytes each including the version
+		"0000000000000000000000000000000000000000000000000000000000000015",
+		"6f243f1394f44554f4ce3fd68649c19adc483ce9240000000000000000000000",
+		"0000000000000000000000000000000000000000000000000000000000000015",
+		"0077bff20c60e522dfaa3350c39b030a5d004e839a0000000000000000000000",
+		"0000000000000000000000000000000000000000000000000000000000000015",
+		"c46349a418fc4578d10a372b54b45c280cc8c4382f0000000000000000000000",
+		// part2, 288 bytes
+		"0000000000000000000000000000000000000000000000000000000000000120",
+		"00000000000000000000000000000000000000000000000000000000002dc6c0",
+		"000000000000000000000000000000000000000000000000000000006390e828",
+		"000000000000000000000000000000000000000000000000000000006390f638",
+		"000000000000000000000000000000000000000000000000000000000000000a",
+		"0000000000000000000000000000000000000000000000000000000000000002",
+		"0000000000000000000000000000000000000000000000000000000000001c20",
+		"0000000000000000000000000000000000000000000000000000000063910448",
+		"00000000000000000000000000000000000000000000000000000000003d0900",
+		// nonce
+		"000000000000000000000000000000000000000000000000743439e511792866",
+	}, "")
+	b, err := newTestPegoutQuote().Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(b); got != want {
+		t.Errorf("Encode() = %v, want %v", got, want)
+	}
+}
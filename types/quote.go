@@ -1,5 +1,16 @@
 package types
 
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
 type Quote struct {
 	FedBTCAddr         string `json:"fedBTCAddr" db:"fed_addr"`
 	LBCAddr            string `json:"lbcAddr" db:"lbc_addr"`
@@ -19,4 +30,177 @@ type Quote struct {
 	CallTime           uint32 `json:"callTime" db:"call_time"`
 	Confirmations      uint16 `json:"confirmations" db:"confirmations"`
 	CallOnRegister     bool   `json:"callOnRegister" db:"call_on_register"`
+	// FeeBreakdown itemizes CallFee, it is not part of the quote signed by the provider
+	FeeBreakdown *FeeBreakdown `json:"feeBreakdown,omitempty" db:"fee_breakdown"`
+}
+
+// quotePart1Arguments and quotePart2Arguments mirror the two parts the LBC hashQuote function encodes a Quote in.
+var (
+	quotePart1Arguments = abi.Arguments{
+		{Name: "fedBtcAddress", Type: mustNewType("bytes20")},
+		{Name: "lbcAddress", Type: mustNewType("address")},
+		{Name: "liquidityProviderRskAddress", Type: mustNewType("address")},
+		{Name: "btcRefundAddress", Type: mustNewType("bytes")},
+		{Name: "rskRefundAddress", Type: mustNewType("address")},
+		{Name: "liquidityProviderBtcAddress", Type: mustNewType("bytes")},
+		{Name: "callFee", Type: mustNewType("uint256")},
+		{Name: "penaltyFee", Type: mustNewType("uint256")},
+		{Name: "contractAddress", Type: mustNewType("address")},
+	}
+	quotePart2Arguments = abi.Arguments{
+		{Name: "data", Type: mustNewType("bytes")},
+		{Name: "gasLimit", Type: mustNewType("uint32")},
+		{Name: "nonce", Type: mustNewType("int64")},
+		{Name: "value", Type: mustNewType("uint256")},
+		{Name: "agreementTimestamp", Type: mustNewType("uint32")},
+		{Name: "timeForDeposit", Type: mustNewType("uint32")},
+		{Name: "callTime", Type: mustNewType("uint32")},
+		{Name: "depositConfirmations", Type: mustNewType("uint16")},
+		{Name: "callOnRegister", Type: mustNewType("bool")},
+	}
+	// quoteArguments are all the fields of the Quote struct, in order
+	quoteArguments = concatArguments(quotePart1Arguments, quotePart2Arguments)
+	// partsArguments encode the two parts of a struct, as abi.encode(part1, part2) does
+	partsArguments = abi.Arguments{
+		{Name: "part1", Type: mustNewType("bytes")},
+		{Name: "part2", Type: mustNewType("bytes")},
+	}
+)
+
+func mustNewType(t string) abi.Type {
+	typ, err := abi.NewType(t, "", nil)
+	if err != nil {
+		panic(err)
+	}
+	return typ
+}
+
+func concatArguments(parts ...abi.Arguments) abi.Arguments {
+	var res abi.Arguments
+	for _, p := range parts {
+		res = append(res, p...)
+	}
+	return res
+}
+
+// encodeParts encodes values in two parts, split after the arguments of part1, and returns the encoding of both
+// parts as two bytes arguments.
+func encodeParts(part1, part2 abi.Arguments, values []interface{}) ([]byte, error) {
+	if len(values) != len(part1)+len(part2) {
+		return nil, fmt.Errorf("got %v values, want %v", len(values), len(part1)+len(part2))
+	}
+	b1, err := part1.Pack(values[:len(part1)]...)
+	if err != nil {
+		return nil, err
+	}
+	b2, err := part2.Pack(values[len(part1):]...)
+	if err != nil {
+		return nil, err
+	}
+	return partsArguments.Pack(b1, b2)
+}
+
+// Encode returns the ABI encoding of the quote exactly as the LiquidityBridgeContract encodes it before hashing.
+func (q *Quote) Encode() ([]byte, error) {
+	args, err := q.abiValues()
+	if err != nil {
+		return nil, err
+	}
+	return encodeParts(quotePart1Arguments, quotePart2Arguments, args)
+}
+
+// abiValues returns the quote fields converted to the Go types expected by quoteArguments, in the same order.
+func (q *Quote) abiValues() ([]interface{}, error) {
+	fedBTCAddr, err := DecodeBTCAddress(q.FedBTCAddr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid fedBTCAddr: %v", err)
+	}
+	var fedBTCAddr20 [20]byte
+	copy(fedBTCAddr20[:], fedBTCAddr)
+	btcRefundAddr, err := DecodeBTCAddressWithVersion(q.BTCRefundAddr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid btcRefundAddr: %v", err)
+	}
+	lpBTCAddr, err := DecodeBTCAddressWithVersion(q.LPBTCAddr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid lpBTCAddr: %v", err)
+	}
+	lbcAddr, err := parseRSKAddr("lbcAddr", q.LBCAddr)
+	if err != nil {
+		return nil, err
+	}
+	lpRSKAddr, err := parseRSKAddr("lpRSKAddr", q.LPRSKAddr)
+	if err != nil {
+		return nil, err
+	}
+	rskRefundAddr, err := parseRSKAddr("rskRefundAddr", q.RSKRefundAddr)
+	if err != nil {
+		return nil, err
+	}
+	contractAddr, err := parseRSKAddr("contractAddr", q.ContractAddr)
+	if err != nil {
+		return nil, err
+	}
+	data, err := hex.DecodeString(strings.TrimPrefix(q.Data, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid data: %v", err)
+	}
+	callFee, err := weiArg("callFee", q.CallFee)
+	if err != nil {
+		return nil, err
+	}
+	penaltyFee, err := weiArg("penaltyFee", q.PenaltyFee)
+	if err != nil {
+		return nil, err
+	}
+	value, err := weiArg("value", q.Value)
+	if err != nil {
+		return nil, err
+	}
+	return []interface{}{
+		fedBTCAddr20,
+		lbcAddr,
+		lpRSKAddr,
+		btcRefundAddr,
+		rskRefundAddr,
+		lpBTCAddr,
+		callFee,
+		penaltyFee,
+		contractAddr,
+		data,
+		q.GasLimit,
+		q.Nonce,
+		value,
+		q.AgreementTimestamp,
+		q.TimeForDeposit,
+		q.CallTime,
+		q.Confirmations,
+		q.CallOnRegister,
+	}, nil
+}
+
+// Hash returns the keccak256 hash of the encoded quote, which matches the result of the LBC hashQuote function.
+func (q *Quote) Hash() ([]byte, error) {
+	b, err := q.Encode()
+	if err != nil {
+		return nil, err
+	}
+	return crypto.Keccak256(b), nil
+}
+
+func parseRSKAddr(field string, addr string) (common.Address, error) {
+	if !common.IsHexAddress(addr) {
+		return common.Address{}, fmt.Errorf("invalid %v: %v", field, addr)
+	}
+	return common.HexToAddress(addr), nil
+}
+
+func weiArg(field string, w *Wei) (*big.Int, error) {
+	if w == nil {
+		return nil, fmt.Errorf("%v is <nil>", field)
+	}
+	if w.AsBigInt().Sign() < 0 {
+		return nil, fmt.Errorf("%v is negative: %v", field, w)
+	}
+	return w.AsBigInt(), nil
 }
@@ -0,0 +1,236 @@
+package types
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func newTestQuote() *Quote {
+	return &Quote{
+		FedBTCAddr:         "3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy",
+		LBCAddr:            "0xC52AbEae2f7A6e2E3C5Ab1C2a7E21B6F4A2F1C10",
+		LPRSKAddr:          "0xd562c283d2260c62110fa3da885842afbe16bda2",
+		BTCRefundAddr:      "mipcBbFg9gMiCh81Kj8tqqdgoZub1ZJRfn",
+		RSKRefundAddr:      "0x0000000000000000000000000000000000000001",
+		LPBTCAddr:          "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2",
+		CallFee:            NewWei(501000),
+		PenaltyFee:         NewWei(1000000),
+		ContractAddr:       "0x0000000000000000000000000000000000000002",
+		Data:               "0x",
+		GasLimit:           50000,
+		Nonce:              8373381263192041574,
+		Value:              NewWei(3000000),
+		AgreementTimestamp: 1670441000,
+		TimeForDeposit:     3600,
+		CallTime:           7200,
+		Confirmations:      6,
+	}
+}
+
+// quoteHashVectors are quotes with their expected hashes. TestQuote_HashMatchesLBC checks them against the hashQuote
+// function of a deployed LBC, and the hashes are the keccak256 of the encoding written out word by word in
+// TestQuote_Encode, which follows the layout of the LBC encodeQuote:
+// abi.encode(encodePart1(quote), encodePart2(quote)).
+var quoteHashVectors = []struct {
+	name string
+	q    func() *Quote
+	want string
+}{
+	{
+		name: "quote hash",
+		q:    newTestQuote,
+		want: "d1355b87d1d95d39831eedbc9f08a7e53bc1178e64378e9ee166c785e67e309b",
+	},
+	{
+		name: "quote hash with negative nonce, data and call on register",
+		q: func() *Quote {
+			q := newTestQuote()
+			q.Nonce = -1
+			q.Data = "0xa9059cbb"
+			q.CallOnRegister = true
+			return q
+		},
+		want: "134e61b82749d648efc6d9d21bb4a97d5a15f931ede8e450bb727d19cf093cd9",
+	},
+}
+
+func TestQuote_Hash(t *testing.T) {
+	type hashTest struct {
+		name    string
+		q       func() *Quote
+		want    string
+		wantErr bool
+	}
+	tests := []hashTest{
+		{
+			name: "invalid fed address",
+			q: func() *Quote {
+				q := newTestQuote()
+				q.FedBTCAddr = "3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLz"
+				return q
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid lbc address",
+			q: func() *Quote {
+				q := newTestQuote()
+				q.LBCAddr = "0x123"
+				return q
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid data",
+			q: func() *Quote {
+				q := newTestQuote()
+				q.Data = "0xzz"
+				return q
+			},
+			wantErr: true,
+		},
+		{
+			name: "<nil> call fee",
+			q: func() *Quote {
+				q := newTestQuote()
+				q.CallFee = nil
+				return q
+			},
+			wantErr: true,
+		},
+	}
+	for _, v := range quoteHashVectors {
+		tests = append(tests, hashTest{name: v.name, q: v.q, want: v.want})
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.q().Hash()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Hash() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && hex.EncodeToString(got) != tt.want {
+				t.Errorf("Hash() = %x, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuote_Encode(t *testing.T) {
+	want := strings.Join([]string{
+		// abi.encode(part1, part2): the offsets of both parts
+		"0000000000000000000000000000000000000000000000000000000000000040",
+		"0000000000000000000000000000000000000000000000000000000000000200",
+		// part1, 416 bytes
+		"00000000000000000000000000000000000000000000000000000000000001a0",
+		// fedBtcAddress is a bytes20, so the hash is left aligned
+		"b472a266d0bd89c13706a4132ccfb16f7c3b9fcb000000000000000000000000",
+		"000000000000000000000000c52abeae2f7a6e2e3c5ab1c2a7e21b6f4a2f1c10",
+		"000000000000000000000000d562c283d2260c62110fa3da885842afbe16bda2",
+		// the offset of btcRefundAddress within part1
+		"0000000000000000000000000000000000000000000000000000000000000120",
+		"0000000000000000000000000000000000000000000000000000000000000001",
+		// the offset of liquidityProviderBtcAddress within part1
+		"0000000000000000000000000000000000000000000000000000000000000160",
+		"000000000000000000000000000000000000000000000000000000000007a508",
+		"00000000000000000000000000000000000000000000000000000000000f4240",
+		"0000000000000000000000000000000000000000000000000000000000000002",
+		// btcRefundAddress, 21 bytes including the version
+		"0000000000000000000000000000000000000000000000000000000000000015",
+		"6f243f1394f44554f4ce3fd68649c19adc483ce9240000000000000000000000",
+		// liquidityProviderBtcAddress, 21 bytes including the version
+		"0000000000000000000000000000000000000000000000000000000000000015",
+		"0077bff20c60e522dfaa3350c39b030a5d004e839a0000000000000000000000",
+		// part2, 320 bytes
+		"0000000000000000000000000000000000000000000000000000000000000140",
+		// the offset of data within part2
+		"0000000000000000000000000000000000000000000000000000000000000120",
+		"000000000000000000000000000000000000000000000000000000000000c350",
+		"000000000000000000000000000000000000000000000000743439e511792866",
+		"00000000000000000000000000000000000000000000000000000000002dc6c0",
+		"000000000000000000000000000000000000000000000000000000006390e828",
+		"0000000000000000000000000000000000000000000000000000000000000e10",
+		"0000000000000000000000000000000000000000000000000000000000001c20",
+		"0000000000000000000000000000000000000000000000000000000000000006",
+		"0000000000000000000000000000000000000000000000000000000000000000",
+		// data, empty
+		"0000000000000000000000000000000000000000000000000000000000000000",
+	}, "")
+	b, err := newTestQuote().Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(b); got != want {
+		t.Errorf("Encode() = %v, want %v", got, want)
+	}
+
+	q := newTestQuote()
+	q.Nonce = -1
+	q.Data = "0xa9059cbb"
+	b, err = q.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// nonce is an int64, so negative values are sign extended
+	if got := hex.EncodeToString(b[19*32 : 20*32]); got != "ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff" {
+		t.Errorf("nonce = %v", got)
+	}
+	// data is padded to a whole word
+	if got := hex.EncodeToString(b[len(b)-64:]); got != "0000000000000000000000000000000000000000000000000000000000000004"+
+		"a9059cbb00000000000000000000000000000000000000000000000000000000" {
+		t.Errorf("data = %v", got)
+	}
+}
+
+func TestDecodeBTCAddressWithVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		addr    string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "mainnet p2pkh",
+			addr: "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2",
+			want: "0077bff20c60e522dfaa3350c39b030a5d004e839a",
+		},
+		{
+			name: "testnet p2pkh",
+			addr: "mipcBbFg9gMiCh81Kj8tqqdgoZub1ZJRfn",
+			want: "6f243f1394f44554f4ce3fd68649c19adc483ce924",
+		},
+		{
+			name: "testnet p2sh",
+			addr: "2N2JD6wb56AfK4tfmM6PwdVmoYk2dCKf4Br",
+			want: "c46349a418fc4578d10a372b54b45c280cc8c4382f",
+		},
+		{
+			name:    "wrong checksum",
+			addr:    "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN3",
+			wantErr: true,
+		},
+		{
+			name:    "invalid character",
+			addr:    "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN0",
+			wantErr: true,
+		},
+		{
+			name:    "empty address",
+			addr:    "",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecodeBTCAddressWithVersion(tt.addr)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DecodeBTCAddressWithVersion() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && hex.EncodeToString(got) != tt.want {
+				t.Errorf("DecodeBTCAddressWithVersion() = %x, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,5 +1,12 @@
 package types
 
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
 type RQState uint32
 
 const (
@@ -10,12 +17,188 @@ const (
 	RQStateRegisterPegInSucceeded
 	RQStateRegisterPegInFailed
 	RQStateWaitingForDepositConfirmations
+	RQStateSendPegoutSucceeded
+	RQStateSendPegoutFailed
+	RQStateRefundPegOutSucceeded
+	RQStateRefundPegOutFailed
 )
 
+var rqStateNames = map[RQState]string{
+	RQStateWaitingForDeposit:              "WaitingForDeposit",
+	RQStateTimeForDepositElapsed:          "TimeForDepositElapsed",
+	RQStateCallForUserSucceeded:           "CallForUserSucceeded",
+	RQStateCallForUserFailed:              "CallForUserFailed",
+	RQStateRegisterPegInSucceeded:         "RegisterPegInSucceeded",
+	RQStateRegisterPegInFailed:            "RegisterPegInFailed",
+	RQStateWaitingForDepositConfirmations: "WaitingForDepositConfirmations",
+	RQStateSendPegoutSucceeded:            "SendPegoutSucceeded",
+	RQStateSendPegoutFailed:               "SendPegoutFailed",
+	RQStateRefundPegOutSucceeded:          "RefundPegOutSucceeded",
+	RQStateRefundPegOutFailed:             "RefundPegOutFailed",
+}
+
+// peginTransitions lists the states a retained peg-in quote can move to from each state.
+var peginTransitions = map[RQState][]RQState{
+	RQStateWaitingForDeposit: {
+		RQStateWaitingForDepositConfirmations,
+		RQStateTimeForDepositElapsed,
+		RQStateCallForUserSucceeded,
+		RQStateCallForUserFailed,
+	},
+	RQStateWaitingForDepositConfirmations: {
+		RQStateTimeForDepositElapsed,
+		RQStateCallForUserSucceeded,
+		RQStateCallForUserFailed,
+	},
+	RQStateCallForUserSucceeded: {RQStateRegisterPegInSucceeded, RQStateRegisterPegInFailed},
+	RQStateCallForUserFailed:    {RQStateRegisterPegInSucceeded, RQStateRegisterPegInFailed},
+}
+
+// pegoutTransitions lists the states a retained peg-out quote can move to from each state.
+var pegoutTransitions = map[RQState][]RQState{
+	RQStateWaitingForDeposit: {
+		RQStateWaitingForDepositConfirmations,
+		RQStateTimeForDepositElapsed,
+		RQStateSendPegoutSucceeded,
+		RQStateSendPegoutFailed,
+	},
+	RQStateWaitingForDepositConfirmations: {
+		RQStateTimeForDepositElapsed,
+		RQStateSendPegoutSucceeded,
+		RQStateSendPegoutFailed,
+	},
+	RQStateSendPegoutSucceeded: {RQStateRefundPegOutSucceeded, RQStateRefundPegOutFailed},
+}
+
+type ErrInvalidStateTransition struct {
+	From RQState
+	To   RQState
+}
+
+func (e *ErrInvalidStateTransition) Error() string {
+	return fmt.Sprintf("invalid retained quote state transition from %v to %v", e.From, e.To)
+}
+
+func (s RQState) String() string {
+	if name, ok := rqStateNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("RQState(%d)", uint32(s))
+}
+
+func (s RQState) MarshalText() ([]byte, error) {
+	name, ok := rqStateNames[s]
+	if !ok {
+		return nil, fmt.Errorf("unknown retained quote state: %d", uint32(s))
+	}
+	return []byte(name), nil
+}
+
+// UnmarshalText accepts the name of a state, or its number as retained quotes were stored before states had names.
+func (s *RQState) UnmarshalText(text []byte) error {
+	for state, name := range rqStateNames {
+		if name == string(text) {
+			*s = state
+			return nil
+		}
+	}
+	if n, err := strconv.ParseUint(string(text), 10, 32); err == nil {
+		if _, ok := rqStateNames[RQState(n)]; ok {
+			*s = RQState(n)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown retained quote state: %q", text)
+}
+
+// UnmarshalJSON accepts the state as a JSON string, or as the JSON number it was encoded as before states had names.
+// Like other JSON values, null leaves the state unchanged.
+func (s *RQState) UnmarshalJSON(data []byte) error {
+	var text string
+	if string(data) == "null" {
+		return nil
+	}
+	if len(data) > 0 && data[0] != '"' {
+		text = string(data)
+	} else if err := json.Unmarshal(data, &text); err != nil {
+		return err
+	}
+	return s.UnmarshalText([]byte(text))
+}
+
+// IsTerminal reports whether a retained quote in this state can no longer change its state.
+func (s RQState) IsTerminal() bool {
+	_, ok := rqStateNames[s]
+	return ok && len(peginTransitions[s]) == 0 && len(pegoutTransitions[s]) == 0
+}
+
+// LocksLiquidity reports whether the liquidity required by a retained quote in this state is still reserved.
+func (s RQState) LocksLiquidity() bool {
+	return s == RQStateWaitingForDeposit || s == RQStateWaitingForDepositConfirmations
+}
+
+// LiquidityLockingStates returns the states for which LocksLiquidity is true, in ascending order.
+func LiquidityLockingStates() []RQState {
+	var states []RQState
+	for s := RQState(0); int(s) < len(rqStateNames); s++ {
+		if s.LocksLiquidity() {
+			states = append(states, s)
+		}
+	}
+	return states
+}
+
 type RetainedQuote struct {
-	QuoteHash   string  `json:"quoteHash" db:"quote_hash"`
-	DepositAddr string  `json:"depositAddr" db:"deposit_addr"`
-	Signature   string  `json:"signature" db:"signature"`
-	ReqLiq      *Wei    `json:"reqLiq" db:"req_liq"`
-	State       RQState `json:"state" db:"state"`
+	QuoteHash          string  `json:"quoteHash" db:"quote_hash"`
+	DepositAddr        string  `json:"depositAddr" db:"deposit_addr"`
+	Signature          string  `json:"signature" db:"signature"`
+	ReqLiq             *Wei    `json:"reqLiq" db:"req_liq"`
+	State              RQState `json:"state" db:"state"`
+	AgreementTimestamp uint32  `json:"agreementTimestamp" db:"agreement_timestamp"`
+	TimeForDeposit     uint32  `json:"timeForDeposit" db:"time_for_deposit"`
+	// FeeBreakdown itemizes the call fee of the quote, nil when the quote was signed from its hash alone
+	FeeBreakdown *FeeBreakdown `json:"feeBreakdown,omitempty" db:"fee_breakdown"`
+}
+
+// DepositDeadline returns the moment after which the user deposit is no longer accepted.
+func (rq *RetainedQuote) DepositDeadline() time.Time {
+	return time.Unix(int64(rq.AgreementTimestamp)+int64(rq.TimeForDeposit), 0)
+}
+
+// Transition moves the retained quote to the given state, failing if the peg-in state graph does not allow it.
+func (rq *RetainedQuote) Transition(to RQState) error {
+	return transition(peginTransitions, &rq.State, to)
+}
+
+type RetainedPegoutQuote struct {
+	QuoteHash          string  `json:"quoteHash" db:"quote_hash"`
+	Signature          string  `json:"signature" db:"signature"`
+	ReqLiq             *Wei    `json:"reqLiq" db:"req_liq"`
+	State              RQState `json:"state" db:"state"`
+	AgreementTimestamp uint32  `json:"agreementTimestamp" db:"agreement_timestamp"`
+	DepositDateLimit   uint32  `json:"depositDateLimit" db:"deposit_date_limit"`
+}
+
+// DepositDeadline returns the moment after which the user deposit is no longer accepted. It is the zero time when the
+// deadline is unknown, as for the quotes retained before it was recorded.
+func (rq *RetainedPegoutQuote) DepositDeadline() time.Time {
+	if rq.DepositDateLimit == 0 {
+		return time.Time{}
+	}
+	return time.Unix(int64(rq.DepositDateLimit), 0)
+}
+
+// Transition moves the retained quote to the given state, failing if the peg-out state graph does not allow it.
+func (rq *RetainedPegoutQuote) Transition(to RQState) error {
+	return transition(pegoutTransitions, &rq.State, to)
+}
+
+func transition(graph map[RQState][]RQState, state *RQState, to RQState) error {
+	for _, s := range graph[*state] {
+		if s == to {
+			*state = to
+			return nil
+		}
+	}
+	return &ErrInvalidStateTransition{From: *state, To: to}
 }
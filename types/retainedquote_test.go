@@ -0,0 +1,211 @@
+package types
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestRQState_String(t *testing.T) {
+	tests := []struct {
+		name  string
+		state RQState
+		want  string
+	}{
+		{
+			name:  "waiting for deposit",
+			state: RQStateWaitingForDeposit,
+			want:  "WaitingForDeposit",
+		},
+		{
+			name:  "register peg-in succeeded",
+			state: RQStateRegisterPegInSucceeded,
+			want:  "RegisterPegInSucceeded",
+		},
+		{
+			name:  "refund peg-out failed",
+			state: RQStateRefundPegOutFailed,
+			want:  "RefundPegOutFailed",
+		},
+		{
+			name:  "unknown state",
+			state: RQState(100),
+			want:  "RQState(100)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.state.String(); got != tt.want {
+				t.Errorf("String() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRQState_JSON(t *testing.T) {
+	rq := RetainedQuote{QuoteHash: "abc", ReqLiq: NewWei(1), State: RQStateWaitingForDepositConfirmations}
+	b, err := json.Marshal(&rq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"quoteHash":"abc","depositAddr":"","signature":"","reqLiq":"1","state":"WaitingForDepositConfirmations",` +
+		`"agreementTimestamp":0,"timeForDeposit":0}`
+	if string(b) != want {
+		t.Errorf("json.Marshal() = %s, want %v", b, want)
+	}
+
+	var got RetainedQuote
+	if err = json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.State != RQStateWaitingForDepositConfirmations {
+		t.Errorf("json.Unmarshal() state = %v, want %v", got.State, RQStateWaitingForDepositConfirmations)
+	}
+
+	// retained quotes stored before states had names encode them as numbers
+	legacy := `{"quoteHash":"abc","depositAddr":"","signature":"","reqLiq":1,"state":6,"agreementTimestamp":0,"timeForDeposit":0}`
+	got = RetainedQuote{}
+	if err = json.Unmarshal([]byte(legacy), &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, rq) {
+		t.Errorf("json.Unmarshal() = %+v, want %+v", got, rq)
+	}
+	if b, err = json.Marshal(&got); err != nil || string(b) != want {
+		t.Errorf("json.Marshal() = %s, %v, want %v", b, err, want)
+	}
+
+	for _, state := range []string{`"Unknown"`, `100`, `-1`, `1.5`} {
+		if err = json.Unmarshal([]byte(`{"state":`+state+`}`), &got); err == nil {
+			t.Errorf("json.Unmarshal() did not fail with state %v", state)
+		}
+	}
+	if err = json.Unmarshal([]byte(`{"state":"Unknown"}`), &got); err == nil {
+		t.Error("json.Unmarshal() did not fail with unknown state")
+	}
+	if _, err = json.Marshal(RQState(100)); err == nil {
+		t.Error("json.Marshal() did not fail with unknown state")
+	}
+}
+
+func TestRQState_IsTerminal(t *testing.T) {
+	terminal := map[RQState]bool{
+		RQStateTimeForDepositElapsed:  true,
+		RQStateRegisterPegInSucceeded: true,
+		RQStateRegisterPegInFailed:    true,
+		RQStateSendPegoutFailed:       true,
+		RQStateRefundPegOutSucceeded:  true,
+		RQStateRefundPegOutFailed:     true,
+	}
+	for state := range rqStateNames {
+		if got := state.IsTerminal(); got != terminal[state] {
+			t.Errorf("%v.IsTerminal() = %v, want %v", state, got, terminal[state])
+		}
+	}
+}
+
+func TestRQState_LocksLiquidity(t *testing.T) {
+	for state := range rqStateNames {
+		want := state == RQStateWaitingForDeposit || state == RQStateWaitingForDepositConfirmations
+		if got := state.LocksLiquidity(); got != want {
+			t.Errorf("%v.LocksLiquidity() = %v, want %v", state, got, want)
+		}
+	}
+}
+
+func TestLiquidityLockingStates(t *testing.T) {
+	want := []RQState{RQStateWaitingForDeposit, RQStateWaitingForDepositConfirmations}
+	if got := LiquidityLockingStates(); !reflect.DeepEqual(got, want) {
+		t.Errorf("LiquidityLockingStates() = %v, want %v", got, want)
+	}
+}
+
+func TestRetainedQuote_Transition(t *testing.T) {
+	tests := []struct {
+		name    string
+		from    RQState
+		to      RQState
+		wantErr bool
+	}{
+		{
+			name: "deposit confirmations",
+			from: RQStateWaitingForDeposit,
+			to:   RQStateWaitingForDepositConfirmations,
+		},
+		{
+			name: "time for deposit elapsed",
+			from: RQStateWaitingForDeposit,
+			to:   RQStateTimeForDepositElapsed,
+		},
+		{
+			name: "call for user succeeded",
+			from: RQStateWaitingForDepositConfirmations,
+			to:   RQStateCallForUserSucceeded,
+		},
+		{
+			name: "register peg-in after failed call",
+			from: RQStateCallForUserFailed,
+			to:   RQStateRegisterPegInSucceeded,
+		},
+		{
+			name:    "back to waiting for deposit",
+			from:    RQStateRegisterPegInSucceeded,
+			to:      RQStateWaitingForDeposit,
+			wantErr: true,
+		},
+		{
+			name:    "same state",
+			from:    RQStateWaitingForDeposit,
+			to:      RQStateWaitingForDeposit,
+			wantErr: true,
+		},
+		{
+			name:    "peg-out state",
+			from:    RQStateWaitingForDeposit,
+			to:      RQStateSendPegoutSucceeded,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rq := &RetainedQuote{State: tt.from}
+			err := rq.Transition(tt.to)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Transition() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			var transitionErr *ErrInvalidStateTransition
+			if tt.wantErr && (!errors.As(err, &transitionErr) || rq.State != tt.from) {
+				t.Errorf("Transition() error = %v, state = %v", err, rq.State)
+			}
+			if !tt.wantErr && rq.State != tt.to {
+				t.Errorf("Transition() state = %v, want %v", rq.State, tt.to)
+			}
+		})
+	}
+}
+
+func TestRetainedPegoutQuote_Transition(t *testing.T) {
+	rq := &RetainedPegoutQuote{State: RQStateWaitingForDeposit}
+	for _, to := range []RQState{RQStateWaitingForDepositConfirmations, RQStateSendPegoutSucceeded, RQStateRefundPegOutSucceeded} {
+		if err := rq.Transition(to); err != nil {
+			t.Fatalf("Transition() error = %v", err)
+		}
+	}
+	if err := rq.Transition(RQStateRefundPegOutFailed); err == nil {
+		t.Error("Transition() did not fail from a terminal state")
+	}
+	rq = &RetainedPegoutQuote{State: RQStateWaitingForDeposit}
+	if err := rq.Transition(RQStateCallForUserSucceeded); err == nil {
+		t.Error("Transition() did not fail with a peg-in state")
+	}
+}
+
+func TestRetainedQuote_DepositDeadline(t *testing.T) {
+	rq := &RetainedQuote{AgreementTimestamp: math.MaxUint32, TimeForDeposit: 3600}
+	if got, want := rq.DepositDeadline().Unix(), int64(math.MaxUint32)+3600; got != want {
+		t.Errorf("DepositDeadline() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,89 @@
+package types
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core"
+)
+
+// TypedData is the EIP-712 typed data document, as accepted by eth_signTypedData_v4 and external signers. It is
+// encoded and hashed by the go-ethereum signer, the same implementation Clef uses.
+type TypedData core.TypedData
+
+// TypedData returns the quote as an EIP-712 PeginQuote typed data document, whose hash is the quote TypedDataHash.
+func (q *Quote) TypedData(chainId *big.Int) (*TypedData, error) {
+	domain, err := eip712Domain(chainId, q.LBCAddr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid EIP-712 domain: %v", err)
+	}
+	message, err := q.typedMessage()
+	if err != nil {
+		return nil, err
+	}
+	return &TypedData{
+		Types: core.Types{
+			"EIP712Domain":     eip712DomainType,
+			PeginQuoteTypeName: peginQuoteType(),
+		},
+		PrimaryType: PeginQuoteTypeName,
+		Domain:      domain,
+		Message:     message,
+	}, nil
+}
+
+// typedMessage returns the fields of the quote as the message of a PeginQuote typed data document.
+func (q *Quote) typedMessage() (core.TypedDataMessage, error) {
+	values, err := q.abiValues()
+	if err != nil {
+		return nil, err
+	}
+	message := make(core.TypedDataMessage, len(quoteArguments))
+	for i, arg := range quoteArguments {
+		switch v := values[i].(type) {
+		case [20]byte:
+			message[arg.Name] = "0x" + hex.EncodeToString(v[:])
+		case []byte:
+			message[arg.Name] = "0x" + hex.EncodeToString(v)
+		case common.Address:
+			message[arg.Name] = v.Hex()
+		case bool:
+			message[arg.Name] = v
+		default:
+			// numbers are sent as decimal strings, so big values are not rounded by JSON decoders
+			message[arg.Name] = fmt.Sprint(v)
+		}
+	}
+	return message, nil
+}
+
+// Hash returns the EIP-712 digest of the typed data, keccak256("\x19\x01" || domainSeparator || hashStruct(message)).
+func (td *TypedData) Hash() ([]byte, error) {
+	domainSeparator, err := td.domainSeparator()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := td.Types[td.PrimaryType]; !ok {
+		return nil, fmt.Errorf("unknown primary type: %v", td.PrimaryType)
+	}
+	structHash, err := (*core.TypedData)(td).HashStruct(td.PrimaryType, td.Message)
+	if err != nil {
+		return nil, err
+	}
+	return crypto.Keccak256([]byte("\x19\x01"), domainSeparator, structHash), nil
+}
+
+func (td *TypedData) domainSeparator() ([]byte, error) {
+	if td.Domain.ChainId == nil {
+		return nil, errors.New("invalid domain: chainId is <nil>")
+	}
+	res, err := (*core.TypedData)(td).HashStruct("EIP712Domain", td.Domain.Map())
+	if err != nil {
+		return nil, fmt.Errorf("invalid domain: %v", err)
+	}
+	return res, nil
+}
@@ -0,0 +1,101 @@
+package types
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"testing"
+)
+
+func TestQuote_TypedData(t *testing.T) {
+	q := newTestQuote()
+	q.Nonce = -5
+	q.Data = "0xa9059cbb"
+	q.CallOnRegister = true
+	td, err := q.TypedData(big.NewInt(31))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "281b761940eb555c95785c759a5e414f621e4f8adeb38a2b25ac51ad8f4484aa"
+	got, err := td.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(got) != want {
+		t.Errorf("Hash() = %x, want %v", got, want)
+	}
+
+	// the digest must survive the round trip to an external signer
+	b, err := json.Marshal(td)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded TypedData
+	if err = json.Unmarshal(b, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	got, err = decoded.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(got) != want {
+		t.Errorf("Hash() after JSON round trip = %x, want %v", got, want)
+	}
+
+	if _, err = q.TypedData(nil); err == nil {
+		t.Error("TypedData() did not fail with <nil> chain id")
+	}
+}
+
+func TestTypedData_HashErrors(t *testing.T) {
+	q := newTestQuote()
+	tests := []struct {
+		name   string
+		modify func(td *TypedData)
+	}{
+		{
+			name:   "unknown primary type",
+			modify: func(td *TypedData) { td.PrimaryType = "PegoutQuote" },
+		},
+		{
+			name:   "missing value",
+			modify: func(td *TypedData) { delete(td.Message, "nonce") },
+		},
+		{
+			name:   "out of range",
+			modify: func(td *TypedData) { td.Message["gasLimit"] = "4294967296" },
+		},
+		{
+			name:   "negative unsigned",
+			modify: func(td *TypedData) { td.Message["callFee"] = "-1" },
+		},
+		{
+			name:   "wrong fixed bytes length",
+			modify: func(td *TypedData) { td.Message["fedBtcAddress"] = "0x0102" },
+		},
+		{
+			name:   "invalid address",
+			modify: func(td *TypedData) { td.Message["lbcAddress"] = "abc" },
+		},
+		{
+			name:   "wrong bool type",
+			modify: func(td *TypedData) { td.Message["callOnRegister"] = "true" },
+		},
+		{
+			name:   "missing chain id",
+			modify: func(td *TypedData) { td.Domain.ChainId = nil },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			td, err := q.TypedData(big.NewInt(31))
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.modify(td)
+			if _, err = td.Hash(); err == nil {
+				t.Errorf("Hash() did not fail")
+			}
+		})
+	}
+}
@@ -2,10 +2,14 @@ package types
 
 import (
 	"database/sql/driver"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"math/big"
+	"strings"
 )
 
+// Wei is an amount in wei. It is encoded in JSON as a decimal string, not a number.
 type Wei big.Int
 
 type BigIntPtr = *big.Int
@@ -15,6 +19,65 @@ var bEighteen = big.NewInt(18)
 var bTenPowTen = new(big.Int).Exp(bTen, bTen, nil)           // 10**10
 var bTenPowEighteen = new(big.Int).Exp(bTen, bEighteen, nil) // 10**18
 
+// weiUnits are the units accepted by ParseWei, in wei.
+var weiUnits = map[string]*big.Int{
+	"wei":  big.NewInt(1),
+	"gwei": big.NewInt(1000000000),
+	"sat":  bTenPowTen,
+	"rbtc": bTenPowEighteen,
+}
+
+// maxAmountLen bounds the length of the amounts accepted by ParseWei, well above the 78 digits of the largest uint256.
+const maxAmountLen = 100
+
+// ParseWei parses an unsigned decimal amount of wei, optionally followed by one of the units wei, gwei, sat or rbtc,
+// such as "0.5 rbtc".
+func ParseWei(s string) (*Wei, error) {
+	fields := strings.Fields(s)
+	unit := "wei"
+	switch len(fields) {
+	case 1:
+	case 2:
+		unit = strings.ToLower(fields[1])
+	default:
+		return nil, fmt.Errorf("invalid amount: %q", s)
+	}
+	multiplier, ok := weiUnits[unit]
+	if !ok {
+		return nil, fmt.Errorf("invalid amount %q: unknown unit %q", s, fields[1])
+	}
+	if len(fields[0]) > maxAmountLen {
+		return nil, fmt.Errorf("invalid amount: longer than %v characters", maxAmountLen)
+	}
+	if !isDecimal(fields[0]) {
+		return nil, fmt.Errorf("invalid amount: %q", s)
+	}
+	amount, ok := new(big.Rat).SetString(fields[0])
+	if !ok {
+		return nil, fmt.Errorf("invalid amount: %q", s)
+	}
+	amount.Mul(amount, new(big.Rat).SetInt(multiplier))
+	if !amount.IsInt() {
+		return nil, fmt.Errorf("invalid amount %q: fractions of a wei are not allowed", s)
+	}
+	return NewBigWei(amount.Num()), nil
+}
+
+// isDecimal reports whether s is made of digits, with an optional fractional part such as "0.5".
+func isDecimal(s string) bool {
+	digits := false
+	for i, c := range s {
+		switch {
+		case c >= '0' && c <= '9':
+			digits = true
+		case c == '.' && digits && i < len(s)-1 && !strings.Contains(s[i+1:], "."):
+		default:
+			return false
+		}
+	}
+	return digits
+}
+
 func NewWei(x int64) *Wei {
 	w := new(Wei)
 	w.AsBigInt().SetInt64(x)
@@ -83,6 +146,8 @@ func (w *Wei) Scan(src interface{}) error {
 			return errors.New("cannot scan invalid value")
 		}
 		return nil
+	case []byte:
+		return w.Scan(string(src.([]byte)))
 	case nil:
 		return errors.New("cannot scan <nil> value")
 	default:
@@ -90,12 +155,28 @@ func (w *Wei) Scan(src interface{}) error {
 	}
 }
 
+// MarshalJSON encodes w as a decimal string, as JSON numbers above 2^53 lose precision in most clients.
 func (w *Wei) MarshalJSON() ([]byte, error) {
-	return w.AsBigInt().MarshalJSON()
+	return json.Marshal(w.String())
 }
 
+// UnmarshalJSON accepts both a decimal string and a JSON number, so amounts encoded as numbers keep decoding.
 func (w *Wei) UnmarshalJSON(bytes []byte) error {
-	return w.AsBigInt().UnmarshalJSON(bytes)
+	if string(bytes) == "null" {
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(bytes, &s); err != nil {
+		var n json.Number
+		if err = json.Unmarshal(bytes, &n); err != nil {
+			return fmt.Errorf("invalid wei value %s: must be a decimal string or an integer", bytes)
+		}
+		s = n.String()
+	}
+	if _, ok := w.AsBigInt().SetString(s, 10); !ok {
+		return fmt.Errorf("invalid wei value: %s", bytes)
+	}
+	return nil
 }
 
 func (w *Wei) Add(x, y *Wei) *Wei {
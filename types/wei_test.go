@@ -5,6 +5,7 @@ import (
 	"math"
 	"math/big"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -245,6 +246,12 @@ func TestWei_Scan(t *testing.T) {
 			args:    args{src: new(big.Int).Mul(new(big.Int).SetUint64(math.MaxUint64), big.NewInt(10)).String()}, // 10 * math.MaxUint64
 			wantErr: false,
 		},
+		{
+			name:    "valid bytes value",
+			w:       new(Wei),
+			args:    args{src: []byte("100")},
+			wantErr: false,
+		},
 		{
 			name:    "<nil> value",
 			w:       new(Wei),
@@ -269,7 +276,11 @@ func TestWei_Scan(t *testing.T) {
 			if err := tt.w.Scan(tt.args.src); (err != nil) != tt.wantErr {
 				t.Errorf("Scan() error = %v, wantErr %v", err, tt.wantErr)
 			} else if !tt.wantErr {
-				val, ok := new(big.Int).SetString(tt.args.src.(string), 10)
+				src, ok := tt.args.src.(string)
+				if !ok {
+					src = string(tt.args.src.([]byte))
+				}
+				val, ok := new(big.Int).SetString(src, 10)
 				if !ok {
 					t.Fatal("invalid arg")
 				}
@@ -363,10 +374,6 @@ func TestWei_Cmp(t *testing.T) {
 }
 
 func TestWei_MarshalJSON(t *testing.T) {
-	bigIntToBytes := func(i *big.Int) []byte {
-		bytes, _ := i.MarshalJSON()
-		return bytes
-	}
 	tests := []struct {
 		name    string
 		w       *Wei
@@ -376,7 +383,13 @@ func TestWei_MarshalJSON(t *testing.T) {
 		{
 			name:    "marshal wei",
 			w:       NewWei(100),
-			want:    bigIntToBytes(big.NewInt(100)),
+			want:    []byte(`"100"`),
+			wantErr: false,
+		},
+		{
+			name:    "marshal wei above 2^53",
+			w:       NewBigWei(new(big.Int).Mul(big.NewInt(5), bTenPowEighteen)),
+			want:    []byte(`"5000000000000000000"`),
 			wantErr: false,
 		},
 	}
@@ -395,10 +408,6 @@ func TestWei_MarshalJSON(t *testing.T) {
 }
 
 func TestWei_UnmarshalJSON(t *testing.T) {
-	bigIntToBytes := func(i *big.Int) []byte {
-		bytes, _ := i.MarshalJSON()
-		return bytes
-	}
 	type args struct {
 		val   *big.Int
 		bytes []byte
@@ -412,17 +421,86 @@ func TestWei_UnmarshalJSON(t *testing.T) {
 		{
 			name:    "unmarshal wei",
 			w:       new(Wei),
-			args:    args{val: big.NewInt(100), bytes: bigIntToBytes(big.NewInt(100))},
+			args:    args{val: big.NewInt(100), bytes: []byte(`"100"`)},
 			wantErr: false,
 		},
+		{
+			name:    "unmarshal wei number",
+			w:       new(Wei),
+			args:    args{val: big.NewInt(100), bytes: []byte(`100`)},
+			wantErr: false,
+		},
+		{
+			name:    "unmarshal wei number above 2^53",
+			w:       new(Wei),
+			args:    args{val: new(big.Int).Mul(big.NewInt(5), bTenPowEighteen), bytes: []byte(`5000000000000000000`)},
+			wantErr: false,
+		},
+		{
+			name:    "unmarshal fractional wei number",
+			w:       new(Wei),
+			args:    args{bytes: []byte(`1.5`)},
+			wantErr: true,
+		},
+		{
+			name:    "unmarshal invalid wei string",
+			w:       new(Wei),
+			args:    args{bytes: []byte(`"0x64"`)},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			if err := tt.w.UnmarshalJSON(tt.args.bytes); (err != nil) != tt.wantErr {
 				t.Errorf("UnmarshalJSON() error = %v, wantErr %v", err, tt.wantErr)
-			} else if tt.w.AsBigInt().Cmp(tt.args.val) != 0 {
+			} else if !tt.wantErr && tt.w.AsBigInt().Cmp(tt.args.val) != 0 {
 				t.Errorf("tt.w = %v, want %v", tt.w, tt.args.val)
 			}
 		})
 	}
 }
+
+func TestParseWei(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    *Wei
+		wantErr bool
+	}{
+		{name: "wei", s: "1000000", want: NewWei(1000000)},
+		{name: "wei unit", s: "25 wei", want: NewWei(25)},
+		{name: "gwei", s: "60 gwei", want: NewWei(60000000000)},
+		{name: "satoshis", s: "3 sat", want: NewWei(30000000000)},
+		{name: "fraction of rbtc", s: "0.5 rbtc", want: NewWei(500000000000000000)},
+		{name: "above 2^64", s: "100 RBTC", want: NewBigWei(new(big.Int).Mul(big.NewInt(100), bTenPowEighteen))},
+		{name: "extra spaces", s: "  2   gwei ", want: NewWei(2000000000)},
+		{name: "fraction of wei", s: "0.5", wantErr: true},
+		{name: "negative", s: "-1 rbtc", wantErr: true},
+		{name: "unknown unit", s: "1 eth", wantErr: true},
+		{name: "invalid number", s: "one rbtc", wantErr: true},
+		{name: "empty", s: "", wantErr: true},
+		{name: "too many fields", s: "1 rbtc 2", wantErr: true},
+		{name: "ratio", s: "1/2 rbtc", wantErr: true},
+		{name: "exponent", s: "1e18", wantErr: true},
+		{name: "huge exponent", s: "1e999999999", wantErr: true},
+		{name: "sign", s: "+1 rbtc", wantErr: true},
+		{name: "no integer part", s: ".5 rbtc", wantErr: true},
+		{name: "no fractional part", s: "1. rbtc", wantErr: true},
+		{name: "two points", s: "1.2.3 rbtc", wantErr: true},
+		{name: "hexadecimal", s: "0x10", wantErr: true},
+		{name: "longest", s: strings.Repeat("0", maxAmountLen-1) + "1", want: NewWei(1)},
+		{name: "too long", s: strings.Repeat("0", maxAmountLen) + "1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseWei(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseWei() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && got.Cmp(tt.want) != 0 {
+				t.Errorf("ParseWei() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}